@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IanKnighton/institutionalized/internal/bitbucket"
+	"github.com/IanKnighton/institutionalized/internal/gitremote"
+)
+
+// bitbucketTemplatePaths are where pull request templates are looked for on
+// Bitbucket. Bitbucket keeps default descriptions in the repository settings
+// rather than in files, so only the common repository locations are checked.
+var bitbucketTemplatePaths = []string{
+	"pull_request_template.md",
+	"PULL_REQUEST_TEMPLATE.md",
+	"docs/pull_request_template.md",
+}
+
+// bitbucketCloudRepo is a repository on Bitbucket Cloud
+type bitbucketCloudRepo struct {
+	remote      gitremote.Remote
+	credentials bitbucket.Credentials
+	client      *bitbucket.CloudClient
+}
+
+// newBitbucketCloudRepo prepares a client for the repository behind remote.
+// apiURL overrides the API's base URL if it isn't empty.
+func newBitbucketCloudRepo(remote gitremote.Remote, apiURL string) *bitbucketCloudRepo {
+	if apiURL == "" {
+		apiURL = bitbucket.CloudAPIBaseURL
+	}
+	credentials := bitbucket.FindCredentials()
+	return &bitbucketCloudRepo{
+		remote:      remote,
+		credentials: credentials,
+		client:      bitbucket.NewCloudClient(apiURL, credentials),
+	}
+}
+
+// name returns "Bitbucket"
+func (r *bitbucketCloudRepo) name() string {
+	return "Bitbucket"
+}
+
+// prNoun returns "pull request"
+func (r *bitbucketCloudRepo) prNoun() string {
+	return "pull request"
+}
+
+// prRef formats a pull request number as "#12"
+func (r *bitbucketCloudRepo) prRef(number int) string {
+	return fmt.Sprintf("#%d", number)
+}
+
+// templatePaths lists the pull request template locations
+func (r *bitbucketCloudRepo) templatePaths() []string {
+	return bitbucketTemplatePaths
+}
+
+// checkAccess makes sure there are credentials
+func (r *bitbucketCloudRepo) checkAccess() error {
+	if r.credentials.Empty() {
+		return fmt.Errorf("no Bitbucket credentials found. Set BITBUCKET_TOKEN, or BITBUCKET_USERNAME and BITBUCKET_APP_PASSWORD")
+	}
+	return nil
+}
+
+// defaultBranch asks Bitbucket for the repository's main branch
+func (r *bitbucketCloudRepo) defaultBranch() (string, error) {
+	if err := r.checkAccess(); err != nil {
+		return "", err
+	}
+	return r.client.DefaultBranch(context.Background(), r.remote.Owner(), r.remote.Name())
+}
+
+// createPR opens the pull request
+func (r *bitbucketCloudRepo) createPR(pr pullRequest) (*pullRequest, error) {
+	if err := r.checkAccess(); err != nil {
+		return nil, err
+	}
+	created, err := r.client.CreatePullRequest(context.Background(), r.remote.Owner(), r.remote.Name(), bitbucket.NewPullRequest{
+		Title:       pr.title,
+		Description: pr.body,
+		Source:      pr.head,
+		Destination: pr.base,
+		Draft:       pr.draft,
+	})
+	if err != nil {
+		return nil, err
+	}
+	pr.number, pr.url = created.ID, created.URL
+	return &pr, nil
+}
+
+// findPR looks for an open pull request from head
+func (r *bitbucketCloudRepo) findPR(head string) (*pullRequest, error) {
+	if err := r.checkAccess(); err != nil {
+		return nil, err
+	}
+	pulls, err := r.client.OpenPullRequests(context.Background(), r.remote.Owner(), r.remote.Name(), head)
+	if err != nil || len(pulls) == 0 {
+		return nil, err
+	}
+	return fromBitbucketPR(pulls[0]), nil
+}
+
+// updatePR replaces the pull request's title and description
+func (r *bitbucketCloudRepo) updatePR(pr pullRequest) (*pullRequest, error) {
+	if err := r.checkAccess(); err != nil {
+		return nil, err
+	}
+	updated, err := r.client.UpdatePullRequest(context.Background(), r.remote.Owner(), r.remote.Name(), pr.number, pr.title, pr.body)
+	if err != nil {
+		return nil, err
+	}
+	pr.url = updated.URL
+	return &pr, nil
+}
+
+// bitbucketServerRepo is a repository on Bitbucket Data Center
+type bitbucketServerRepo struct {
+	project     string
+	repo        string
+	credentials bitbucket.Credentials
+	client      *bitbucket.ServerClient
+}
+
+// newBitbucketServerRepo prepares a client for the repository behind
+// remote. apiURL overrides the API's base URL if it isn't empty.
+func newBitbucketServerRepo(remote gitremote.Remote, apiURL string) *bitbucketServerRepo {
+	if apiURL == "" {
+		apiURL = bitbucket.ServerAPIBaseURL(remote.Host)
+	}
+	project, repo := bitbucket.ServerRepository(remote.Path)
+	credentials := bitbucket.FindCredentials()
+	return &bitbucketServerRepo{
+		project:     project,
+		repo:        repo,
+		credentials: credentials,
+		client:      bitbucket.NewServerClient(apiURL, credentials),
+	}
+}
+
+// name returns "Bitbucket Data Center"
+func (r *bitbucketServerRepo) name() string {
+	return "Bitbucket Data Center"
+}
+
+// prNoun returns "pull request"
+func (r *bitbucketServerRepo) prNoun() string {
+	return "pull request"
+}
+
+// prRef formats a pull request number as "#12"
+func (r *bitbucketServerRepo) prRef(number int) string {
+	return fmt.Sprintf("#%d", number)
+}
+
+// templatePaths lists the pull request template locations
+func (r *bitbucketServerRepo) templatePaths() []string {
+	return bitbucketTemplatePaths
+}
+
+// checkAccess makes sure there are credentials
+func (r *bitbucketServerRepo) checkAccess() error {
+	if r.credentials.Empty() {
+		return fmt.Errorf("no Bitbucket credentials found. Set BITBUCKET_TOKEN to an HTTP access token, or BITBUCKET_USERNAME and BITBUCKET_PASSWORD")
+	}
+	return nil
+}
+
+// defaultBranch asks Bitbucket for the repository's default branch
+func (r *bitbucketServerRepo) defaultBranch() (string, error) {
+	if err := r.checkAccess(); err != nil {
+		return "", err
+	}
+	return r.client.DefaultBranch(context.Background(), r.project, r.repo)
+}
+
+// createPR opens the pull request. Drafts need Bitbucket Data Center 8.18
+// or later.
+func (r *bitbucketServerRepo) createPR(pr pullRequest) (*pullRequest, error) {
+	if err := r.checkAccess(); err != nil {
+		return nil, err
+	}
+	created, err := r.client.CreatePullRequest(context.Background(), r.project, r.repo, bitbucket.NewPullRequest{
+		Title:       pr.title,
+		Description: pr.body,
+		Source:      pr.head,
+		Destination: pr.base,
+		Draft:       pr.draft,
+	})
+	if err != nil {
+		return nil, err
+	}
+	pr.number, pr.url = created.ID, created.URL
+	return &pr, nil
+}
+
+// findPR looks for an open pull request from head
+func (r *bitbucketServerRepo) findPR(head string) (*pullRequest, error) {
+	if err := r.checkAccess(); err != nil {
+		return nil, err
+	}
+	pulls, err := r.client.OpenPullRequests(context.Background(), r.project, r.repo, head)
+	if err != nil || len(pulls) == 0 {
+		return nil, err
+	}
+	return fromBitbucketPR(pulls[0]), nil
+}
+
+// updatePR replaces the pull request's title and description
+func (r *bitbucketServerRepo) updatePR(pr pullRequest) (*pullRequest, error) {
+	if err := r.checkAccess(); err != nil {
+		return nil, err
+	}
+	updated, err := r.client.UpdatePullRequest(context.Background(), r.project, r.repo, pr.number, pr.title, pr.body)
+	if err != nil {
+		return nil, err
+	}
+	pr.url = updated.URL
+	return &pr, nil
+}
+
+// fromBitbucketPR converts a pull request from either Bitbucket API
+func fromBitbucketPR(pull bitbucket.PullRequest) *pullRequest {
+	return &pullRequest{
+		number: pull.ID,
+		url:    pull.URL,
+		title:  pull.Title,
+		body:   pull.Description,
+		head:   pull.Source,
+		base:   pull.Destination,
+		draft:  pull.Draft,
+	}
+}
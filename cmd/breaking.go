@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/breaking"
+	"github.com/IanKnighton/institutionalized/internal/config"
+	"github.com/IanKnighton/institutionalized/internal/conventional"
+)
+
+// gitTree reads the files of a commit, or of the index if rev is empty. With
+// worktree set it reads the tracked files in the working tree instead.
+type gitTree struct {
+	root     string
+	rev      string
+	worktree bool
+}
+
+// Files lists the files directly in dir
+func (t gitTree) Files(dir string) ([]string, error) {
+	dir = strings.TrimPrefix(path.Clean("/"+dir), "/")
+
+	args := []string{"ls-files", "-z", "--"}
+	if t.rev != "" {
+		args = []string{"ls-tree", "-z", "--name-only", t.rev, "--"}
+	}
+	if dir != "" {
+		args = append(args, dir+"/")
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = t.root
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, file := range strings.Split(string(output), "\x00") {
+		parent := path.Dir(file)
+		if parent == "." {
+			parent = ""
+		}
+		if file == "" || parent != dir {
+			continue
+		}
+		// Tracked files deleted from the working tree are gone from it
+		if t.worktree {
+			if _, err := os.Stat(filepath.Join(t.root, file)); err != nil {
+				continue
+			}
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// Read returns the content of a file
+func (t gitTree) Read(file string) ([]byte, error) {
+	if t.worktree {
+		return os.ReadFile(filepath.Join(t.root, file))
+	}
+	cmd := exec.Command("git", "show", t.rev+":"+file)
+	cmd.Dir = t.root
+	return cmd.Output()
+}
+
+// detectBreakingChanges compares the public APIs touched by the staged files
+// between the commit the changes are based on and the index, or the working
+// tree with --all. Failures are reported as warnings, since the commit
+// message can be generated without the analysis.
+func detectBreakingChanges(cfg *config.Config, changes stagedChanges, source changeSource) []breaking.Break {
+	if !cfg.Commit.DetectBreakingChanges() {
+		return nil
+	}
+	base := source.base
+	if base == "" {
+		base = "HEAD"
+	}
+	// The first commit can't break anything
+	if !revisionExists(base) {
+		return nil
+	}
+	root, err := getRepoRoot()
+	if err != nil {
+		return nil
+	}
+
+	// Renamed files take their API with them, so both paths count
+	var changed []string
+	for _, file := range changes.Files {
+		changed = append(changed, file.Path)
+		if file.OldPath != file.Path {
+			changed = append(changed, file.OldPath)
+		}
+	}
+
+	breaks, err := breaking.Detect(gitTree{root: root, rev: base}, gitTree{root: root, worktree: source.worktree}, changed)
+	if err != nil {
+		fmt.Printf("⚠️  Not checking for breaking changes: %v\n", err)
+		return nil
+	}
+	return breaks
+}
+
+// checkBreakingMarked returns a violation if breaking changes were detected
+// but the message doesn't mark the commit as breaking
+func checkBreakingMarked(message string, breaks []breaking.Break) []string {
+	if len(breaks) == 0 {
+		return nil
+	}
+	if msg, err := conventional.Parse(strings.TrimSpace(message)); err == nil && msg.IsBreaking() {
+		return nil
+	}
+	return []string{`the changes break the public API, so the first line needs "!" before the colon and the message needs a "BREAKING CHANGE:" footer`}
+}
+
+// breakDescriptions describes each breaking change on one line
+func breakDescriptions(breaks []breaking.Break) []string {
+	descriptions := make([]string, len(breaks))
+	for i, b := range breaks {
+		descriptions[i] = b.String()
+	}
+	return descriptions
+}
+
+// printBreakingChanges lists the detected breaking changes
+func printBreakingChanges(breaks []breaking.Break) {
+	if len(breaks) == 0 {
+		return
+	}
+	fmt.Printf("💥 Breaking API changes detected (%d):\n", len(breaks))
+	for _, b := range breaks {
+		fmt.Printf("  - %s\n", b)
+	}
+	fmt.Println()
+}
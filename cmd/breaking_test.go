@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/IanKnighton/institutionalized/internal/config"
+)
+
+func TestDetectBreakingChangesInIndex(t *testing.T) {
+	inTestRepo(t, "go.mod", "module example.com/m\n")
+	if err := os.Mkdir("client", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "client/client.go", "package client\n\nfunc New() {}\n\nfunc Close() {}\n")
+	git(t, "add", "client")
+	git(t, "commit", "-q", "-m", "add client")
+
+	// Only the staged version counts, not the working tree
+	writeFile(t, "client/client.go", "package client\n\nfunc New(url string) {}\n\nfunc Close() {}\n")
+	git(t, "add", "client/client.go")
+	writeFile(t, "client/client.go", "package client\n\nfunc New(url string) {}\n")
+
+	cfg := config.DefaultConfig()
+	changes, err := getStagedChanges(cfg, changeSource{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	breaks := detectBreakingChanges(cfg, changes, changeSource{})
+	if len(breaks) != 1 || breaks[0].String() != "client: changed signature of func New: func() → func(string)" {
+		t.Errorf("Unexpected breaks: %v", breaks)
+	}
+
+	if violations := checkBreakingMarked("feat(client): take a URL", breaks); len(violations) != 1 {
+		t.Errorf("Expected an unmarked breaking change to be reported, got %q", violations)
+	}
+	if violations := checkBreakingMarked("feat(client)!: take a URL", breaks); len(violations) != 0 {
+		t.Errorf("Expected a marked breaking change to pass, got %q", violations)
+	}
+}
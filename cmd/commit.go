@@ -1,23 +1,32 @@
 package cmd
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
-	"regexp"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/IanKnighton/institutionalized/internal/budget"
+	"github.com/IanKnighton/institutionalized/internal/commitlint"
 	"github.com/IanKnighton/institutionalized/internal/config"
+	"github.com/IanKnighton/institutionalized/internal/conventional"
+	"github.com/IanKnighton/institutionalized/internal/gitdiff"
+	"github.com/IanKnighton/institutionalized/internal/ignore"
 	"github.com/IanKnighton/institutionalized/internal/llm"
+	"github.com/IanKnighton/institutionalized/internal/scope"
+	"github.com/IanKnighton/institutionalized/internal/secrets"
+	"github.com/IanKnighton/institutionalized/internal/trailers"
 	"github.com/spf13/cobra"
 )
 
 var commitCmd = &cobra.Command{
 	Use:   "commit",
 	Short: "Generate and commit changes using AI",
-	Long:  `Analyze staged changes and generate a conventional commit message using AI providers (OpenAI/Gemini), then prompt for confirmation.`,
+	Long:  `Analyze staged changes and generate a conventional commit message using AI providers (OpenAI/Gemini/Claude/Ollama), then prompt for confirmation.`,
 	RunE:  runCommit,
 }
 
@@ -26,6 +35,12 @@ func init() {
 	commitCmd.Flags().Bool("dry-run", false, "Show staged changes without calling API or committing")
 	commitCmd.Flags().BoolP("push", "p", false, "Push changes to remote after successful commit")
 	commitCmd.Flags().StringP("context", "c", "", "Additional context to include in the commit message generation")
+	commitCmd.Flags().IntP("candidates", "n", 1, "Number of different commit messages to generate and choose from")
+	commitCmd.Flags().Int("pick", 0, "Commit the candidate with this number without prompting (for scripts)")
+	commitCmd.Flags().Bool("split", false, "Group the staged hunks into several logical commits")
+	commitCmd.Flags().BoolP("signoff", "s", false, "Add a Signed-off-by trailer for the committer")
+	addGitCommitFlags(commitCmd)
+	commitCmd.Flags().StringArray("co-author", nil, "Add a Co-authored-by trailer for \"Name <email>\", or for a name, email or alias from the roster or recent commit authors (repeatable)")
 }
 
 func runCommit(cmd *cobra.Command, args []string) error {
@@ -34,35 +49,38 @@ func runCommit(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("not in a git repository")
 	}
 
-	// Get staged changes
-	diff, err := getStagedDiff()
-	if err != nil {
-		return fmt.Errorf("failed to get staged changes: %w", err)
-	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
 
-	if strings.TrimSpace(diff) == "" {
-		return fmt.Errorf("no staged changes found. Use 'git add' to stage changes first")
+	candidateCount, _ := cmd.Flags().GetInt("candidates")
+	if candidateCount < 1 {
+		return fmt.Errorf("--candidates must be at least 1")
 	}
-
-	// Check for dry-run mode
-	dryRun, _ := cmd.Flags().GetBool("dry-run")
-	if dryRun {
-		fmt.Println("Staged changes found:")
-		fmt.Println(diff)
-		return nil
+	pick, _ := cmd.Flags().GetInt("pick")
+	if pick < 0 {
+		return fmt.Errorf("--pick must be a candidate number starting at 1")
+	}
+	splitCommits, _ := cmd.Flags().GetBool("split")
+	if splitCommits && (candidateCount > 1 || pick > 0) {
+		return fmt.Errorf("--split can't be combined with --candidates or --pick")
+	}
+	gitOptions := newGitCommitOptions(cmd)
+	if splitCommits && (gitOptions.amend || gitOptions.all) {
+		return fmt.Errorf("--split can't be combined with --amend or --all; stage the changes to split instead")
+	}
+	source, err := gitOptions.changeSource()
+	if err != nil {
+		return err
 	}
 
 	// Get context flag value
 	contextText, _ := cmd.Flags().GetString("context")
 	// If context flag is present but empty, prompt user for input
 	if cmd.Flags().Changed("context") && contextText == "" {
-		fmt.Print("Please enter additional context: ")
-		reader := bufio.NewReader(os.Stdin)
-		input, err := reader.ReadString('\n')
+		input, err := readLine("Please enter additional context: ")
 		if err != nil {
 			return fmt.Errorf("failed to read context input: %w", err)
 		}
-		contextText = strings.TrimSpace(input)
+		contextText = input
 	}
 
 	// Load configuration
@@ -71,53 +89,197 @@ func runCommit(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
 
+	// Trailers are resolved up front so a mistyped co-author fails early
+	messageTrailers, err := newCommitTrailers(cmd, cfg)
+	if err != nil {
+		return err
+	}
+
+	// Get staged changes, leaving out the contents of excluded files
+	changes, err := getStagedChanges(cfg, source)
+	if err != nil {
+		return fmt.Errorf("failed to get staged changes: %w", err)
+	}
+
+	if changes.empty() {
+		if gitOptions.all {
+			return fmt.Errorf("no changes found in tracked files")
+		}
+		return fmt.Errorf("no staged changes found. Use 'git add' to stage changes first")
+	}
+
 	// Setup providers based on configuration and available API keys
 	providers, err := setupProviders(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to setup providers: %w", err)
 	}
 
+	// Check if emoji should be used (flag overrides config)
+	useEmoji, _ := cmd.Flags().GetBool("emoji")
+
+	// The allowed types and scopes shape both the prompt and the checks
+	rules := commitRules(cfg)
+	// Issue keys in the branch name are added to every message
+	refs := currentBranchIssues(cfg)
+
+	if splitCommits {
+		committed, err := runSplit(cfg, providers, rules, refs, messageTrailers, gitOptions, useEmoji, contextText, dryRun)
+		if err != nil || !committed {
+			return err
+		}
+		return pushIfRequested(cmd)
+	}
+
+	// Suggest a scope from the changed paths so related commits agree on it
+	suggestedScope := suggestScope(cfg, rules, changes)
+	// Breaking API changes have to be marked in the message
+	breaks := detectBreakingChanges(cfg, changes, source)
+	commitPrompt := func(diff string) string {
+		return llm.CommitMessagePromptTemplate(diff, rules, suggestedScope, breakDescriptions(breaks), useEmoji, contextText)
+	}
+
+	// Check for dry-run mode
+	if dryRun {
+		fmt.Println("Staged changes found:")
+		fmt.Println(changes.Diff)
+		if len(changes.Excluded) > 0 {
+			fmt.Println(strings.TrimPrefix(changes.excludedListing(), "\n"))
+		}
+		if suggestedScope != "" {
+			fmt.Printf("Suggested scope: %s\n", suggestedScope)
+		}
+		printIssueReferences(refs)
+		printBreakingChanges(breaks)
+		messageTrailers.print(trailers.ProviderPlaceholder)
+		if err := reportSecrets(cfg, "staged changes", changes.Diff, true); err != nil {
+			return err
+		}
+		printDiffBudget(newDiffPlan(changes, llm.NewProviderManager(providers, 0), commitPrompt), len(providers) > 0)
+		return nil
+	}
+
+	// Nothing leaves the machine until it has been checked for secrets
+	changes.Diff, err = protectSecrets(cfg, "staged changes", changes.Diff, true)
+	if err != nil {
+		return err
+	}
+
 	if len(providers) == 0 {
-		return fmt.Errorf("no LLM providers available. Please set OPENAI_API_KEY, GEMINI_API_KEY, or CLAUDE_API_KEY environment variable")
+		return fmt.Errorf("no LLM providers available. Please set OPENAI_API_KEY, GEMINI_API_KEY, or CLAUDE_API_KEY environment variable, or enable Ollama with 'institutionalized config set providers.ollama.enabled true'")
 	}
 
 	fmt.Println("Analyzing staged changes...")
 
-	// Check if emoji should be used (flag overrides config)
-	useEmoji, _ := cmd.Flags().GetBool("emoji")
-
 	// Create provider manager with configured delay threshold
-	delayThreshold := time.Duration(cfg.Providers.DelayThreshold) * time.Second
-	manager := llm.NewProviderManager(providers, delayThreshold)
+	manager, err := newProviderManager(cfg, providers)
+	if err != nil {
+		return err
+	}
 
-	// Generate commit message using available providers
-	commitMessage, providerUsed, err := manager.GenerateCommitMessage(diff, useEmoji, contextText)
+	// Diffs too large for the providers' context windows are cut down, with
+	// the files that don't fit summarized separately
+	diff, err := fitDiff("staged changes", changes, manager, commitPrompt)
 	if err != nil {
-		return fmt.Errorf("failed to generate commit message: %w", err)
+		return err
 	}
 
-	// Post-process to add emoji if needed and not already present
-	if useEmoji {
-		commitMessage = addEmojiToCommitMessage(commitMessage)
+	conversation := llm.NewConversation(llm.TaskCommit, commitPrompt(diff))
+	review := newReviewer(manager, conversation)
+	review.kind = "commit message"
+	review.heading = "Proposed commit message (generated by %s):"
+	review.editHelp = "Edit the commit message. Lines starting with '#' are ignored,\nand an empty message keeps the previous version."
+	review.parse = func(reply string) (string, error) {
+		return prepareCommitMessage(cfg, rules, refs, reply, useEmoji), nil
+	}
+	if cfg.Commit.ValidateMessages() {
+		review.check = func(message string) []string {
+			return append(checkCommitMessage(message, rules), checkBreakingMarked(message, breaks)...)
+		}
 	}
+	review.show = func(message, provider string, streamed bool) {
+		// Display the proposed commit message unless it was just streamed as is
+		if streamed {
+			fmt.Println()
+		} else {
+			fmt.Printf("\nProposed commit message (generated by %s):\n%s\n\n", provider, message)
+		}
+		printBreakingChanges(breaks)
+		messageTrailers.print(provider)
+	}
+
+	var commitMessage, providerUsed string
+	streamed := false
+	if manager.Strategy() == llm.StrategyBestOf || candidateCount > 1 {
+		// Collect several messages, from every provider with best-of, and
+		// let the user pick one
+		candidates, err := manager.Candidates(conversation, candidateCount)
+		if err != nil {
+			return fmt.Errorf("failed to generate commit message: %w", err)
+		}
 
-	// Display the proposed commit message
-	fmt.Printf("\nProposed commit message (generated by %s):\n%s\n\n", providerUsed, commitMessage)
+		messages := make([]string, len(candidates))
+		labels := make([]string, len(candidates))
+		for i, candidate := range candidates {
+			messages[i] = prepareCommitMessage(cfg, rules, refs, candidate.Reply, useEmoji)
+			labels[i] = fmt.Sprintf("Generated by %s:\n%s", candidate.Provider, messages[i])
+		}
 
-	// Ask for user confirmation
-	if !askForConfirmation("Do you want to commit with this message?") {
-		fmt.Println("Commit cancelled.")
-		return nil
+		choice := pick - 1
+		if pick == 0 {
+			choice = selectCandidate("commit message", labels)
+			if choice < 0 {
+				fmt.Println("Commit cancelled.")
+				return nil
+			}
+		} else if pick > len(candidates) {
+			return fmt.Errorf("--pick %d is out of range: %d different commit message(s) were generated", pick, len(candidates))
+		}
+		commitMessage, providerUsed = messages[choice], candidates[choice].Provider
+		conversation.Reply(commitMessage)
+	} else {
+		if pick > 1 {
+			return fmt.Errorf("--pick %d is out of range: only one commit message is generated without --candidates", pick)
+		}
+
+		// Generate commit message using available providers, showing it as it
+		// is written when running in a terminal
+		commitMessage, providerUsed, streamed, err = review.generate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if pick > 0 {
+		// Scripts choose up front, so there is nothing to review
+		review.display(commitMessage, providerUsed, streamed)
+	} else {
+		// Let the user accept, edit, regenerate or refine the message
+		commitMessage, providerUsed, err = review.review(commitMessage, providerUsed, streamed)
+		if errors.Is(err, errReviewCancelled) {
+			fmt.Println("Commit cancelled.")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 	}
 
-	// Commit the changes
-	if err := commitChanges(commitMessage); err != nil {
+	// Commit the changes with the trailers after the body
+	if err := commitChanges(messageTrailers.apply(commitMessage, providerUsed), gitOptions); err != nil {
 		return fmt.Errorf("failed to commit changes: %w", err)
 	}
 
-	fmt.Println("Changes committed successfully!")
+	if gitOptions.amend {
+		fmt.Println("Commit amended successfully!")
+	} else {
+		fmt.Println("Changes committed successfully!")
+	}
+
+	return pushIfRequested(cmd)
+}
 
-	// Check if push flag is set
+// pushIfRequested pushes the new commits if the push flag is set
+func pushIfRequested(cmd *cobra.Command) error {
 	pushChanges, _ := cmd.Flags().GetBool("push")
 	if pushChanges {
 		fmt.Println("Pushing changes to remote...")
@@ -136,13 +298,261 @@ func isGitRepo() bool {
 	return err == nil
 }
 
-func getStagedDiff() (string, error) {
-	cmd := exec.Command("git", "diff", "--cached")
-	output, err := cmd.Output()
+// getRepoRoot returns the top-level directory of the working tree
+func getRepoRoot() (string, error) {
+	output, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// stagedChanges is the staged diff of the files sent to providers, plus the
+// line counts of files excluded by ignore rules
+type stagedChanges struct {
+	Diff     string
+	Excluded []gitdiff.Stat
+	// Files lists every staged file, including excluded ones
+	Files []gitdiff.Stat
+}
+
+// paths returns the paths of all staged files
+func (c stagedChanges) paths() []string {
+	paths := make([]string, len(c.Files))
+	for i, file := range c.Files {
+		paths[i] = file.Path
+	}
+	return paths
+}
+
+// empty reports whether nothing is staged
+func (c stagedChanges) empty() bool {
+	return strings.TrimSpace(c.Diff) == "" && len(c.Excluded) == 0
+}
+
+// excludedListing lists the excluded files so the model knows they changed
+func (c stagedChanges) excludedListing() string {
+	if len(c.Excluded) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\nChanged files excluded from this diff (contents not shown):\n")
+	for _, stat := range c.Excluded {
+		fmt.Fprintf(&b, "- %s\n", stat)
+	}
+	return b.String()
+}
+
+// getStagedChanges collects the diff of the changes from source file by file,
+// leaving out files matched by the default excludes, diff.exclude or
+// .institutionalizedignore
+func getStagedChanges(cfg *config.Config, source changeSource) (stagedChanges, error) {
+	output, err := exec.Command("git", append(source.diffArgs(), "--numstat", "-z")...).Output()
+	if err != nil {
+		return stagedChanges{}, err
+	}
+	stats, err := gitdiff.ParseNumstat(string(output))
+	if err != nil {
+		return stagedChanges{}, err
+	}
+
+	matcher, err := newIgnoreMatcher(cfg)
+	if err != nil {
+		return stagedChanges{}, err
+	}
+
+	changes := stagedChanges{Files: stats}
+	var pathspecs []string
+	for _, stat := range stats {
+		if matcher.Match(stat.Path) {
+			changes.Excluded = append(changes.Excluded, stat)
+			continue
+		}
+		// Both sides of a rename are needed for git to detect it
+		pathspecs = append(pathspecs, ":(literal)"+stat.Path)
+		if stat.OldPath != stat.Path {
+			pathspecs = append(pathspecs, ":(literal)"+stat.OldPath)
+		}
+	}
+	if len(pathspecs) == 0 {
+		return changes, nil
+	}
+
+	args := append(append(source.diffArgs(), "--"), pathspecs...)
+	diff, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return stagedChanges{}, err
+	}
+	changes.Diff = string(diff)
+	return changes, nil
+}
+
+// newIgnoreMatcher combines the default excludes, the configured patterns and
+// the repository's .institutionalizedignore, in that order of precedence
+func newIgnoreMatcher(cfg *config.Config) (*ignore.Matcher, error) {
+	matcher := &ignore.Matcher{}
+	if cfg.Diff.UseDefaultExcludes() {
+		if err := matcher.Add(ignore.DefaultPatterns); err != nil {
+			return nil, err
+		}
+	}
+	if err := matcher.Add(cfg.Diff.Exclude); err != nil {
+		return nil, fmt.Errorf("invalid diff.exclude: %w", err)
+	}
+
+	root, err := getRepoRoot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find repository root: %w", err)
+	}
+	if err := matcher.AddFile(filepath.Join(root, ignore.File)); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ignore.File, err)
+	}
+	return matcher, nil
+}
+
+// scanForSecrets looks for possible secrets in text, using the repository's
+// allowlist. Diffs are scanned as diffs so only added lines are checked.
+func scanForSecrets(what, text string, isDiff bool) ([]secrets.Finding, error) {
+	root, err := getRepoRoot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find repository root: %w", err)
+	}
+	allowlist, err := secrets.LoadAllowlist(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load secrets allowlist: %w", err)
+	}
+
+	scanner := secrets.NewScanner(allowlist)
+	if isDiff {
+		return scanner.ScanDiff(text), nil
+	}
+	return scanner.Scan(what, text), nil
+}
+
+// protectSecrets applies the security.secrets policy to text that is about
+// to be sent to a provider. With "block" any finding stops the command; with
+// "redact" the secrets are replaced with placeholders.
+func protectSecrets(cfg *config.Config, what, text string, isDiff bool) (string, error) {
+	policy := cfg.Security.SecretsPolicy()
+	if policy == config.SecretsOff {
+		return text, nil
+	}
+
+	findings, err := scanForSecrets(what, text, isDiff)
 	if err != nil {
 		return "", err
 	}
-	return string(output), nil
+	if len(findings) == 0 {
+		return text, nil
+	}
+
+	if policy == config.SecretsRedact {
+		fmt.Printf("🔒 Redacting %d possible secret(s) in %s before sending:\n", len(findings), what)
+		printSecretFindings(findings)
+		if isDiff {
+			return secrets.RedactDiff(text, findings), nil
+		}
+		return secrets.Redact(text, findings), nil
+	}
+
+	fmt.Printf("🚨 Found %d possible secret(s) in %s:\n", len(findings), what)
+	printSecretFindings(findings)
+	return "", fmt.Errorf("possible secrets found in %s, nothing was sent. Remove them, list false positives in %s, or run 'institutionalized config set security.secrets redact'", what, secrets.AllowlistFile)
+}
+
+// reportSecrets prints what the security.secrets policy would do with text,
+// without blocking
+func reportSecrets(cfg *config.Config, what, text string, isDiff bool) error {
+	policy := cfg.Security.SecretsPolicy()
+	if policy == config.SecretsOff {
+		return nil
+	}
+
+	findings, err := scanForSecrets(what, text, isDiff)
+	if err != nil || len(findings) == 0 {
+		return err
+	}
+
+	action := "block sending"
+	if policy == config.SecretsRedact {
+		action = "be redacted"
+	}
+	fmt.Printf("🚨 Found %d possible secret(s) in %s that would %s:\n", len(findings), what, action)
+	printSecretFindings(findings)
+	return nil
+}
+
+// printSecretFindings lists findings without revealing the secrets
+func printSecretFindings(findings []secrets.Finding) {
+	for _, finding := range findings {
+		fmt.Printf("  - %s\n", finding)
+	}
+}
+
+// responseTokens is the room left in each request for the model's answer
+const responseTokens = 1024
+
+// summaryParallelism is the number of diff summaries requested at once
+const summaryParallelism = 4
+
+// newDiffPlan plans how to fit the diff into the smallest context
+// window of the manager's providers, leaving room for the rest of the prompt
+// and the excluded files
+func newDiffPlan(changes stagedChanges, manager *llm.ProviderManager, prompt func(diff string) string) budget.Plan {
+	window := manager.ContextWindow()
+	limits := budget.Limits{
+		Prompt: window - responseTokens - budget.EstimateTokens(prompt(changes.excludedListing())),
+		Chunk:  window - responseTokens - budget.EstimateTokens(llm.DiffSummaryPromptTemplate("", "")),
+	}
+	return budget.NewPlan(gitdiff.Parse(changes.Diff), limits)
+}
+
+// fitDiff returns the text sent to providers in place of the diff: the diff
+// itself if it fits the providers' context windows, or the files that fit
+// plus summaries of the rest, followed by the list of excluded files. what
+// names the changes in messages, e.g. "staged changes".
+func fitDiff(what string, changes stagedChanges, manager *llm.ProviderManager, prompt func(diff string) string) (string, error) {
+	plan := newDiffPlan(changes, manager, prompt)
+	if plan.Fits() {
+		return changes.Diff + changes.excludedListing(), nil
+	}
+
+	fmt.Printf("The %s are too large to send in full (~%d tokens, limit %d); summarizing %d part(s)...\n", what, plan.Tokens, plan.Limits.Prompt, len(plan.Chunks))
+	fitted, err := plan.Summarize(summaryParallelism, func(label, chunk string) (string, error) {
+		summary, _, err := manager.SummarizeDiff(label, chunk)
+		return summary, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize the %s: %w", what, err)
+	}
+	return fitted + changes.excludedListing(), nil
+}
+
+// printDiffBudget reports what a diff plan would send for each file
+func printDiffBudget(plan budget.Plan, haveProviders bool) {
+	fmt.Printf("Diff budget: ~%d tokens of %d available", plan.Tokens, plan.Limits.Prompt)
+	if !haveProviders {
+		fmt.Print(" (no providers available, assuming the default context window)")
+	}
+	fmt.Println()
+
+	if plan.Fits() {
+		fmt.Println("  The full diff would be sent.")
+		return
+	}
+	for _, file := range plan.Files {
+		detail := fmt.Sprintf("~%d tokens, %s", file.Tokens, file.Priority)
+		if file.Parts > 1 {
+			detail += fmt.Sprintf(", %d parts", file.Parts)
+		}
+		if file.Truncated {
+			detail += ", truncated"
+		}
+		fmt.Printf("  %-10s %s (%s)\n", file.Action, file.Path, detail)
+	}
+	if len(plan.Chunks) > 0 {
+		fmt.Printf("  %d summary request(s) would be made before generating the message.\n", len(plan.Chunks))
+	}
 }
 
 // setupProviders creates LLM providers based on configuration and available API keys
@@ -158,85 +568,283 @@ func setupProviders(cfg *config.Config) ([]llm.Provider, error) {
 	availableProviders := make(map[string]llm.Provider)
 
 	if openaiKey != "" && cfg.Providers.OpenAI.Enabled {
-		availableProviders["openai"] = llm.NewOpenAIProvider(openaiKey)
+		availableProviders["openai"] = llm.NewOpenAIProvider(openaiKey, modelSettings(cfg.Providers.OpenAI))
 	}
 	if geminiKey != "" && cfg.Providers.Gemini.Enabled {
-		availableProviders["gemini"] = llm.NewGeminiProvider(geminiKey)
+		availableProviders["gemini"] = llm.NewGeminiProvider(geminiKey, modelSettings(cfg.Providers.Gemini))
 	}
 	if claudeKey != "" && cfg.Providers.Claude.Enabled {
-		availableProviders["claude"] = llm.NewClaudeProvider(claudeKey)
+		availableProviders["claude"] = llm.NewClaudeProvider(claudeKey, modelSettings(cfg.Providers.Claude))
 	}
+	// Ollama runs locally and needs no API key, only an explicit opt-in
+	if cfg.Providers.Ollama.Enabled {
+		availableProviders["ollama"] = llm.NewOllamaProvider(cfg.Providers.Ollama.Host, modelSettings(cfg.Providers.Ollama.ProviderConfig))
+	}
+
+	// Names were checked for duplicates when the config was loaded
+	for _, compatible := range cfg.Providers.OpenAICompatible {
+		if !compatible.Enabled {
+			continue
+		}
+		settings := modelSettings(compatible.ProviderConfig)
+		if compatible.BaseURL == "" || settings.Commit.Model == "" || settings.PR.Model == "" {
+			return nil, fmt.Errorf("openai_compatible provider %q requires base_url and model", compatible.Name)
+		}
 
-	// Add primary provider first if available
-	if primary, exists := availableProviders[cfg.Providers.Priority]; exists {
-		providers = append(providers, primary)
-		delete(availableProviders, cfg.Providers.Priority)
+		// Servers that need a key are skipped when it isn't set, like the built-in providers
+		apiKey := ""
+		if compatible.APIKeyEnv != "" {
+			apiKey = os.Getenv(compatible.APIKeyEnv)
+			if apiKey == "" {
+				continue
+			}
+		}
+
+		availableProviders[compatible.Name] = llm.NewOpenAICompatibleProvider(compatible.Name, compatible.BaseURL, apiKey, compatible.Headers, settings)
 	}
 
-	// Add remaining providers as fallbacks
-	for _, provider := range availableProviders {
-		providers = append(providers, provider)
+	// Add providers listed in the priority first, in the order given
+	for _, name := range cfg.Providers.PriorityOrder() {
+		if provider, exists := availableProviders[name]; exists {
+			providers = append(providers, provider)
+			delete(availableProviders, name)
+		}
+	}
+
+	// Add remaining providers as fallbacks in a stable order
+	for _, name := range cfg.Providers.ProviderNames() {
+		if provider, exists := availableProviders[name]; exists {
+			providers = append(providers, provider)
+			delete(availableProviders, name)
+		}
 	}
 
 	return providers, nil
 }
 
-func askForConfirmation(question string) bool {
-	fmt.Printf("%s (y/N): ", question)
-	reader := bufio.NewReader(os.Stdin)
-	response, err := reader.ReadString('\n')
+// newProviderManager creates a provider manager using the configured delay
+// threshold and strategy that reports each provider failure before falling back
+func newProviderManager(cfg *config.Config, providers []llm.Provider) (*llm.ProviderManager, error) {
+	delayThreshold := time.Duration(cfg.Providers.DelayThreshold) * time.Second
+	manager := llm.NewProviderManager(providers, delayThreshold)
+
+	hedgeDelay := time.Duration(cfg.Providers.HedgeDelay * float64(time.Second))
+	if err := manager.SetStrategy(llm.Strategy(cfg.Providers.Strategy), hedgeDelay); err != nil {
+		return nil, fmt.Errorf("invalid providers.strategy: %w", err)
+	}
+
+	manager.SetFallbackHandler(func(provider string, err error) {
+		fmt.Printf("⚠️  %v\n", err)
+	})
+	return manager, nil
+}
+
+// modelSettings converts a provider's configuration into the per-command
+// generation options used by the llm providers
+func modelSettings(providerConfig config.ProviderConfig) llm.ModelSettings {
+	return llm.ModelSettings{
+		Commit: generationOptions(providerConfig.SettingsFor(config.CommandCommit)),
+		PR:     generationOptions(providerConfig.SettingsFor(config.CommandPR)),
+	}
+}
+
+// generationOptions converts configured generation settings to llm options
+func generationOptions(settings config.GenerationSettings) llm.GenerationOptions {
+	return llm.GenerationOptions{
+		Model:         settings.Model,
+		Temperature:   settings.Temperature,
+		TopP:          settings.TopP,
+		MaxTokens:     settings.MaxTokens,
+		ContextWindow: settings.ContextWindow,
+	}
+}
+
+// isTerminal reports whether the file is connected to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
 	if err != nil {
 		return false
 	}
-	response = strings.ToLower(strings.TrimSpace(response))
-	return response == "y" || response == "yes"
+	return info.Mode()&os.ModeCharDevice != 0
 }
 
-func commitChanges(message string) error {
-	cmd := exec.Command("git", "commit", "-m", message)
-	return cmd.Run()
+// streamPrinter writes streamed tokens to stdout, printing a heading each
+// time a provider starts answering
+type streamPrinter struct {
+	// heading is a format string that receives the provider name
+	heading  string
+	provider string
+	midLine  bool
+}
+
+// newStreamPrinter creates a stream printer with the given heading format
+func newStreamPrinter(heading string) *streamPrinter {
+	return &streamPrinter{heading: heading}
+}
+
+// print writes a token, starting a new section if the provider changed
+func (s *streamPrinter) print(provider, token string) {
+	if provider != s.provider {
+		s.finish()
+		fmt.Printf("\n"+s.heading+"\n", provider)
+		s.provider = provider
+	}
+	fmt.Print(token)
+	s.midLine = !strings.HasSuffix(token, "\n")
+}
+
+// fallback reports a provider failure on its own line, even mid-stream
+func (s *streamPrinter) fallback(provider string, err error) {
+	s.finish()
+	fmt.Printf("⚠️  %v\n", err)
+	// Output from the next provider needs its own heading
+	s.provider = ""
+}
+
+// finish ends a partially written line
+func (s *streamPrinter) finish() {
+	if s.midLine {
+		fmt.Println()
+		s.midLine = false
+	}
+}
+
+// streamedFrom reports whether the output on screen came from the provider
+func (s *streamPrinter) streamedFrom(provider string) bool {
+	return s.provider != "" && s.provider == provider
+}
+
+// selectCandidate shows numbered options and asks the user to pick one. It
+// returns the zero-based index of the choice, or -1 if the user cancels.
+func selectCandidate(kind string, labels []string) int {
+	fmt.Println()
+	for i, label := range labels {
+		fmt.Printf("[%d] %s\n\n", i+1, label)
+	}
+
+	for {
+		response, err := readLine(fmt.Sprintf("Select a %s [1-%d] or press Enter to cancel: ", kind, len(labels)))
+		if err != nil || response == "" {
+			return -1
+		}
+
+		choice, err := strconv.Atoi(response)
+		if err == nil && choice >= 1 && choice <= len(labels) {
+			return choice - 1
+		}
+		fmt.Printf("Invalid selection: %s\n", response)
+	}
 }
 
+// pushToRemote runs git push, showing its output and any pre-push hook errors
 func pushToRemote() error {
 	cmd := exec.Command("git", "push")
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
-// addEmojiToCommitMessage adds appropriate emoji to commit message if not already present
-func addEmojiToCommitMessage(message string) string {
-	// Extract the commit type from the message
-	re := regexp.MustCompile(`^(\w+)(\(.+\))?:\s*(.*)`)
-	matches := re.FindStringSubmatch(message)
+// commitRules returns the Conventional Commits rules generated commit
+// messages must follow: the configured types, scopes and limits, narrowed to
+// what the repository's commitlint config accepts
+func commitRules(cfg *config.Config) conventional.Rules {
+	rules := conventional.Rules{
+		Types:           cfg.Commit.CommitTypes(),
+		Scopes:          cfg.Commit.Scopes,
+		MaxHeaderLength: cfg.Commit.MaxSubjectLength(),
+		BodyWrap:        cfg.Commit.WrapColumn(),
+	}
+	if !cfg.Commit.UseCommitlint() {
+		return rules
+	}
 
-	if len(matches) >= 4 {
-		commitType := matches[1]
-		scope := matches[2] // includes parentheses if present
-		description := matches[3]
+	root, err := getRepoRoot()
+	if err != nil {
+		return rules
+	}
+	lint, err := commitlint.Load(root)
+	if err != nil {
+		fmt.Printf("⚠️  Ignoring commitlint config: %v\n", err)
+		return rules
+	}
+	if lint == nil {
+		return rules
+	}
+	return lint.Apply(rules)
+}
 
-		// Check if emoji is already present
-		if hasEmoji(message) {
-			return message
-		}
+// suggestScope returns the scope matching the staged files, or "" if there is
+// none or the changes touch too many scopes, which is reported as a warning
+func suggestScope(cfg *config.Config, rules conventional.Rules, changes stagedChanges) string {
+	if !cfg.Commit.InferScopes() {
+		return ""
+	}
+	root, err := getRepoRoot()
+	if err != nil {
+		return ""
+	}
+	resolver, err := scope.NewResolver(root, cfg.Commit.ScopeRules)
+	if err != nil {
+		fmt.Printf("⚠️  Not suggesting a scope: %v\n", err)
+		return ""
+	}
 
-		// Get emoji for commit type
-		emoji := config.GetEmojiForCommitType(commitType)
-		if emoji != "" {
-			return fmt.Sprintf("%s%s%s: %s", emoji, commitType, scope, description)
-		}
+	summary := resolver.Resolve(changes.paths(), rules.Scopes)
+	suggested, split := summary.Suggest(cfg.Commit.CombinedScopesLimit())
+	if split {
+		fmt.Printf("⚠️  These changes touch %d scopes (%s); consider committing them separately.\n", len(summary.Scopes), strings.Join(summary.Names(), ", "))
 	}
+	return suggested
+}
 
+// prepareCommitMessage turns a provider's reply into a commit message. With
+// validation enabled it strips the chatter around the message and repairs
+// what can be fixed locally, then the issue references and emoji are added
+// if needed.
+func prepareCommitMessage(cfg *config.Config, rules conventional.Rules, refs []string, reply string, useEmoji bool) string {
+	message := reply
+	if cfg.Commit.ValidateMessages() {
+		message, _ = conventional.Repair(reply, rules)
+	}
+	message = addIssueReferences(cfg, message, refs)
+	if useEmoji {
+		message = addEmojiToCommitMessage(message, rules)
+	}
 	return message
 }
 
-// hasEmoji checks if the message already contains emoji
-func hasEmoji(message string) bool {
-	// Simple check for common emoji characters
-	emojiRunes := []rune("✨🐛📚💄♻️✅🔧⚡👷🏗️⏪")
-	for _, r := range message {
-		for _, emoji := range emojiRunes {
-			if r == emoji {
-				return true
-			}
+// checkCommitMessage returns the rules a commit message breaks. The emoji
+// doesn't count towards the length of the first line.
+func checkCommitMessage(message string, rules conventional.Rules) []string {
+	message = strings.TrimSpace(message)
+	if msg, err := conventional.Parse(message); err == nil && msg.Emoji != "" {
+		message = strings.TrimPrefix(message, msg.Emoji)
+	}
+	return conventional.Check(message, rules)
+}
+
+// addEmojiToCommitMessage adds the emoji of the message's type if the
+// message doesn't have one yet
+func addEmojiToCommitMessage(message string, rules conventional.Rules) string {
+	msg, err := conventional.Parse(message)
+	if err != nil || msg.Emoji != "" || hasEmoji(message, rules) {
+		return message
+	}
+
+	prefix := rules.EmojiPrefix(msg.Type)
+	if prefix == "" {
+		return message
+	}
+	// Only the first line gets the emoji; the body and footers are kept as is
+	return prefix + strings.TrimSpace(message)
+}
+
+// hasEmoji checks if the message already contains the emoji of a type
+func hasEmoji(message string, rules conventional.Rules) bool {
+	for _, t := range rules.Types {
+		if t.Emoji != "" && strings.Contains(message, t.Emoji) {
+			return true
 		}
 	}
 	return false
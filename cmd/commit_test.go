@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/IanKnighton/institutionalized/internal/config"
+	"github.com/IanKnighton/institutionalized/internal/conventional"
+)
+
+func TestPrepareCommitMessage(t *testing.T) {
+	cfg := config.DefaultConfig()
+	rules := conventional.DefaultRules()
+	reply := "Here is the commit message:\n\n```\nFeature(api): add export.\n\nStreams rows instead of loading them.\n```"
+
+	if got := prepareCommitMessage(cfg, rules, nil, reply, true); got != "✨ feat(api): add export\n\nStreams rows instead of loading them." {
+		t.Errorf("Unexpected repaired message: %q", got)
+	}
+
+	disabled := false
+	cfg.Commit.Validate = &disabled
+	if got := prepareCommitMessage(cfg, rules, nil, "fix: x\n\nbody", true); got != "🐛 fix: x\n\nbody" {
+		t.Errorf("Expected the body to be kept, got %q", got)
+	}
+}
+
+func TestPrepareCommitMessageAddsIssueReferences(t *testing.T) {
+	cfg := config.DefaultConfig()
+	rules := conventional.DefaultRules()
+	refs := []string{"PROJ-123"}
+
+	if got := prepareCommitMessage(cfg, rules, refs, "feat: add export", false); got != "feat: add export\n\nRefs: PROJ-123" {
+		t.Errorf("Expected a trailer, got %q", got)
+	}
+
+	cfg.Issues.Commit = config.IssuesPrefix
+	if got := prepareCommitMessage(cfg, rules, refs, "feat: add export", true); got != "✨ feat: PROJ-123 add export" {
+		t.Errorf("Expected a prefix, got %q", got)
+	}
+
+	cfg.Issues.Commit = config.IssuesOff
+	if got := prepareCommitMessage(cfg, rules, refs, "feat: add export", false); got != "feat: add export" {
+		t.Errorf("Expected no references, got %q", got)
+	}
+}
+
+func TestCheckCommitMessageIgnoresEmoji(t *testing.T) {
+	rules := conventional.DefaultRules()
+	rules.MaxHeaderLength = 11
+
+	if violations := checkCommitMessage("✨ feat: add x", rules); len(violations) != 0 {
+		t.Errorf("Expected the emoji not to count, got %q", violations)
+	}
+	if violations := checkCommitMessage("✨ feat: add x and y", rules); len(violations) != 1 {
+		t.Errorf("Expected a length violation, got %q", violations)
+	}
+}
+
+func TestCustomTypesDriveEmoji(t *testing.T) {
+	rules := conventional.Rules{Types: []conventional.Type{{Name: "deps", Emoji: "⬆️"}, {Name: "feat"}}}
+
+	if got := addEmojiToCommitMessage("deps: bump cobra", rules); got != "⬆️ deps: bump cobra" {
+		t.Errorf("Expected the configured emoji, got %q", got)
+	}
+	if got := addEmojiToCommitMessage("feat: add x", rules); got != "feat: add x" {
+		t.Errorf("Expected no emoji for a type without one, got %q", got)
+	}
+
+	// The default emoji are separated from the type by a space, as they
+	// always have been
+	defaults := conventional.DefaultRules()
+	for message, expected := range map[string]string{"feat: add x": "✨ feat: add x", "fix(api): y": "🐛 fix(api): y", "ci: z": "👷 ci: z"} {
+		if got := addEmojiToCommitMessage(message, defaults); got != expected {
+			t.Errorf("addEmojiToCommitMessage(%q) = %q, expected %q", message, got, expected)
+		}
+	}
+}
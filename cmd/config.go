@@ -3,8 +3,15 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/IanKnighton/institutionalized/internal/config"
+	"github.com/IanKnighton/institutionalized/internal/ignore"
+	"github.com/IanKnighton/institutionalized/internal/llm"
+	"github.com/IanKnighton/institutionalized/internal/trailers"
 	"github.com/spf13/cobra"
 )
 
@@ -24,7 +31,7 @@ var configShowCmd = &cobra.Command{
 var configSetCmd = &cobra.Command{
 	Use:   "set [key] [value]",
 	Short: "Set a configuration value",
-	Long:  `Set a configuration value. Available keys: use_emoji (true/false), providers.openai.enabled (true/false), providers.gemini.enabled (true/false), providers.priority (openai/gemini), providers.delay_threshold (seconds)`,
+	Long:  `Set a configuration value. Available keys: use_emoji (true/false), providers.openai.enabled (true/false), providers.gemini.enabled (true/false), providers.claude.enabled (true/false), providers.ollama.enabled (true/false), providers.ollama.host (URL), providers.<provider>.model (model name), providers.<provider>.temperature (0-2), providers.<provider>.top_p (0-1), providers.<provider>.max_tokens (number), providers.<provider>.context_window (tokens), where <provider> is a built-in provider or an openai_compatible name, providers.priority (openai/gemini/claude/ollama or an openai_compatible name; comma-separate to set a fallback order), providers.delay_threshold (seconds), providers.strategy (sequential/race/best-of), providers.hedge_delay (seconds, 0 starts all providers at once), security.secrets (block/redact/off), diff.default_excludes (true/false), diff.exclude (comma-separated gitignore-style patterns), commit.validate (true/false), commit.subject_max_length (characters), commit.body_wrap (characters), commit.scopes (comma-separated), commit.commitlint (true/false), commit.infer_scope (true/false), commit.max_combined_scopes (1-10), commit.detect_breaking (true/false), issues.commit (trailer/prefix/both/off), issues.trailer (trailer name), issues.pr_keyword (e.g. Closes or Fixes, or off), trailers.signoff (true/false), trailers.roster (path to a co-author roster), trailers.add (comma-separated "Token: value" trailers; {provider} is replaced by the provider name), hook.timeout (seconds the prepare-commit-msg hook waits for a message, 1-600), forge.type (github/gitlab/bitbucket/bitbucket-datacenter/gitea/forgejo, or auto to detect it from the remote). Commit types and path-to-scope rules are defined under commit.types and commit.scope_rules in the config file, issue key patterns under issues.patterns, and the forges of self-hosted instances under forge.hosts. Generation settings can be limited to one command with providers.<provider>.commit.<setting> or providers.<provider>.pr.<setting>, and reset with the value "default". OpenAI-compatible providers are defined under providers.openai_compatible in the config file.`,
 	Args:  cobra.ExactArgs(2),
 	RunE:  runConfigSet,
 }
@@ -54,12 +61,119 @@ func runConfigShow(cmd *cobra.Command, args []string) error {
 	fmt.Printf("  providers:\n")
 	fmt.Printf("    openai:\n")
 	fmt.Printf("      enabled: %t\n", cfg.Providers.OpenAI.Enabled)
+	printGenerationSettings("      ", cfg.Providers.OpenAI, llm.DefaultOpenAIModel)
 	fmt.Printf("    gemini:\n")
 	fmt.Printf("      enabled: %t\n", cfg.Providers.Gemini.Enabled)
+	printGenerationSettings("      ", cfg.Providers.Gemini, llm.DefaultGeminiModel)
 	fmt.Printf("    claude:\n")
 	fmt.Printf("      enabled: %t\n", cfg.Providers.Claude.Enabled)
+	printGenerationSettings("      ", cfg.Providers.Claude, llm.DefaultClaudeModel)
+	fmt.Printf("    ollama:\n")
+	fmt.Printf("      enabled: %t\n", cfg.Providers.Ollama.Enabled)
+	fmt.Printf("      host: %s\n", cfg.Providers.Ollama.Host)
+	printGenerationSettings("      ", cfg.Providers.Ollama.ProviderConfig, llm.DefaultOllamaModel)
+	if len(cfg.Providers.OpenAICompatible) > 0 {
+		fmt.Printf("    openai_compatible:\n")
+		for _, compatible := range cfg.Providers.OpenAICompatible {
+			fmt.Printf("      - name: %s\n", compatible.Name)
+			fmt.Printf("        enabled: %t\n", compatible.Enabled)
+			fmt.Printf("        base_url: %s\n", compatible.BaseURL)
+			printGenerationSettings("        ", compatible.ProviderConfig, "")
+			if compatible.APIKeyEnv != "" {
+				fmt.Printf("        api_key_env: %s\n", compatible.APIKeyEnv)
+			}
+			if len(compatible.Headers) > 0 {
+				// Header values often carry credentials, so only show the names
+				headerNames := make([]string, 0, len(compatible.Headers))
+				for name := range compatible.Headers {
+					headerNames = append(headerNames, name)
+				}
+				sort.Strings(headerNames)
+				fmt.Printf("        headers: %s\n", strings.Join(headerNames, ", "))
+			}
+		}
+	}
 	fmt.Printf("    priority: %s\n", cfg.Providers.Priority)
 	fmt.Printf("    delay_threshold: %d seconds\n", cfg.Providers.DelayThreshold)
+	strategy := cfg.Providers.Strategy
+	if strategy == "" {
+		strategy = config.StrategySequential
+	}
+	fmt.Printf("    strategy: %s\n", strategy)
+	if strategy == config.StrategyRace {
+		fmt.Printf("    hedge_delay: %g seconds\n", cfg.Providers.HedgeDelay)
+	}
+
+	fmt.Printf("  security:\n")
+	fmt.Printf("    secrets: %s\n", cfg.Security.SecretsPolicy())
+	fmt.Printf("  diff:\n")
+	fmt.Printf("    default_excludes: %t\n", cfg.Diff.UseDefaultExcludes())
+	if len(cfg.Diff.Exclude) > 0 {
+		fmt.Printf("    exclude: %s\n", strings.Join(cfg.Diff.Exclude, ", "))
+	}
+	fmt.Printf("  commit:\n")
+	fmt.Printf("    validate: %t\n", cfg.Commit.ValidateMessages())
+	fmt.Printf("    subject_max_length: %d\n", cfg.Commit.MaxSubjectLength())
+	fmt.Printf("    body_wrap: %d\n", cfg.Commit.WrapColumn())
+	types := make([]string, 0, len(cfg.Commit.CommitTypes()))
+	for _, t := range cfg.Commit.CommitTypes() {
+		types = append(types, strings.TrimSpace(t.Emoji+" "+t.Name))
+	}
+	fmt.Printf("    types: %s\n", strings.Join(types, ", "))
+	if len(cfg.Commit.Scopes) > 0 {
+		fmt.Printf("    scopes: %s\n", strings.Join(cfg.Commit.Scopes, ", "))
+	}
+	fmt.Printf("    infer_scope: %t\n", cfg.Commit.InferScopes())
+	for _, rule := range cfg.Commit.ScopeRules {
+		fmt.Printf("    scope rule: %s -> %s\n", rule.Path, rule.Scope)
+	}
+	fmt.Printf("    max_combined_scopes: %d\n", cfg.Commit.CombinedScopesLimit())
+	fmt.Printf("    commitlint: %t\n", cfg.Commit.UseCommitlint())
+	fmt.Printf("    detect_breaking: %t\n", cfg.Commit.DetectBreakingChanges())
+	fmt.Printf("  issues:\n")
+	if len(cfg.Issues.Patterns) > 0 {
+		for _, pattern := range cfg.Issues.Patterns {
+			fmt.Printf("    pattern: %s\n", pattern)
+		}
+	} else {
+		fmt.Printf("    patterns: default\n")
+	}
+	fmt.Printf("    commit: %s\n", cfg.Issues.CommitPolicy())
+	fmt.Printf("    trailer: %s\n", cfg.Issues.TrailerToken())
+	if keyword := cfg.Issues.ClosingKeyword(); keyword != "" {
+		fmt.Printf("    pr_keyword: %s\n", keyword)
+	} else {
+		fmt.Printf("    pr_keyword: off\n")
+	}
+	fmt.Printf("  trailers:\n")
+	fmt.Printf("    signoff: %t\n", cfg.Trailers.Signoff)
+	if cfg.Trailers.Roster != "" {
+		fmt.Printf("    roster: %s\n", cfg.Trailers.Roster)
+	}
+	for _, trailer := range cfg.Trailers.Add {
+		fmt.Printf("    add: %s\n", trailer)
+	}
+	fmt.Printf("  hook:\n")
+	fmt.Printf("    timeout: %d seconds\n", cfg.Hook.TimeoutSeconds())
+	fmt.Printf("  forge:\n")
+	if cfg.Forge.Type != "" {
+		fmt.Printf("    type: %s\n", cfg.Forge.Type)
+	} else {
+		fmt.Printf("    type: auto\n")
+	}
+	hosts := make([]string, 0, len(cfg.Forge.Hosts))
+	for host := range cfg.Forge.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		entry := cfg.Forge.Hosts[host]
+		if entry.APIURL != "" {
+			fmt.Printf("    hosts.%s: %s (%s)\n", host, entry.Type, entry.APIURL)
+		} else {
+			fmt.Printf("    hosts.%s: %s\n", host, entry.Type)
+		}
+	}
 
 	// Show config file location
 	homeDir, err := os.UserHomeDir()
@@ -121,12 +235,32 @@ func runConfigSet(cmd *cobra.Command, args []string) error {
 		default:
 			return fmt.Errorf("invalid value for providers.claude.enabled: %s (expected true/false)", value)
 		}
+	case "providers.ollama.enabled":
+		switch value {
+		case "true", "1", "yes", "on":
+			cfg.Providers.Ollama.Enabled = true
+		case "false", "0", "no", "off":
+			cfg.Providers.Ollama.Enabled = false
+		default:
+			return fmt.Errorf("invalid value for providers.ollama.enabled: %s (expected true/false)", value)
+		}
+	case "providers.ollama.host":
+		if !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+			return fmt.Errorf("invalid value for providers.ollama.host: %s (expected http:// or https:// URL)", value)
+		}
+		cfg.Providers.Ollama.Host = value
 	case "providers.priority":
-		if value == "openai" || value == "gemini" || value == "claude" {
-			cfg.Providers.Priority = value
-		} else {
-			return fmt.Errorf("invalid value for providers.priority: %s (expected openai/gemini/claude)", value)
+		known := cfg.Providers.ProviderNames()
+		order := config.Providers{Priority: value}.PriorityOrder()
+		if len(order) == 0 {
+			return fmt.Errorf("invalid value for providers.priority: %s (expected %s)", value, strings.Join(known, "/"))
+		}
+		for _, name := range order {
+			if !slices.Contains(known, name) {
+				return fmt.Errorf("invalid value for providers.priority: %s (expected %s, or a comma-separated list of them)", name, strings.Join(known, "/"))
+			}
 		}
+		cfg.Providers.Priority = strings.Join(order, ",")
 	case "providers.delay_threshold":
 		// Parse the value as integer
 		var delayThreshold int
@@ -137,8 +271,204 @@ func runConfigSet(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("invalid value for providers.delay_threshold: %d (expected 1-300 seconds)", delayThreshold)
 		}
 		cfg.Providers.DelayThreshold = delayThreshold
+	case "providers.strategy":
+		switch value {
+		case config.StrategySequential, config.StrategyRace, config.StrategyBestOf:
+			cfg.Providers.Strategy = value
+		default:
+			return fmt.Errorf("invalid value for providers.strategy: %s (expected sequential/race/best-of)", value)
+		}
+	case "providers.hedge_delay":
+		hedgeDelay, err := strconv.ParseFloat(value, 64)
+		if err != nil || hedgeDelay < 0 || hedgeDelay > 300 {
+			return fmt.Errorf("invalid value for providers.hedge_delay: %s (expected 0-300 seconds)", value)
+		}
+		cfg.Providers.HedgeDelay = hedgeDelay
+	case "security.secrets":
+		switch value {
+		case config.SecretsBlock, config.SecretsRedact, config.SecretsOff:
+			cfg.Security.Secrets = value
+		default:
+			return fmt.Errorf("invalid value for security.secrets: %s (expected block/redact/off)", value)
+		}
+	case "diff.default_excludes":
+		switch value {
+		case "true", "1", "yes", "on":
+			cfg.Diff.DefaultExcludes = nil
+		case "false", "0", "no", "off":
+			disabled := false
+			cfg.Diff.DefaultExcludes = &disabled
+		default:
+			return fmt.Errorf("invalid value for diff.default_excludes: %s (expected true/false)", value)
+		}
+	case "diff.exclude":
+		// A comma-separated list replaces the patterns; "default" clears them
+		var patterns []string
+		if value != "default" {
+			for _, pattern := range strings.Split(value, ",") {
+				if pattern = strings.TrimSpace(pattern); pattern != "" {
+					patterns = append(patterns, pattern)
+				}
+			}
+		}
+		if _, err := ignore.NewMatcher(patterns); err != nil {
+			return fmt.Errorf("invalid value for diff.exclude: %w", err)
+		}
+		cfg.Diff.Exclude = patterns
+	case "commit.validate":
+		switch value {
+		case "true", "1", "yes", "on":
+			cfg.Commit.Validate = nil
+		case "false", "0", "no", "off":
+			disabled := false
+			cfg.Commit.Validate = &disabled
+		default:
+			return fmt.Errorf("invalid value for commit.validate: %s (expected true/false)", value)
+		}
+	case "commit.subject_max_length", "commit.body_wrap":
+		// "default" resets to the built-in limit
+		columns := 0
+		if value != "default" {
+			columns, err = strconv.Atoi(value)
+			if err != nil || columns < 20 || columns > 200 {
+				return fmt.Errorf("invalid value for %s: %s (expected 20-200 characters or default)", key, value)
+			}
+		}
+		if key == "commit.body_wrap" {
+			cfg.Commit.BodyWrap = columns
+		} else {
+			cfg.Commit.SubjectMaxLength = columns
+		}
+	case "commit.commitlint":
+		switch value {
+		case "true", "1", "yes", "on":
+			cfg.Commit.Commitlint = nil
+		case "false", "0", "no", "off":
+			disabled := false
+			cfg.Commit.Commitlint = &disabled
+		default:
+			return fmt.Errorf("invalid value for commit.commitlint: %s (expected true/false)", value)
+		}
+	case "commit.infer_scope":
+		switch value {
+		case "true", "1", "yes", "on":
+			cfg.Commit.InferScope = nil
+		case "false", "0", "no", "off":
+			disabled := false
+			cfg.Commit.InferScope = &disabled
+		default:
+			return fmt.Errorf("invalid value for commit.infer_scope: %s (expected true/false)", value)
+		}
+	case "commit.detect_breaking":
+		switch value {
+		case "true", "1", "yes", "on":
+			cfg.Commit.DetectBreaking = nil
+		case "false", "0", "no", "off":
+			disabled := false
+			cfg.Commit.DetectBreaking = &disabled
+		default:
+			return fmt.Errorf("invalid value for commit.detect_breaking: %s (expected true/false)", value)
+		}
+	case "commit.max_combined_scopes":
+		// "default" resets to the built-in limit
+		limit := 0
+		if value != "default" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > 10 {
+				return fmt.Errorf("invalid value for commit.max_combined_scopes: %s (expected 1-10 or default)", value)
+			}
+		}
+		cfg.Commit.MaxCombinedScopes = limit
+	case "commit.scopes":
+		// A comma-separated list replaces the scopes; "default" allows any scope
+		var scopes []string
+		if value != "default" {
+			for _, scope := range strings.Split(value, ",") {
+				if scope = strings.TrimSpace(scope); scope != "" {
+					scopes = append(scopes, scope)
+				}
+			}
+		}
+		cfg.Commit.Scopes = scopes
+	case "issues.commit":
+		switch value {
+		case config.IssuesTrailer, config.IssuesPrefix, config.IssuesBoth, config.IssuesOff:
+			cfg.Issues.Commit = value
+		default:
+			return fmt.Errorf("invalid value for issues.commit: %s (expected trailer/prefix/both/off)", value)
+		}
+	case "issues.trailer":
+		// "default" resets to Refs
+		if value == "default" {
+			value = ""
+		} else if !trailers.ValidToken(value) {
+			return fmt.Errorf("invalid value for issues.trailer: %s (expected a trailer name such as Refs or Jira, or default)", value)
+		}
+		cfg.Issues.Trailer = value
+	case "issues.pr_keyword":
+		// "default" resets to Closes
+		if value == "default" {
+			value = ""
+		} else if strings.ContainsAny(value, " \t\n") {
+			return fmt.Errorf("invalid value for issues.pr_keyword: %s (expected one word such as Closes or Fixes, off, or default)", value)
+		}
+		cfg.Issues.PRKeyword = value
+	case "trailers.signoff":
+		switch value {
+		case "true", "1", "yes", "on":
+			cfg.Trailers.Signoff = true
+		case "false", "0", "no", "off":
+			cfg.Trailers.Signoff = false
+		default:
+			return fmt.Errorf("invalid value for trailers.signoff: %s (expected true/false)", value)
+		}
+	case "trailers.roster":
+		// "default" removes the roster
+		if value == "default" {
+			value = ""
+		}
+		cfg.Trailers.Roster = value
+	case "trailers.add":
+		// A comma-separated list replaces the trailers; "default" clears them
+		var added []string
+		if value != "default" {
+			for _, trailer := range strings.Split(value, ",") {
+				if trailer = strings.TrimSpace(trailer); trailer == "" {
+					continue
+				}
+				if _, err := trailers.Parse(trailer); err != nil {
+					return fmt.Errorf("invalid value for trailers.add: %w", err)
+				}
+				added = append(added, trailer)
+			}
+		}
+		cfg.Trailers.Add = added
+	case "hook.timeout":
+		// "default" resets to the built-in timeout
+		timeout := 0
+		if value != "default" {
+			timeout, err = strconv.Atoi(value)
+			if err != nil || timeout < 1 || timeout > 600 {
+				return fmt.Errorf("invalid value for hook.timeout: %s (expected 1-600 seconds or default)", value)
+			}
+		}
+		cfg.Hook.Timeout = timeout
+	case "forge.type":
+		// "auto" detects the forge from the remote's host
+		if value == "auto" {
+			value = ""
+		} else if !config.ValidForgeType(value) {
+			return fmt.Errorf("invalid value for forge.type: %s (expected github/gitlab/bitbucket/bitbucket-datacenter/gitea/forgejo or auto)", value)
+		}
+		cfg.Forge.Type = value
 	default:
-		return fmt.Errorf("unknown config key: %s (available: use_emoji, providers.openai.enabled, providers.gemini.enabled, providers.claude.enabled, providers.priority, providers.delay_threshold)", key)
+		handled, err := setGenerationSetting(cfg, key, value)
+		if err != nil {
+			return err
+		}
+		if !handled {
+			return fmt.Errorf("unknown config key: %s (available: use_emoji, providers.<provider>.enabled, providers.<provider>.[commit.|pr.]{model,temperature,top_p,max_tokens,context_window}, providers.ollama.host, providers.priority, providers.delay_threshold, providers.strategy, providers.hedge_delay, security.secrets, diff.default_excludes, diff.exclude, commit.validate, commit.subject_max_length, commit.body_wrap, commit.scopes, commit.commitlint, commit.infer_scope, commit.max_combined_scopes, commit.detect_breaking, issues.commit, issues.trailer, issues.pr_keyword, trailers.signoff, trailers.roster, trailers.add, hook.timeout, forge.type)", key)
+		}
 	}
 
 	if err := config.SaveConfig(cfg); err != nil {
@@ -166,3 +496,132 @@ func runConfigInit(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// printGenerationSettings prints a provider's model and sampling settings,
+// including any per-command overrides
+func printGenerationSettings(indent string, providerConfig config.ProviderConfig, defaultModel string) {
+	model := providerConfig.Model
+	if model == "" && defaultModel != "" {
+		model = fmt.Sprintf("%s (default)", defaultModel)
+	}
+	fmt.Printf("%smodel: %s\n", indent, model)
+	printSamplingSettings(indent, providerConfig.GenerationSettings)
+
+	for _, override := range []struct {
+		name     string
+		settings config.GenerationSettings
+	}{
+		{config.CommandCommit, providerConfig.Commit},
+		{config.CommandPR, providerConfig.PR},
+	} {
+		if override.settings == (config.GenerationSettings{}) {
+			continue
+		}
+		fmt.Printf("%s%s:\n", indent, override.name)
+		if override.settings.Model != "" {
+			fmt.Printf("%s  model: %s\n", indent, override.settings.Model)
+		}
+		printSamplingSettings(indent+"  ", override.settings)
+	}
+}
+
+// printSamplingSettings prints the sampling settings that have been set
+func printSamplingSettings(indent string, settings config.GenerationSettings) {
+	if settings.Temperature != nil {
+		fmt.Printf("%stemperature: %g\n", indent, *settings.Temperature)
+	}
+	if settings.TopP != nil {
+		fmt.Printf("%stop_p: %g\n", indent, *settings.TopP)
+	}
+	if settings.MaxTokens != 0 {
+		fmt.Printf("%smax_tokens: %d\n", indent, settings.MaxTokens)
+	}
+	if settings.ContextWindow != 0 {
+		fmt.Printf("%scontext_window: %d\n", indent, settings.ContextWindow)
+	}
+}
+
+// setGenerationSetting handles keys of the form
+// providers.<provider>.[commit.|pr.]<setting>, where the provider is a
+// built-in one or the name of an openai_compatible entry. It reports whether
+// the key was a generation setting at all.
+func setGenerationSetting(cfg *config.Config, key, value string) (bool, error) {
+	parts := strings.Split(key, ".")
+	if len(parts) < 3 || len(parts) > 4 || parts[0] != "providers" {
+		return false, nil
+	}
+
+	providerConfig := cfg.Providers.Provider(parts[1])
+	if providerConfig == nil {
+		return false, nil
+	}
+
+	settings := &providerConfig.GenerationSettings
+	if len(parts) == 4 {
+		switch parts[2] {
+		case config.CommandCommit:
+			settings = &providerConfig.Commit
+		case config.CommandPR:
+			settings = &providerConfig.PR
+		default:
+			return false, nil
+		}
+	}
+
+	reset := value == "default"
+
+	switch parts[len(parts)-1] {
+	case "model":
+		if strings.TrimSpace(value) == "" {
+			return true, fmt.Errorf("invalid value for %s: model name cannot be empty", key)
+		}
+		if reset {
+			value = ""
+		}
+		settings.Model = value
+	case "temperature":
+		if reset {
+			settings.Temperature = nil
+			break
+		}
+		temperature, err := strconv.ParseFloat(value, 64)
+		if err != nil || temperature < 0 || temperature > 2 {
+			return true, fmt.Errorf("invalid value for %s: %s (expected a number between 0 and 2)", key, value)
+		}
+		settings.Temperature = &temperature
+	case "top_p":
+		if reset {
+			settings.TopP = nil
+			break
+		}
+		topP, err := strconv.ParseFloat(value, 64)
+		if err != nil || topP < 0 || topP > 1 {
+			return true, fmt.Errorf("invalid value for %s: %s (expected a number between 0 and 1)", key, value)
+		}
+		settings.TopP = &topP
+	case "max_tokens":
+		if reset {
+			settings.MaxTokens = 0
+			break
+		}
+		maxTokens, err := strconv.Atoi(value)
+		if err != nil || maxTokens < 1 {
+			return true, fmt.Errorf("invalid value for %s: %s (expected a positive number of tokens)", key, value)
+		}
+		settings.MaxTokens = maxTokens
+	case "context_window":
+		if reset {
+			settings.ContextWindow = 0
+			break
+		}
+		contextWindow, err := strconv.Atoi(value)
+		if err != nil || contextWindow < 1024 {
+			return true, fmt.Errorf("invalid value for %s: %s (expected at least 1024 tokens)", key, value)
+		}
+		settings.ContextWindow = contextWindow
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IanKnighton/institutionalized/internal/config"
+)
+
+func TestSetGenerationSettingForCompatibleProvider(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Providers.OpenAICompatible = []config.OpenAICompatibleConfig{{Name: "vllm", BaseURL: "http://localhost:8000/v1"}}
+
+	for key, value := range map[string]string{
+		"providers.vllm.model":          "qwen2.5-coder",
+		"providers.vllm.temperature":    "0.2",
+		"providers.vllm.pr.max_tokens":  "2048",
+		"providers.openai.commit.top_p": "0.9",
+		"providers.vllm.context_window": "32768",
+	} {
+		if handled, err := setGenerationSetting(cfg, key, value); !handled || err != nil {
+			t.Errorf("Expected %s to be set, got handled=%v err=%v", key, handled, err)
+		}
+	}
+
+	vllm := cfg.Providers.OpenAICompatible[0]
+	if vllm.Model != "qwen2.5-coder" || vllm.Temperature == nil || *vllm.Temperature != 0.2 || vllm.PR.MaxTokens != 2048 || vllm.ContextWindow != 32768 {
+		t.Errorf("Unexpected settings for vllm: %+v", vllm.ProviderConfig)
+	}
+	if cfg.Providers.OpenAI.Commit.TopP == nil {
+		t.Error("Expected the built-in provider to still be handled")
+	}
+
+	if handled, _ := setGenerationSetting(cfg, "providers.missing.model", "x"); handled {
+		t.Error("Expected an unknown provider not to be handled")
+	}
+	if _, err := setGenerationSetting(cfg, "providers.vllm.temperature", "3"); err == nil {
+		t.Error("Expected an out of range temperature to be rejected")
+	}
+}
+
+func TestLoadConfigRejectsDuplicateProviderNames(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeConfig := func(content string) {
+		t.Helper()
+		dir := filepath.Join(home, ".config", "institutionalized")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig("providers:\n  openai_compatible:\n    - name: local\n      base_url: http://a/v1\n    - name: local\n      base_url: http://b/v1\n")
+	if _, err := config.LoadConfig(); err == nil || !strings.Contains(err.Error(), `duplicate provider name "local"`) {
+		t.Errorf("Expected the duplicate name to be rejected, got %v", err)
+	}
+
+	writeConfig("providers:\n  openai_compatible:\n    - name: ollama\n      base_url: http://a/v1\n")
+	if _, err := config.LoadConfig(); err == nil {
+		t.Error("Expected a name clashing with a built-in provider to be rejected")
+	}
+}
+
+func TestSetupProvidersSkipsDisabledCompatibleProviders(t *testing.T) {
+	for _, key := range []string{"OPENAI_API_KEY", "GEMINI_API_KEY", "CLAUDE_API_KEY"} {
+		t.Setenv(key, "")
+	}
+	cfg := config.DefaultConfig()
+	on := config.OpenAICompatibleConfig{Name: "on", BaseURL: "http://localhost:8000/v1"}
+	on.Enabled = true
+	on.Model = "local-model"
+	// The disabled entry isn't complete, which doesn't matter while it's off
+	cfg.Providers.OpenAICompatible = []config.OpenAICompatibleConfig{{Name: "off"}, on}
+
+	providers, err := setupProviders(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(providers) != 1 || providers[0].Name() != "on" {
+		t.Errorf("Expected only the enabled provider, got %d providers", len(providers))
+	}
+}
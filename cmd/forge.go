@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/bitbucket"
+	"github.com/IanKnighton/institutionalized/internal/config"
+	"github.com/IanKnighton/institutionalized/internal/gitea"
+	"github.com/IanKnighton/institutionalized/internal/gitlab"
+	"github.com/IanKnighton/institutionalized/internal/gitremote"
+)
+
+// prRemote is the remote pull requests are opened against
+const prRemote = "origin"
+
+// forge is a code hosting service that pull requests are opened on
+type forge interface {
+	// name is the service's name, e.g. "GitHub"
+	name() string
+	// prNoun is what the service calls a pull request
+	prNoun() string
+	// prRef formats a pull request number the way the service shows it
+	prRef(number int) string
+	// checkAccess makes sure pull requests can be created
+	checkAccess() error
+	// defaultBranch asks the service for the repository's default branch
+	defaultBranch() (string, error)
+	// templatePaths lists where the repository may keep its pull request
+	// template, in order of priority
+	templatePaths() []string
+	// createPR opens the pull request and returns it with its number and URL
+	createPR(pr pullRequest) (*pullRequest, error)
+	// findPR returns the open pull request from the branch head, or nil if
+	// there is none
+	findPR(head string) (*pullRequest, error)
+	// updatePR replaces the title and body of the pull request pr.number
+	updatePR(pr pullRequest) (*pullRequest, error)
+}
+
+// pullRequest is a pull request, or merge request, on any forge
+type pullRequest struct {
+	number int
+	url    string
+	title  string
+	body   string
+	// head is the branch with the changes
+	head string
+	// base is the branch the changes are merged into
+	base  string
+	draft bool
+}
+
+// findForge works out which forge the origin remote is on and how to reach
+// the repository there. The forge configured for the host, or for every
+// repository, wins over the one guessed from the host name.
+func findForge(cfg *config.Config) (forge, error) {
+	remote, err := originRemote()
+	if err != nil {
+		return nil, err
+	}
+
+	forgeType, apiURL := cfg.Forge.ForHost(remote.Host)
+	if forgeType == "" {
+		forgeType = detectForge(remote.Host)
+	}
+	switch forgeType {
+	case config.ForgeGitHub:
+		return newGitHubRepo(remote, apiURL), nil
+	case config.ForgeGitLab:
+		return newGitLabProject(remote, apiURL), nil
+	case config.ForgeBitbucket:
+		return newBitbucketCloudRepo(remote, apiURL), nil
+	case config.ForgeBitbucketDataCenter:
+		return newBitbucketServerRepo(remote, apiURL), nil
+	case config.ForgeGitea:
+		return newGiteaRepo(remote, apiURL), nil
+	}
+	return nil, fmt.Errorf("unknown forge %q configured for %s", forgeType, remote.Host)
+}
+
+// detectForge guesses the forge from the host name. Hosts that don't name a
+// forge are taken to be GitHub Enterprise Server.
+func detectForge(host string) string {
+	switch {
+	case gitlab.IsHost(host):
+		return config.ForgeGitLab
+	case bitbucket.IsCloudHost(host):
+		return config.ForgeBitbucket
+	case bitbucket.IsServerHost(host):
+		return config.ForgeBitbucketDataCenter
+	case gitea.IsHost(host):
+		return config.ForgeGitea
+	}
+	return config.ForgeGitHub
+}
+
+// originRemote parses the URL of the origin remote
+func originRemote() (gitremote.Remote, error) {
+	output, err := exec.Command("git", "remote", "get-url", prRemote).Output()
+	if err != nil {
+		return gitremote.Remote{}, fmt.Errorf("the repository has no %s remote", prRemote)
+	}
+	return gitremote.Parse(string(output))
+}
+
+// checkBranchPushed makes sure the branch is on the remote, since the pull
+// request is opened from there, and warns about commits that aren't. noun is
+// what the forge calls a pull request.
+func checkBranchPushed(branch, noun string) error {
+	if !branchExists(branch) {
+		return fmt.Errorf("branch %s hasn't been pushed to %s. Run 'git push -u %s %s' first", branch, prRemote, prRemote, branch)
+	}
+
+	output, err := exec.Command("git", "rev-list", "--count", fmt.Sprintf("refs/remotes/%s/%s..%s", prRemote, branch, branch)).Output()
+	if err != nil {
+		return nil
+	}
+	if ahead := strings.TrimSpace(string(output)); ahead != "0" {
+		fmt.Printf("⚠️  %s has %s commit(s) that aren't pushed to %s; they won't be in the %s.\n", branch, ahead, prRemote, noun)
+	}
+	return nil
+}
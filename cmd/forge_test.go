@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/IanKnighton/institutionalized/internal/config"
+)
+
+func TestDetectForge(t *testing.T) {
+	t.Setenv("GITLAB_HOST", "")
+	t.Setenv("CI_SERVER_HOST", "")
+	tests := map[string]string{
+		"github.com":            config.ForgeGitHub,
+		"ghe.example.com":       config.ForgeGitHub,
+		"gitlab.example.com":    config.ForgeGitLab,
+		"bitbucket.org":         config.ForgeBitbucket,
+		"bitbucket.example.com": config.ForgeBitbucketDataCenter,
+		"codeberg.org":          config.ForgeGitea,
+		"forgejo.example.com":   config.ForgeGitea,
+	}
+	for host, expected := range tests {
+		if got := detectForge(host); got != expected {
+			t.Errorf("detectForge(%q) = %q, expected %q", host, got, expected)
+		}
+	}
+}
+
+func TestFindForgeFromConfig(t *testing.T) {
+	inTestRepo(t, "file.txt", "one\n")
+	git(t, "remote", "add", "origin", "https://code.example.com/owner/repo.git")
+
+	var created map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/repos/owner/repo":
+			w.Write([]byte(`{"default_branch": "main"}`))
+		case "POST /api/v1/repos/owner/repo/pulls":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"number": 5, "html_url": "https://code.example.com/owner/repo/pulls/5"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("GITEA_TOKEN", "secret")
+
+	// Without settings an unknown host is taken for GitHub Enterprise
+	cfg := config.DefaultConfig()
+	if repo, err := findForge(cfg); err != nil || repo.name() != "GitHub" {
+		t.Fatalf("Expected GitHub, got %v (%v)", repo, err)
+	}
+
+	cfg.Forge.Type = config.ForgeBitbucket
+	if repo, err := findForge(cfg); err != nil || repo.name() != "Bitbucket" {
+		t.Fatalf("Expected forge.type to be used, got %v (%v)", repo, err)
+	}
+
+	// The host's own setting wins
+	cfg.Forge.Hosts = map[string]config.ForgeHost{
+		"Code.example.com": {Type: config.ForgeForgejo, APIURL: server.URL + "/api/v1"},
+	}
+	repo, err := findForge(cfg)
+	if err != nil || repo.name() != "Gitea" {
+		t.Fatalf("Expected the host's forge to be used, got %v (%v)", repo, err)
+	}
+	if branch, err := repo.defaultBranch(); branch != "main" {
+		t.Errorf("Expected the configured API URL to be used, got %q (%v)", branch, err)
+	}
+
+	pr, err := repo.createPR(pullRequest{title: "feat: x", body: "body", head: "feature", base: "main", draft: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if repo.prRef(pr.number) != "#5" || created["title"] != "WIP: feat: x" {
+		t.Errorf("Expected a work in progress pull request, got %+v from request %v", pr, created)
+	}
+
+	cfg.Forge.Hosts = map[string]config.ForgeHost{"code.example.com": {Type: "svn"}}
+	if _, err := findForge(cfg); err == nil {
+		t.Error("Expected an unknown forge to be rejected")
+	}
+}
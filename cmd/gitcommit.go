@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultSigningKey is the value of -S without a key id, which signs with
+// the key git is configured to use
+const defaultSigningKey = "default"
+
+// gitCommitOptions are the commit command's flags that are passed through to
+// git commit
+type gitCommitOptions struct {
+	amend    bool
+	all      bool
+	noVerify bool
+	// signKey is the key id for -S, defaultSigningKey for git's default key,
+	// or "" to leave signing to git's config
+	signKey string
+	author  string
+}
+
+// addGitCommitFlags registers the flags passed through to git commit
+func addGitCommitFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("amend", false, "Replace the last commit, with a message covering its changes and the staged ones")
+	cmd.Flags().BoolP("all", "a", false, "Commit all changes to tracked files, as git commit -a does")
+	cmd.Flags().Bool("no-verify", false, "Skip the pre-commit and commit-msg hooks")
+	cmd.Flags().StringP("gpg-sign", "S", "", "Sign the commit, with the given key id or git's default key (-S or -S<keyid>)")
+	cmd.Flags().Lookup("gpg-sign").NoOptDefVal = defaultSigningKey
+	cmd.Flags().String("author", "", "Override the commit author (\"Name <email>\")")
+}
+
+// newGitCommitOptions reads the flags passed through to git commit
+func newGitCommitOptions(cmd *cobra.Command) gitCommitOptions {
+	var o gitCommitOptions
+	o.amend, _ = cmd.Flags().GetBool("amend")
+	o.all, _ = cmd.Flags().GetBool("all")
+	o.noVerify, _ = cmd.Flags().GetBool("no-verify")
+	o.signKey, _ = cmd.Flags().GetString("gpg-sign")
+	o.author, _ = cmd.Flags().GetString("author")
+	return o
+}
+
+// args returns the git commit arguments for the options
+func (o gitCommitOptions) args() []string {
+	var args []string
+	if o.amend {
+		args = append(args, "--amend")
+	}
+	if o.all {
+		args = append(args, "--all")
+	}
+	if o.noVerify {
+		args = append(args, "--no-verify")
+	}
+	switch o.signKey {
+	case "":
+	case defaultSigningKey:
+		args = append(args, "--gpg-sign")
+	default:
+		args = append(args, "--gpg-sign="+o.signKey)
+	}
+	if o.author != "" {
+		args = append(args, "--author="+o.author)
+	}
+	return args
+}
+
+// changeSource returns where the changes the commit will contain come from.
+// Amending compares with the parent of HEAD, so the message covers the
+// changes of the amended commit too; --all takes the tracked files from the
+// working tree instead of the index.
+func (o gitCommitOptions) changeSource() (changeSource, error) {
+	source := changeSource{worktree: o.all}
+	if !o.amend && !o.all {
+		return source, nil
+	}
+
+	base := "HEAD"
+	if o.amend {
+		if !revisionExists("HEAD") {
+			return source, fmt.Errorf("there is no commit to amend yet")
+		}
+		base = "HEAD~1"
+	}
+	if !revisionExists(base) {
+		// The first commit is compared with an empty repository
+		output, err := exec.Command("git", "hash-object", "-t", "tree", os.DevNull).Output()
+		if err != nil {
+			return source, fmt.Errorf("failed to find the empty tree: %w", err)
+		}
+		base = strings.TrimSpace(string(output))
+	}
+	source.base = base
+	return source, nil
+}
+
+// changeSource selects the changes a commit will contain, or those of a
+// branch
+type changeSource struct {
+	// base is the revision or tree the changes are compared with; "" is
+	// HEAD, or nothing in a new repository
+	base string
+	// worktree takes tracked files from the working tree instead of the index
+	worktree bool
+	// head is the branch whose changes since its merge-base with base are
+	// shown, instead of the index or working tree
+	head string
+}
+
+// diffArgs returns the git diff arguments that show the changes
+func (s changeSource) diffArgs() []string {
+	if s.head != "" {
+		return []string{"diff", s.base + "..." + s.head}
+	}
+	args := []string{"diff"}
+	if !s.worktree {
+		args = append(args, "--cached")
+	}
+	if s.base != "" {
+		args = append(args, s.base)
+	}
+	return args
+}
+
+// revisionExists reports whether rev names a commit
+func revisionExists(rev string) bool {
+	return exec.Command("git", "rev-parse", "--verify", "--quiet", rev+"^{commit}").Run() == nil
+}
+
+// commitChanges runs git commit with the message and options. git's output,
+// such as hook failures, and prompts, such as a passphrase for signing, go
+// straight to the terminal.
+func commitChanges(message string, options gitCommitOptions) error {
+	args := append([]string{"commit", "-m", message}, options.args()...)
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/IanKnighton/institutionalized/internal/config"
+)
+
+func TestAmendCoversLastCommit(t *testing.T) {
+	inTestRepo(t, "file.txt", "one\n")
+	writeFile(t, "file.txt", "one\ntwo\n")
+	git(t, "commit", "-q", "-a", "-m", "add two")
+	writeFile(t, "file.txt", "one\ntwo\nthree\n")
+	git(t, "add", "file.txt")
+
+	options := gitCommitOptions{amend: true}
+	source, err := options.changeSource()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	changes, err := getStagedChanges(config.DefaultConfig(), source)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(changes.Diff, "+two") || !strings.Contains(changes.Diff, "+three") {
+		t.Errorf("Expected the diff to cover the amended commit and the staged change:\n%s", changes.Diff)
+	}
+
+	if err := commitChanges("feat: add two and three", options); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if log := git(t, "log", "--format=%s"); log != "feat: add two and three\ninitial" {
+		t.Errorf("Expected the last commit to be replaced, got:\n%s", log)
+	}
+}
+
+func TestAmendFirstCommit(t *testing.T) {
+	inTestRepo(t, "file.txt", "one\n")
+
+	source, err := gitCommitOptions{amend: true}.changeSource()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	changes, err := getStagedChanges(config.DefaultConfig(), source)
+	if err != nil || !strings.Contains(changes.Diff, "+one") {
+		t.Errorf("Expected the first commit to be compared with nothing, got %q (%v)", changes.Diff, err)
+	}
+}
+
+func TestCommitAll(t *testing.T) {
+	inTestRepo(t, "file.txt", "one\n")
+	writeFile(t, "file.txt", "two\n")
+	writeFile(t, "untracked.txt", "new\n")
+
+	options := gitCommitOptions{all: true}
+	source, err := options.changeSource()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	changes, err := getStagedChanges(config.DefaultConfig(), source)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if paths := changes.paths(); !slices.Equal(paths, []string{"file.txt"}) {
+		t.Errorf("Expected only the tracked file, got %q", paths)
+	}
+
+	if err := commitChanges("fix: two", options); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status := git(t, "status", "--porcelain"); status != "?? untracked.txt" {
+		t.Errorf("Expected only the untracked file to be left, got %q", status)
+	}
+}
+
+func TestGitCommitArgs(t *testing.T) {
+	options := gitCommitOptions{noVerify: true, signKey: defaultSigningKey, author: "Alex Kim <alex@example.com>"}
+	expected := []string{"--no-verify", "--gpg-sign", "--author=Alex Kim <alex@example.com>"}
+	if args := options.args(); !slices.Equal(args, expected) {
+		t.Errorf("Expected %q, got %q", expected, args)
+	}
+
+	options = gitCommitOptions{signKey: "ABC123"}
+	if args := options.args(); !slices.Equal(args, []string{"--gpg-sign=ABC123"}) {
+		t.Errorf("Expected the key id to be passed, got %q", args)
+	}
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IanKnighton/institutionalized/internal/gitea"
+	"github.com/IanKnighton/institutionalized/internal/gitremote"
+)
+
+// giteaTemplatePaths are where Gitea and Forgejo look for pull request
+// templates
+var giteaTemplatePaths = []string{
+	".forgejo/pull_request_template.md",
+	".forgejo/PULL_REQUEST_TEMPLATE.md",
+	".gitea/pull_request_template.md",
+	".gitea/PULL_REQUEST_TEMPLATE.md",
+	".github/pull_request_template.md",
+	".github/PULL_REQUEST_TEMPLATE.md",
+	"pull_request_template.md",
+	"PULL_REQUEST_TEMPLATE.md",
+}
+
+// giteaRepo is a repository on Gitea or Forgejo
+type giteaRepo struct {
+	remote gitremote.Remote
+	// client is nil if no token was found
+	client *gitea.Client
+}
+
+// newGiteaRepo looks for a token to reach the repository behind remote.
+// apiURL overrides the API's base URL if it isn't empty.
+func newGiteaRepo(remote gitremote.Remote, apiURL string) *giteaRepo {
+	if apiURL == "" {
+		apiURL = gitea.APIBaseURL(remote.Host)
+	}
+	repo := &giteaRepo{remote: remote}
+	if token := gitea.Token(remote.Host); token != "" {
+		repo.client = gitea.NewClient(apiURL, token)
+	}
+	return repo
+}
+
+// name returns "Gitea"
+func (r *giteaRepo) name() string {
+	return "Gitea"
+}
+
+// prNoun returns "pull request"
+func (r *giteaRepo) prNoun() string {
+	return "pull request"
+}
+
+// prRef formats a pull request number as "#12"
+func (r *giteaRepo) prRef(number int) string {
+	return fmt.Sprintf("#%d", number)
+}
+
+// templatePaths lists Gitea's and Forgejo's pull request template locations
+func (r *giteaRepo) templatePaths() []string {
+	return giteaTemplatePaths
+}
+
+// checkAccess makes sure there is a token
+func (r *giteaRepo) checkAccess() error {
+	if r.client == nil {
+		return fmt.Errorf("no Gitea token found for %s. Set GITEA_TOKEN or FORGEJO_TOKEN, or run 'tea login add'", r.remote.Host)
+	}
+	return nil
+}
+
+// defaultBranch asks Gitea for the repository's default branch
+func (r *giteaRepo) defaultBranch() (string, error) {
+	if err := r.checkAccess(); err != nil {
+		return "", err
+	}
+	repository, err := r.client.Repository(context.Background(), r.remote.Owner(), r.remote.Name())
+	if err != nil {
+		return "", err
+	}
+	return repository.DefaultBranch, nil
+}
+
+// createPR opens the pull request. Gitea marks drafts, which it calls work
+// in progress, by their title.
+func (r *giteaRepo) createPR(pr pullRequest) (*pullRequest, error) {
+	if err := r.checkAccess(); err != nil {
+		return nil, err
+	}
+
+	title := pr.title
+	if pr.draft {
+		title = gitea.DraftTitle(title)
+	}
+	created, err := r.client.CreatePullRequest(context.Background(), r.remote.Owner(), r.remote.Name(), gitea.NewPullRequest{
+		Title: title,
+		Body:  pr.body,
+		Head:  pr.head,
+		Base:  pr.base,
+	})
+	if err != nil {
+		return nil, err
+	}
+	pr.number, pr.url, pr.title = created.Number, created.HTMLURL, title
+	return &pr, nil
+}
+
+// findPR looks for an open pull request from head
+func (r *giteaRepo) findPR(head string) (*pullRequest, error) {
+	if err := r.checkAccess(); err != nil {
+		return nil, err
+	}
+	pulls, err := r.client.OpenPullRequests(context.Background(), r.remote.Owner(), r.remote.Name(), head)
+	if err != nil || len(pulls) == 0 {
+		return nil, err
+	}
+	pull := pulls[0]
+	return &pullRequest{
+		number: pull.Number,
+		url:    pull.HTMLURL,
+		title:  pull.Title,
+		body:   pull.Body,
+		head:   pull.Head.Ref,
+		base:   pull.Base.Ref,
+		draft:  gitea.IsDraftTitle(pull.Title),
+	}, nil
+}
+
+// updatePR replaces the pull request's title and body. Work in progress
+// keeps the title prefix that marks it.
+func (r *giteaRepo) updatePR(pr pullRequest) (*pullRequest, error) {
+	if err := r.checkAccess(); err != nil {
+		return nil, err
+	}
+
+	if pr.draft {
+		pr.title = gitea.DraftTitle(pr.title)
+	}
+	updated, err := r.client.UpdatePullRequest(context.Background(), r.remote.Owner(), r.remote.Name(), pr.number, gitea.PullRequestUpdate{
+		Title: pr.title,
+		Body:  pr.body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	pr.url = updated.HTMLURL
+	return &pr, nil
+}
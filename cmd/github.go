@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/github"
+	"github.com/IanKnighton/institutionalized/internal/gitremote"
+)
+
+// githubRepo is a repository on GitHub or GitHub Enterprise Server
+type githubRepo struct {
+	remote gitremote.Remote
+	// client is nil if no token was found; gh is used instead, if available
+	client *github.Client
+}
+
+// newGitHubRepo looks for a token to reach the repository behind remote.
+// apiURL overrides the API's base URL if it isn't empty.
+func newGitHubRepo(remote gitremote.Remote, apiURL string) *githubRepo {
+	if apiURL == "" {
+		apiURL = github.APIBaseURL(remote.Host)
+	}
+	repo := &githubRepo{remote: remote}
+	if token := github.Token(remote.Host); token != "" {
+		repo.client = github.NewClient(apiURL, token)
+	}
+	return repo
+}
+
+// name returns "GitHub"
+func (r *githubRepo) name() string {
+	return "GitHub"
+}
+
+// prNoun returns "pull request"
+func (r *githubRepo) prNoun() string {
+	return "pull request"
+}
+
+// prRef formats a pull request number as "#12"
+func (r *githubRepo) prRef(number int) string {
+	return fmt.Sprintf("#%d", number)
+}
+
+// templatePaths lists GitHub's pull request template locations
+func (r *githubRepo) templatePaths() []string {
+	return githubTemplatePaths
+}
+
+// checkAccess makes sure there is a token or an authenticated gh
+func (r *githubRepo) checkAccess() error {
+	if r.client != nil {
+		return nil
+	}
+	if isGHCliAvailable() && isGHAuthenticated(r.remote.Host) {
+		return nil
+	}
+	tokenVars := "GH_TOKEN or GITHUB_TOKEN"
+	if r.remote.Host != github.DefaultHost {
+		tokenVars = "GH_ENTERPRISE_TOKEN or GITHUB_ENTERPRISE_TOKEN"
+	}
+	return fmt.Errorf("no GitHub token found for %s. Set %s, or run 'gh auth login'", r.remote.Host, tokenVars)
+}
+
+// defaultBranch asks GitHub for the repository's default branch
+func (r *githubRepo) defaultBranch() (string, error) {
+	if r.client != nil {
+		repository, err := r.client.Repository(context.Background(), r.remote.Owner(), r.remote.Name())
+		if err != nil {
+			return "", err
+		}
+		return repository.DefaultBranch, nil
+	}
+
+	if !isGHCliAvailable() || !isGHAuthenticated(r.remote.Host) {
+		return "", fmt.Errorf("no GitHub token found")
+	}
+	cmd := exec.Command("gh", "repo", "view", r.ghRepo(), "--json", "defaultBranchRef", "--jq", ".defaultBranchRef.name")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	branch := strings.TrimSpace(string(output))
+	if branch == "" || branch == "null" {
+		return "", fmt.Errorf("gh didn't report a default branch")
+	}
+	return branch, nil
+}
+
+// createPR opens the pull request, through the API if there is a token and
+// with gh otherwise
+func (r *githubRepo) createPR(pr pullRequest) (*pullRequest, error) {
+	if r.client == nil {
+		return r.createPRWithGH(pr)
+	}
+
+	created, err := r.client.CreatePullRequest(context.Background(), r.remote.Owner(), r.remote.Name(), github.NewPullRequest{
+		Title: pr.title,
+		Body:  pr.body,
+		Head:  pr.head,
+		Base:  pr.base,
+		Draft: pr.draft,
+	})
+	if err != nil {
+		return nil, err
+	}
+	pr.number, pr.url = created.Number, created.HTMLURL
+	return &pr, nil
+}
+
+// findPR looks for an open pull request from head, through the API if there
+// is a token and with gh otherwise
+func (r *githubRepo) findPR(head string) (*pullRequest, error) {
+	if r.client == nil {
+		return r.findPRWithGH(head)
+	}
+
+	pulls, err := r.client.OpenPullRequests(context.Background(), r.remote.Owner(), r.remote.Name(), head)
+	if err != nil || len(pulls) == 0 {
+		return nil, err
+	}
+	pull := pulls[0]
+	return &pullRequest{
+		number: pull.Number,
+		url:    pull.HTMLURL,
+		title:  pull.Title,
+		body:   pull.Body,
+		head:   pull.Head.Ref,
+		base:   pull.Base.Ref,
+		draft:  pull.Draft,
+	}, nil
+}
+
+// updatePR replaces the pull request's title and body, through the API if
+// there is a token and with gh otherwise
+func (r *githubRepo) updatePR(pr pullRequest) (*pullRequest, error) {
+	if r.client == nil {
+		return r.updatePRWithGH(pr)
+	}
+
+	updated, err := r.client.UpdatePullRequest(context.Background(), r.remote.Owner(), r.remote.Name(), pr.number, github.PullRequestUpdate{
+		Title: pr.title,
+		Body:  pr.body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	pr.url = updated.HTMLURL
+	return &pr, nil
+}
+
+// ghRepo names the repository the way gh's --repo flag expects
+func (r *githubRepo) ghRepo() string {
+	return r.remote.Host + "/" + r.remote.Path
+}
+
+// pullURLPattern finds the pull request number in the URL gh prints
+var pullURLPattern = regexp.MustCompile(`https?://\S+/pull/(\d+)`)
+
+// createPRWithGH opens the pull request with gh. The body goes through stdin
+// so its size and content don't matter.
+func (r *githubRepo) createPRWithGH(pr pullRequest) (*pullRequest, error) {
+	args := []string{"pr", "create", "--repo", r.ghRepo(), "--title", pr.title, "--body-file", "-", "--base", pr.base, "--head", pr.head}
+	if pr.draft {
+		args = append(args, "--draft")
+	}
+
+	cmd := exec.Command("gh", args...)
+	cmd.Stdin = strings.NewReader(pr.body)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return nil, fmt.Errorf("gh CLI error: %s", strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("gh CLI error: %w", err)
+	}
+
+	match := pullURLPattern.FindStringSubmatch(stdout.String())
+	if match == nil {
+		return nil, fmt.Errorf("gh didn't report the pull request URL: %s", strings.TrimSpace(stdout.String()))
+	}
+	pr.number, _ = strconv.Atoi(match[1])
+	pr.url = match[0]
+	return &pr, nil
+}
+
+// findPRWithGH looks for an open pull request from head with gh
+func (r *githubRepo) findPRWithGH(head string) (*pullRequest, error) {
+	cmd := exec.Command("gh", "pr", "list", "--repo", r.ghRepo(), "--head", head, "--state", "open", "--json", "number,url,title,body,isDraft,baseRefName")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if stderr.Len() > 0 {
+			return nil, fmt.Errorf("gh CLI error: %s", strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("gh CLI error: %w", err)
+	}
+
+	var pulls []struct {
+		Number      int    `json:"number"`
+		URL         string `json:"url"`
+		Title       string `json:"title"`
+		Body        string `json:"body"`
+		IsDraft     bool   `json:"isDraft"`
+		BaseRefName string `json:"baseRefName"`
+	}
+	if err := json.Unmarshal(output, &pulls); err != nil {
+		return nil, fmt.Errorf("failed to parse gh output: %w", err)
+	}
+	if len(pulls) == 0 {
+		return nil, nil
+	}
+	pull := pulls[0]
+	return &pullRequest{
+		number: pull.Number,
+		url:    pull.URL,
+		title:  pull.Title,
+		body:   pull.Body,
+		head:   head,
+		base:   pull.BaseRefName,
+		draft:  pull.IsDraft,
+	}, nil
+}
+
+// updatePRWithGH replaces the pull request's title and body with gh. The
+// body goes through stdin, as when creating it.
+func (r *githubRepo) updatePRWithGH(pr pullRequest) (*pullRequest, error) {
+	cmd := exec.Command("gh", "pr", "edit", strconv.Itoa(pr.number), "--repo", r.ghRepo(), "--title", pr.title, "--body-file", "-")
+	cmd.Stdin = strings.NewReader(pr.body)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return nil, fmt.Errorf("gh CLI error: %s", strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("gh CLI error: %w", err)
+	}
+	return &pr, nil
+}
+
+// isGHCliAvailable checks if gh CLI is available
+func isGHCliAvailable() bool {
+	_, err := exec.LookPath("gh")
+	return err == nil
+}
+
+// isGHAuthenticated checks if gh is logged in to host
+func isGHAuthenticated(host string) bool {
+	cmd := exec.Command("gh", "auth", "status", "--hostname", host)
+	return cmd.Run() == nil
+}
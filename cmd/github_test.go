@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/IanKnighton/institutionalized/internal/config"
+	"github.com/IanKnighton/institutionalized/internal/github"
+)
+
+func TestGitHubRepoCreatesPRThroughAPI(t *testing.T) {
+	inTestRepo(t, "file.txt", "one\n")
+	git(t, "remote", "add", "origin", "git@github.com:owner/repo.git")
+	git(t, "checkout", "-q", "-b", "feature")
+
+	var created github.NewPullRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /repos/owner/repo":
+			w.Write([]byte(`{"default_branch": "trunk"}`))
+		case "POST /repos/owner/repo/pulls":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"number": 7, "html_url": "https://github.com/owner/repo/pull/7"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("GITHUB_API_URL", server.URL)
+	t.Setenv("GH_TOKEN", "secret")
+
+	repo, err := findForge(config.DefaultConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if repo.name() != "GitHub" {
+		t.Fatalf("Expected a GitHub repository, got %s", repo.name())
+	}
+	if err := repo.checkAccess(); err != nil {
+		t.Errorf("Expected the token to be enough, got %v", err)
+	}
+	if branch, err := getDefaultBranch(repo); branch != "trunk" {
+		t.Errorf("Expected the default branch from the API, got %q (%v)", branch, err)
+	}
+
+	if err := checkBranchPushed("feature", repo.prNoun()); err == nil || !strings.Contains(err.Error(), "git push -u origin feature") {
+		t.Errorf("Expected a hint to push the branch, got %v", err)
+	}
+	git(t, "update-ref", "refs/remotes/origin/feature", "HEAD")
+	if err := checkBranchPushed("feature", repo.prNoun()); err != nil {
+		t.Errorf("Expected the pushed branch to pass, got %v", err)
+	}
+
+	pr, err := repo.createPR(pullRequest{title: "feat: x", body: "body", head: "feature", base: "trunk"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pr.number != 7 || repo.prRef(pr.number) != "#7" || created.Head != "feature" || created.Base != "trunk" {
+		t.Errorf("Unexpected pull request %+v from request %+v", pr, created)
+	}
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IanKnighton/institutionalized/internal/gitlab"
+	"github.com/IanKnighton/institutionalized/internal/gitremote"
+)
+
+// gitlabTemplatePaths are where GitLab looks for the default merge request
+// template
+var gitlabTemplatePaths = []string{
+	".gitlab/merge_request_templates/Default.md",
+	".gitlab/merge_request_templates/default.md",
+}
+
+// gitlabProject is a project on gitlab.com or a self-hosted GitLab
+type gitlabProject struct {
+	remote gitremote.Remote
+	// client is nil if no token was found
+	client *gitlab.Client
+}
+
+// newGitLabProject looks for a token to reach the project behind remote.
+// apiURL overrides the API's base URL if it isn't empty.
+func newGitLabProject(remote gitremote.Remote, apiURL string) *gitlabProject {
+	if apiURL == "" {
+		apiURL = gitlab.APIBaseURL(remote.Host)
+	}
+	project := &gitlabProject{remote: remote}
+	if token := gitlab.Token(remote.Host); token != "" {
+		project.client = gitlab.NewClient(apiURL, token)
+	}
+	return project
+}
+
+// name returns "GitLab"
+func (p *gitlabProject) name() string {
+	return "GitLab"
+}
+
+// prNoun returns "merge request"
+func (p *gitlabProject) prNoun() string {
+	return "merge request"
+}
+
+// prRef formats a merge request number as "!12"
+func (p *gitlabProject) prRef(number int) string {
+	return fmt.Sprintf("!%d", number)
+}
+
+// templatePaths lists GitLab's merge request template locations
+func (p *gitlabProject) templatePaths() []string {
+	return gitlabTemplatePaths
+}
+
+// checkAccess makes sure there is a token
+func (p *gitlabProject) checkAccess() error {
+	if p.client == nil {
+		return fmt.Errorf("no GitLab token found for %s. Set GITLAB_TOKEN, or run 'glab auth login'", p.remote.Host)
+	}
+	return nil
+}
+
+// defaultBranch asks GitLab for the project's default branch
+func (p *gitlabProject) defaultBranch() (string, error) {
+	if err := p.checkAccess(); err != nil {
+		return "", err
+	}
+	project, err := p.client.Project(context.Background(), p.remote.Path)
+	if err != nil {
+		return "", err
+	}
+	return project.DefaultBranch, nil
+}
+
+// createPR opens a merge request. GitLab marks drafts by their title.
+func (p *gitlabProject) createPR(pr pullRequest) (*pullRequest, error) {
+	if err := p.checkAccess(); err != nil {
+		return nil, err
+	}
+
+	title := pr.title
+	if pr.draft {
+		title = gitlab.DraftTitle(title)
+	}
+	created, err := p.client.CreateMergeRequest(context.Background(), p.remote.Path, gitlab.NewMergeRequest{
+		Title:        title,
+		Description:  pr.body,
+		SourceBranch: pr.head,
+		TargetBranch: pr.base,
+	})
+	if err != nil {
+		return nil, err
+	}
+	pr.number, pr.url, pr.title = created.IID, created.WebURL, title
+	return &pr, nil
+}
+
+// findPR looks for an open merge request from head
+func (p *gitlabProject) findPR(head string) (*pullRequest, error) {
+	if err := p.checkAccess(); err != nil {
+		return nil, err
+	}
+	mrs, err := p.client.OpenMergeRequests(context.Background(), p.remote.Path, head)
+	if err != nil || len(mrs) == 0 {
+		return nil, err
+	}
+	mr := mrs[0]
+	return &pullRequest{
+		number: mr.IID,
+		url:    mr.WebURL,
+		title:  mr.Title,
+		body:   mr.Description,
+		head:   mr.SourceBranch,
+		base:   mr.TargetBranch,
+		draft:  mr.Draft,
+	}, nil
+}
+
+// updatePR replaces the merge request's title and description. A draft
+// keeps the title prefix that marks it.
+func (p *gitlabProject) updatePR(pr pullRequest) (*pullRequest, error) {
+	if err := p.checkAccess(); err != nil {
+		return nil, err
+	}
+
+	if pr.draft {
+		pr.title = gitlab.DraftTitle(pr.title)
+	}
+	updated, err := p.client.UpdateMergeRequest(context.Background(), p.remote.Path, pr.number, gitlab.MergeRequestUpdate{
+		Title:       pr.title,
+		Description: pr.body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	pr.url = updated.WebURL
+	return &pr, nil
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/IanKnighton/institutionalized/internal/config"
+	"github.com/IanKnighton/institutionalized/internal/gitlab"
+)
+
+func TestGitLabProjectCreatesMergeRequest(t *testing.T) {
+	inTestRepo(t, "file.txt", "one\n")
+	git(t, "remote", "add", "origin", "git@gitlab.example.com:group/sub/project.git")
+
+	var created gitlab.NewMergeRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.EscapedPath() {
+		case "GET /api/v4/projects/group%2Fsub%2Fproject":
+			w.Write([]byte(`{"default_branch": "develop"}`))
+		case "POST /api/v4/projects/group%2Fsub%2Fproject/merge_requests":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"iid": 3, "web_url": "https://gitlab.example.com/group/sub/project/-/merge_requests/3"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("GITLAB_API_URL", server.URL+"/api/v4")
+	t.Setenv("GITLAB_TOKEN", "secret")
+
+	repo, err := findForge(config.DefaultConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if repo.name() != "GitLab" || repo.prNoun() != "merge request" {
+		t.Fatalf("Expected a GitLab project, got %s", repo.name())
+	}
+	if branch, err := getDefaultBranch(repo); branch != "develop" {
+		t.Errorf("Expected the default branch from the API, got %q (%v)", branch, err)
+	}
+
+	pr, err := repo.createPR(pullRequest{title: "feat: x", body: "body", head: "feature", base: "develop", draft: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if repo.prRef(pr.number) != "!3" || created.Title != "Draft: feat: x" || created.SourceBranch != "feature" {
+		t.Errorf("Unexpected merge request %+v from request %+v", pr, created)
+	}
+}
+
+func TestGitLabTemplate(t *testing.T) {
+	inTestRepo(t, "file.txt", "one\n")
+	if err := os.MkdirAll(".gitlab/merge_request_templates", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, ".gitlab/merge_request_templates/Bug.md", "## Bug\n")
+	writeFile(t, ".gitlab/merge_request_templates/Default.md", "## What does this MR do?\n")
+
+	template, err := getPRTemplate(gitlabTemplatePaths)
+	if err != nil || template != "## What does this MR do?" {
+		t.Errorf("Expected the default merge request template, got %q (%v)", template, err)
+	}
+}
@@ -0,0 +1,336 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/IanKnighton/institutionalized/internal/config"
+	"github.com/IanKnighton/institutionalized/internal/llm"
+	"github.com/spf13/cobra"
+)
+
+// hookName is the git hook that fills in the commit message
+const hookName = "prepare-commit-msg"
+
+// hookMarker identifies hooks written by "hook install"
+const hookMarker = "# institutionalized prepare-commit-msg hook"
+
+// chainedHookSuffix is appended to the name of a hook that was installed
+// before ours; our hook runs it first
+const chainedHookSuffix = ".pre-institutionalized"
+
+var hookCmd = &cobra.Command{
+	Use:   "hook",
+	Short: "Manage the git hook that writes messages for plain git commit",
+	Long:  `Install a prepare-commit-msg git hook so that "git commit" without a message opens the editor with a generated commit message. The hook never blocks a commit: if no message can be generated in time, the editor opens as usual.`,
+}
+
+var hookInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the prepare-commit-msg hook",
+	Long:  `Install the prepare-commit-msg hook in the repository's hooks directory, which respects core.hooksPath. An existing prepare-commit-msg hook is kept and runs before the generated message is added.`,
+	Args:  cobra.NoArgs,
+	RunE:  runHookInstall,
+}
+
+var hookUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the prepare-commit-msg hook",
+	Long:  `Remove the prepare-commit-msg hook installed by "hook install" and restore the hook it replaced, if any.`,
+	Args:  cobra.NoArgs,
+	RunE:  runHookUninstall,
+}
+
+var hookStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the prepare-commit-msg hook is installed",
+	Args:  cobra.NoArgs,
+	RunE:  runHookStatus,
+}
+
+// hookRunCmd is what the installed hook calls, with git's hook arguments
+var hookRunCmd = &cobra.Command{
+	Use:    "run <message-file> [source] [commit]",
+	Short:  "Write a generated message to the commit message file (called by the hook)",
+	Args:   cobra.RangeArgs(1, 3),
+	Hidden: true,
+	RunE:   runHookRun,
+}
+
+func init() {
+	rootCmd.AddCommand(hookCmd)
+	hookCmd.AddCommand(hookInstallCmd)
+	hookCmd.AddCommand(hookUninstallCmd)
+	hookCmd.AddCommand(hookStatusCmd)
+	hookCmd.AddCommand(hookRunCmd)
+}
+
+// hookPaths returns the path of the prepare-commit-msg hook and of the hook
+// it chains to. git resolves the hooks directory, including core.hooksPath.
+func hookPaths() (hook, chained string, err error) {
+	output, err := exec.Command("git", "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return "", "", fmt.Errorf("not in a git repository")
+	}
+	dir, err := filepath.Abs(strings.TrimSpace(string(output)))
+	if err != nil {
+		return "", "", err
+	}
+	hook = filepath.Join(dir, hookName)
+	return hook, hook + chainedHookSuffix, nil
+}
+
+// isOurHook reports whether the file is a hook written by "hook install"
+func isOurHook(path string) bool {
+	content, err := os.ReadFile(path)
+	return err == nil && bytes.Contains(content, []byte(hookMarker))
+}
+
+// fileExists reports whether path exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// hookScript returns the hook, which runs a chained hook first and then asks
+// executable for a message. A failing chained hook still stops the commit,
+// but nothing we do can.
+func hookScript(executable string) string {
+	quoted := "'" + strings.ReplaceAll(executable, "'", `'\''`) + "'"
+	return `#!/bin/sh
+` + hookMarker + `
+# Installed by "institutionalized hook install"; remove it with
+# "institutionalized hook uninstall".
+
+chained="$0` + chainedHookSuffix + `"
+if [ -x "$chained" ]; then
+	"$chained" "$@" || exit $?
+fi
+
+exe=` + quoted + `
+if [ ! -x "$exe" ]; then
+	exe=$(command -v institutionalized) || exit 0
+fi
+"$exe" hook run "$@" </dev/null || true
+exit 0
+`
+}
+
+func runHookInstall(cmd *cobra.Command, args []string) error {
+	hook, chained, err := hookPaths()
+	if err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the institutionalized executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+
+	// Keep a hook that was there before, so ours can run it first
+	if fileExists(hook) && !isOurHook(hook) {
+		if fileExists(chained) {
+			return fmt.Errorf("both %s and %s exist; remove one of them first", hook, chained)
+		}
+		if err := os.Rename(hook, chained); err != nil {
+			return fmt.Errorf("failed to keep the existing hook: %w", err)
+		}
+		fmt.Printf("Kept the existing hook as %s; it runs first.\n", chained)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(hook), 0755); err != nil {
+		return fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+	if err := os.WriteFile(hook, []byte(hookScript(executable)), 0755); err != nil {
+		return fmt.Errorf("failed to write hook: %w", err)
+	}
+
+	fmt.Printf("Installed %s\n", hook)
+	fmt.Println("\"git commit\" without a message now starts with a generated one.")
+	return nil
+}
+
+func runHookUninstall(cmd *cobra.Command, args []string) error {
+	hook, chained, err := hookPaths()
+	if err != nil {
+		return err
+	}
+	if !fileExists(hook) {
+		return fmt.Errorf("no %s hook is installed", hookName)
+	}
+	if !isOurHook(hook) {
+		return fmt.Errorf("%s wasn't installed by institutionalized; leaving it alone", hook)
+	}
+
+	if err := os.Remove(hook); err != nil {
+		return fmt.Errorf("failed to remove hook: %w", err)
+	}
+	fmt.Printf("Removed %s\n", hook)
+
+	if fileExists(chained) {
+		if err := os.Rename(chained, hook); err != nil {
+			return fmt.Errorf("failed to restore the previous hook from %s: %w", chained, err)
+		}
+		fmt.Printf("Restored the previous hook.\n")
+	}
+	return nil
+}
+
+func runHookStatus(cmd *cobra.Command, args []string) error {
+	hook, chained, err := hookPaths()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Hook: %s\n", hook)
+	switch {
+	case !fileExists(hook):
+		fmt.Println("Status: not installed")
+	case !isOurHook(hook):
+		fmt.Println("Status: another prepare-commit-msg hook is installed; \"hook install\" keeps it and runs it first")
+	default:
+		fmt.Println("Status: installed")
+		if fileExists(chained) {
+			fmt.Printf("Chained hook: %s\n", chained)
+		}
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	fmt.Printf("Timeout: %d seconds\n", cfg.Hook.TimeoutSeconds())
+	return nil
+}
+
+// runHookRun fills an empty commit message with a generated one. It never
+// fails: problems are reported and the message is left to the user.
+func runHookRun(cmd *cobra.Command, args []string) error {
+	messageFile := args[0]
+	// Messages from -m, -F, templates, merges, squashes and amends are kept
+	if len(args) > 1 && args[1] != "" {
+		return nil
+	}
+
+	existing, err := os.ReadFile(messageFile)
+	if err != nil {
+		hookWarning(err)
+		return nil
+	}
+	if hasMessage(string(existing)) {
+		return nil
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		hookWarning(err)
+		return nil
+	}
+
+	// Give up after the timeout so the commit goes on without a message
+	timeout := cfg.Hook.TimeoutSeconds()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	message, err := generateHookMessage(ctx, cfg)
+	if ctx.Err() != nil {
+		hookWarning(fmt.Errorf("no message after %d seconds", timeout))
+		return nil
+	}
+	if err != nil {
+		hookWarning(err)
+		return nil
+	}
+	if message == "" {
+		return nil
+	}
+
+	// git's comments, such as the list of changes, stay below the message
+	if err := os.WriteFile(messageFile, []byte(message+"\n"+string(existing)), 0644); err != nil {
+		hookWarning(err)
+	}
+	return nil
+}
+
+// hasMessage reports whether a commit message file has text besides git's
+// comment lines
+func hasMessage(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		// A verbose commit's diff follows the scissors line
+		if strings.HasPrefix(line, "# ------------------------ >8 ------------------------") {
+			break
+		}
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			return true
+		}
+	}
+	return false
+}
+
+// generateHookMessage generates a commit message for the staged changes
+// without asking anything. It returns "" if nothing is staged. Requests to
+// the providers stop when ctx is done.
+func generateHookMessage(ctx context.Context, cfg *config.Config) (string, error) {
+	changes, err := getStagedChanges(cfg, changeSource{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get staged changes: %w", err)
+	}
+	if changes.empty() {
+		return "", nil
+	}
+
+	providers, err := setupProviders(cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to setup providers: %w", err)
+	}
+	if len(providers) == 0 {
+		return "", fmt.Errorf("no LLM providers available")
+	}
+
+	rules := commitRules(cfg)
+	refs := currentBranchIssues(cfg)
+	suggestedScope := suggestScope(cfg, rules, changes)
+	breaks := detectBreakingChanges(cfg, changes, changeSource{})
+	commitPrompt := func(diff string) string {
+		return llm.CommitMessagePromptTemplate(diff, rules, suggestedScope, breakDescriptions(breaks), cfg.UseEmoji, "")
+	}
+
+	changes.Diff, err = protectSecrets(cfg, "staged changes", changes.Diff, true)
+	if err != nil {
+		return "", err
+	}
+	manager, err := newProviderManager(cfg, providers)
+	if err != nil {
+		return "", err
+	}
+	manager.SetContext(ctx)
+	diff, err := fitDiff("staged changes", changes, manager, commitPrompt)
+	if err != nil {
+		return "", err
+	}
+
+	reply, provider, err := manager.Chat(llm.NewConversation(llm.TaskCommit, commitPrompt(diff)))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate commit message: %w", err)
+	}
+	// The hook has no flags, so only the configured trailers are added
+	messageTrailers, err := configTrailers(cfg)
+	if err != nil {
+		return "", err
+	}
+	return messageTrailers.apply(prepareCommitMessage(cfg, rules, refs, reply, cfg.UseEmoji), provider), nil
+}
+
+// hookWarning reports why no message was generated
+func hookWarning(err error) {
+	fmt.Fprintf(os.Stderr, "institutionalized: %v; write the commit message yourself\n", err)
+}
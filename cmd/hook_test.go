@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHookInstallChainsExistingHook(t *testing.T) {
+	inTestRepo(t, "file.txt", "one\n")
+	git(t, "config", "core.hooksPath", "hooks")
+	if err := os.Mkdir("hooks", 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The existing hook leaves a trace so we can tell it still runs
+	writeFile(t, "hooks/prepare-commit-msg", "#!/bin/sh\necho chained >> \"$(git rev-parse --show-toplevel)/trace\"\n")
+	os.Chmod("hooks/prepare-commit-msg", 0755)
+
+	if err := runHookInstall(nil, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	hook, chained, _ := hookPaths()
+	if !isOurHook(hook) || !fileExists(chained) {
+		t.Fatalf("Expected our hook in core.hooksPath with the old one chained, got %s", hook)
+	}
+	if filepath.Base(filepath.Dir(hook)) != "hooks" {
+		t.Errorf("Expected core.hooksPath to be used, got %s", hook)
+	}
+
+	// Installing again keeps the chained hook
+	if err := runHookInstall(nil, nil); err != nil {
+		t.Fatalf("Unexpected error reinstalling: %v", err)
+	}
+
+	// The test binary can't generate messages, so point the hook elsewhere;
+	// a missing executable must not block the commit
+	writeFile(t, hook, hookScript("/nonexistent/institutionalized"))
+	writeFile(t, "file.txt", "two\n")
+	git(t, "commit", "-q", "-a", "-m", "fix: two")
+	if trace, _ := os.ReadFile("trace"); string(trace) != "chained\n" {
+		t.Errorf("Expected the chained hook to run once, got %q", trace)
+	}
+
+	if err := runHookUninstall(nil, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if isOurHook(hook) || fileExists(chained) || !fileExists(hook) {
+		t.Error("Expected the previous hook to be restored")
+	}
+	if err := runHookUninstall(nil, nil); err == nil {
+		t.Error("Expected uninstalling a hook we didn't write to fail")
+	}
+}
+
+func TestHookRunFailsOpen(t *testing.T) {
+	inTestRepo(t, "file.txt", "one\n")
+	t.Setenv("HOME", t.TempDir())
+	for _, key := range []string{"OPENAI_API_KEY", "GEMINI_API_KEY", "CLAUDE_API_KEY"} {
+		t.Setenv(key, "")
+	}
+	writeFile(t, "file.txt", "two\n")
+	git(t, "add", "file.txt")
+
+	template := "\n# Please enter the commit message for your changes.\n"
+	writeFile(t, "MSG", template)
+
+	// Without providers the message is left to the user
+	if err := runHookRun(hookRunCmd, []string{"MSG"}); err != nil {
+		t.Errorf("Expected the hook never to fail, got %v", err)
+	}
+	// Messages given with -m are kept
+	if err := runHookRun(hookRunCmd, []string{"MSG", "message"}); err != nil {
+		t.Errorf("Expected the hook never to fail, got %v", err)
+	}
+	if content, _ := os.ReadFile("MSG"); string(content) != template {
+		t.Errorf("Expected the message file to be unchanged, got %q", content)
+	}
+}
+
+func TestHasMessage(t *testing.T) {
+	tests := map[string]bool{
+		"":                    false,
+		"\n# comment\n#\n":    false,
+		"fix: x\n# comment\n": true,
+		"# ------------------------ >8 ------------------------\n+added line\n": false,
+	}
+	for content, expected := range tests {
+		if got := hasMessage(content); got != expected {
+			t.Errorf("hasMessage(%q) = %v, expected %v", strings.TrimSpace(content), got, expected)
+		}
+	}
+}
+
+func TestHookRunTimesOutAndAddsConfiguredTrailers(t *testing.T) {
+	inTestRepo(t, "file.txt", "one\n")
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, key := range []string{"OPENAI_API_KEY", "GEMINI_API_KEY", "CLAUDE_API_KEY"} {
+		t.Setenv(key, "")
+	}
+	writeFile(t, "file.txt", "two\n")
+	git(t, "add", "file.txt")
+
+	var slow atomic.Bool
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			// Answer only after the hook has given up
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+			return
+		}
+		w.Write([]byte(`{"choices": [{"message": {"content": "feat: update file"}}]}`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	dir := filepath.Join(home, ".config", "institutionalized")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	configFile := "providers:\n  priority: local\n  delay_threshold: 10\n  openai_compatible:\n    - name: local\n      enabled: true\n      base_url: " + server.URL + "/v1\n      model: local-model\nhook:\n  timeout: 1\ntrailers:\n  add: [\"Generated-by: {provider}\"]\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(configFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	template := "\n# Please enter the commit message for your changes.\n"
+	writeFile(t, "MSG", template)
+	if err := runHookRun(hookRunCmd, []string{"MSG"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if content, _ := os.ReadFile("MSG"); string(content) != "feat: update file\n\nGenerated-by: local\n"+template {
+		t.Errorf("Expected the message with the configured trailer, got %q", content)
+	}
+
+	// After the timeout the hook returns and leaves the message to the user
+	slow.Store(true)
+	writeFile(t, "MSG", template)
+	start := time.Now()
+	if err := runHookRun(hookRunCmd, []string{"MSG"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected the hook to give up after its timeout, took %v", elapsed)
+	}
+	if content, _ := os.ReadFile("MSG"); string(content) != template {
+		t.Errorf("Expected the message file to be unchanged, got %q", content)
+	}
+}
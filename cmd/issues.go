@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/config"
+	"github.com/IanKnighton/institutionalized/internal/issues"
+)
+
+// branchIssues returns the issue references in a branch name. An invalid
+// pattern is reported as a warning, since the message can be written without
+// the references.
+func branchIssues(cfg *config.Config, branch string) []string {
+	if branch == "" {
+		return nil
+	}
+	extractor, err := issues.NewExtractor(cfg.Issues.Patterns)
+	if err != nil {
+		fmt.Printf("⚠️  Not adding issue references: %v\n", err)
+		return nil
+	}
+	return extractor.Extract(branch)
+}
+
+// currentBranchIssues returns the issue references in the name of the
+// current branch; a detached HEAD has none
+func currentBranchIssues(cfg *config.Config) []string {
+	branch, err := getCurrentBranch()
+	if err != nil {
+		return nil
+	}
+	return branchIssues(cfg, branch)
+}
+
+// addIssueReferences adds the references to a commit message as trailers,
+// a prefix of the description or both, as configured
+func addIssueReferences(cfg *config.Config, message string, refs []string) string {
+	if len(refs) == 0 {
+		return message
+	}
+	policy := cfg.Issues.CommitPolicy()
+	if policy == config.IssuesPrefix || policy == config.IssuesBoth {
+		message = issues.AddPrefix(message, refs)
+	}
+	if policy == config.IssuesTrailer || policy == config.IssuesBoth {
+		message = issues.AddTrailers(message, cfg.Issues.TrailerToken(), refs)
+	}
+	return message
+}
+
+// addClosingLines adds a line such as "Closes #456" to a pull request body
+// for each reference, unless disabled
+func addClosingLines(cfg *config.Config, body string, refs []string) string {
+	keyword := cfg.Issues.ClosingKeyword()
+	if keyword == "" || len(refs) == 0 {
+		return body
+	}
+	return issues.AddClosingLines(body, keyword, refs)
+}
+
+// printIssueReferences shows the references found in the branch name
+func printIssueReferences(refs []string) {
+	if len(refs) > 0 {
+		fmt.Printf("Issue references: %s\n", strings.Join(refs, ", "))
+	}
+}
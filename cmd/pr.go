@@ -1,13 +1,11 @@
 package cmd
 
 import (
-	"bufio"
-	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
-	"time"
 
 	"github.com/IanKnighton/institutionalized/internal/config"
 	"github.com/IanKnighton/institutionalized/internal/llm"
@@ -16,9 +14,11 @@ import (
 
 var prCmd = &cobra.Command{
 	Use:   "pr",
-	Short: "Create a pull request using GitHub CLI",
-	Long:  `Create a pull request that documents the scope of changes made, testing added, and features completed. Uses GitHub CLI (gh) to create the PR.`,
-	RunE:  runPR,
+	Short: "Create a pull request on GitHub, GitLab, Bitbucket or Gitea",
+	Long: `Create a pull request that documents the scope of changes made, testing added, and features completed. The forge is worked out from the origin remote's host, or set with forge.type and forge.hosts in the config. On GitHub the PR is created through the API with a token from GH_TOKEN, GITHUB_TOKEN or GitHub CLI's login, and GitHub CLI (gh) is used if no token is found. On GitLab, including self-hosted instances, a merge request is created with a token from GITLAB_TOKEN or glab's login. Bitbucket Cloud and Data Center use BITBUCKET_TOKEN, or BITBUCKET_USERNAME with an app password or password, and Gitea and Forgejo use GITEA_TOKEN, FORGEJO_TOKEN or tea's login.
+
+If the branch already has an open pull request, its title and description are regenerated from every commit on the branch and updated instead, after showing what changes. Parts of the description between <!-- keep --> and <!-- /keep --> markers are kept.`,
+	RunE: runPR,
 }
 
 func init() {
@@ -27,6 +27,9 @@ func init() {
 	prCmd.Flags().Bool("dry-run", false, "Show what would be done without creating the PR")
 	prCmd.Flags().BoolP("yes", "y", false, "Skip confirmation prompt and create PR immediately")
 	prCmd.Flags().StringP("context", "c", "", "Additional context to include in the PR generation")
+	prCmd.Flags().String("input", prInputBoth, "What the PR description is generated from: commits, diff or both")
+	prCmd.Flags().Bool("update", false, "Update the branch's open PR, failing if there is none")
+	prCmd.Flags().Bool("keep-sections", true, "Keep the parts of an updated PR's description marked with <!-- keep --> and <!-- /keep -->")
 }
 
 func runPR(cmd *cobra.Command, args []string) error {
@@ -35,30 +38,45 @@ func runPR(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("not in a git repository")
 	}
 
-	// Check if gh CLI is available
-	if !isGHCliAvailable() {
-		return fmt.Errorf("GitHub CLI (gh) is not available. Please install it from https://cli.github.com/")
-	}
-
 	// Check for dry-run mode early - we don't need auth for dry-run
 	isDryRun, _ := cmd.Flags().GetBool("dry-run")
 
-	// Check if user is authenticated with gh (skip for dry-run)
-	if !isDryRun && !isGHAuthenticated() {
-		return fmt.Errorf("not authenticated with GitHub CLI. Run 'gh auth login' to authenticate")
+	input, _ := cmd.Flags().GetString("input")
+	if !validPRInput(input) {
+		return fmt.Errorf("invalid --input %q: must be commits, diff or both", input)
+	}
+
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Find the forge hosting the repository and a way to reach it (skip for
+	// dry-run)
+	repo, err := findForge(cfg)
+	if err != nil && !isDryRun {
+		return fmt.Errorf("failed to find the repository's forge: %w", err)
+	}
+	if !isDryRun {
+		if err := repo.checkAccess(); err != nil {
+			return err
+		}
+	}
+	templatePaths := githubTemplatePaths
+	if repo != nil {
+		templatePaths = repo.templatePaths()
 	}
 
 	// Get context flag value
 	contextText, _ := cmd.Flags().GetString("context")
 	// If context flag is present but empty, prompt user for input
 	if cmd.Flags().Changed("context") && contextText == "" {
-		fmt.Print("Please enter additional context: ")
-		reader := bufio.NewReader(os.Stdin)
-		input, err := reader.ReadString('\n')
+		input, err := readLine("Please enter additional context: ")
 		if err != nil {
 			return fmt.Errorf("failed to read context input: %w", err)
 		}
-		contextText = strings.TrimSpace(input)
+		contextText = input
 	}
 
 	// Get current branch
@@ -68,7 +86,7 @@ func runPR(cmd *cobra.Command, args []string) error {
 	}
 
 	// Get default branch
-	defaultBranch, err := getDefaultBranch()
+	defaultBranch, err := getDefaultBranch(repo)
 	if err != nil {
 		return fmt.Errorf("failed to get default branch: %w", err)
 	}
@@ -78,94 +96,118 @@ func runPR(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("cannot create PR from default branch (%s). Please create a feature branch first", defaultBranch)
 	}
 
-	// Show user what we're about to do
-	fmt.Printf("🔄 Creating PR: %s -> %s\n", currentBranch, defaultBranch)
-
-	// Load configuration
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
+	// The pull request is opened from the pushed branch
+	if !isDryRun {
+		if err := checkBranchPushed(currentBranch, repo.prNoun()); err != nil {
+			return err
+		}
 	}
 
-	// Generate PR title and body
-	prTitle, prBody, err := generatePRContent(currentBranch, defaultBranch, cfg, isDryRun, contextText)
-	if err != nil {
-		return fmt.Errorf("failed to generate PR content: %w", err)
+	// A branch with an open pull request gets that pull request updated,
+	// regenerated from every commit since its base (skip for dry-run)
+	var update *prUpdate
+	if !isDryRun {
+		existing, err := repo.findPR(currentBranch)
+		if err != nil {
+			return fmt.Errorf("failed to look for an open %s: %w", repo.prNoun(), err)
+		}
+		if existing != nil {
+			// Bodies edited in a browser come back with CRLF line endings
+			existing.body = strings.ReplaceAll(existing.body, "\r\n", "\n")
+			keepSections, _ := cmd.Flags().GetBool("keep-sections")
+			update = &prUpdate{current: existing, keepSections: keepSections}
+			defaultBranch = existing.base
+		} else if mustUpdate, _ := cmd.Flags().GetBool("update"); mustUpdate {
+			return fmt.Errorf("branch %s has no open %s to update", currentBranch, repo.prNoun())
+		}
 	}
 
-	// Check for dry-run mode
-	if isDryRun {
-		fmt.Printf("📋 PR Preview (dry-run mode)\n")
-		fmt.Printf("=====================================\n")
-		fmt.Printf("Title: %s\n", prTitle)
-		fmt.Printf("Base: %s\n", defaultBranch)
-		fmt.Printf("Head: %s\n", currentBranch)
-		isDraft, _ := cmd.Flags().GetBool("draft")
-		if isDraft {
-			fmt.Printf("Draft: Yes\n")
-		} else {
-			fmt.Printf("Draft: No\n")
-		}
-		fmt.Printf("\nBody:\n%s\n", prBody)
-		fmt.Printf("=====================================\n")
-		fmt.Printf("✅ Dry-run completed. Use 'institutionalized pr' to create the actual PR.\n")
-		return nil
+	// Show user what we're about to do
+	if update != nil {
+		fmt.Printf("🔄 Updating %s %s: %s -> %s\n", repo.prNoun(), repo.prRef(update.current.number), currentBranch, defaultBranch)
+	} else {
+		fmt.Printf("🔄 Creating PR: %s -> %s\n", currentBranch, defaultBranch)
 	}
 
 	// Check for draft flag
 	isDraft, _ := cmd.Flags().GetBool("draft")
 
-	// Check for yes flag to skip confirmation
+	// Generate PR title and body, letting the user review them unless the
+	// --yes flag is provided
 	skipConfirmation, _ := cmd.Flags().GetBool("yes")
-
-	// Show PR preview and ask for confirmation unless --yes flag is provided
-	if !skipConfirmation {
-		fmt.Printf("📋 PR Preview\n")
-		fmt.Printf("=====================================\n")
-		fmt.Printf("Title: %s\n", prTitle)
-		fmt.Printf("Base: %s\n", defaultBranch)
-		fmt.Printf("Head: %s\n", currentBranch)
-		if isDraft {
-			fmt.Printf("Draft: Yes\n")
+	prTitle, prBody, err := generatePRContent(currentBranch, defaultBranch, templatePaths, cfg, isDryRun, contextText, skipConfirmation, isDraft, input, update)
+	if errors.Is(err, errReviewCancelled) {
+		if update != nil {
+			fmt.Println("Pull request update cancelled.")
 		} else {
-			fmt.Printf("Draft: No\n")
-		}
-		fmt.Printf("\nBody:\n%s\n", prBody)
-		fmt.Printf("=====================================\n")
-
-		// Ask for user confirmation
-		if !askForConfirmation("Do you want to create this pull request?") {
 			fmt.Println("Pull request creation cancelled.")
-			return nil
 		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to generate PR content: %w", err)
+	}
+
+	// Check for dry-run mode
+	if isDryRun {
+		printPRPreview("📋 PR Preview (dry-run mode)", prTitle, prBody, currentBranch, defaultBranch, isDraft)
+		fmt.Printf("✅ Dry-run completed. Use 'institutionalized pr' to create the actual PR.\n")
+		return nil
+	}
+
+	if update != nil {
+		return updatePR(repo, update.current, prTitle, prBody)
 	}
 
 	// Create the PR
-	if err := createPR(prTitle, prBody, currentBranch, defaultBranch, isDraft); err != nil {
-		return fmt.Errorf("failed to create pull request: %w", err)
+	pr, err := repo.createPR(pullRequest{
+		title: prTitle,
+		body:  prBody,
+		head:  currentBranch,
+		base:  defaultBranch,
+		draft: isDraft,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", repo.prNoun(), err)
 	}
 
-	fmt.Printf("✅ Pull request created successfully!\n")
+	fmt.Printf("✅ Created %s %s: %s\n", repo.prNoun(), repo.prRef(pr.number), pr.url)
 	return nil
 }
 
-// isGHCliAvailable checks if gh CLI is available
-func isGHCliAvailable() bool {
-	_, err := exec.LookPath("gh")
-	return err == nil
-}
+// updatePR replaces the title and body of the open pull request current,
+// unless they are already up to date
+func updatePR(repo forge, current *pullRequest, title, body string) error {
+	if title == current.title && body == current.body {
+		fmt.Printf("✅ Nothing to update; %s %s is already up to date: %s\n", repo.prNoun(), repo.prRef(current.number), current.url)
+		return nil
+	}
 
-// isGHAuthenticated checks if user is authenticated with GitHub CLI
-func isGHAuthenticated() bool {
-	// Check if GH_TOKEN is set (GitHub Actions environment)
-	if os.Getenv("GH_TOKEN") != "" {
-		return true
+	pr := *current
+	pr.title, pr.body = title, body
+	updated, err := repo.updatePR(pr)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", repo.prNoun(), err)
 	}
 
-	// Check normal gh auth status
-	cmd := exec.Command("gh", "auth", "status")
-	err := cmd.Run()
-	return err == nil
+	fmt.Printf("✅ Updated %s %s: %s\n", repo.prNoun(), repo.prRef(updated.number), updated.url)
+	return nil
+}
+
+// printPRPreview shows the pull request that would be created
+func printPRPreview(heading, title, body, currentBranch, defaultBranch string, isDraft bool) {
+	fmt.Printf("%s\n", heading)
+	fmt.Printf("=====================================\n")
+	fmt.Printf("Title: %s\n", title)
+	fmt.Printf("Base: %s\n", defaultBranch)
+	fmt.Printf("Head: %s\n", currentBranch)
+	if isDraft {
+		fmt.Printf("Draft: Yes\n")
+	} else {
+		fmt.Printf("Draft: No\n")
+	}
+	fmt.Printf("\nBody:\n%s\n", body)
+	fmt.Printf("=====================================\n")
 }
 
 // getCurrentBranch returns the current git branch
@@ -178,8 +220,9 @@ func getCurrentBranch() (string, error) {
 	return strings.TrimSpace(string(output)), nil
 }
 
-// getDefaultBranch returns the default branch of the repository
-func getDefaultBranch() (string, error) {
+// getDefaultBranch returns the default branch of the repository. repo may be
+// nil if the forge isn't known.
+func getDefaultBranch(repo forge) (string, error) {
 	// Try to get from symbolic ref first
 	cmd := exec.Command("git", "symbolic-ref", "refs/remotes/origin/HEAD")
 	output, err := cmd.Output()
@@ -192,15 +235,10 @@ func getDefaultBranch() (string, error) {
 		}
 	}
 
-	// Try using gh CLI to get default branch if authenticated
-	if isGHAuthenticated() {
-		cmd := exec.Command("gh", "repo", "view", "--json", "defaultBranchRef", "--jq", ".defaultBranchRef.name")
-		output, err := cmd.Output()
-		if err == nil {
-			branch := strings.TrimSpace(string(output))
-			if branch != "" && branch != "null" {
-				return branch, nil
-			}
+	// Ask the forge
+	if repo != nil {
+		if branch, err := repo.defaultBranch(); err == nil && branch != "" {
+			return branch, nil
 		}
 	}
 
@@ -221,16 +259,16 @@ func branchExists(branch string) bool {
 	return cmd.Run() == nil
 }
 
-// getPRTemplate looks for pull_request_template.md in the .github directory
-func getPRTemplate() (string, error) {
-	// Common locations for PR templates
-	templatePaths := []string{
-		".github/pull_request_template.md",
-		".github/PULL_REQUEST_TEMPLATE.md",
-		".github/PULL_REQUEST_TEMPLATE/pull_request_template.md",
-		"docs/pull_request_template.md",
-	}
+// githubTemplatePaths are the common locations for GitHub PR templates
+var githubTemplatePaths = []string{
+	".github/pull_request_template.md",
+	".github/PULL_REQUEST_TEMPLATE.md",
+	".github/PULL_REQUEST_TEMPLATE/pull_request_template.md",
+	"docs/pull_request_template.md",
+}
 
+// getPRTemplate returns the first PR template found at templatePaths
+func getPRTemplate(templatePaths []string) (string, error) {
 	for _, templatePath := range templatePaths {
 		if _, err := os.Stat(templatePath); err == nil {
 			content, err := os.ReadFile(templatePath)
@@ -245,32 +283,38 @@ func getPRTemplate() (string, error) {
 	return "", nil
 }
 
-// generatePRContent generates the PR title and body using LLM providers
-func generatePRContent(currentBranch, defaultBranch string, cfg *config.Config, isDryRun bool, contextText string) (string, string, error) {
-	// First, try to get commits between default branch and current branch
-	cmd := exec.Command("git", "log", fmt.Sprintf("%s..%s", defaultBranch, currentBranch), "--oneline")
-	output, err := cmd.Output()
-
-	// If that fails, try getting recent commits from current branch
+// generatePRContent generates the PR title and body using LLM providers and
+// lets the user review them. With the best-of strategy the user first picks
+// one of the generated versions. If skipReview is set the first version is
+// used as is. input chooses whether the commits, the diff or both are sent.
+// update is the open pull request being regenerated, if any; the review then
+// shows how it changes.
+func generatePRContent(currentBranch, defaultBranch string, templatePaths []string, cfg *config.Config, isDryRun bool, contextText string, skipReview bool, isDraft bool, input string, update *prUpdate) (string, string, error) {
+	// The commits and, depending on input, the diff of the branch since it
+	// forked from the base branch on the remote
+	changes, err := getBranchChanges(cfg, prBaseRef(defaultBranch), currentBranch, input)
 	if err != nil {
-		cmd = exec.Command("git", "log", "--oneline", "-10", currentBranch)
-		output, err = cmd.Output()
-		if err != nil {
-			return "", "", fmt.Errorf("failed to get commits: %w", err)
-		}
-	}
-
-	commits := strings.TrimSpace(string(output))
-	if commits == "" {
-		return "", "", fmt.Errorf("no commits found on branch %s", currentBranch)
+		return "", "", err
 	}
+	commits := changes.subjects
 
 	// Get PR template if available
-	prTemplate, err := getPRTemplate()
+	prTemplate, err := getPRTemplate(templatePaths)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to get PR template: %w", err)
 	}
 
+	// Issues named in the branch are closed by the PR, and an update keeps
+	// the marked sections of the current body
+	refs := branchIssues(cfg, currentBranch)
+	finishBody := func(body string) string {
+		body = addClosingLines(cfg, body, refs)
+		if update != nil {
+			body = update.finishBody(body)
+		}
+		return body
+	}
+
 	// For dry-run mode, use a simple template without requiring API keys
 	if isDryRun {
 		// Generate PR title from the first commit or branch name
@@ -329,7 +373,18 @@ This pull request includes changes from the **%s** branch.
 *This PR preview was created by institutionalized (dry-run mode)*`, currentBranch, commits, currentBranch, defaultBranch)
 		}
 
-		return prTitle, prBody, nil
+		return prTitle, finishBody(prBody), nil
+	}
+
+	// Nothing leaves the machine until it has been checked for secrets;
+	// commit messages can quote them too
+	changes.commits, err = protectSecrets(cfg, "commit messages", changes.commits, false)
+	if err != nil {
+		return "", "", err
+	}
+	changes.diff.Diff, err = protectSecrets(cfg, "branch changes", changes.diff.Diff, true)
+	if err != nil {
+		return "", "", err
 	}
 
 	// Setup providers based on configuration and available API keys
@@ -339,55 +394,99 @@ This pull request includes changes from the **%s** branch.
 	}
 
 	if len(providers) == 0 {
-		return "", "", fmt.Errorf("no LLM providers available. Please set OPENAI_API_KEY, GEMINI_API_KEY, or CLAUDE_API_KEY environment variable")
+		return "", "", fmt.Errorf("no LLM providers available. Please set OPENAI_API_KEY, GEMINI_API_KEY, or CLAUDE_API_KEY environment variable, or enable Ollama with 'institutionalized config set providers.ollama.enabled true'")
 	}
 
 	// Determine if emoji should be used
 	useEmoji := cfg.UseEmoji
 
 	// Create provider manager with configured delay threshold
-	delayThreshold := time.Duration(cfg.Providers.DelayThreshold) * time.Second
-	manager := llm.NewProviderManager(providers, delayThreshold)
-
-	// Generate PR content using available providers
-	prTitle, prBody, providerUsed, err := manager.GeneratePRContent(commits, currentBranch, defaultBranch, useEmoji, prTemplate, contextText)
+	manager, err := newProviderManager(cfg, providers)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to generate PR content using %s: %w", providerUsed, err)
+		return "", "", err
 	}
 
-	fmt.Printf("✨ PR content generated using %s\n", providerUsed)
-
-	return prTitle, prBody, nil
-}
-
-// createPR creates the pull request using gh CLI
-func createPR(title, body, currentBranch, baseBranch string, isDraft bool) error {
-	args := []string{"pr", "create", "--title", title, "--body", body, "--base", baseBranch}
-
-	if isDraft {
-		args = append(args, "--draft")
+	prompt := func(diff string) string {
+		return llm.PRContentPromptTemplate(changes.prompt(diff), currentBranch, defaultBranch, prTemplate, useEmoji, contextText)
 	}
 
-	cmd := exec.Command("gh", args...)
+	// Diffs too large for the providers' context windows are cut down, with
+	// the files that don't fit summarized separately
+	diff := ""
+	if input != prInputCommits && !changes.diff.empty() {
+		diff, err = fitDiff("branch changes", changes.diff, manager, prompt)
+		if err != nil {
+			return "", "", err
+		}
+	}
 
-	// Capture both stdout and stderr for better error reporting
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	conversation := llm.NewConversation(llm.TaskPR, prompt(diff))
+	review := newReviewer(manager, conversation)
+	review.kind = "pull request"
+	review.heading = "✍️  Generating PR content with %s..."
+	review.editPattern = "institutionalized-*.md"
+	review.parse = func(reply string) (string, error) {
+		title, body, err := llm.ParsePRResponse(reply)
+		if err != nil {
+			return "", err
+		}
+		return joinPRContent(title, finishBody(body)), nil
+	}
+	review.format = func(content string) string {
+		return llm.FormatPRResponse(splitPRContent(content))
+	}
+	review.show = func(content, provider string, streamed bool) {
+		title, body := splitPRContent(content)
+		fmt.Printf("✨ PR content generated using %s\n", provider)
+		if update != nil {
+			printPRChanges("📋 PR Update", update.current, title, body)
+			return
+		}
+		printPRPreview("📋 PR Preview", title, body, currentBranch, defaultBranch, isDraft)
+	}
 
-	err := cmd.Run()
-	if err != nil {
-		// Show the actual error from gh CLI
-		if stderr.Len() > 0 {
-			return fmt.Errorf("gh CLI error: %s", stderr.String())
+	var content, providerUsed string
+	if manager.Strategy() == llm.StrategyBestOf {
+		// Ask every provider and let the user pick one of the descriptions
+		content, providerUsed, err = review.choose(func(content, provider string) string {
+			title, body := splitPRContent(content)
+			return fmt.Sprintf("Generated by %s:\nTitle: %s\n\n%s", provider, title, body)
+		}, skipReview)
+		if err != nil {
+			return "", "", err
+		}
+	} else {
+		// Generate PR content using available providers, showing the response
+		// as it is written when running in a terminal
+		content, providerUsed, _, err = review.generate()
+		if err != nil {
+			return "", "", err
 		}
-		return fmt.Errorf("failed to create PR: %w", err)
 	}
 
-	// Show success output
-	if stdout.Len() > 0 {
-		fmt.Print(stdout.String())
+	if skipReview {
+		fmt.Printf("✨ PR content generated using %s\n", providerUsed)
+	} else {
+		// Let the user accept, edit, regenerate or refine the PR
+		content, _, err = review.review(content, providerUsed, false)
+		if err != nil {
+			return "", "", err
+		}
 	}
 
-	return nil
+	prTitle, prBody := splitPRContent(content)
+	return prTitle, prBody, nil
+}
+
+// joinPRContent puts a PR title and body into one text, title first, as
+// shown in the editor
+func joinPRContent(title, body string) string {
+	return title + "\n\n" + body
+}
+
+// splitPRContent splits text written by joinPRContent, or edited by the
+// user, into a title and body
+func splitPRContent(content string) (string, string) {
+	title, body, _ := strings.Cut(strings.TrimSpace(content), "\n")
+	return strings.TrimSpace(title), strings.TrimSpace(body)
 }
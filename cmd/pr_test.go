@@ -17,7 +17,7 @@ func TestGetPRTemplate(t *testing.T) {
 	os.Chdir(tempDir)
 
 	// Test 1: No template file exists
-	template, err := getPRTemplate()
+	template, err := getPRTemplate(githubTemplatePaths)
 	if err != nil {
 		t.Errorf("Expected no error when no template exists, got: %v", err)
 	}
@@ -36,7 +36,7 @@ func TestGetPRTemplate(t *testing.T) {
 		t.Fatalf("Failed to create test template file: %v", err)
 	}
 
-	template, err = getPRTemplate()
+	template, err = getPRTemplate(githubTemplatePaths)
 	if err != nil {
 		t.Errorf("Expected no error when template exists, got: %v", err)
 	}
@@ -52,7 +52,7 @@ func TestGetPRTemplate(t *testing.T) {
 		t.Fatalf("Failed to create uppercase template file: %v", err)
 	}
 
-	template, err = getPRTemplate()
+	template, err = getPRTemplate(githubTemplatePaths)
 	if err != nil {
 		t.Errorf("Expected no error when uppercase template exists, got: %v", err)
 	}
@@ -66,7 +66,7 @@ func TestGetPRTemplate(t *testing.T) {
 		t.Fatalf("Failed to create lowercase template file: %v", err)
 	}
 
-	template, err = getPRTemplate()
+	template, err = getPRTemplate(githubTemplatePaths)
 	if err != nil {
 		t.Errorf("Expected no error, got: %v", err)
 	}
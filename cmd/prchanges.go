@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/config"
+	"github.com/IanKnighton/institutionalized/internal/llm"
+)
+
+// What pull request descriptions are generated from, chosen with --input
+const (
+	prInputCommits = "commits"
+	prInputDiff    = "diff"
+	prInputBoth    = "both"
+)
+
+// validPRInput reports whether input is one of the --input modes
+func validPRInput(input string) bool {
+	return input == prInputCommits || input == prInputDiff || input == prInputBoth
+}
+
+// branchChanges is what a branch changes compared with the branch it is
+// merged into
+type branchChanges struct {
+	// subjects lists the commits one per line, for dry-run previews
+	subjects string
+	// commits holds the full commit messages, oldest first; empty for the
+	// diff mode
+	commits string
+	// stat is the diffstat and files the list of changed files; both are
+	// empty for the commits mode
+	stat  string
+	files string
+	// diff is the diff since the merge-base, leaving out excluded files
+	diff stagedChanges
+}
+
+// prompt returns the changes as given to the prompt, with diff in place of
+// the full diff
+func (c branchChanges) prompt(diff string) llm.PRChanges {
+	return llm.PRChanges{Commits: c.commits, Stat: c.stat, Files: c.files, Diff: diff}
+}
+
+// prBaseRef returns the ref the branch is compared with: the base branch on
+// the remote if it has been fetched, since that is what the pull request is
+// merged into, and the local branch otherwise
+func prBaseRef(base string) string {
+	if branchExists(base) {
+		return prRemote + "/" + base
+	}
+	return base
+}
+
+// getBranchChanges collects the commits of head that aren't on base and,
+// unless input is "commits", the changes since their merge-base. If base
+// can't be compared with head, the last commits of head are described
+// instead.
+func getBranchChanges(cfg *config.Config, base, head, input string) (branchChanges, error) {
+	logRange := []string{base + ".." + head}
+	subjects, err := exec.Command("git", append([]string{"log", "--oneline"}, logRange...)...).Output()
+	comparable := err == nil
+	if !comparable {
+		logRange = []string{"-10", head}
+		subjects, err = exec.Command("git", append([]string{"log", "--oneline"}, logRange...)...).Output()
+		if err != nil {
+			return branchChanges{}, fmt.Errorf("failed to get commits: %w", err)
+		}
+	}
+
+	changes := branchChanges{subjects: strings.TrimSpace(string(subjects))}
+	if changes.subjects == "" {
+		return branchChanges{}, fmt.Errorf("no commits found on branch %s", head)
+	}
+
+	if input != prInputCommits && !comparable {
+		fmt.Printf("⚠️  %s can't be compared with %s; describing the commits only.\n", head, base)
+		input = prInputCommits
+	}
+
+	if input != prInputDiff {
+		output, err := exec.Command("git", append([]string{"log", "--reverse", "--format=commit %h%n%B"}, logRange...)...).Output()
+		if err != nil {
+			return branchChanges{}, fmt.Errorf("failed to get commit messages: %w", err)
+		}
+		changes.commits = strings.TrimSpace(string(output))
+	}
+	if input == prInputCommits {
+		return changes, nil
+	}
+
+	source := changeSource{base: base, head: head}
+	stat, err := exec.Command("git", append(source.diffArgs(), "--stat")...).Output()
+	if err != nil {
+		return branchChanges{}, fmt.Errorf("failed to get diffstat: %w", err)
+	}
+	changes.stat = strings.TrimRight(string(stat), "\n")
+
+	nameStatus, err := exec.Command("git", append(source.diffArgs(), "--name-status", "-z")...).Output()
+	if err != nil {
+		return branchChanges{}, fmt.Errorf("failed to list changed files: %w", err)
+	}
+	changes.files = formatNameStatus(string(nameStatus))
+
+	changes.diff, err = getStagedChanges(cfg, source)
+	if err != nil {
+		return branchChanges{}, fmt.Errorf("failed to get diff: %w", err)
+	}
+	return changes, nil
+}
+
+// fileStatuses names the status letters of git diff --name-status
+var fileStatuses = map[byte]string{
+	'A': "added",
+	'C': "copied",
+	'D': "deleted",
+	'M': "modified",
+	'R': "renamed",
+	'T': "type changed",
+}
+
+// formatNameStatus lists the files in the output of git diff --name-status
+// -z, one per line with how it changed
+func formatNameStatus(output string) string {
+	fields := strings.Split(strings.TrimSuffix(output, "\x00"), "\x00")
+	var b strings.Builder
+	for i := 0; i+1 < len(fields); i += 2 {
+		status, path := fields[i], fields[i+1]
+		if status == "" {
+			continue
+		}
+		name, ok := fileStatuses[status[0]]
+		if !ok {
+			name = "changed"
+		}
+		// Renames and copies are followed by the old and the new path
+		if (status[0] == 'R' || status[0] == 'C') && i+2 < len(fields) {
+			path = fmt.Sprintf("%s → %s", path, fields[i+2])
+			i++
+		}
+		fmt.Fprintf(&b, "- %s: %s\n", name, path)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/IanKnighton/institutionalized/internal/config"
+)
+
+func TestGetBranchChanges(t *testing.T) {
+	inTestRepo(t, "file.txt", "one\n")
+	git(t, "branch", "-M", "main")
+	writeFile(t, "old.txt", "old\n")
+	git(t, "add", "old.txt")
+	git(t, "commit", "-q", "-m", "add old")
+
+	git(t, "checkout", "-q", "-b", "feature")
+	writeFile(t, "file.txt", "one\ntwo\n")
+	git(t, "mv", "old.txt", "renamed.txt")
+	git(t, "commit", "-q", "-a", "-m", "feat: add two", "-m", "Two is needed for the report.")
+	writeFile(t, "package-lock.json", "{}\n")
+	git(t, "add", "package-lock.json")
+	git(t, "commit", "-q", "-m", "chore: lock")
+
+	// Changes on main after the branch forked aren't part of the branch
+	git(t, "checkout", "-q", "main")
+	writeFile(t, "main.txt", "later\n")
+	git(t, "add", "main.txt")
+	git(t, "commit", "-q", "-m", "later on main")
+	git(t, "checkout", "-q", "feature")
+
+	cfg := config.DefaultConfig()
+	changes, err := getBranchChanges(cfg, "main", "feature", prInputBoth)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(changes.commits, "feat: add two\n\nTwo is needed for the report.") || strings.Index(changes.commits, "add two") > strings.Index(changes.commits, "lock") {
+		t.Errorf("Expected the full messages, oldest first:\n%s", changes.commits)
+	}
+	if strings.Contains(changes.stat, "main.txt") || !strings.Contains(changes.stat, "3 files changed") {
+		t.Errorf("Expected the diffstat since the merge-base:\n%s", changes.stat)
+	}
+	expectedFiles := "- modified: file.txt\n- added: package-lock.json\n- renamed: old.txt → renamed.txt"
+	if changes.files != expectedFiles {
+		t.Errorf("Expected files:\n%s\ngot:\n%s", expectedFiles, changes.files)
+	}
+	if !strings.Contains(changes.diff.Diff, "+two") || strings.Contains(changes.diff.Diff, "main.txt") {
+		t.Errorf("Expected the diff since the merge-base:\n%s", changes.diff.Diff)
+	}
+	if len(changes.diff.Excluded) != 1 || changes.diff.Excluded[0].Path != "package-lock.json" {
+		t.Errorf("Expected the lockfile to be excluded, got %v", changes.diff.Excluded)
+	}
+
+	changes, err = getBranchChanges(cfg, "main", "feature", prInputCommits)
+	if err != nil || changes.commits == "" || changes.stat != "" || changes.diff.Diff != "" {
+		t.Errorf("Expected only the commits, got %+v (%v)", changes, err)
+	}
+	changes, err = getBranchChanges(cfg, "main", "feature", prInputDiff)
+	if err != nil || changes.commits != "" || changes.diff.Diff == "" {
+		t.Errorf("Expected only the diff, got %+v (%v)", changes, err)
+	}
+
+	// Without a base to compare with, the last commits are described
+	changes, err = getBranchChanges(cfg, "missing", "feature", prInputDiff)
+	if err != nil || !strings.Contains(changes.commits, "feat: add two") || changes.diff.Diff != "" {
+		t.Errorf("Expected the commits only, got %+v (%v)", changes, err)
+	}
+
+	git(t, "checkout", "-q", "-b", "empty", "main")
+	if _, err := getBranchChanges(cfg, "main", "empty", prInputBoth); err == nil {
+		t.Error("Expected a branch without commits to be rejected")
+	}
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Markers around parts of a pull request body that people wrote by hand.
+// Updates carry them over into the regenerated body.
+const (
+	keepStartMarker = "<!-- keep -->"
+	keepEndMarker   = "<!-- /keep -->"
+)
+
+// prUpdate is an open pull request whose title and body are regenerated
+type prUpdate struct {
+	current *pullRequest
+	// keepSections carries the marked sections of the current body over
+	keepSections bool
+}
+
+// finishBody adds the sections kept from the current body to a generated
+// body
+func (u *prUpdate) finishBody(body string) string {
+	if !u.keepSections {
+		return body
+	}
+	return preserveSections(u.current.body, body)
+}
+
+// keptSections returns the sections of body between keep markers, markers
+// included. A section without an end marker runs to the end of the body.
+func keptSections(body string) []string {
+	var sections []string
+	for {
+		start := strings.Index(body, keepStartMarker)
+		if start < 0 {
+			return sections
+		}
+		body = body[start:]
+		end := strings.Index(body, keepEndMarker)
+		if end < 0 {
+			return append(sections, strings.TrimSpace(body))
+		}
+		end += len(keepEndMarker)
+		sections = append(sections, body[:end])
+		body = body[end:]
+	}
+}
+
+// preserveSections appends the kept sections of the current body to the
+// updated one, unless they are already there
+func preserveSections(current, updated string) string {
+	for _, section := range keptSections(current) {
+		if !strings.Contains(updated, section) {
+			updated = strings.TrimRight(updated, "\n") + "\n\n" + section
+		}
+	}
+	return updated
+}
+
+// printPRChanges shows how an update changes the pull request: its new title
+// and a diff of its body
+func printPRChanges(heading string, current *pullRequest, title, body string) {
+	fmt.Printf("%s\n", heading)
+	fmt.Printf("=====================================\n")
+	if title == current.title {
+		fmt.Printf("Title: %s (unchanged)\n", title)
+	} else {
+		fmt.Printf("Title: %s\n", title)
+		fmt.Printf("Was: %s\n", current.title)
+	}
+	fmt.Printf("Base: %s\n", current.base)
+	fmt.Printf("Head: %s\n", current.head)
+
+	diff, err := bodyDiff(current.body, body, isTerminal(os.Stdout))
+	switch {
+	case err != nil:
+		fmt.Printf("\nBody:\n%s\n", body)
+	case diff == "":
+		fmt.Printf("\nBody: unchanged\n")
+	default:
+		fmt.Printf("\nBody changes:\n%s", diff)
+	}
+	fmt.Printf("=====================================\n")
+}
+
+// bodyDiff compares the current and updated body with git diff. It returns
+// "" if they are the same.
+func bodyDiff(current, updated string, color bool) (string, error) {
+	dir, err := os.MkdirTemp("", "institutionalized-pr-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	for name, body := range map[string]string{"current": current, "updated": updated} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(strings.TrimRight(body, "\n")+"\n"), 0o600); err != nil {
+			return "", err
+		}
+	}
+
+	colorFlag := "--color=never"
+	if color {
+		colorFlag = "--color=always"
+	}
+	cmd := exec.Command("git", "diff", "--no-index", colorFlag, "current", "updated")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	// git diff exits with 1 when the files differ
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return "", err
+	}
+	return string(output), nil
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/IanKnighton/institutionalized/internal/config"
+	"github.com/IanKnighton/institutionalized/internal/gitlab"
+)
+
+func TestPreserveSections(t *testing.T) {
+	current := "## Summary\n\nOld summary\n\n<!-- keep -->\n## Screenshots\n\n![before](a.png)\n<!-- /keep -->\n\n## Notes\n\n<!-- keep -->Deploy after #12<!-- /keep -->\n"
+	updated := "## Summary\n\nNew summary\n"
+
+	body := preserveSections(current, updated)
+	expected := "## Summary\n\nNew summary\n\n<!-- keep -->\n## Screenshots\n\n![before](a.png)\n<!-- /keep -->\n\n<!-- keep -->Deploy after #12<!-- /keep -->"
+	if body != expected {
+		t.Errorf("Expected the kept sections to be appended, got:\n%s", body)
+	}
+
+	// Sections the new body already has aren't repeated
+	if again := preserveSections(current, body); again != body {
+		t.Errorf("Expected the body to stay the same, got:\n%s", again)
+	}
+
+	// An unterminated section runs to the end of the body
+	sections := keptSections("text\n<!-- keep -->\nkept to the end\n")
+	if len(sections) != 1 || sections[0] != "<!-- keep -->\nkept to the end" {
+		t.Errorf("Unexpected sections %q", sections)
+	}
+
+	if body := preserveSections("no markers", updated); body != updated {
+		t.Errorf("Expected the body without markers to be unchanged, got %q", body)
+	}
+}
+
+func TestBodyDiff(t *testing.T) {
+	diff, err := bodyDiff("## Summary\n\nOld\n", "## Summary\n\nNew\n", false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(diff, "-Old\n") || !strings.Contains(diff, "+New\n") || !strings.Contains(diff, "a/current") {
+		t.Errorf("Unexpected diff:\n%s", diff)
+	}
+
+	if diff, err := bodyDiff("same", "same\n", false); err != nil || diff != "" {
+		t.Errorf("Expected no diff, got %q (%v)", diff, err)
+	}
+}
+
+func TestGitLabProjectUpdatesDraftMergeRequest(t *testing.T) {
+	inTestRepo(t, "file.txt", "one\n")
+	git(t, "remote", "add", "origin", "git@gitlab.com:group/project.git")
+
+	var update gitlab.MergeRequestUpdate
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.EscapedPath() {
+		case "GET /api/v4/projects/group%2Fproject/merge_requests":
+			w.Write([]byte(`[{"iid": 4, "web_url": "https://gitlab.com/group/project/-/merge_requests/4", "title": "Draft: old", "description": "old body", "draft": true, "source_branch": "feature", "target_branch": "develop"}]`))
+		case "PUT /api/v4/projects/group%2Fproject/merge_requests/4":
+			json.NewDecoder(r.Body).Decode(&update)
+			w.Write([]byte(`{"iid": 4, "web_url": "https://gitlab.com/group/project/-/merge_requests/4"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("GITLAB_API_URL", server.URL+"/api/v4")
+	t.Setenv("GITLAB_TOKEN", "secret")
+
+	repo, err := findForge(config.DefaultConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	current, err := repo.findPR("feature")
+	if err != nil || current == nil {
+		t.Fatalf("Expected the open merge request, got %v (%v)", current, err)
+	}
+	if current.number != 4 || current.base != "develop" || !current.draft {
+		t.Errorf("Unexpected merge request %+v", current)
+	}
+
+	if err := updatePR(repo, current, "feat: new", "new body"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if update.Title != "Draft: feat: new" || update.Description != "new body" {
+		t.Errorf("Expected the draft to stay a draft, got %+v", update)
+	}
+
+	// Nothing is sent when nothing changes
+	update = gitlab.MergeRequestUpdate{}
+	if err := updatePR(repo, current, current.title, current.body); err != nil || update.Title != "" {
+		t.Errorf("Expected no update, got %+v (%v)", update, err)
+	}
+}
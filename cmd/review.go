@@ -0,0 +1,409 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/llm"
+)
+
+// errReviewCancelled is returned when the user cancels the review
+var errReviewCancelled = errors.New("cancelled")
+
+// stdin is shared by every prompt so input typed ahead (or piped in) isn't
+// lost between prompts
+var stdin = bufio.NewReader(os.Stdin)
+
+// readLine prints a prompt and reads one trimmed line from stdin
+func readLine(prompt string) (string, error) {
+	fmt.Print(prompt)
+	line, err := stdin.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// reviewAction is a choice in the review menu
+type reviewAction int
+
+const (
+	reviewAccept reviewAction = iota
+	reviewEdit
+	reviewRegenerate
+	reviewRefine
+	reviewSwitchProvider
+	reviewCancel
+)
+
+// reviewer lets the user accept, edit, regenerate or refine generated content.
+// Regenerating and feedback continue the same conversation, so providers see
+// their earlier answers.
+type reviewer struct {
+	// all holds every provider; manager is the one in use after switching
+	all     *llm.ProviderManager
+	manager *llm.ProviderManager
+
+	conversation *llm.Conversation
+	// kind names the content in prompts, e.g. "commit message"
+	kind string
+	// heading is printed above streamed output; it receives the provider name
+	heading string
+	// editPattern names the temporary file opened in the editor
+	editPattern string
+	// editHelp is added to the editor as '#' comment lines, which are removed
+	// again afterwards. Leave it empty for content that may contain '#' lines.
+	editHelp string
+
+	// parse turns a provider's reply into the content shown to the user
+	parse func(reply string) (string, error)
+	// format turns content back into a reply for the conversation
+	format func(content string) string
+	// show displays the content; streamed is set if it's already on screen
+	show func(content, provider string, streamed bool)
+	// check returns the format rules the content breaks. Generated content
+	// that breaks rules is sent back for correction. Nil disables checks.
+	check func(content string) []string
+}
+
+// maxCorrections limits how often generated content is sent back to be fixed
+const maxCorrections = 2
+
+// newReviewer creates a reviewer for a conversation, using the manager's providers
+func newReviewer(manager *llm.ProviderManager, conversation *llm.Conversation) *reviewer {
+	return &reviewer{
+		all:          manager,
+		manager:      manager,
+		conversation: conversation,
+		editPattern:  "institutionalized-*.txt",
+		parse:        func(reply string) (string, error) { return reply, nil },
+		format:       func(content string) string { return content },
+	}
+}
+
+// generate asks for the conversation's next reply, streaming it when running
+// in a terminal, and records it in the conversation. Replies that break the
+// format rules are sent back for correction. streamed reports whether the
+// content is already on screen as is.
+func (r *reviewer) generate() (content, provider string, streamed bool, err error) {
+	content, provider, streamed, err = r.request()
+	if err != nil {
+		return content, provider, streamed, err
+	}
+	content, provider, streamed = r.correct(content, provider, streamed)
+	return content, provider, streamed, nil
+}
+
+// choose asks every provider for an answer and lets the user pick one; with
+// skipSelect the first answer is used. The chosen answer is recorded in the
+// conversation and checked like a generated one. label describes an answer
+// in the list. Answers that can't be parsed are left out.
+func (r *reviewer) choose(label func(content, provider string) string, skipSelect bool) (string, string, error) {
+	candidates, err := r.manager.Candidates(r.conversation, 1)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate %s: %w", r.kind, err)
+	}
+
+	var usable []llm.Candidate
+	var contents, labels []string
+	for _, candidate := range candidates {
+		content, err := r.parse(candidate.Reply)
+		if err != nil {
+			fmt.Printf("⚠️  Ignoring the %s from %s: %v\n", r.kind, candidate.Provider, err)
+			continue
+		}
+		usable = append(usable, candidate)
+		contents = append(contents, content)
+		labels = append(labels, label(content, candidate.Provider))
+	}
+	if len(usable) == 0 {
+		return "", "", fmt.Errorf("failed to generate %s: no provider returned a usable answer", r.kind)
+	}
+
+	choice := 0
+	if !skipSelect && len(usable) > 1 {
+		choice = selectCandidate(r.kind, labels)
+		if choice < 0 {
+			return "", "", errReviewCancelled
+		}
+	}
+
+	r.conversation.Reply(usable[choice].Reply)
+	content, provider, _ := r.correct(contents[choice], usable[choice].Provider, false)
+	return content, provider, nil
+}
+
+// correct sends content that breaks the format rules back to be fixed, up to
+// maxCorrections times. If a correction fails the content is kept as is.
+func (r *reviewer) correct(content, provider string, streamed bool) (string, string, bool) {
+	if r.check == nil {
+		return content, provider, streamed
+	}
+
+	for attempt := 0; attempt < maxCorrections; attempt++ {
+		violations := r.check(content)
+		if len(violations) == 0 {
+			break
+		}
+		fmt.Printf("\n⚠️  The %s from %s doesn't follow the required format, asking for a fix:\n", r.kind, provider)
+		printViolations(violations)
+
+		saved := append([]llm.Message(nil), r.conversation.Messages...)
+		r.conversation.Correct(violations)
+		corrected, correctedBy, correctedStreamed, err := r.request()
+		if err != nil {
+			// Keep the answer we have; remaining problems are shown as warnings
+			r.conversation.Messages = saved
+			fmt.Printf("⚠️  %v\n", err)
+			break
+		}
+		content, provider, streamed = corrected, correctedBy, correctedStreamed
+	}
+	return content, provider, streamed
+}
+
+// request sends the conversation to the providers once and records the reply
+func (r *reviewer) request() (content, provider string, streamed bool, err error) {
+	var reply string
+	if r.manager.Strategy() != llm.StrategyRace && isTerminal(os.Stdout) {
+		printer := newStreamPrinter(r.heading)
+		// The printer only belongs to this request
+		previous := r.manager.SetFallbackHandler(printer.fallback)
+		defer r.manager.SetFallbackHandler(previous)
+		reply, provider, err = r.manager.StreamChat(r.conversation, printer.print)
+		printer.finish()
+		streamed = printer.streamedFrom(provider)
+	} else {
+		reply, provider, err = r.manager.Chat(r.conversation)
+	}
+	if err != nil {
+		return "", provider, false, fmt.Errorf("failed to generate %s: %w", r.kind, err)
+	}
+
+	content, err = r.parse(reply)
+	if err != nil {
+		return "", provider, false, fmt.Errorf("failed to generate %s using %s: %w", r.kind, provider, err)
+	}
+	r.conversation.Reply(reply)
+	return content, provider, streamed && content == reply, nil
+}
+
+// display shows the content followed by any format rules it still breaks
+func (r *reviewer) display(content, provider string, streamed bool) {
+	r.show(content, provider, streamed)
+	if r.check == nil {
+		return
+	}
+	if violations := r.check(content); len(violations) > 0 {
+		fmt.Printf("⚠️  This %s doesn't follow the required format:\n", r.kind)
+		printViolations(violations)
+		fmt.Println()
+	}
+}
+
+// printViolations lists broken format rules
+func printViolations(violations []string) {
+	for _, violation := range violations {
+		fmt.Printf("  - %s\n", violation)
+	}
+}
+
+// review shows the content and handles the user's choices until the content
+// is accepted or the review is cancelled. It returns the accepted content and
+// the provider that wrote it, marked ", edited" if the user changed it.
+func (r *reviewer) review(content, provider string, streamed bool) (string, string, error) {
+	for {
+		r.display(content, provider, streamed)
+		streamed = false
+
+		var err error
+		switch r.ask() {
+		case reviewAccept:
+			return content, provider, nil
+		case reviewCancel:
+			return "", "", errReviewCancelled
+		case reviewEdit:
+			edited, err := editText(content, r.editPattern, r.editHelp)
+			if err != nil {
+				fmt.Printf("⚠️  %v\n", err)
+				continue
+			}
+			if edited == "" {
+				fmt.Printf("Empty %s, keeping the previous version.\n", r.kind)
+				continue
+			}
+			if edited != content {
+				content = edited
+				provider = strings.TrimSuffix(provider, ", edited") + ", edited"
+				r.conversation.Reply(r.format(content))
+			}
+			continue
+		case reviewRegenerate:
+			content, provider, streamed, err = r.retry(content, provider, nil)
+		case reviewRefine:
+			feedback, readErr := readLine("What should change? ")
+			if readErr != nil || feedback == "" {
+				continue
+			}
+			content, provider, streamed, err = r.retry(content, provider, func() {
+				r.conversation.Refine(feedback)
+			})
+		case reviewSwitchProvider:
+			names := r.all.ProviderNames()
+			choice := selectCandidate("provider", names)
+			if choice < 0 {
+				continue
+			}
+			previous := r.manager
+			r.manager = r.all.Only(names[choice])
+			content, provider, streamed, err = r.retry(content, provider, nil)
+			if err != nil {
+				r.manager = previous
+			}
+		}
+		if err != nil {
+			fmt.Printf("⚠️  %v\n", err)
+		}
+	}
+}
+
+// retry asks for a new answer to the last request, after applying change to
+// the conversation. If that fails the conversation is restored and the
+// previous content kept.
+func (r *reviewer) retry(content, provider string, change func()) (string, string, bool, error) {
+	saved := append([]llm.Message(nil), r.conversation.Messages...)
+	if change != nil {
+		change()
+	} else {
+		r.conversation.Retry()
+	}
+
+	newContent, newProvider, streamed, err := r.generate()
+	if err != nil {
+		r.conversation.Messages = saved
+		return content, provider, false, err
+	}
+	return newContent, newProvider, streamed, nil
+}
+
+// ask shows the review menu and reads the user's choice. Closing stdin cancels.
+func (r *reviewer) ask() reviewAction {
+	canSwitch := len(r.all.ProviderNames()) > 1
+	options := "[a]ccept, [e]dit, [r]egenerate, [f]eedback"
+	if canSwitch {
+		options += ", [s]witch provider"
+	}
+	options += ", [c]ancel"
+
+	for {
+		response, err := readLine(fmt.Sprintf("Use this %s? %s: ", r.kind, options))
+		if err != nil {
+			return reviewCancel
+		}
+
+		switch strings.ToLower(response) {
+		case "a", "accept", "y", "yes":
+			return reviewAccept
+		case "e", "edit":
+			return reviewEdit
+		case "r", "regenerate":
+			return reviewRegenerate
+		case "f", "feedback":
+			return reviewRefine
+		case "s", "switch":
+			if canSwitch {
+				return reviewSwitchProvider
+			}
+		case "c", "cancel", "n", "no":
+			return reviewCancel
+		}
+		if response != "" {
+			fmt.Printf("Invalid choice: %s\n", response)
+		}
+	}
+}
+
+// editText opens text in the user's editor and returns the result, trimmed.
+// The editor is chosen like git does (GIT_EDITOR, core.editor, VISUAL,
+// EDITOR), falling back to vi. help is shown as '#' comment lines that are
+// stripped from the result.
+func editText(text, pattern, help string) (string, error) {
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	content := text + "\n"
+	if help != "" {
+		content += "\n# " + strings.ReplaceAll(help, "\n", "\n# ") + "\n"
+	}
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	editor := gitEditor()
+	cmd := editorCommand(editor, file.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor %q failed: %w", editor, err)
+	}
+
+	edited, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read edited file: %w", err)
+	}
+	if help == "" {
+		return strings.TrimSpace(string(edited)), nil
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(edited), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+// shellMetacharacters are the characters that make git run an editor through
+// the shell rather than directly
+const shellMetacharacters = "|&;<>()$`\\\"' \t\n*?[#~=%"
+
+// editorCommand returns the command that opens file in editor. Like git, an
+// editor without shell metacharacters is run directly and anything else is
+// run by the shell, so it may include arguments and quoted paths. A path to
+// an existing editor is run directly even if it contains spaces.
+func editorCommand(editor, file string) *exec.Cmd {
+	if !strings.ContainsAny(editor, shellMetacharacters) {
+		return exec.Command(editor, file)
+	}
+	if info, err := os.Stat(editor); err == nil && !info.IsDir() && strings.ContainsRune(editor, os.PathSeparator) {
+		return exec.Command(editor, file)
+	}
+	return exec.Command("sh", "-c", editor+` "$@"`, editor, file)
+}
+
+// gitEditor returns the editor git would use
+func gitEditor() string {
+	if output, err := exec.Command("git", "var", "GIT_EDITOR").Output(); err == nil {
+		if editor := strings.TrimSpace(string(output)); editor != "" {
+			return editor
+		}
+	}
+	if editor := os.Getenv("EDITOR"); editor != "" {
+		return editor
+	}
+	return "vi"
+}
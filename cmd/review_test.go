@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IanKnighton/institutionalized/internal/llm"
+)
+
+// scriptedProvider answers chat requests with its name and the number of
+// messages it was sent
+type scriptedProvider struct {
+	name    string
+	history []llm.Message
+}
+
+func (p *scriptedProvider) Name() string { return p.name }
+
+func (p *scriptedProvider) SummarizeDiff(ctx context.Context, path string, diff string) (string, error) {
+	return "", errors.New("not used")
+}
+
+func (p *scriptedProvider) ContextWindow() int { return llm.DefaultContextWindow }
+
+func (p *scriptedProvider) Chat(ctx context.Context, task llm.Task, messages []llm.Message) (string, error) {
+	p.history = messages
+	return strings.Repeat("x", len(messages)) + " from " + p.name, nil
+}
+
+// withInput replaces stdin for the duration of a test
+func withInput(t *testing.T, input string) {
+	original := stdin
+	stdin = bufio.NewReader(strings.NewReader(input))
+	t.Cleanup(func() { stdin = original })
+}
+
+func newTestReviewer(providers ...llm.Provider) *reviewer {
+	manager := llm.NewProviderManager(providers, time.Second)
+	review := newReviewer(manager, llm.NewConversation(llm.TaskCommit, "prompt"))
+	review.kind = "commit message"
+	review.show = func(content, provider string, streamed bool) {}
+	return review
+}
+
+func TestReviewRefinesWithFeedback(t *testing.T) {
+	first := &scriptedProvider{name: "first"}
+	second := &scriptedProvider{name: "second"}
+	review := newTestReviewer(first, second)
+
+	content, provider, _, err := review.generate()
+	if err != nil || content != "x from first" || provider != "first" {
+		t.Fatalf("Unexpected first answer %q from %s: %v", content, provider, err)
+	}
+
+	// Feedback continues the conversation, then switching provider asks the
+	// second provider the same follow-up
+	withInput(t, "f\nshorter\ns\n2\na\n")
+	content, provider, err = review.review(content, provider, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if content != "xxx from second" || provider != "second" {
+		t.Errorf("Unexpected accepted content %q from %s", content, provider)
+	}
+	if len(first.history) != 3 || first.history[1].Content != "x from first" || !strings.Contains(first.history[2].Content, "shorter") {
+		t.Errorf("Expected the feedback as a follow-up turn, got %+v", first.history)
+	}
+	if len(second.history) != 3 || second.history[2].Role != llm.RoleUser {
+		t.Errorf("Expected the switched provider to get the same request, got %+v", second.history)
+	}
+}
+
+func TestReviewCancel(t *testing.T) {
+	review := newTestReviewer(&scriptedProvider{name: "only"})
+
+	withInput(t, "s\nnonsense\nc\n")
+	if _, _, err := review.review("feat: x", "only", false); !errors.Is(err, errReviewCancelled) {
+		t.Errorf("Expected the review to be cancelled, got %v", err)
+	}
+
+	withInput(t, "")
+	if _, _, err := review.review("feat: x", "only", false); !errors.Is(err, errReviewCancelled) {
+		t.Errorf("Expected closed input to cancel, got %v", err)
+	}
+}
+
+func TestEditText(t *testing.T) {
+	// sed leaves a backup next to the file, so keep it out of the real temp dir
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv("GIT_EDITOR", `sed -i.bak -e 's/draft/final/'`)
+
+	edited, err := editText("feat: draft", "test-*.txt", "Lines starting with '#' are ignored")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if edited != "feat: final" {
+		t.Errorf("Expected the edit without help comments, got %q", edited)
+	}
+
+	// Without help, '#' lines such as Markdown headings are kept
+	edited, err = editText("draft\n\n## Summary", "test-*.md", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if title, body := splitPRContent(edited); title != "final" || body != "## Summary" {
+		t.Errorf("Unexpected PR edit: %q / %q", title, body)
+	}
+}
+
+func TestEditTextWithEditorPathContainingSpaces(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	dir := filepath.Join(t.TempDir(), "my editor")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	editor := filepath.Join(dir, "edit")
+	// Edits the last argument, so options before the file are ignored
+	script := "#!/bin/sh\nfor file; do :; done\nsed -i.bak -e 's/draft/final/' \"$file\"\n"
+	if err := os.WriteFile(editor, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The path as is, and quoted with an argument as git expects it
+	for _, setting := range []string{editor, `"` + editor + `" --wait`} {
+		t.Setenv("GIT_EDITOR", setting)
+		edited, err := editText("feat: draft", "test-*.txt", "")
+		if err != nil || edited != "feat: final" {
+			t.Errorf("Editor %s: expected the edit, got %q (%v)", setting, edited, err)
+		}
+	}
+}
+
+func TestGenerateAsksForCorrections(t *testing.T) {
+	provider := &scriptedProvider{name: "only"}
+	review := newTestReviewer(provider)
+	review.check = func(content string) []string {
+		if strings.HasPrefix(content, "xxx") {
+			return nil
+		}
+		return []string{"too short"}
+	}
+
+	content, _, _, err := review.generate()
+	if err != nil || content != "xxx from only" {
+		t.Fatalf("Expected the corrected answer, got %q: %v", content, err)
+	}
+	if len(provider.history) != 3 || !strings.Contains(provider.history[2].Content, "too short") {
+		t.Errorf("Expected the violations as a follow-up turn, got %+v", provider.history)
+	}
+
+	// Content that can't be fixed is returned after the last attempt
+	review = newTestReviewer(&scriptedProvider{name: "only"})
+	review.check = func(content string) []string { return []string{"never right"} }
+	content, _, _, err = review.generate()
+	if err != nil || content != strings.Repeat("x", 1+2*maxCorrections)+" from only" {
+		t.Errorf("Expected the answer after %d corrections, got %q: %v", maxCorrections, content, err)
+	}
+}
+
+func TestChooseChecksAndCancels(t *testing.T) {
+	first := &scriptedProvider{name: "first"}
+	review := newTestReviewer(first, &scriptedProvider{name: "second"})
+	review.manager.SetStrategy(llm.StrategyBestOf, 0)
+	review.check = func(content string) []string {
+		if strings.HasPrefix(content, "xxx") {
+			return nil
+		}
+		return []string{"too short"}
+	}
+	label := func(content, provider string) string { return content }
+
+	withInput(t, "\n")
+	if _, _, err := review.choose(label, false); !errors.Is(err, errReviewCancelled) {
+		t.Errorf("Expected the selection to be cancelled, got %v", err)
+	}
+
+	// The chosen answer is sent back for correction like a generated one
+	withInput(t, "2\n")
+	content, _, err := review.choose(label, false)
+	if err != nil || content != "xxx from first" {
+		t.Fatalf("Expected the corrected answer, got %q: %v", content, err)
+	}
+	if len(first.history) != 3 || first.history[1].Content != "x from second" {
+		t.Errorf("Expected the chosen answer in the conversation, got %+v", first.history)
+	}
+
+	// Answers that can't be parsed aren't offered
+	review = newTestReviewer(&scriptedProvider{name: "first"}, &scriptedProvider{name: "second"})
+	review.manager.SetStrategy(llm.StrategyBestOf, 0)
+	review.parse = func(reply string) (string, error) {
+		if strings.HasSuffix(reply, "first") {
+			return "", errors.New("no title")
+		}
+		return reply, nil
+	}
+	if content, provider, err := review.choose(label, false); err != nil || provider != "second" {
+		t.Errorf("Expected the only usable answer, got %q from %s: %v", content, provider, err)
+	}
+}
@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/budget"
+	"github.com/IanKnighton/institutionalized/internal/config"
+	"github.com/IanKnighton/institutionalized/internal/conventional"
+	"github.com/IanKnighton/institutionalized/internal/llm"
+	"github.com/IanKnighton/institutionalized/internal/split"
+	"github.com/IanKnighton/institutionalized/internal/trailers"
+)
+
+// runSplit asks the providers to group the staged hunks into several commits,
+// lets the user review the plan and creates the commits. It reports whether
+// any commits were created.
+func runSplit(cfg *config.Config, providers []llm.Provider, rules conventional.Rules, refs []string, messageTrailers commitTrailers, gitOptions gitCommitOptions, useEmoji bool, contextText string, dryRun bool) (bool, error) {
+	// Patches are built from this diff, so it has to include binary files
+	output, err := exec.Command("git", "diff", "--cached", "--binary").Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to get staged changes: %w", err)
+	}
+	staged := split.New(string(output))
+	if len(staged.Hunks) == 0 {
+		return false, fmt.Errorf("no staged changes found. Use 'git add' to stage changes first")
+	}
+	if len(staged.Hunks) == 1 {
+		return false, fmt.Errorf("the staged changes are a single hunk and can't be split; run commit without --split")
+	}
+
+	// Excluded files are only listed, like in a regular commit
+	matcher, err := newIgnoreMatcher(cfg)
+	if err != nil {
+		return false, err
+	}
+	diff := staged.Annotated(func(path string) bool { return !matcher.Match(path) })
+
+	if dryRun {
+		fmt.Printf("Staged hunks that would be grouped into commits:\n%s", staged.Listing())
+		printIssueReferences(refs)
+		messageTrailers.print(trailers.ProviderPlaceholder)
+		if err := reportSecrets(cfg, "staged changes", diff, true); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+
+	// Nothing leaves the machine until it has been checked for secrets
+	diff, err = protectSecrets(cfg, "staged changes", diff, true)
+	if err != nil {
+		return false, err
+	}
+
+	if len(providers) == 0 {
+		return false, fmt.Errorf("no LLM providers available. Please set OPENAI_API_KEY, GEMINI_API_KEY, or CLAUDE_API_KEY environment variable, or enable Ollama with 'institutionalized config set providers.ollama.enabled true'")
+	}
+	manager, err := newProviderManager(cfg, providers)
+	if err != nil {
+		return false, err
+	}
+
+	// Summaries would lose the hunk numbers, so the whole diff has to fit
+	prompt := llm.SplitPlanPromptTemplate(staged.Listing(), diff, rules, useEmoji, contextText)
+	if tokens, limit := budget.EstimateTokens(prompt), manager.ContextWindow()-responseTokens; tokens > limit {
+		return false, fmt.Errorf("staged changes are too large to split (~%d tokens, limit %d). Stage fewer files and split them in several steps", tokens, limit)
+	}
+
+	fmt.Printf("Grouping %d staged hunks into commits...\n", len(staged.Hunks))
+
+	review := newReviewer(manager, llm.NewConversation(llm.TaskSplit, prompt))
+	review.kind = "commit plan"
+	review.heading = "Planning commits with %s..."
+	review.editHelp = "Edit the commit plan. Every hunk must be in exactly one commit.\nLines starting with '#' are ignored, and an empty plan keeps the previous version."
+	review.parse = func(reply string) (string, error) {
+		plan, err := split.ParsePlan(reply)
+		if err != nil {
+			return "", err
+		}
+		for i := range plan {
+			plan[i].Message = prepareCommitMessage(cfg, rules, refs, plan[i].Message, useEmoji)
+		}
+		return plan.String(), nil
+	}
+	review.check = func(content string) []string {
+		return checkSplitPlan(cfg, rules, staged, content)
+	}
+	review.show = func(content, provider string, streamed bool) {
+		plan, err := split.ParsePlan(content)
+		if err != nil {
+			fmt.Printf("\nProposed commit plan (generated by %s):\n%s\n\n", provider, content)
+			return
+		}
+		fmt.Printf("\nProposed commits (generated by %s):\n", provider)
+		printSplitPlan(staged, plan)
+		messageTrailers.print(provider)
+	}
+
+	content, providerUsed, streamed, err := review.generate()
+	if err != nil {
+		return false, err
+	}
+
+	// The plan has to cover every hunk before anything is committed
+	var plan split.Plan
+	for {
+		content, providerUsed, err = review.review(content, providerUsed, streamed)
+		if errors.Is(err, errReviewCancelled) {
+			fmt.Println("Commit cancelled.")
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		// Broken format rules are only warnings, like for single commits
+		plan, err = split.ParsePlan(content)
+		if err == nil && len(staged.Check(plan)) == 0 {
+			break
+		}
+		fmt.Println("⚠️  The commit plan can't be used until it puts every hunk in exactly one commit.")
+		streamed = false
+	}
+
+	for i := range plan {
+		plan[i].Message = messageTrailers.apply(plan[i].Message, providerUsed)
+	}
+	if err := commitPlan(staged, plan, gitOptions); err != nil {
+		return false, err
+	}
+	fmt.Printf("Created %d commits.\n", len(plan))
+	return true, nil
+}
+
+// checkSplitPlan returns the problems that keep a commit plan from covering
+// the staged hunks, followed by the format rules its commit messages break if
+// validation is enabled
+func checkSplitPlan(cfg *config.Config, rules conventional.Rules, staged *split.Diff, content string) []string {
+	plan, err := split.ParsePlan(content)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	problems := staged.Check(plan)
+	if cfg.Commit.ValidateMessages() {
+		for i, group := range plan {
+			for _, violation := range checkCommitMessage(group.Message, rules) {
+				problems = append(problems, fmt.Sprintf("commit %d: %s", i+1, violation))
+			}
+		}
+	}
+	return problems
+}
+
+// printSplitPlan shows each planned commit with its message and files
+func printSplitPlan(staged *split.Diff, plan split.Plan) {
+	for i, group := range plan {
+		subject, body, _ := strings.Cut(group.Message, "\n")
+		fmt.Printf("\n[%d] %s\n", i+1, subject)
+		if body = strings.TrimSpace(body); body != "" {
+			fmt.Printf("    %s\n", strings.ReplaceAll(body, "\n", "\n    "))
+		}
+		for _, path := range staged.Paths(group.Hunks) {
+			fmt.Printf("    - %s\n", path)
+		}
+	}
+	fmt.Println()
+}
+
+// commitPlan creates one commit per group of the plan by staging only the
+// group's hunks. If a commit can't be created, the index is restored so the
+// changes not committed yet are still staged.
+func commitPlan(staged *split.Diff, plan split.Plan, options gitCommitOptions) error {
+	output, err := exec.Command("git", "write-tree").Output()
+	if err != nil {
+		return fmt.Errorf("failed to save the staged changes: %w", err)
+	}
+	saved := strings.TrimSpace(string(output))
+	restore := func() {
+		exec.Command("git", "read-tree", saved).Run()
+	}
+
+	// Start from the last commit, or from nothing in a new repository
+	reset := exec.Command("git", "read-tree", "HEAD")
+	if exec.Command("git", "rev-parse", "--verify", "--quiet", "HEAD").Run() != nil {
+		reset = exec.Command("git", "read-tree", "--empty")
+	}
+	if err := reset.Run(); err != nil {
+		restore()
+		return fmt.Errorf("failed to unstage the changes: %w", err)
+	}
+
+	for i, group := range plan {
+		if err := applyCached(staged.Patch(group.Hunks)); err != nil {
+			restore()
+			return fmt.Errorf("failed to stage commit %d of %d, the remaining changes are still staged: %w", i+1, len(plan), err)
+		}
+		if err := commitChanges(group.Message, options); err != nil {
+			restore()
+			return fmt.Errorf("failed to create commit %d of %d, the remaining changes are still staged: %w", i+1, len(plan), err)
+		}
+		subject, _, _ := strings.Cut(group.Message, "\n")
+		fmt.Printf("✅ [%d/%d] %s\n", i+1, len(plan), subject)
+	}
+
+	// The commits should add up to what was staged; restoring the index keeps
+	// anything they missed staged
+	if output, err := exec.Command("git", "write-tree").Output(); err != nil || strings.TrimSpace(string(output)) != saved {
+		restore()
+		fmt.Println("⚠️  The commits don't include every staged change; the rest is still staged.")
+	}
+	return nil
+}
+
+// applyCached applies a patch to the index only
+func applyCached(patch string) error {
+	cmd := exec.Command("git", "apply", "--cached", "-")
+	cmd.Stdin = strings.NewReader(patch)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("git apply: %s", message)
+		}
+		return err
+	}
+	return nil
+}
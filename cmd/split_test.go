@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/IanKnighton/institutionalized/internal/conventional"
+	"github.com/IanKnighton/institutionalized/internal/llm"
+	"github.com/IanKnighton/institutionalized/internal/split"
+)
+
+// inTestRepo runs the test inside a new git repository with one commit of
+// the given file
+func inTestRepo(t *testing.T, name, content string) {
+	dir := t.TempDir()
+	originalDir, _ := os.Getwd()
+	t.Cleanup(func() { os.Chdir(originalDir) })
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	writeFile(t, name, content)
+	git(t, "init", "-q")
+	git(t, "add", name)
+	git(t, "commit", "-q", "-m", "initial")
+}
+
+func writeFile(t *testing.T, name, content string) {
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func git(t *testing.T, args ...string) string {
+	output, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func TestCommitPlan(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 30; i++ {
+		lines = append(lines, "line")
+	}
+	original := strings.Join(lines, "\n") + "\n"
+	inTestRepo(t, "file.txt", original)
+
+	lines[1], lines[27] = "first change", "second change"
+	writeFile(t, "file.txt", strings.Join(lines, "\n")+"\n")
+	writeFile(t, "new.txt", "new\n")
+	git(t, "add", "file.txt", "new.txt")
+
+	staged := split.New(git(t, "diff", "--cached", "--binary") + "\n")
+	if len(staged.Hunks) != 3 {
+		t.Fatalf("Expected 3 hunks, got:\n%s", staged.Listing())
+	}
+
+	// The later hunk is committed first, so it has to apply out of order
+	plan := split.Plan{{Hunks: []int{2, 3}, Message: "feat: second"}, {Hunks: []int{1}, Message: "fix: first"}}
+	if err := commitPlan(staged, plan, gitCommitOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if log := git(t, "log", "--format=%s"); log != "fix: first\nfeat: second\ninitial" {
+		t.Errorf("Unexpected commits:\n%s", log)
+	}
+	if first := git(t, "show", "HEAD~1:file.txt"); strings.Contains(first, "first change") || !strings.Contains(first, "second change") {
+		t.Errorf("Expected only the second change in the first commit:\n%s", first)
+	}
+	if status := git(t, "status", "--porcelain"); status != "" {
+		t.Errorf("Expected everything to be committed, got:\n%s", status)
+	}
+}
+
+func TestSplitPromptLeavesOutBinaryPatches(t *testing.T) {
+	inTestRepo(t, "file.txt", "one\n")
+	writeFile(t, "file.txt", "two\n")
+	writeFile(t, "image.png", "\x89PNG\x00\x01\x02secret-looking bytes\x00")
+	git(t, "add", "file.txt", "image.png")
+
+	// The helper trims the blank line that ends a binary patch
+	output, err := exec.Command("git", "diff", "--cached", "--binary").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	staged := split.New(string(output))
+	diff := staged.Annotated(nil)
+	prompt := llm.SplitPlanPromptTemplate(staged.Listing(), diff, conventional.DefaultRules(), false, "")
+	if strings.Contains(prompt, "GIT binary patch") || !strings.Contains(diff, "binary file changed: image.png [hunk 2]") {
+		t.Errorf("Expected the binary file to only be named:\n%s", diff)
+	}
+
+	// The patch still carries the binary data, so the file is committed
+	if err := commitPlan(staged, split.Plan{{Hunks: []int{1, 2}, Message: "feat: add image"}}, gitCommitOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if files := git(t, "show", "--name-only", "--format="); files != "file.txt\nimage.png" {
+		t.Errorf("Expected both files in the commit, got %q", files)
+	}
+}
+
+func TestCommitPlanKeepsChangesStagedOnFailure(t *testing.T) {
+	inTestRepo(t, "file.txt", "one\n")
+	writeFile(t, "file.txt", "two\n")
+	git(t, "add", "file.txt")
+
+	staged := split.New(git(t, "diff", "--cached", "--binary") + "\n")
+	// A patch that doesn't apply stops the split before anything is committed
+	staged.Files[0].Hunks[0] = strings.Replace(staged.Files[0].Hunks[0], "-one", "-three", 1)
+
+	if err := commitPlan(staged, split.Plan{{Hunks: []int{1}, Message: "fix: x"}}, gitCommitOptions{}); err == nil {
+		t.Fatal("Expected the patch to fail")
+	}
+	if staged := git(t, "diff", "--cached", "--name-only"); staged != "file.txt" {
+		t.Errorf("Expected file.txt to still be staged, got %q", staged)
+	}
+	if log := git(t, "log", "--format=%s"); log != "initial" {
+		t.Errorf("Expected no new commits, got:\n%s", log)
+	}
+}
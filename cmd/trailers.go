@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/config"
+	"github.com/IanKnighton/institutionalized/internal/conventional"
+	"github.com/IanKnighton/institutionalized/internal/trailers"
+	"github.com/spf13/cobra"
+)
+
+// recentAuthors is how many commits are searched for co-authors not in the
+// roster
+const recentAuthors = 1000
+
+// commitTrailers are the trailers added to every commit a run creates:
+// configured trailers first, then co-authors, then the sign-off
+type commitTrailers struct {
+	// configured may contain the {provider} placeholder
+	configured []conventional.Footer
+	coAuthors  []trailers.Person
+	// signoff is the committer identity, or "" if commits aren't signed off
+	signoff string
+}
+
+// newCommitTrailers collects the trailers requested by the command's flags
+// and the config
+func newCommitTrailers(cmd *cobra.Command, cfg *config.Config) (commitTrailers, error) {
+	queries, _ := cmd.Flags().GetStringArray("co-author")
+
+	// The flag can turn a configured sign-off off again
+	signoff := cfg.Trailers.Signoff
+	if cmd.Flags().Changed("signoff") {
+		signoff, _ = cmd.Flags().GetBool("signoff")
+	}
+	return buildCommitTrailers(cfg, queries, signoff)
+}
+
+// configTrailers collects the trailers requested by the config alone, for
+// commands without trailer flags such as the commit hook
+func configTrailers(cfg *config.Config) (commitTrailers, error) {
+	return buildCommitTrailers(cfg, nil, cfg.Trailers.Signoff)
+}
+
+// buildCommitTrailers collects the configured trailers, the co-authors found
+// for queries and, if signoff is set, the committer's sign-off
+func buildCommitTrailers(cfg *config.Config, queries []string, signoff bool) (commitTrailers, error) {
+	var t commitTrailers
+	for _, text := range cfg.Trailers.Add {
+		trailer, err := trailers.Parse(text)
+		if err != nil {
+			return t, fmt.Errorf("invalid entry in trailers.add: %w", err)
+		}
+		t.configured = append(t.configured, trailer)
+	}
+
+	if len(queries) > 0 {
+		resolver := &coAuthorResolver{rosterPath: cfg.Trailers.Roster}
+		for _, query := range queries {
+			person, err := resolver.resolve(query)
+			if err != nil {
+				return t, err
+			}
+			t.coAuthors = append(t.coAuthors, person)
+		}
+	}
+
+	if signoff {
+		identity, err := committerIdentity()
+		if err != nil {
+			return t, fmt.Errorf("failed to sign off: %w", err)
+		}
+		t.signoff = identity
+	}
+	return t, nil
+}
+
+// footers returns the trailers for a message written by provider
+func (t commitTrailers) footers(provider string) []conventional.Footer {
+	provider = strings.TrimSuffix(provider, ", edited")
+
+	var footers []conventional.Footer
+	for _, trailer := range t.configured {
+		footers = append(footers, trailers.Expand(trailer, provider))
+	}
+	for _, person := range t.coAuthors {
+		footers = append(footers, conventional.Footer{Token: trailers.CoAuthoredBy, Separator: ": ", Value: person.String()})
+	}
+	if t.signoff != "" {
+		footers = append(footers, conventional.Footer{Token: trailers.SignedOffBy, Separator: ": ", Value: t.signoff})
+	}
+	return footers
+}
+
+// apply adds the trailers the message doesn't have yet after its body
+func (t commitTrailers) apply(message, provider string) string {
+	return conventional.AddFooters(message, t.footers(provider))
+}
+
+// print lists the trailers added on commit
+func (t commitTrailers) print(provider string) {
+	footers := t.footers(provider)
+	if len(footers) == 0 {
+		return
+	}
+	fmt.Println("Trailers added on commit:")
+	for _, footer := range footers {
+		fmt.Printf("  %s\n", footer)
+	}
+	fmt.Println()
+}
+
+// committerIdentity returns "Name <email>" of the committer, as git's own
+// --signoff uses
+func committerIdentity() (string, error) {
+	output, err := exec.Command("git", "var", "GIT_COMMITTER_IDENT").Output()
+	if err != nil {
+		return "", fmt.Errorf("git doesn't know who you are; set user.name and user.email")
+	}
+	// The identity is followed by a timestamp and time zone
+	ident := strings.TrimSpace(string(output))
+	if end := strings.LastIndex(ident, ">"); end >= 0 {
+		ident = ident[:end+1]
+	}
+	return ident, nil
+}
+
+// coAuthorResolver finds co-authors in the roster and the authors of recent
+// commits, each loaded once
+type coAuthorResolver struct {
+	rosterPath string
+	roster     []trailers.Person
+	authors    []trailers.Person
+	loaded     bool
+}
+
+// resolve turns a --co-author value into a person. "Name <email>" is used as
+// is; anything else is looked up in the roster first, then among the
+// authors of recent commits.
+func (r *coAuthorResolver) resolve(query string) (trailers.Person, error) {
+	if person, ok := trailers.ParsePerson(query); ok {
+		return person, nil
+	}
+	if !r.loaded {
+		if err := r.load(); err != nil {
+			return trailers.Person{}, err
+		}
+		r.loaded = true
+	}
+
+	for _, source := range []struct {
+		name   string
+		people []trailers.Person
+	}{
+		{"the roster", r.roster},
+		{"recent commit authors", r.authors},
+	} {
+		found := trailers.Find(source.people, query)
+		switch len(found) {
+		case 0:
+			continue
+		case 1:
+			return found[0], nil
+		}
+		names := make([]string, len(found))
+		for i, person := range found {
+			names[i] = person.String()
+		}
+		return trailers.Person{}, fmt.Errorf("co-author %q matches several people in %s: %s", query, source.name, strings.Join(names, ", "))
+	}
+	return trailers.Person{}, fmt.Errorf("no co-author matches %q in the roster or recent commit authors; pass \"Name <email>\" instead", query)
+}
+
+// load reads the roster, if one is configured, and the recent commit authors
+func (r *coAuthorResolver) load() error {
+	if r.rosterPath != "" {
+		path := r.rosterPath
+		if rest, ok := strings.CutPrefix(path, "~/"); ok {
+			if home, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(home, rest)
+			}
+		}
+		if !filepath.IsAbs(path) {
+			root, err := getRepoRoot()
+			if err != nil {
+				return err
+			}
+			path = filepath.Join(root, path)
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read co-author roster: %w", err)
+		}
+		r.roster, err = trailers.ParseRoster(string(content))
+		if err != nil {
+			return fmt.Errorf("invalid co-author roster %s: %w", path, err)
+		}
+	}
+
+	// A repository without commits has no authors to search
+	output, err := exec.Command("git", "log", fmt.Sprintf("-%d", recentAuthors), "--format=%aN <%aE>").Output()
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		person, ok := trailers.ParsePerson(line)
+		if ok && !seen[strings.ToLower(person.Email)] {
+			seen[strings.ToLower(person.Email)] = true
+			r.authors = append(r.authors, person)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/IanKnighton/institutionalized/internal/conventional"
+	"github.com/IanKnighton/institutionalized/internal/trailers"
+)
+
+func TestCoAuthorResolver(t *testing.T) {
+	inTestRepo(t, "file.txt", "one\n")
+	writeFile(t, "file.txt", "two\n")
+	git(t, "commit", "-q", "-a", "-m", "second", "--author", "Alex Kim <alex@example.com>")
+	writeFile(t, "team.txt", "ak = Alex Kim <akim@corp.example>\nSam Lee <sam@corp.example>\n")
+
+	resolver := &coAuthorResolver{rosterPath: "team.txt"}
+	tests := map[string]string{
+		"Pat Doe <pat@example.com>": "Pat Doe <pat@example.com>",
+		// The roster is searched before the history
+		"AK":    "Alex Kim <akim@corp.example>",
+		"sam":   "Sam Lee <sam@corp.example>",
+		"alex@": "Alex Kim <alex@example.com>",
+		"test":  "Test <test@example.com>",
+	}
+	for query, expected := range tests {
+		person, err := resolver.resolve(query)
+		if err != nil || person.String() != expected {
+			t.Errorf("resolve(%q) = %q (%v), expected %q", query, person, err, expected)
+		}
+	}
+
+	if _, err := resolver.resolve("nobody"); err == nil {
+		t.Error("Expected an unknown co-author to be rejected")
+	}
+	if _, err := resolver.resolve("corp"); err == nil || !strings.Contains(err.Error(), "several people") {
+		t.Errorf("Expected an ambiguous co-author to be rejected, got %v", err)
+	}
+}
+
+func TestCommitTrailersApply(t *testing.T) {
+	generatedBy, _ := trailers.Parse("Generated-by: institutionalized/{provider}")
+	messageTrailers := commitTrailers{
+		configured: []conventional.Footer{generatedBy},
+		coAuthors:  []trailers.Person{{Name: "Sam Lee", Email: "sam@example.com"}},
+		signoff:    "Test <test@example.com>",
+	}
+
+	// Trailers the model already wrote aren't repeated
+	message := "feat!: drop v1\n\nBody.\n\nBREAKING CHANGE: v1 is gone\nCo-authored-by: Sam Lee <sam@example.com>"
+	expected := "feat!: drop v1\n\nBody.\n\nBREAKING CHANGE: v1 is gone\nCo-authored-by: Sam Lee <sam@example.com>\nGenerated-by: institutionalized/claude\nSigned-off-by: Test <test@example.com>"
+	if got := messageTrailers.apply(message, "claude, edited"); got != expected {
+		t.Errorf("Unexpected message:\n%s\nexpected:\n%s", got, expected)
+	}
+}
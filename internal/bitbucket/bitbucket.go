@@ -0,0 +1,147 @@
+// Package bitbucket is a small client for the parts of the Bitbucket REST
+// APIs that institutionalized needs: finding a repository's default branch
+// and opening and updating pull requests. Bitbucket Cloud and Bitbucket Data
+// Center (formerly Server) have different APIs, served by CloudClient and
+// ServerClient.
+package bitbucket
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// CloudHost is the host of Bitbucket Cloud
+const CloudHost = "bitbucket.org"
+
+// IsCloudHost reports whether host is Bitbucket Cloud
+func IsCloudHost(host string) bool {
+	return strings.EqualFold(host, CloudHost)
+}
+
+// IsServerHost reports whether host looks like a Bitbucket Data Center
+// instance, that is has "bitbucket" in its name
+func IsServerHost(host string) bool {
+	return !IsCloudHost(host) && strings.Contains(strings.ToLower(host), "bitbucket")
+}
+
+// Credentials authenticate API requests, either with a token or with a
+// username and an app password or password
+type Credentials struct {
+	Token    string
+	Username string
+	Password string
+}
+
+// FindCredentials reads credentials from BITBUCKET_TOKEN, or from
+// BITBUCKET_USERNAME with BITBUCKET_APP_PASSWORD or BITBUCKET_PASSWORD
+func FindCredentials() Credentials {
+	password := os.Getenv("BITBUCKET_APP_PASSWORD")
+	if password == "" {
+		password = os.Getenv("BITBUCKET_PASSWORD")
+	}
+	return Credentials{
+		Token:    os.Getenv("BITBUCKET_TOKEN"),
+		Username: os.Getenv("BITBUCKET_USERNAME"),
+		Password: password,
+	}
+}
+
+// Empty reports whether there is nothing to authenticate with
+func (c Credentials) Empty() bool {
+	return c.Token == "" && (c.Username == "" || c.Password == "")
+}
+
+// header returns the headers that authenticate requests, preferring the
+// token
+func (c Credentials) header() http.Header {
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+	switch {
+	case c.Token != "":
+		header.Set("Authorization", "Bearer "+c.Token)
+	case c.Username != "" && c.Password != "":
+		basic := base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password))
+		header.Set("Authorization", "Basic "+basic)
+	}
+	return header
+}
+
+// NewPullRequest describes a pull request to open
+type NewPullRequest struct {
+	Title       string
+	Description string
+	// Source is the branch with the changes
+	Source string
+	// Destination is the branch the changes are merged into
+	Destination string
+	Draft       bool
+}
+
+// PullRequest is a pull request as returned by either API
+type PullRequest struct {
+	ID          int
+	URL         string
+	Title       string
+	Description string
+	Draft       bool
+	Source      string
+	Destination string
+}
+
+// APIError is returned when the API answers with an error status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("Bitbucket API error (HTTP %d)", e.StatusCode)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// parseError builds an APIError from an error response. Bitbucket Cloud
+// answers with one error and its field problems, Bitbucket Data Center with
+// a list of errors.
+func parseError(statusCode int, body []byte) error {
+	apiErr := &APIError{StatusCode: statusCode}
+	var errResp struct {
+		// Bitbucket Cloud
+		Error struct {
+			Message string              `json:"message"`
+			Fields  map[string][]string `json:"fields"`
+		} `json:"error"`
+		// Bitbucket Data Center
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &errResp) != nil {
+		apiErr.Message = strings.TrimSpace(string(body))
+		return apiErr
+	}
+
+	var messages []string
+	if errResp.Error.Message != "" {
+		messages = append(messages, errResp.Error.Message)
+	}
+	fields := make([]string, 0, len(errResp.Error.Fields))
+	for field, problems := range errResp.Error.Fields {
+		fields = append(fields, field+": "+strings.Join(problems, ", "))
+	}
+	sort.Strings(fields)
+	messages = append(messages, fields...)
+	for _, detail := range errResp.Errors {
+		messages = append(messages, detail.Message)
+	}
+	apiErr.Message = strings.Join(messages, "; ")
+	return apiErr
+}
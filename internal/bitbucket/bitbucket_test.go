@@ -0,0 +1,208 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCloudClient(t *testing.T) {
+	var created map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "someone" || password != "app-password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /2.0/repositories/team/repo":
+			w.Write([]byte(`{"mainbranch": {"name": "develop"}}`))
+		case "POST /2.0/repositories/team/repo/pullrequests":
+			json.NewDecoder(r.Body).Decode(&created)
+			if created["title"] == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"type": "error", "error": {"message": "Bad request", "fields": {"title": ["This field is required."]}}}`))
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 9, "title": "feat: x", "draft": true, "links": {"html": {"href": "https://bitbucket.org/team/repo/pull-requests/9"}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewCloudClient(server.URL+"/2.0", Credentials{Username: "someone", Password: "app-password"})
+	ctx := context.Background()
+
+	branch, err := client.DefaultBranch(ctx, "team", "repo")
+	if err != nil || branch != "develop" {
+		t.Errorf("Expected the main branch to be develop, got %q (%v)", branch, err)
+	}
+
+	pr, err := client.CreatePullRequest(ctx, "team", "repo", NewPullRequest{Title: "feat: x", Description: "body", Source: "feature", Destination: "develop", Draft: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pr.ID != 9 || pr.URL != "https://bitbucket.org/team/repo/pull-requests/9" || !pr.Draft {
+		t.Errorf("Unexpected pull request %+v", pr)
+	}
+	source, _ := created["source"].(map[string]any)["branch"].(map[string]any)
+	if source["name"] != "feature" || created["draft"] != true {
+		t.Errorf("Unexpected request %v", created)
+	}
+
+	_, err = client.CreatePullRequest(ctx, "team", "repo", NewPullRequest{Source: "feature", Destination: "develop"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "Bad request; title: This field is required." {
+		t.Errorf("Expected the field error to be reported, got %v", err)
+	}
+}
+
+func TestServerClient(t *testing.T) {
+	var created serverPullRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errors": [{"message": "Authentication failed. Please check your credentials and try again."}]}`))
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /bitbucket/rest/api/1.0/projects/PROJ/repos/repo/branches/default":
+			// An older version without the default-branch endpoint
+			w.Write([]byte(`{"id": "refs/heads/master", "displayId": "master"}`))
+		case "POST /bitbucket/rest/api/1.0/projects/PROJ/repos/repo/pull-requests":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 4, "title": "feat: x", "links": {"self": [{"href": "https://git.example.com/bitbucket/projects/PROJ/repos/repo/pull-requests/4"}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors": [{"message": "Not found"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewServerClient(server.URL+"/bitbucket/rest/api/1.0", Credentials{Token: "secret"})
+	ctx := context.Background()
+
+	branch, err := client.DefaultBranch(ctx, "PROJ", "repo")
+	if err != nil || branch != "master" {
+		t.Errorf("Expected the older endpoint to give master, got %q (%v)", branch, err)
+	}
+
+	pr, err := client.CreatePullRequest(ctx, "PROJ", "repo", NewPullRequest{Title: "feat: x", Source: "feature", Destination: "master"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pr.ID != 4 || !strings.HasSuffix(pr.URL, "/pull-requests/4") {
+		t.Errorf("Unexpected pull request %+v", pr)
+	}
+	if created.FromRef.ID != "refs/heads/feature" || created.ToRef.ID != "refs/heads/master" {
+		t.Errorf("Unexpected request %+v", created)
+	}
+
+	_, err = NewServerClient(server.URL+"/bitbucket/rest/api/1.0", Credentials{}).DefaultBranch(ctx, "PROJ", "repo")
+	if err == nil || !strings.Contains(err.Error(), "Authentication failed") {
+		t.Errorf("Expected an authentication error, got %v", err)
+	}
+}
+
+func TestClientsUpdatePullRequests(t *testing.T) {
+	var cloudUpdate, serverUpdate map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /2.0/repositories/team/repo/pullrequests":
+			if q := r.URL.Query().Get("q"); q != `source.branch.name = "feature" AND state = "OPEN"` {
+				t.Errorf("Unexpected query %q", q)
+			}
+			w.Write([]byte(`{"values": [{"id": 9, "title": "old", "source": {"branch": {"name": "feature"}}, "destination": {"branch": {"name": "develop"}}}]}`))
+		case "PUT /2.0/repositories/team/repo/pullrequests/9":
+			json.NewDecoder(r.Body).Decode(&cloudUpdate)
+			w.Write([]byte(`{"id": 9, "links": {"html": {"href": "https://bitbucket.org/team/repo/pull-requests/9"}}}`))
+		case "GET /rest/api/1.0/projects/PROJ/repos/repo/pull-requests":
+			if r.URL.Query().Get("at") != "refs/heads/feature" || r.URL.Query().Get("direction") != "OUTGOING" {
+				t.Errorf("Unexpected query %q", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"values": [{"id": 4, "version": 2, "title": "old", "fromRef": {"id": "refs/heads/feature"}, "toRef": {"id": "refs/heads/master"}}]}`))
+		case "GET /rest/api/1.0/projects/PROJ/repos/repo/pull-requests/4":
+			w.Write([]byte(`{"id": 4, "version": 3}`))
+		case "PUT /rest/api/1.0/projects/PROJ/repos/repo/pull-requests/4":
+			json.NewDecoder(r.Body).Decode(&serverUpdate)
+			w.Write([]byte(`{"id": 4, "links": {"self": [{"href": "https://git.example.com/projects/PROJ/repos/repo/pull-requests/4"}]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	cloud := NewCloudClient(server.URL+"/2.0", Credentials{Token: "secret"})
+	pulls, err := cloud.OpenPullRequests(ctx, "team", "repo", "feature")
+	if err != nil || len(pulls) != 1 || pulls[0].ID != 9 || pulls[0].Source != "feature" || pulls[0].Destination != "develop" {
+		t.Fatalf("Expected pull request 9 into develop, got %+v (%v)", pulls, err)
+	}
+	pr, err := cloud.UpdatePullRequest(ctx, "team", "repo", 9, "new", "new body")
+	if err != nil || pr.URL != "https://bitbucket.org/team/repo/pull-requests/9" {
+		t.Errorf("Unexpected pull request %+v (%v)", pr, err)
+	}
+	if cloudUpdate["title"] != "new" || cloudUpdate["description"] != "new body" {
+		t.Errorf("Unexpected update %v", cloudUpdate)
+	}
+
+	dataCenter := NewServerClient(server.URL+"/rest/api/1.0", Credentials{Token: "secret"})
+	pulls, err = dataCenter.OpenPullRequests(ctx, "PROJ", "repo", "feature")
+	if err != nil || len(pulls) != 1 || pulls[0].ID != 4 || pulls[0].Source != "feature" || pulls[0].Destination != "master" {
+		t.Fatalf("Expected pull request 4 into master, got %+v (%v)", pulls, err)
+	}
+	pr, err = dataCenter.UpdatePullRequest(ctx, "PROJ", "repo", 4, "new", "new body")
+	if err != nil || !strings.HasSuffix(pr.URL, "/pull-requests/4") {
+		t.Errorf("Unexpected pull request %+v (%v)", pr, err)
+	}
+	// The update names the version read just before it
+	if serverUpdate["version"] != float64(3) || serverUpdate["title"] != "new" {
+		t.Errorf("Unexpected update %v", serverUpdate)
+	}
+}
+
+func TestServerRepository(t *testing.T) {
+	tests := map[string][2]string{
+		"PROJ/repo":               {"PROJ", "repo"},
+		"scm/PROJ/repo":           {"PROJ", "repo"},
+		"bitbucket/scm/PROJ/repo": {"PROJ", "repo"},
+		"scm/~someone/repo":       {"~someone", "repo"},
+	}
+	for path, expected := range tests {
+		if project, repo := ServerRepository(path); project != expected[0] || repo != expected[1] {
+			t.Errorf("ServerRepository(%q) = %q, %q, expected %q", path, project, repo, expected)
+		}
+	}
+}
+
+func TestHosts(t *testing.T) {
+	if !IsCloudHost("Bitbucket.org") || IsServerHost("bitbucket.org") {
+		t.Error("Expected bitbucket.org to be Bitbucket Cloud")
+	}
+	if !IsServerHost("bitbucket.example.com") || IsServerHost("git.example.com") {
+		t.Error("Unexpected Bitbucket Data Center detection")
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	for _, name := range []string{"BITBUCKET_TOKEN", "BITBUCKET_USERNAME", "BITBUCKET_APP_PASSWORD", "BITBUCKET_PASSWORD"} {
+		t.Setenv(name, "")
+	}
+	if !FindCredentials().Empty() {
+		t.Error("Expected no credentials")
+	}
+	t.Setenv("BITBUCKET_USERNAME", "someone")
+	if !FindCredentials().Empty() {
+		t.Error("Expected a username alone not to be enough")
+	}
+	t.Setenv("BITBUCKET_PASSWORD", "password")
+	if credentials := FindCredentials(); credentials.Empty() || credentials.Password != "password" {
+		t.Errorf("Unexpected credentials %+v", credentials)
+	}
+}
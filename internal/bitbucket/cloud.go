@@ -0,0 +1,131 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/IanKnighton/institutionalized/internal/restapi"
+)
+
+// CloudAPIBaseURL is the base URL of the Bitbucket Cloud API
+const CloudAPIBaseURL = "https://api.bitbucket.org/2.0/"
+
+// CloudClient calls the Bitbucket Cloud REST API
+type CloudClient struct {
+	api *restapi.Client
+}
+
+// NewCloudClient creates a client for the Bitbucket Cloud API at baseURL,
+// usually CloudAPIBaseURL
+func NewCloudClient(baseURL string, credentials Credentials) *CloudClient {
+	return &CloudClient{api: restapi.NewClient("Bitbucket", baseURL, credentials.header(), parseError)}
+}
+
+// cloudBranch names a branch in a pull request
+type cloudBranch struct {
+	Branch struct {
+		Name string `json:"name"`
+	} `json:"branch"`
+}
+
+// newCloudBranch returns a pull request end for the branch called name
+func newCloudBranch(name string) cloudBranch {
+	var branch cloudBranch
+	branch.Branch.Name = name
+	return branch
+}
+
+// cloudPullRequest is a pull request in the Bitbucket Cloud API
+type cloudPullRequest struct {
+	ID          int         `json:"id,omitempty"`
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Draft       bool        `json:"draft"`
+	Source      cloudBranch `json:"source"`
+	Destination cloudBranch `json:"destination"`
+	Links       struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"links"`
+}
+
+// DefaultBranch returns the main branch of workspace/repo
+func (c *CloudClient) DefaultBranch(ctx context.Context, workspace, repo string) (string, error) {
+	var repository struct {
+		MainBranch struct {
+			Name string `json:"name"`
+		} `json:"mainbranch"`
+	}
+	if err := c.api.Do(ctx, http.MethodGet, cloudRepoPath(workspace, repo), nil, &repository); err != nil {
+		return "", err
+	}
+	return repository.MainBranch.Name, nil
+}
+
+// CreatePullRequest opens a pull request in workspace/repo
+func (c *CloudClient) CreatePullRequest(ctx context.Context, workspace, repo string, pr NewPullRequest) (*PullRequest, error) {
+	request := cloudPullRequest{
+		Title:       pr.Title,
+		Description: pr.Description,
+		Draft:       pr.Draft,
+		Source:      newCloudBranch(pr.Source),
+		Destination: newCloudBranch(pr.Destination),
+	}
+	var created cloudPullRequest
+	if err := c.api.Do(ctx, http.MethodPost, cloudRepoPath(workspace, repo)+"/pullrequests", request, &created); err != nil {
+		return nil, err
+	}
+	return created.pullRequest(), nil
+}
+
+// OpenPullRequests lists the open pull requests in workspace/repo from the
+// branch source
+func (c *CloudClient) OpenPullRequests(ctx context.Context, workspace, repo, source string) ([]PullRequest, error) {
+	query := url.Values{"q": {fmt.Sprintf(`source.branch.name = %q AND state = "OPEN"`, source)}}
+	var page struct {
+		Values []cloudPullRequest `json:"values"`
+	}
+	if err := c.api.Do(ctx, http.MethodGet, cloudRepoPath(workspace, repo)+"/pullrequests?"+query.Encode(), nil, &page); err != nil {
+		return nil, err
+	}
+	pulls := make([]PullRequest, 0, len(page.Values))
+	for _, pull := range page.Values {
+		pulls = append(pulls, *pull.pullRequest())
+	}
+	return pulls, nil
+}
+
+// UpdatePullRequest changes the title and description of pull request id
+func (c *CloudClient) UpdatePullRequest(ctx context.Context, workspace, repo string, id int, title, description string) (*PullRequest, error) {
+	update := struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}{title, description}
+	var updated cloudPullRequest
+	path := fmt.Sprintf("%s/pullrequests/%d", cloudRepoPath(workspace, repo), id)
+	if err := c.api.Do(ctx, http.MethodPut, path, update, &updated); err != nil {
+		return nil, err
+	}
+	return updated.pullRequest(), nil
+}
+
+// pullRequest converts the API's pull request
+func (p cloudPullRequest) pullRequest() *PullRequest {
+	return &PullRequest{
+		ID:          p.ID,
+		URL:         p.Links.HTML.Href,
+		Title:       p.Title,
+		Description: p.Description,
+		Draft:       p.Draft,
+		Source:      p.Source.Branch.Name,
+		Destination: p.Destination.Branch.Name,
+	}
+}
+
+// cloudRepoPath returns the API path of a repository
+func cloudRepoPath(workspace, repo string) string {
+	return "repositories/" + url.PathEscape(workspace) + "/" + url.PathEscape(repo)
+}
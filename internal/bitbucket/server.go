@@ -0,0 +1,156 @@
+package bitbucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/restapi"
+)
+
+// ServerClient calls the Bitbucket Data Center REST API
+type ServerClient struct {
+	api *restapi.Client
+}
+
+// NewServerClient creates a client for the Bitbucket Data Center API at
+// baseURL. Use ServerAPIBaseURL to find the base URL for a host.
+func NewServerClient(baseURL string, credentials Credentials) *ServerClient {
+	return &ServerClient{api: restapi.NewClient("Bitbucket", baseURL, credentials.header(), parseError)}
+}
+
+// ServerAPIBaseURL returns the REST API base URL for a Bitbucket Data Center
+// host, https://<host>/rest/api/1.0/
+func ServerAPIBaseURL(host string) string {
+	return "https://" + host + "/rest/api/1.0/"
+}
+
+// ServerRepository splits the path of a remote URL into the project key and
+// repository slug. Clone URLs over HTTP have an "scm/" segment, possibly
+// after the instance's context path, which is dropped.
+func ServerRepository(path string) (project, repo string) {
+	if i := strings.LastIndex("/"+path, "/scm/"); i >= 0 {
+		path = path[i+len("/scm/")-1:]
+	}
+	project, repo, _ = strings.Cut(path, "/")
+	return project, repo
+}
+
+// serverRef names a branch in a pull request
+type serverRef struct {
+	ID        string `json:"id"`
+	DisplayID string `json:"displayId,omitempty"`
+}
+
+// serverPullRequest is a pull request in the Bitbucket Data Center API
+type serverPullRequest struct {
+	ID int `json:"id,omitempty"`
+	// Version must be sent back with updates, to detect concurrent changes
+	Version     int       `json:"version"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Draft       bool      `json:"draft,omitempty"`
+	FromRef     serverRef `json:"fromRef"`
+	ToRef       serverRef `json:"toRef"`
+	Links       struct {
+		Self []struct {
+			Href string `json:"href"`
+		} `json:"self"`
+	} `json:"links"`
+}
+
+// DefaultBranch returns the default branch of project/repo. Versions before
+// 7.6 only answer at the older, since deprecated, endpoint.
+func (c *ServerClient) DefaultBranch(ctx context.Context, project, repo string) (string, error) {
+	var branch struct {
+		DisplayID string `json:"displayId"`
+	}
+	err := c.api.Do(ctx, http.MethodGet, serverRepoPath(project, repo)+"/default-branch", nil, &branch)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		err = c.api.Do(ctx, http.MethodGet, serverRepoPath(project, repo)+"/branches/default", nil, &branch)
+	}
+	if err != nil {
+		return "", err
+	}
+	return branch.DisplayID, nil
+}
+
+// CreatePullRequest opens a pull request in project/repo. Draft pull
+// requests need Bitbucket Data Center 8.18 or later.
+func (c *ServerClient) CreatePullRequest(ctx context.Context, project, repo string, pr NewPullRequest) (*PullRequest, error) {
+	request := serverPullRequest{
+		Title:       pr.Title,
+		Description: pr.Description,
+		Draft:       pr.Draft,
+		FromRef:     serverRef{ID: "refs/heads/" + pr.Source},
+		ToRef:       serverRef{ID: "refs/heads/" + pr.Destination},
+	}
+	var created serverPullRequest
+	if err := c.api.Do(ctx, http.MethodPost, serverRepoPath(project, repo)+"/pull-requests", request, &created); err != nil {
+		return nil, err
+	}
+	return created.pullRequest(), nil
+}
+
+// OpenPullRequests lists the open pull requests in project/repo from the
+// branch source
+func (c *ServerClient) OpenPullRequests(ctx context.Context, project, repo, source string) ([]PullRequest, error) {
+	query := url.Values{"at": {"refs/heads/" + source}, "direction": {"OUTGOING"}, "state": {"OPEN"}}
+	var page struct {
+		Values []serverPullRequest `json:"values"`
+	}
+	if err := c.api.Do(ctx, http.MethodGet, serverRepoPath(project, repo)+"/pull-requests?"+query.Encode(), nil, &page); err != nil {
+		return nil, err
+	}
+	pulls := make([]PullRequest, 0, len(page.Values))
+	for _, pull := range page.Values {
+		pulls = append(pulls, *pull.pullRequest())
+	}
+	return pulls, nil
+}
+
+// UpdatePullRequest changes the title and description of pull request id.
+// It reads the pull request first for the version the update must name.
+func (c *ServerClient) UpdatePullRequest(ctx context.Context, project, repo string, id int, title, description string) (*PullRequest, error) {
+	path := fmt.Sprintf("%s/pull-requests/%d", serverRepoPath(project, repo), id)
+	var current serverPullRequest
+	if err := c.api.Do(ctx, http.MethodGet, path, nil, &current); err != nil {
+		return nil, err
+	}
+
+	update := struct {
+		Version     int    `json:"version"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}{current.Version, title, description}
+	var updated serverPullRequest
+	if err := c.api.Do(ctx, http.MethodPut, path, update, &updated); err != nil {
+		return nil, err
+	}
+	return updated.pullRequest(), nil
+}
+
+// pullRequest converts the API's pull request
+func (p serverPullRequest) pullRequest() *PullRequest {
+	pull := &PullRequest{
+		ID:          p.ID,
+		Title:       p.Title,
+		Description: p.Description,
+		Draft:       p.Draft,
+		Source:      strings.TrimPrefix(p.FromRef.ID, "refs/heads/"),
+		Destination: strings.TrimPrefix(p.ToRef.ID, "refs/heads/"),
+	}
+	if len(p.Links.Self) > 0 {
+		pull.URL = p.Links.Self[0].Href
+	}
+	return pull
+}
+
+// serverRepoPath returns the API path of a repository
+func serverRepoPath(project, repo string) string {
+	return "projects/" + url.PathEscape(project) + "/repos/" + url.PathEscape(repo)
+}
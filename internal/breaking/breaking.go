@@ -0,0 +1,92 @@
+// Package breaking detects changes to public APIs that break their users,
+// such as removed functions or changed signatures, by comparing the files of
+// two versions of a repository. Each language is handled by an Analyzer.
+package breaking
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Tree reads the files of one version of a repository. Paths are relative to
+// the repository root and use forward slashes.
+type Tree interface {
+	// Files lists the files directly in a directory; "" or "." is the root.
+	// A directory that doesn't exist has no files.
+	Files(dir string) ([]string, error)
+	// Read returns the content of a file
+	Read(path string) ([]byte, error)
+}
+
+// Break is a change that breaks users of an API
+type Break struct {
+	// Package identifies the API, e.g. the directory of a Go package
+	Package string
+	// Symbol is the changed identifier, e.g. "Client.Do"
+	Symbol string
+	// Change describes what happened, e.g. "removed func"
+	Change string
+	// Detail shows the old and new form, if there is one
+	Detail string
+}
+
+// String describes the break, e.g. "pkg/client: changed signature of func
+// Client.Do: func(int) error → func(int, bool) error"
+func (b Break) String() string {
+	text := fmt.Sprintf("%s: %s %s", b.Package, b.Change, b.Symbol)
+	if b.Detail != "" {
+		text += ": " + b.Detail
+	}
+	return text
+}
+
+// Analyzer finds breaking changes in the APIs of one language
+type Analyzer interface {
+	// Name identifies the analyzer in error messages, e.g. "go"
+	Name() string
+	// Handles reports whether a change to the file can affect an API the
+	// analyzer checks
+	Handles(path string) bool
+	// Compare returns the breaking changes between the old and new tree in
+	// the APIs that contain the changed files
+	Compare(old, new Tree, changed []string) ([]Break, error)
+}
+
+// analyzers holds the analyzers Detect runs
+var analyzers = []Analyzer{GoAnalyzer{}}
+
+// Register adds an analyzer for another language
+func Register(analyzer Analyzer) {
+	analyzers = append(analyzers, analyzer)
+}
+
+// Detect runs every analyzer on the changed files it handles and returns the
+// breaking changes sorted by package and symbol
+func Detect(old, new Tree, changed []string) ([]Break, error) {
+	var breaks []Break
+	for _, analyzer := range analyzers {
+		var handled []string
+		for _, path := range changed {
+			if analyzer.Handles(path) {
+				handled = append(handled, path)
+			}
+		}
+		if len(handled) == 0 {
+			continue
+		}
+
+		found, err := analyzer.Compare(old, new, handled)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", analyzer.Name(), err)
+		}
+		breaks = append(breaks, found...)
+	}
+
+	sort.SliceStable(breaks, func(i, j int) bool {
+		if breaks[i].Package != breaks[j].Package {
+			return breaks[i].Package < breaks[j].Package
+		}
+		return breaks[i].Symbol < breaks[j].Symbol
+	})
+	return breaks, nil
+}
@@ -0,0 +1,131 @@
+package breaking
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// mapTree is a Tree held in memory
+type mapTree map[string]string
+
+func (t mapTree) Files(dir string) ([]string, error) {
+	var files []string
+	for file := range t {
+		if path.Dir(file) == path.Clean(dir) {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (t mapTree) Read(file string) ([]byte, error) {
+	content, ok := t[file]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", file)
+	}
+	return []byte(content), nil
+}
+
+const oldClient = `package client
+
+type Client struct {
+	BaseURL string
+	Timeout int
+	secret  string
+}
+
+func New(url string) *Client { return nil }
+
+func (c *Client) Do(method, path string) error { return nil }
+
+func (c *Client) Close() {}
+
+type Doer interface {
+	Do(method, path string) error
+}
+
+type Removed struct{ Field int }
+
+const Version = "1"
+
+var Debug bool
+`
+
+const newClient = `package client
+
+type Client struct {
+	BaseURL string
+	secret  int
+	Extra   bool
+}
+
+func New(baseURL string) *Client { return nil }
+
+func (c *Client) Do(method, path string, retry bool) error { return nil }
+
+type Doer interface {
+	Do(method, path string) error
+	Close() error
+}
+
+const Version = "2"
+
+var Debug = true
+`
+
+func TestDetectGoBreaks(t *testing.T) {
+	old := mapTree{"pkg/client/client.go": oldClient}
+	new := mapTree{"pkg/client/client.go": newClient}
+
+	breaks, err := Detect(old, new, []string{"pkg/client/client.go"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, b := range breaks {
+		got = append(got, b.String())
+	}
+	expected := []string{
+		"pkg/client: removed method Client.Close",
+		"pkg/client: changed signature of method Client.Do: func (*Client) (string, string) error → func (*Client) (string, string, bool) error",
+		"pkg/client: removed field Client.Timeout",
+		"pkg/client: added interface method Doer.Close: existing implementations of Doer no longer satisfy it",
+		"pkg/client: removed type Removed",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected breaks:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestDetectIgnoresNonAPIChanges(t *testing.T) {
+	old := mapTree{
+		"internal/x/x.go": "package x\n\nfunc Gone() {}\n",
+		"main.go":         "package main\n\nfunc Helper() {}\n",
+		"lib/a.go":        "package lib\n\nfunc Moved() {}\n",
+		"lib/a_test.go":   "package lib\n\nfunc TestOnly() {}\n",
+	}
+	new := mapTree{
+		"main.go":   "package main\n",
+		"lib/a.go":  "package lib\n",
+		"lib/b.go":  "package lib\n\nfunc Moved() {}\n",
+		"lib/c.txt": "not go",
+	}
+
+	breaks, err := Detect(old, new, []string{"internal/x/x.go", "main.go", "lib/a.go", "lib/a_test.go", "lib/b.go"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(breaks) != 0 {
+		t.Errorf("Expected no breaks, got %v", breaks)
+	}
+
+	// Code that doesn't parse is reported rather than guessed at
+	if _, err := Detect(old, mapTree{"lib/a.go": "package lib\nfunc {"}, []string{"lib/a.go"}); err == nil {
+		t.Error("Expected a parse error")
+	}
+}
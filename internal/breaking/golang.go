@@ -0,0 +1,335 @@
+package breaking
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path"
+	"strings"
+)
+
+// GoAnalyzer compares the exported API of Go packages: functions, methods,
+// types, struct fields, interface methods, variables and constants. Internal
+// and main packages can't be imported by other modules, so they have no API
+// to break.
+type GoAnalyzer struct{}
+
+// Name identifies the analyzer
+func (GoAnalyzer) Name() string {
+	return "go"
+}
+
+// Handles reports whether the file is non-test Go code in an importable package
+func (GoAnalyzer) Handles(file string) bool {
+	if !strings.HasSuffix(file, ".go") || strings.HasSuffix(file, "_test.go") {
+		return false
+	}
+	for _, dir := range strings.Split(path.Dir(file), "/") {
+		if dir == "internal" || dir == "testdata" || dir == "vendor" {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare compares the exported API of each package with a changed file
+func (a GoAnalyzer) Compare(old, new Tree, changed []string) ([]Break, error) {
+	var breaks []Break
+	seen := make(map[string]bool)
+	for _, file := range changed {
+		dir := path.Dir(file)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+
+		before, err := goAPI(old, dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the previous version of %s: %w", dir, err)
+		}
+		after, err := goAPI(new, dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the new version of %s: %w", dir, err)
+		}
+		breaks = append(breaks, compareGoAPI(dir, before, after)...)
+	}
+	return breaks, nil
+}
+
+// goSymbol is an exported identifier of a Go package
+type goSymbol struct {
+	// kind is e.g. "func", "method", "field" or "interface method"
+	kind string
+	// signature is the part of the declaration users depend on, e.g. the
+	// parameter and result types of a function
+	signature string
+	// owner is the type a method or field belongs to
+	owner string
+}
+
+// describe returns the symbol's kind and signature, e.g. "func(int) error"
+func (s goSymbol) describe() string {
+	if s.signature == "" {
+		return s.kind
+	}
+	if strings.HasPrefix(s.signature, "func") {
+		return s.signature
+	}
+	return s.kind + " " + s.signature
+}
+
+// goAPI returns the exported symbols of the package in dir by name. Methods
+// and fields are named "Type.Name". A directory without Go files or with a
+// main package has no API.
+func goAPI(tree Tree, dir string) (map[string]goSymbol, error) {
+	files, err := tree.Files(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	api := make(map[string]goSymbol)
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if !strings.HasSuffix(file, ".go") || strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		src, err := tree.Read(file)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := parser.ParseFile(fset, file, src, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		if parsed.Name.Name == "main" {
+			return nil, nil
+		}
+		collectGoSymbols(fset, parsed, api)
+	}
+	return api, nil
+}
+
+// collectGoSymbols adds the exported symbols declared in a file to api
+func collectGoSymbols(fset *token.FileSet, file *ast.File, api map[string]goSymbol) {
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if !decl.Name.IsExported() {
+				continue
+			}
+			if decl.Recv == nil || len(decl.Recv.List) == 0 {
+				api[decl.Name.Name] = goSymbol{kind: "func", signature: funcSignature(fset, "", decl.Type)}
+				continue
+			}
+			receiver := decl.Recv.List[0].Type
+			owner := receiverName(receiver)
+			if !ast.IsExported(owner) {
+				continue
+			}
+			api[owner+"."+decl.Name.Name] = goSymbol{kind: "method", signature: funcSignature(fset, "("+typeString(fset, receiver)+") ", decl.Type), owner: owner}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if spec.Name.IsExported() {
+						collectGoType(fset, spec, api)
+					}
+				case *ast.ValueSpec:
+					kind := "var"
+					if decl.Tok == token.CONST {
+						kind = "const"
+					}
+					signature := ""
+					if spec.Type != nil {
+						signature = typeString(fset, spec.Type)
+					}
+					for _, name := range spec.Names {
+						if name.IsExported() {
+							api[name.Name] = goSymbol{kind: kind, signature: signature}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// collectGoType adds an exported type and its exported fields or interface
+// methods to api
+func collectGoType(fset *token.FileSet, spec *ast.TypeSpec, api map[string]goSymbol) {
+	name := spec.Name.Name
+	params := typeParams(fset, spec.TypeParams)
+
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		api[name] = goSymbol{kind: "type", signature: params + "struct"}
+		for _, field := range t.Fields.List {
+			for _, fieldName := range fieldNames(field) {
+				if ast.IsExported(fieldName) {
+					api[name+"."+fieldName] = goSymbol{kind: "field", signature: typeString(fset, field.Type), owner: name}
+				}
+			}
+		}
+	case *ast.InterfaceType:
+		api[name] = goSymbol{kind: "type", signature: params + "interface"}
+		for _, method := range t.Methods.List {
+			if len(method.Names) == 0 {
+				// Embedded interfaces and type constraints
+				embedded := typeString(fset, method.Type)
+				api[name+"."+embedded] = goSymbol{kind: "embedded interface", owner: name}
+				continue
+			}
+			for _, methodName := range method.Names {
+				if funcType, ok := method.Type.(*ast.FuncType); ok {
+					api[name+"."+methodName.Name] = goSymbol{kind: "interface method", signature: funcSignature(fset, "", funcType), owner: name}
+				}
+			}
+		}
+	default:
+		signature := params + typeString(fset, spec.Type)
+		if spec.Assign.IsValid() {
+			signature = "= " + signature
+		}
+		api[name] = goSymbol{kind: "type", signature: signature}
+	}
+}
+
+// compareGoAPI returns the changes from before to after that break users:
+// removed or changed symbols, and methods added to interfaces, which existing
+// implementations don't have
+func compareGoAPI(pkg string, before, after map[string]goSymbol) []Break {
+	var breaks []Break
+	for name, old := range before {
+		// A removed type is reported once, not for each of its members
+		if _, ownerKept := after[old.owner]; old.owner != "" && !ownerKept {
+			continue
+		}
+
+		current, ok := after[name]
+		switch {
+		case !ok:
+			breaks = append(breaks, Break{Package: pkg, Symbol: name, Change: "removed " + old.kind})
+		case old.kind != current.kind:
+			breaks = append(breaks, Break{Package: pkg, Symbol: name, Change: "changed " + old.kind, Detail: old.describe() + " → " + current.describe()})
+		case old.signature != current.signature && !untyped(old, current):
+			change := "changed type of " + old.kind
+			switch {
+			case old.kind == "type":
+				change = "changed definition of type"
+			case strings.HasPrefix(old.signature, "func"):
+				change = "changed signature of " + old.kind
+			}
+			breaks = append(breaks, Break{Package: pkg, Symbol: name, Change: change, Detail: old.signature + " → " + current.signature})
+		}
+	}
+
+	for name, current := range after {
+		if _, existed := before[name]; existed || (current.kind != "interface method" && current.kind != "embedded interface") {
+			continue
+		}
+		if owner, ok := before[current.owner]; ok && strings.HasSuffix(owner.signature, "interface") {
+			breaks = append(breaks, Break{Package: pkg, Symbol: name, Change: "added " + current.kind, Detail: "existing implementations of " + current.owner + " no longer satisfy it"})
+		}
+	}
+	return breaks
+}
+
+// untyped reports whether a variable or constant has no explicit type in
+// either version, so a different signature doesn't mean a different type
+func untyped(old, current goSymbol) bool {
+	return (old.kind == "var" || old.kind == "const") && (old.signature == "" || current.signature == "")
+}
+
+// funcSignature formats a function type without parameter names, so renaming
+// a parameter isn't reported, e.g. "func[T any](int, ...string) (T, error)".
+// Methods include their receiver, e.g. "func (*Client) (string) error".
+func funcSignature(fset *token.FileSet, receiver string, funcType *ast.FuncType) string {
+	signature := "func"
+	if receiver != "" {
+		signature += " " + receiver
+	}
+	signature += typeParams(fset, funcType.TypeParams) + "(" + strings.Join(fieldTypes(fset, funcType.Params), ", ") + ")"
+	results := fieldTypes(fset, funcType.Results)
+	switch len(results) {
+	case 0:
+	case 1:
+		signature += " " + results[0]
+	default:
+		signature += " (" + strings.Join(results, ", ") + ")"
+	}
+	return signature
+}
+
+// typeParams formats type parameters with their constraints, e.g. "[K comparable, V any]"
+func typeParams(fset *token.FileSet, params *ast.FieldList) string {
+	if params == nil || len(params.List) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, param := range params.List {
+		constraint := typeString(fset, param.Type)
+		for _, name := range param.Names {
+			parts = append(parts, name.Name+" "+constraint)
+		}
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// fieldTypes lists the type of each parameter or result, once per name
+func fieldTypes(fset *token.FileSet, fields *ast.FieldList) []string {
+	if fields == nil {
+		return nil
+	}
+	var types []string
+	for _, field := range fields.List {
+		t := typeString(fset, field.Type)
+		for range max(len(field.Names), 1) {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// fieldNames returns the names of a struct field; an embedded field is named
+// after its type
+func fieldNames(field *ast.Field) []string {
+	if len(field.Names) == 0 {
+		return []string{receiverName(field.Type)}
+	}
+	names := make([]string, len(field.Names))
+	for i, name := range field.Names {
+		names[i] = name.Name
+	}
+	return names
+}
+
+// receiverName returns the name of the type in a receiver or embedded field
+// such as "*pkg.Client[T]"
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// typeString formats a type expression as written in the source
+func typeString(fset *token.FileSet, expr ast.Expr) string {
+	var b bytes.Buffer
+	if err := printer.Fprint(&b, fset, expr); err != nil {
+		return fmt.Sprintf("%T", expr)
+	}
+	// Multi-line types such as inline structs are compared on one line
+	return strings.Join(strings.Fields(b.String()), " ")
+}
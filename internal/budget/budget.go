@@ -0,0 +1,409 @@
+// Package budget estimates the size of a diff in tokens and plans which files
+// are sent in full, summarized or only listed so the prompt fits a provider's
+// context window.
+package budget
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/IanKnighton/institutionalized/internal/gitdiff"
+)
+
+// EstimateTokens returns a conservative estimate of the number of tokens in
+// text. Tokenizers average 3-4 bytes per token on code, so this assumes 3.
+func EstimateTokens(text string) int {
+	return (len(text) + 2) / 3
+}
+
+// Limits are the number of diff tokens that fit in each kind of request
+type Limits struct {
+	// Prompt is the space for the diff in the final commit message prompt
+	Prompt int
+	// Chunk is the space for the diff in each summary request
+	Chunk int
+}
+
+// Action is what happens to a file's diff when it doesn't all fit
+type Action int
+
+const (
+	// ActionInclude sends the file's diff as is
+	ActionInclude Action = iota
+	// ActionSummarize replaces the file's diff with a generated summary
+	ActionSummarize
+	// ActionOmit only lists the file and its line counts
+	ActionOmit
+)
+
+// String returns a human-readable name for the action
+func (a Action) String() string {
+	switch a {
+	case ActionSummarize:
+		return "summarized"
+	case ActionOmit:
+		return "omitted"
+	default:
+		return "included"
+	}
+}
+
+// FileReport describes what a plan does with one file
+type FileReport struct {
+	Path     string
+	Priority Priority
+	Tokens   int
+	Action   Action
+	// Parts is the number of summary requests the file is split into
+	Parts int
+	// Truncated is set when the file was too large to summarize completely
+	Truncated bool
+}
+
+// Chunk is a piece of a file's diff to summarize in a single request
+type Chunk struct {
+	Path  string
+	Part  int
+	Parts int
+	Diff  string
+}
+
+// Label returns the file path, with the part number for files split into several chunks
+func (c Chunk) Label() string {
+	if c.Parts <= 1 {
+		return c.Path
+	}
+	return fmt.Sprintf("%s (part %d of %d)", c.Path, c.Part, c.Parts)
+}
+
+// Plan decides which files of a diff are sent in full, summarized or only
+// listed so that the result fits the prompt limit
+type Plan struct {
+	Limits Limits
+	// Tokens is the estimated size of the whole diff
+	Tokens int
+	Files  []FileReport
+	// Chunks are the summary requests needed, in file order
+	Chunks []Chunk
+
+	files []gitdiff.File
+}
+
+// Costs of the lines that replace a file's diff in the final prompt
+const (
+	summaryTokens = 150
+	listingTokens = 20
+)
+
+// NewPlan plans how to fit the files into the limits. Files are kept in full
+// by priority until the prompt is full; the rest are summarized, and
+// lockfiles and generated files are only listed.
+func NewPlan(files []gitdiff.File, limits Limits) Plan {
+	plan := Plan{Limits: limits, files: files, Files: make([]FileReport, len(files))}
+	for i, file := range files {
+		tokens := EstimateTokens(file.String())
+		plan.Tokens += tokens
+		plan.Files[i] = FileReport{Path: file.Path, Priority: Prioritize(file), Tokens: tokens, Action: ActionInclude}
+	}
+	if plan.Tokens <= limits.Prompt {
+		return plan
+	}
+
+	// Consider the most useful files first, keeping diff order among equals
+	order := make([]int, len(files))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return plan.Files[order[a]].Priority > plan.Files[order[b]].Priority
+	})
+
+	remaining := limits.Prompt
+	for _, i := range order {
+		report := &plan.Files[i]
+		switch {
+		case report.Priority == PriorityLow:
+			report.Action = ActionOmit
+			remaining -= listingTokens
+		case report.Tokens <= remaining:
+			remaining -= report.Tokens
+		default:
+			report.Action = ActionSummarize
+			remaining -= summaryTokens
+		}
+	}
+
+	// Make room for the summaries by summarizing the least useful files that
+	// were kept, then by listing summarized files if that isn't enough
+	for i := len(order) - 1; i >= 0 && remaining < 0; i-- {
+		if report := &plan.Files[order[i]]; report.Action == ActionInclude {
+			report.Action = ActionSummarize
+			remaining += report.Tokens - summaryTokens
+		}
+	}
+	for i := len(order) - 1; i >= 0 && remaining < 0; i-- {
+		if report := &plan.Files[order[i]]; report.Action == ActionSummarize {
+			report.Action = ActionOmit
+			remaining += summaryTokens - listingTokens
+		}
+	}
+
+	for i, file := range files {
+		if plan.Files[i].Action != ActionSummarize {
+			continue
+		}
+		chunks, truncated := splitFile(file, limits.Chunk)
+		plan.Files[i].Parts = len(chunks)
+		plan.Files[i].Truncated = truncated
+		plan.Chunks = append(plan.Chunks, chunks...)
+	}
+	return plan
+}
+
+// Fits reports whether the whole diff is sent without changes
+func (p Plan) Fits() bool {
+	return p.Tokens <= p.Limits.Prompt
+}
+
+// Assemble builds the text sent in place of the diff from the files kept in
+// full, the summaries of the chunks (in the order of Chunks) and a list of
+// the omitted files
+func (p Plan) Assemble(summaries []string) string {
+	var b strings.Builder
+	for i, file := range p.files {
+		if p.Files[i].Action == ActionInclude {
+			b.WriteString(file.String())
+		}
+	}
+
+	if len(p.Chunks) > 0 {
+		b.WriteString("\nSummaries of changes too large to include in full:\n")
+		for i, chunk := range p.Chunks {
+			summary := ""
+			if i < len(summaries) {
+				summary = strings.TrimSpace(summaries[i])
+			}
+			fmt.Fprintf(&b, "\n%s:\n%s\n", chunk.Label(), summary)
+		}
+	}
+
+	var omitted []string
+	for i, file := range p.files {
+		if p.Files[i].Action == ActionOmit {
+			omitted = append(omitted, fmt.Sprintf("- %s (+%d -%d)", file.Path, file.Added, file.Deleted))
+		}
+	}
+	if len(omitted) > 0 {
+		b.WriteString("\nOther changed files (lockfiles, generated files or too large to show):\n")
+		b.WriteString(strings.Join(omitted, "\n"))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Summarize requests a summary of every chunk, running up to parallel
+// requests at a time, and returns the assembled text
+func (p Plan) Summarize(parallel int, summarize func(label, diff string) (string, error)) (string, error) {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	summaries := make([]string, len(p.Chunks))
+	errs := make([]error, len(p.Chunks))
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, chunk := range p.Chunks {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, chunk Chunk) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			summaries[i], errs[i] = summarize(chunk.Label(), chunk.Diff)
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return "", fmt.Errorf("failed to summarize %s: %w", p.Chunks[i].Label(), err)
+		}
+	}
+	return p.Assemble(summaries), nil
+}
+
+// maxChunksPerFile caps the summary requests made for a single file; the
+// rest of a larger file is dropped
+const maxChunksPerFile = 8
+
+// splitFile splits a file's hunks into chunks that fit the limit, each
+// starting with the file header. Hunks too large for a chunk on their own
+// are split by lines. It reports whether the file had to be cut short.
+func splitFile(file gitdiff.File, limit int) ([]Chunk, bool) {
+	var diffs []string
+	current := file.Header
+	for _, hunk := range file.Hunks {
+		for _, piece := range splitHunk(hunk, limit-EstimateTokens(file.Header)) {
+			if current != file.Header && EstimateTokens(current+piece) > limit {
+				diffs = append(diffs, current)
+				current = file.Header
+			}
+			current += piece
+		}
+	}
+	diffs = append(diffs, current)
+
+	truncated := false
+	if len(diffs) > maxChunksPerFile {
+		diffs = diffs[:maxChunksPerFile]
+		truncated = true
+	}
+
+	chunks := make([]Chunk, len(diffs))
+	for i, diff := range diffs {
+		chunks[i] = Chunk{Path: file.Path, Part: i + 1, Parts: len(diffs), Diff: diff}
+	}
+	return chunks, truncated
+}
+
+// splitHunk splits a hunk into pieces of whole lines that fit in limit
+// tokens. Only the first piece keeps the "@@" line.
+func splitHunk(hunk string, limit int) []string {
+	if EstimateTokens(hunk) <= limit {
+		return []string{hunk}
+	}
+
+	var pieces []string
+	var current strings.Builder
+	for _, line := range strings.SplitAfter(hunk, "\n") {
+		if current.Len() > 0 && EstimateTokens(current.String()+line) > limit {
+			pieces = append(pieces, current.String())
+			current.Reset()
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		pieces = append(pieces, current.String())
+	}
+	return pieces
+}
+
+// Priority ranks how much a file's diff says about the intent of a change
+type Priority int
+
+const (
+	// PriorityLow is for lockfiles, vendored and generated files
+	PriorityLow Priority = iota
+	// PriorityNormal is for tests, documentation and configuration
+	PriorityNormal
+	// PriorityHigh is for source code
+	PriorityHigh
+)
+
+// String returns a human-readable name for the priority
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "lockfile or generated"
+	case PriorityHigh:
+		return "source"
+	default:
+		return "other"
+	}
+}
+
+// Lockfiles are dependency lockfiles by base name. Together with
+// GeneratedSuffixes and VendoredDirs they are the files that get low
+// priority here and that are left out of prompts by default (see
+// ignore.DefaultPatterns), so the two always agree.
+var Lockfiles = []string{
+	"package-lock.json",
+	"npm-shrinkwrap.json",
+	"yarn.lock",
+	"pnpm-lock.yaml",
+	"bun.lockb",
+	"go.sum",
+	"Cargo.lock",
+	"Gemfile.lock",
+	"poetry.lock",
+	"Pipfile.lock",
+	"uv.lock",
+	"composer.lock",
+	"mix.lock",
+	"Podfile.lock",
+	"flake.lock",
+	"packages.lock.json",
+}
+
+// GeneratedSuffixes mark generated, minified or snapshot files
+var GeneratedSuffixes = []string{
+	".min.js", ".min.css", ".map", ".pb.go", ".pb.gw.go", "_pb2.py", "_pb2_grpc.py",
+	".pb.h", ".pb.cc", "_generated.go", ".gen.go", ".generated.ts", ".snap",
+}
+
+// VendoredDirs are directories of third-party code, build output or test
+// snapshots, matched at any depth
+var VendoredDirs = []string{"vendor/", "node_modules/", "third_party/", "dist/", "__snapshots__/"}
+
+// sourceExtensions are the file extensions treated as source code
+var sourceExtensions = map[string]bool{
+	".go": true, ".py": true, ".js": true, ".jsx": true, ".ts": true, ".tsx": true,
+	".mjs": true, ".cjs": true, ".rs": true, ".java": true, ".kt": true, ".scala": true,
+	".c": true, ".h": true, ".cc": true, ".cpp": true, ".hpp": true, ".cs": true,
+	".rb": true, ".php": true, ".swift": true, ".m": true, ".ex": true, ".exs": true,
+	".erl": true, ".hs": true, ".lua": true, ".dart": true, ".vue": true, ".svelte": true,
+	".sh": true, ".sql": true, ".zig": true,
+}
+
+// Prioritize ranks a file by its path and, for generated code, its content
+func Prioritize(file gitdiff.File) Priority {
+	if priority := Classify(file.Path); priority != PriorityHigh {
+		return priority
+	}
+	// Go and many other generators mark their output near the top
+	for _, hunk := range file.Hunks {
+		if strings.Contains(hunk, "DO NOT EDIT") && strings.Contains(hunk, "generated") {
+			return PriorityLow
+		}
+	}
+	return PriorityHigh
+}
+
+// Classify ranks a file by its path alone
+func Classify(filePath string) Priority {
+	base := path.Base(filePath)
+	if slices.Contains(Lockfiles, base) {
+		return PriorityLow
+	}
+	for _, suffix := range GeneratedSuffixes {
+		if strings.HasSuffix(base, suffix) {
+			return PriorityLow
+		}
+	}
+	for _, dir := range VendoredDirs {
+		if strings.HasPrefix(filePath, dir) || strings.Contains(filePath, "/"+dir) {
+			return PriorityLow
+		}
+	}
+
+	if isTestFile(filePath) || !sourceExtensions[path.Ext(base)] {
+		return PriorityNormal
+	}
+	return PriorityHigh
+}
+
+// isTestFile reports whether the path looks like a test file
+func isTestFile(filePath string) bool {
+	base := path.Base(filePath)
+	return strings.HasSuffix(base, "_test.go") ||
+		strings.Contains(base, ".test.") ||
+		strings.Contains(base, ".spec.") ||
+		strings.HasPrefix(base, "test_") ||
+		strings.HasPrefix(filePath, "test/") ||
+		strings.HasPrefix(filePath, "tests/") ||
+		strings.Contains(filePath, "/test/") ||
+		strings.Contains(filePath, "/tests/")
+}
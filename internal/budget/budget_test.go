@@ -0,0 +1,130 @@
+package budget
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/IanKnighton/institutionalized/internal/gitdiff"
+)
+
+// fileDiff builds a diff for a file with the given number of added lines per hunk
+func fileDiff(path string, hunks ...int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "diff --git a/%s b/%s\n--- a/%s\n+++ b/%s\n", path, path, path, path)
+	for i, lines := range hunks {
+		fmt.Fprintf(&b, "@@ -%d,0 +%d,%d @@\n", i*100, i*100, lines)
+		for j := 0; j < lines; j++ {
+			fmt.Fprintf(&b, "+line %d of hunk %d in %s\n", j, i, path)
+		}
+	}
+	return b.String()
+}
+
+func TestClassify(t *testing.T) {
+	tests := map[string]Priority{
+		"cmd/commit.go":                 PriorityHigh,
+		"web/src/App.tsx":               PriorityHigh,
+		"cmd/commit_test.go":            PriorityNormal,
+		"README.md":                     PriorityNormal,
+		"go.sum":                        PriorityLow,
+		"frontend/package-lock.json":    PriorityLow,
+		"vendor/github.com/x/y/y.go":    PriorityLow,
+		"api/v1/service.pb.go":          PriorityLow,
+		"static/app.min.js":             PriorityLow,
+		"internal/vendorlib/handler.go": PriorityHigh,
+	}
+	for path, expected := range tests {
+		if got := Classify(path); got != expected {
+			t.Errorf("Classify(%q) = %v, expected %v", path, got, expected)
+		}
+	}
+}
+
+func TestPrioritizeDetectsGeneratedCode(t *testing.T) {
+	diff := "diff --git a/zz.go b/zz.go\n@@ -0,0 +1 @@\n+// Code generated by stringer. DO NOT EDIT.\n"
+	if got := Prioritize(gitdiff.Parse(diff)[0]); got != PriorityLow {
+		t.Errorf("Expected generated Go file to have low priority, got %v", got)
+	}
+}
+
+func TestPlanKeepsSmallDiff(t *testing.T) {
+	diff := fileDiff("main.go", 5)
+	plan := NewPlan(gitdiff.Parse(diff), Limits{Prompt: 1000, Chunk: 1000})
+	if !plan.Fits() || len(plan.Chunks) != 0 {
+		t.Fatalf("Expected small diff to fit, got %+v", plan.Files)
+	}
+	if plan.Assemble(nil) != diff {
+		t.Errorf("Expected the diff to be sent unchanged")
+	}
+}
+
+func TestPlanPrioritizesSource(t *testing.T) {
+	diff := fileDiff("package-lock.json", 300) + fileDiff("docs/guide.md", 40) + fileDiff("main.go", 40)
+	files := gitdiff.Parse(diff)
+	mainTokens := EstimateTokens(files[2].String())
+
+	plan := NewPlan(files, Limits{Prompt: mainTokens + summaryTokens + listingTokens, Chunk: 10000})
+
+	actions := map[string]Action{}
+	for _, report := range plan.Files {
+		actions[report.Path] = report.Action
+	}
+	if actions["main.go"] != ActionInclude || actions["docs/guide.md"] != ActionSummarize || actions["package-lock.json"] != ActionOmit {
+		t.Fatalf("Unexpected actions: %v", actions)
+	}
+	if len(plan.Chunks) != 1 || plan.Chunks[0].Path != "docs/guide.md" {
+		t.Fatalf("Expected one chunk for docs/guide.md, got %+v", plan.Chunks)
+	}
+
+	text, err := plan.Summarize(2, func(label, diff string) (string, error) {
+		return "- rewrote the guide", nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{"+++ b/main.go", "docs/guide.md:\n- rewrote the guide", "- package-lock.json (+300 -0)"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected %q in assembled text:\n%s", expected, text)
+		}
+	}
+	if strings.Contains(text, "+++ b/docs/guide.md") {
+		t.Errorf("Expected the summarized diff to be left out")
+	}
+}
+
+func TestPlanSplitsLargeFiles(t *testing.T) {
+	files := gitdiff.Parse(fileDiff("big.go", 50, 50, 50, 150))
+	chunkLimit := EstimateTokens(files[0].Header+files[0].Hunks[0]) * 2
+
+	plan := NewPlan(files, Limits{Prompt: summaryTokens, Chunk: chunkLimit})
+
+	report := plan.Files[0]
+	if report.Action != ActionSummarize || report.Truncated {
+		t.Fatalf("Expected big.go to be summarized in full, got %+v", report)
+	}
+	if report.Parts != 4 || len(plan.Chunks) != 4 {
+		t.Fatalf("Expected 4 chunks, got %d", len(plan.Chunks))
+	}
+	for _, chunk := range plan.Chunks {
+		if !strings.HasPrefix(chunk.Diff, "diff --git a/big.go") {
+			t.Errorf("Expected every chunk to start with the file header")
+		}
+		if EstimateTokens(chunk.Diff) > chunkLimit {
+			t.Errorf("Chunk %s has %d tokens, limit is %d", chunk.Label(), EstimateTokens(chunk.Diff), chunkLimit)
+		}
+	}
+	if !strings.Contains(plan.Chunks[3].Diff, "+line 149 of hunk 3") {
+		t.Errorf("Expected the last chunk to end with the oversized hunk")
+	}
+}
+
+func TestPlanTruncatesHugeFiles(t *testing.T) {
+	files := gitdiff.Parse(fileDiff("huge.go", 5000))
+
+	plan := NewPlan(files, Limits{Prompt: summaryTokens, Chunk: 500})
+
+	if report := plan.Files[0]; !report.Truncated || report.Parts != maxChunksPerFile {
+		t.Errorf("Expected huge.go to be cut to %d parts, got %+v", maxChunksPerFile, report)
+	}
+}
@@ -0,0 +1,263 @@
+// Package commitlint reads the rules of a repository's commitlint
+// configuration that matter when generating commit messages: the allowed
+// types and scopes and the length limits.
+package commitlint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/conventional"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the commitlint rules found in a repository
+type Config struct {
+	// Path is the file the rules were read from
+	Path string
+	// Types and Scopes are the values of type-enum and scope-enum; empty if
+	// the rule isn't set
+	Types  []string
+	Scopes []string
+	// HeaderMaxLength and BodyMaxLineLength are 0 if the rule isn't set
+	HeaderMaxLength   int
+	BodyMaxLineLength int
+}
+
+// configFiles are the files commitlint looks for, in its order of precedence
+var configFiles = []string{
+	".commitlintrc",
+	".commitlintrc.json",
+	".commitlintrc.yaml",
+	".commitlintrc.yml",
+	".commitlintrc.js",
+	".commitlintrc.cjs",
+	".commitlintrc.mjs",
+	".commitlintrc.ts",
+	"commitlint.config.js",
+	"commitlint.config.cjs",
+	"commitlint.config.mjs",
+	"commitlint.config.ts",
+}
+
+// conventionalPreset is the shared config most repositories extend
+const conventionalPreset = "@commitlint/config-conventional"
+
+// Load reads the commitlint config in dir. It returns nil if there is none.
+func Load(dir string) (*Config, error) {
+	for _, name := range configFiles {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var raw rawConfig
+		switch filepath.Ext(name) {
+		case ".js", ".cjs", ".mjs", ".ts":
+			raw = parseScript(string(data))
+		default:
+			// JSON is valid YAML, so one parser covers both
+			if err := yaml.Unmarshal(data, &raw); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+			}
+		}
+		return raw.config(path)
+	}
+
+	// package.json may carry the config under a "commitlint" key
+	path := filepath.Join(dir, "package.json")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pkg struct {
+		Commitlint *rawConfig `json:"commitlint"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, fmt.Errorf("failed to parse package.json: %w", err)
+	}
+	if pkg.Commitlint == nil {
+		return nil, nil
+	}
+	return pkg.Commitlint.config(path)
+}
+
+// rawConfig is a commitlint config as written. Rules are arrays of
+// [level, applicable, value]; extends is a string or a list.
+type rawConfig struct {
+	Extends any              `yaml:"extends" json:"extends"`
+	Rules   map[string][]any `yaml:"rules" json:"rules"`
+}
+
+// config extracts the rules that matter from a raw config, starting from
+// the conventional preset if the config extends it
+func (raw rawConfig) config(path string) (*Config, error) {
+	c := &Config{Path: path}
+	for _, extends := range stringList(raw.Extends) {
+		if extends == conventionalPreset || extends == "@commitlint/config-angular" {
+			c.Types = conventional.DefaultRules().TypeNames()
+			c.HeaderMaxLength = 100
+			c.BodyMaxLineLength = 100
+		}
+	}
+
+	for name, rule := range raw.Rules {
+		value, enabled, err := ruleValue(rule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %s in %s: %w", name, filepath.Base(path), err)
+		}
+		switch name {
+		case "type-enum":
+			c.Types = nil
+			if enabled {
+				c.Types = stringList(value)
+			}
+		case "scope-enum":
+			c.Scopes = nil
+			if enabled {
+				c.Scopes = stringList(value)
+			}
+		case "header-max-length":
+			c.HeaderMaxLength = 0
+			if enabled {
+				c.HeaderMaxLength = intValue(value)
+			}
+		case "body-max-line-length":
+			c.BodyMaxLineLength = 0
+			if enabled {
+				c.BodyMaxLineLength = intValue(value)
+			}
+		}
+	}
+	return c, nil
+}
+
+// ruleValue returns the value of a rule and whether it is enforced: its
+// level is above 0 (off) and it applies "always"
+func ruleValue(rule []any) (any, bool, error) {
+	if len(rule) == 0 {
+		return nil, false, nil
+	}
+	level := intValue(rule[0])
+	if level < 0 || level > 2 {
+		return nil, false, fmt.Errorf("level must be 0, 1 or 2")
+	}
+	if level == 0 || len(rule) < 3 {
+		return nil, false, nil
+	}
+	applicable, _ := rule[1].(string)
+	return rule[2], applicable == "always", nil
+}
+
+// stringList converts a string or a list of strings
+func stringList(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []any:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// intValue converts a number decoded from YAML or JSON
+func intValue(value any) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+	return 0
+}
+
+// Patterns for the parts of a JavaScript or TypeScript config that matter.
+// Configs that compute their rules can't be read this way; only rules
+// written out as literals are found.
+var (
+	scriptRulePattern    = regexp.MustCompile(`['"]?([a-z-]+)['"]?\s*:\s*\[\s*(\d)\s*,\s*['"](always|never)['"]\s*,\s*(\[[^\]]*\]|\d+)`)
+	scriptExtendsPattern = regexp.MustCompile(`extends\s*:\s*(\[[^\]]*\]|['"][^'"]*['"])`)
+	scriptStringPattern  = regexp.MustCompile(`['"]([^'"]*)['"]`)
+)
+
+// parseScript extracts literal rules from a JavaScript or TypeScript config
+func parseScript(source string) rawConfig {
+	raw := rawConfig{Rules: map[string][]any{}}
+	if match := scriptExtendsPattern.FindStringSubmatch(source); match != nil {
+		raw.Extends = scriptStrings(match[1])
+	}
+	for _, match := range scriptRulePattern.FindAllStringSubmatch(source, -1) {
+		var value any = scriptStrings(match[4])
+		if !strings.HasPrefix(match[4], "[") {
+			value = match[4]
+		}
+		level, _ := strconv.Atoi(match[2])
+		raw.Rules[match[1]] = []any{level, match[3], value}
+	}
+	return raw
+}
+
+// scriptStrings returns the string literals in a JavaScript expression
+func scriptStrings(expression string) []any {
+	var list []any
+	for _, match := range scriptStringPattern.FindAllStringSubmatch(expression, -1) {
+		list = append(list, match[1])
+	}
+	return list
+}
+
+// Apply narrows rules to what commitlint accepts. The types and scopes from
+// commitlint replace the configured ones, keeping the descriptions and emoji
+// of configured or default types with the same name, and the stricter of
+// each length limit is used.
+func (c *Config) Apply(rules conventional.Rules) conventional.Rules {
+	if len(c.Types) > 0 {
+		known := conventional.Rules{Types: append(append([]conventional.Type{}, rules.Types...), conventional.DefaultTypes...)}
+		types := make([]conventional.Type, len(c.Types))
+		for i, name := range c.Types {
+			t, ok := known.Type(name)
+			if !ok {
+				t = conventional.Type{Name: name}
+			}
+			types[i] = t
+		}
+		rules.Types = types
+	}
+	if len(c.Scopes) > 0 {
+		rules.Scopes = c.Scopes
+	}
+	rules.MaxHeaderLength = stricter(rules.MaxHeaderLength, c.HeaderMaxLength)
+	rules.BodyWrap = stricter(rules.BodyWrap, c.BodyMaxLineLength)
+	return rules
+}
+
+// stricter returns the smaller limit, treating 0 as no limit
+func stricter(a, b int) int {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
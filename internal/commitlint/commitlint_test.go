@@ -0,0 +1,122 @@
+package commitlint
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/IanKnighton/institutionalized/internal/conventional"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := map[string]string{
+		".commitlintrc.json": `{
+  "extends": ["@commitlint/config-conventional"],
+  "rules": {
+    "type-enum": [2, "always", ["feat", "fix", "deps"]],
+    "scope-enum": [2, "always", ["api", "cli"]],
+    "header-max-length": [2, "always", 60]
+  }
+}`,
+		".commitlintrc.yaml": `extends: "@commitlint/config-conventional"
+rules:
+  type-enum: [2, always, [feat, fix, deps]]
+  scope-enum:
+    - 2
+    - always
+    - [api, cli]
+  header-max-length: [2, always, 60]
+`,
+		"commitlint.config.js": `module.exports = {
+  extends: ['@commitlint/config-conventional'],
+  rules: {
+    'type-enum': [
+      2,
+      'always',
+      ['feat', 'fix', 'deps'],
+    ],
+    'scope-enum': [2, "always", ["api", "cli"]],
+    'header-max-length': [2, 'always', 60],
+  },
+};`,
+		"package.json": `{"name": "web", "commitlint": {"extends": ["@commitlint/config-conventional"], "rules": {"type-enum": [2, "always", ["feat", "fix", "deps"]], "scope-enum": [2, "always", ["api", "cli"]], "header-max-length": [2, "always", 60]}}}`,
+	}
+
+	for name, content := range tests {
+		dir := t.TempDir()
+		writeFile(t, dir, name, content)
+
+		c, err := Load(dir)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if c == nil || c.Path != filepath.Join(dir, name) {
+			t.Fatalf("%s: expected the config to be found, got %+v", name, c)
+		}
+		if !reflect.DeepEqual(c.Types, []string{"feat", "fix", "deps"}) || !reflect.DeepEqual(c.Scopes, []string{"api", "cli"}) {
+			t.Errorf("%s: unexpected types or scopes: %+v", name, c)
+		}
+		// The preset's body limit applies unless overridden
+		if c.HeaderMaxLength != 60 || c.BodyMaxLineLength != 100 {
+			t.Errorf("%s: unexpected limits: %+v", name, c)
+		}
+	}
+}
+
+func TestLoadWithoutConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "package.json", `{"name": "web"}`)
+
+	if c, err := Load(dir); c != nil || err != nil {
+		t.Errorf("Expected no config, got %+v (%v)", c, err)
+	}
+}
+
+func TestDisabledRules(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, ".commitlintrc.yml", `extends: ["@commitlint/config-conventional"]
+rules:
+  type-enum: [0, always, [feat]]
+  body-max-line-length: [0]
+`)
+
+	c, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if c.Types != nil || c.BodyMaxLineLength != 0 || c.HeaderMaxLength != 100 {
+		t.Errorf("Expected disabled rules to be dropped, got %+v", c)
+	}
+}
+
+func TestApply(t *testing.T) {
+	configured := conventional.Rules{
+		Types:           []conventional.Type{{Name: "deps", Description: "Dependency updates", Emoji: "⬆️"}, {Name: "feat", Description: "Our own"}},
+		Scopes:          []string{"web"},
+		MaxHeaderLength: 72,
+		BodyWrap:        72,
+	}
+	c := &Config{Types: []string{"feat", "fix", "deps", "release"}, Scopes: []string{"api"}, HeaderMaxLength: 100, BodyMaxLineLength: 60}
+
+	rules := c.Apply(configured)
+	expected := []conventional.Type{
+		{Name: "feat", Description: "Our own"},
+		{Name: "fix", Description: "A bug fix", Emoji: "🐛"},
+		{Name: "deps", Description: "Dependency updates", Emoji: "⬆️"},
+		{Name: "release"},
+	}
+	if !reflect.DeepEqual(rules.Types, expected) {
+		t.Errorf("Unexpected types: %+v", rules.Types)
+	}
+	if !reflect.DeepEqual(rules.Scopes, []string{"api"}) || rules.MaxHeaderLength != 72 || rules.BodyWrap != 60 {
+		t.Errorf("Unexpected rules: %+v", rules)
+	}
+}
@@ -4,14 +4,309 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/IanKnighton/institutionalized/internal/conventional"
+	"github.com/IanKnighton/institutionalized/internal/scope"
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the application configuration
 type Config struct {
-	UseEmoji  bool      `yaml:"use_emoji"`
-	Providers Providers `yaml:"providers"`
+	UseEmoji  bool         `yaml:"use_emoji"`
+	Providers Providers    `yaml:"providers"`
+	Security  Security     `yaml:"security,omitempty"`
+	Diff      Diff         `yaml:"diff,omitempty"`
+	Commit    CommitFormat `yaml:"commit,omitempty"`
+	Issues    Issues       `yaml:"issues,omitempty"`
+	Trailers  Trailers     `yaml:"trailers,omitempty"`
+	Hook      Hook         `yaml:"hook,omitempty"`
+	Forge     Forge        `yaml:"forge,omitempty"`
+}
+
+// CommitFormat controls the checks applied to generated commit messages
+type CommitFormat struct {
+	// Validate checks generated messages against the Conventional Commits
+	// format, repairs what it can and asks the provider to fix the rest.
+	// Defaults to true.
+	Validate *bool `yaml:"validate,omitempty"`
+	// SubjectMaxLength is the longest allowed first line in characters
+	SubjectMaxLength int `yaml:"subject_max_length,omitempty"`
+	// BodyWrap is the column body lines are wrapped at
+	BodyWrap int `yaml:"body_wrap,omitempty"`
+	// Types lists the allowed commit types with their descriptions and
+	// emoji. Empty uses the standard Conventional Commits types.
+	Types []conventional.Type `yaml:"types,omitempty"`
+	// Scopes lists the allowed scopes. Empty allows any scope.
+	Scopes []string `yaml:"scopes,omitempty"`
+	// InferScope suggests a scope based on the changed paths. Defaults to true.
+	InferScope *bool `yaml:"infer_scope,omitempty"`
+	// ScopeRules map paths to scopes, tried in order before workspaces and
+	// top-level directories
+	ScopeRules []scope.Rule `yaml:"scope_rules,omitempty"`
+	// MaxCombinedScopes is the most scopes a change may touch before it
+	// should rather be split up
+	MaxCombinedScopes int `yaml:"max_combined_scopes,omitempty"`
+	// Commitlint narrows types, scopes and length limits to the rules in the
+	// repository's commitlint config, if it has one. Defaults to true.
+	Commitlint *bool `yaml:"commitlint,omitempty"`
+	// DetectBreaking compares the public APIs in staged files with HEAD and
+	// asks for the commit to be marked as breaking when they break. Defaults
+	// to true.
+	DetectBreaking *bool `yaml:"detect_breaking,omitempty"`
+}
+
+// Defaults for the commit message checks
+const (
+	DefaultSubjectMaxLength = conventional.DefaultMaxHeaderLength
+	DefaultBodyWrap         = conventional.DefaultBodyWrap
+)
+
+// CommitTypes returns the allowed commit types
+func (c CommitFormat) CommitTypes() []conventional.Type {
+	if len(c.Types) > 0 {
+		return c.Types
+	}
+	return conventional.DefaultTypes
+}
+
+// DefaultMaxCombinedScopes is the default for MaxCombinedScopes
+const DefaultMaxCombinedScopes = 2
+
+// InferScopes reports whether scopes are suggested from the changed paths
+func (c CommitFormat) InferScopes() bool {
+	return c.InferScope == nil || *c.InferScope
+}
+
+// CombinedScopesLimit returns the most scopes a commit may combine
+func (c CommitFormat) CombinedScopesLimit() int {
+	if c.MaxCombinedScopes > 0 {
+		return c.MaxCombinedScopes
+	}
+	return DefaultMaxCombinedScopes
+}
+
+// UseCommitlint reports whether the repository's commitlint config applies
+func (c CommitFormat) UseCommitlint() bool {
+	return c.Commitlint == nil || *c.Commitlint
+}
+
+// DetectBreakingChanges reports whether staged API changes are checked for
+// breaking changes
+func (c CommitFormat) DetectBreakingChanges() bool {
+	return c.DetectBreaking == nil || *c.DetectBreaking
+}
+
+// ValidateMessages reports whether generated messages are checked
+func (c CommitFormat) ValidateMessages() bool {
+	return c.Validate == nil || *c.Validate
+}
+
+// MaxSubjectLength returns the longest allowed first line
+func (c CommitFormat) MaxSubjectLength() int {
+	if c.SubjectMaxLength > 0 {
+		return c.SubjectMaxLength
+	}
+	return DefaultSubjectMaxLength
+}
+
+// WrapColumn returns the column body lines are wrapped at
+func (c CommitFormat) WrapColumn() int {
+	if c.BodyWrap > 0 {
+		return c.BodyWrap
+	}
+	return DefaultBodyWrap
+}
+
+// Issues controls how issue references found in the branch name are added
+// to commit messages and pull requests
+type Issues struct {
+	// Patterns are regular expressions matching issue keys in branch names.
+	// The first capture group, or the whole match, is the key; keys made of
+	// digits become "#123". Empty uses issues.DefaultPatterns.
+	Patterns []string `yaml:"patterns,omitempty"`
+	// Commit is where references go in commit messages.
+	// Valid values: "trailer" (default), "prefix", "both", "off"
+	Commit string `yaml:"commit,omitempty"`
+	// Trailer is the token of the commit trailer. Defaults to "Refs".
+	Trailer string `yaml:"trailer,omitempty"`
+	// PRKeyword starts the line added to pull request bodies for each
+	// reference, e.g. "Closes" (default) or "Fixes". "off" adds no lines.
+	PRKeyword string `yaml:"pr_keyword,omitempty"`
+}
+
+// Issue reference policies for commit messages
+const (
+	IssuesTrailer = "trailer"
+	IssuesPrefix  = "prefix"
+	IssuesBoth    = "both"
+	IssuesOff     = "off"
+)
+
+// Defaults for issue references
+const (
+	DefaultIssueTrailer   = "Refs"
+	DefaultIssuePRKeyword = "Closes"
+)
+
+// CommitPolicy returns where references go in commit messages, defaulting
+// to a trailer
+func (i Issues) CommitPolicy() string {
+	if i.Commit == "" {
+		return IssuesTrailer
+	}
+	return i.Commit
+}
+
+// TrailerToken returns the token of the commit trailer
+func (i Issues) TrailerToken() string {
+	if i.Trailer == "" {
+		return DefaultIssueTrailer
+	}
+	return i.Trailer
+}
+
+// ClosingKeyword returns the keyword of the lines added to pull request
+// bodies, or "" if none are added
+func (i Issues) ClosingKeyword() string {
+	switch i.PRKeyword {
+	case "":
+		return DefaultIssuePRKeyword
+	case IssuesOff:
+		return ""
+	}
+	return i.PRKeyword
+}
+
+// Trailers controls the git trailers added to commit messages
+type Trailers struct {
+	// Signoff adds a Signed-off-by trailer to every commit, as if --signoff
+	// was passed
+	Signoff bool `yaml:"signoff,omitempty"`
+	// Roster is a file listing the people --co-author can refer to, one
+	// "Name <email>" per line with optional aliases before an "=". Relative
+	// paths start at the repository root.
+	Roster string `yaml:"roster,omitempty"`
+	// Add lists trailers added to every commit, written as "Token: value".
+	// "{provider}" in a value is replaced by the provider that wrote the
+	// message.
+	Add []string `yaml:"add,omitempty"`
+}
+
+// Hook controls the prepare-commit-msg hook installed by "hook install"
+type Hook struct {
+	// Timeout is the most seconds the hook waits for a message before it
+	// gives up and leaves the message to the user
+	Timeout int `yaml:"timeout,omitempty"`
+}
+
+// DefaultHookTimeout is the default for Hook.Timeout in seconds
+const DefaultHookTimeout = 30
+
+// TimeoutSeconds returns how long the hook waits for a message
+func (h Hook) TimeoutSeconds() int {
+	if h.Timeout > 0 {
+		return h.Timeout
+	}
+	return DefaultHookTimeout
+}
+
+// Forge controls which code hosting service pull requests are created on.
+// Without settings it is detected from the origin remote's host.
+type Forge struct {
+	// Type forces the forge for every repository.
+	// Valid values: "github", "gitlab", "bitbucket" (Bitbucket Cloud),
+	// "bitbucket-datacenter", "gitea" (also for Forgejo)
+	Type string `yaml:"type,omitempty"`
+	// Hosts name the forge of self-hosted instances whose host names don't
+	// give it away. They take precedence over Type.
+	Hosts map[string]ForgeHost `yaml:"hosts,omitempty"`
+}
+
+// ForgeHost describes the forge running on one host
+type ForgeHost struct {
+	// Type is the forge, with the same values as Forge.Type
+	Type string `yaml:"type"`
+	// APIURL is the REST API base URL, for instances that don't serve the
+	// API at its usual place on the host
+	APIURL string `yaml:"api_url,omitempty"`
+}
+
+// Forge types
+const (
+	ForgeGitHub              = "github"
+	ForgeGitLab              = "gitlab"
+	ForgeBitbucket           = "bitbucket"
+	ForgeBitbucketDataCenter = "bitbucket-datacenter"
+	ForgeGitea               = "gitea"
+	// ForgeForgejo is accepted as another name for ForgeGitea
+	ForgeForgejo = "forgejo"
+)
+
+// ValidForgeType reports whether t names a supported forge
+func ValidForgeType(t string) bool {
+	switch t {
+	case ForgeGitHub, ForgeGitLab, ForgeBitbucket, ForgeBitbucketDataCenter, ForgeGitea, ForgeForgejo:
+		return true
+	}
+	return false
+}
+
+// ForHost returns the configured forge type and API URL for host. The type
+// is "" if the forge should be detected.
+func (f Forge) ForHost(host string) (forgeType, apiURL string) {
+	for name, entry := range f.Hosts {
+		if strings.EqualFold(name, host) {
+			return normalizeForgeType(entry.Type), entry.APIURL
+		}
+	}
+	return normalizeForgeType(f.Type), ""
+}
+
+// normalizeForgeType maps Forgejo onto Gitea, whose API it shares
+func normalizeForgeType(t string) string {
+	t = strings.ToLower(t)
+	if t == ForgeForgejo {
+		return ForgeGitea
+	}
+	return t
+}
+
+// Diff controls which staged changes are sent to providers
+type Diff struct {
+	// Exclude lists gitignore-style patterns for files whose changes are only
+	// listed by name and line counts, in addition to .institutionalizedignore
+	Exclude []string `yaml:"exclude,omitempty"`
+	// DefaultExcludes adds built-in patterns for lockfiles, vendored code,
+	// snapshots, minified bundles and generated protobufs. Defaults to true.
+	DefaultExcludes *bool `yaml:"default_excludes,omitempty"`
+}
+
+// UseDefaultExcludes reports whether the built-in exclude patterns apply
+func (d Diff) UseDefaultExcludes() bool {
+	return d.DefaultExcludes == nil || *d.DefaultExcludes
+}
+
+// Security controls what happens to sensitive data before it is sent to a provider
+type Security struct {
+	// Secrets is the policy for possible secrets found in staged changes and
+	// commit data. Valid values: "block" (default), "redact", "off"
+	Secrets string `yaml:"secrets,omitempty"`
+}
+
+// Secret scanning policies
+const (
+	SecretsBlock  = "block"
+	SecretsRedact = "redact"
+	SecretsOff    = "off"
+)
+
+// SecretsPolicy returns the secret scanning policy, defaulting to block
+func (s Security) SecretsPolicy() string {
+	if s.Secrets == "" {
+		return SecretsBlock
+	}
+	return s.Secrets
 }
 
 // Providers represents the LLM provider configuration
@@ -19,17 +314,189 @@ type Providers struct {
 	OpenAI ProviderConfig `yaml:"openai"`
 	Gemini ProviderConfig `yaml:"gemini"`
 	Claude ProviderConfig `yaml:"claude"`
-	// Priority determines which provider to try first when both are available
-	// Valid values: "openai", "gemini", "claude"
+	Ollama OllamaConfig   `yaml:"ollama"`
+	// OpenAICompatible lists named providers that speak the OpenAI chat
+	// completions API, such as vLLM, LM Studio, LiteLLM or OpenRouter
+	OpenAICompatible []OpenAICompatibleConfig `yaml:"openai_compatible,omitempty"`
+	// Priority determines the order in which providers are tried. It is either
+	// a single provider name or a comma-separated list; providers not listed
+	// are tried afterwards as fallbacks.
+	// Valid names: "openai", "gemini", "claude", "ollama" or the name of an
+	// openai_compatible entry
 	Priority string `yaml:"priority"`
 	// DelayThreshold is the maximum time in seconds to wait for a provider response
 	// before trying the fallback provider (if available)
 	DelayThreshold int `yaml:"delay_threshold"`
+	// Strategy controls how providers are queried
+	// Valid values: "sequential" (default), "race", "best-of"
+	Strategy string `yaml:"strategy,omitempty"`
+	// HedgeDelay is the time in seconds the race strategy waits before also
+	// starting the next provider. 0 starts all providers at once.
+	HedgeDelay float64 `yaml:"hedge_delay,omitempty"`
 }
 
+// Provider query strategies
+const (
+	StrategySequential = "sequential"
+	StrategyRace       = "race"
+	StrategyBestOf     = "best-of"
+)
+
 // ProviderConfig represents configuration for a specific LLM provider
 type ProviderConfig struct {
 	Enabled bool `yaml:"enabled"`
+	// GenerationSettings apply to every request sent to the provider
+	GenerationSettings `yaml:",inline"`
+	// Commit and PR override the settings above for the commit and pr commands
+	Commit GenerationSettings `yaml:"commit,omitempty"`
+	PR     GenerationSettings `yaml:"pr,omitempty"`
+}
+
+// GenerationSettings controls the model and sampling parameters used for
+// requests. Unset values fall back to the provider's defaults.
+type GenerationSettings struct {
+	Model       string   `yaml:"model,omitempty"`
+	Temperature *float64 `yaml:"temperature,omitempty"`
+	TopP        *float64 `yaml:"top_p,omitempty"`
+	MaxTokens   int      `yaml:"max_tokens,omitempty"`
+	// ContextWindow is the model's context size in tokens, used to decide how
+	// much of a large diff fits in a request. Unset uses a built-in estimate
+	// for known models.
+	ContextWindow int `yaml:"context_window,omitempty"`
+}
+
+// Commands that can override provider generation settings
+const (
+	CommandCommit = "commit"
+	CommandPR     = "pr"
+)
+
+// SettingsFor returns the generation settings for the given command, with
+// any per-command overrides applied on top of the provider-wide settings
+func (p ProviderConfig) SettingsFor(command string) GenerationSettings {
+	settings := p.GenerationSettings
+
+	var override GenerationSettings
+	switch command {
+	case CommandCommit:
+		override = p.Commit
+	case CommandPR:
+		override = p.PR
+	}
+
+	if override.Model != "" {
+		settings.Model = override.Model
+	}
+	if override.Temperature != nil {
+		settings.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		settings.TopP = override.TopP
+	}
+	if override.MaxTokens != 0 {
+		settings.MaxTokens = override.MaxTokens
+	}
+	if override.ContextWindow != 0 {
+		settings.ContextWindow = override.ContextWindow
+	}
+
+	return settings
+}
+
+// OllamaConfig represents configuration for a local Ollama server. Unlike the
+// hosted providers it needs no API key, so it is disabled by default.
+type OllamaConfig struct {
+	ProviderConfig `yaml:",inline"`
+	Host           string `yaml:"host"`
+}
+
+// OpenAICompatibleConfig represents a named provider that speaks the OpenAI
+// chat completions API at a custom base URL
+type OpenAICompatibleConfig struct {
+	// Name identifies the provider in priority lists and output
+	Name           string `yaml:"name"`
+	ProviderConfig `yaml:",inline"`
+	// BaseURL is the API root, e.g. "http://localhost:8000/v1"
+	BaseURL string `yaml:"base_url"`
+	// APIKeyEnv is the environment variable holding the API key. Leave empty
+	// for servers that don't require authentication.
+	APIKeyEnv string `yaml:"api_key_env,omitempty"`
+	// Headers are extra HTTP headers sent with every request
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// BuiltinProviderNames lists the providers that don't need an openai_compatible entry
+var BuiltinProviderNames = []string{"openai", "gemini", "claude", "ollama"}
+
+// ProviderNames returns the names of all built-in and configured providers in
+// their default fallback order
+func (p Providers) ProviderNames() []string {
+	names := append([]string{}, BuiltinProviderNames...)
+	for _, compatible := range p.OpenAICompatible {
+		names = append(names, compatible.Name)
+	}
+	return names
+}
+
+// Builtin returns the configuration of a built-in provider by name, or nil if
+// the name is not a built-in provider
+func (p *Providers) Builtin(name string) *ProviderConfig {
+	switch name {
+	case "openai":
+		return &p.OpenAI
+	case "gemini":
+		return &p.Gemini
+	case "claude":
+		return &p.Claude
+	case "ollama":
+		return &p.Ollama.ProviderConfig
+	}
+	return nil
+}
+
+// Provider returns the configuration of a built-in or openai_compatible
+// provider by name, or nil if there is no such provider
+func (p *Providers) Provider(name string) *ProviderConfig {
+	if builtin := p.Builtin(name); builtin != nil {
+		return builtin
+	}
+	for i := range p.OpenAICompatible {
+		if p.OpenAICompatible[i].Name == name {
+			return &p.OpenAICompatible[i].ProviderConfig
+		}
+	}
+	return nil
+}
+
+// validate checks that every openai_compatible provider has a name of its
+// own, so priority lists and config keys can refer to it
+func (p Providers) validate() error {
+	seen := make(map[string]bool)
+	for _, name := range BuiltinProviderNames {
+		seen[name] = true
+	}
+	for _, compatible := range p.OpenAICompatible {
+		if compatible.Name == "" {
+			return fmt.Errorf("openai_compatible provider with base_url %q has no name", compatible.BaseURL)
+		}
+		if seen[compatible.Name] {
+			return fmt.Errorf("duplicate provider name %q in openai_compatible: names must be unique and differ from the built-in providers", compatible.Name)
+		}
+		seen[compatible.Name] = true
+	}
+	return nil
+}
+
+// PriorityOrder returns the provider names listed in Priority, in order
+func (p Providers) PriorityOrder() []string {
+	var order []string
+	for _, name := range strings.Split(p.Priority, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			order = append(order, name)
+		}
+	}
+	return order
 }
 
 // DefaultConfig returns the default configuration
@@ -46,8 +513,22 @@ func DefaultConfig() *Config {
 			Claude: ProviderConfig{
 				Enabled: true,
 			},
+			Ollama: OllamaConfig{
+				ProviderConfig: ProviderConfig{
+					Enabled: false,
+					GenerationSettings: GenerationSettings{
+						Model: "llama3.2",
+					},
+				},
+				Host: "http://localhost:11434",
+			},
 			Priority:       "openai",
 			DelayThreshold: 10,
+			Strategy:       StrategySequential,
+			HedgeDelay:     2,
+		},
+		Security: Security{
+			Secrets: SecretsBlock,
 		},
 	}
 }
@@ -73,6 +554,9 @@ func LoadConfig() (*Config, error) {
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return DefaultConfig(), nil
 	}
+	if err := config.Providers.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", configPath, err)
+	}
 
 	return &config, nil
 }
@@ -111,25 +595,3 @@ func getConfigPath() (string, error) {
 
 	return filepath.Join(homeDir, ".config", "institutionalized", "config.yaml"), nil
 }
-
-// GetEmojiForCommitType returns the appropriate emoji for a commit type
-func GetEmojiForCommitType(commitType string) string {
-	emojiMap := map[string]string{
-		"feat":     "✨",
-		"fix":      "🐛",
-		"docs":     "📚",
-		"style":    "💄",
-		"refactor": "♻️",
-		"test":     "✅",
-		"chore":    "🔧",
-		"perf":     "⚡",
-		"ci":       "👷",
-		"build":    "🏗️",
-		"revert":   "⏪",
-	}
-
-	if emoji, exists := emojiMap[commitType]; exists {
-		return emoji + " "
-	}
-	return ""
-}
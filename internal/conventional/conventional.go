@@ -0,0 +1,373 @@
+package conventional
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Message is a commit message in the Conventional Commits 1.0 format:
+//
+//	type(scope)!: description
+//
+//	body
+//
+//	footers
+type Message struct {
+	// Emoji is an optional gitmoji-style prefix before the type
+	Emoji       string
+	Type        string
+	Scope       string
+	Breaking    bool
+	Description string
+	Body        string
+	Footers     []Footer
+}
+
+// Footer is a git trailer-style line such as "Refs: #123" or
+// "BREAKING CHANGE: drop v1 API"
+type Footer struct {
+	Token string
+	// Separator is ": " or " #"
+	Separator string
+	Value     string
+}
+
+// String formats the footer as it appears in the message
+func (f Footer) String() string {
+	return f.Token + f.Separator + f.Value
+}
+
+// BreakingChangeToken is the footer token that marks a breaking change
+const BreakingChangeToken = "BREAKING CHANGE"
+
+// headerPattern matches "type(scope)!: description", optionally preceded by
+// an emoji (any run of non-ASCII characters, which covers variation selectors)
+var headerPattern = regexp.MustCompile(`^([^\x00-\x7F]+ ?)?([A-Za-z][A-Za-z0-9-]*)(?:\(([^()]*)\))?(!)?: *(.*)$`)
+
+// footerPattern matches the first line of a footer
+var footerPattern = regexp.MustCompile(`^(BREAKING[ -]CHANGE|[A-Za-z][A-Za-z0-9-]*)(: | #)(.*)$`)
+
+// Header returns the first line of the message
+func (m Message) Header() string {
+	var b strings.Builder
+	b.WriteString(m.Emoji)
+	b.WriteString(m.Type)
+	if m.Scope != "" {
+		b.WriteString("(" + m.Scope + ")")
+	}
+	if m.Breaking {
+		b.WriteString("!")
+	}
+	b.WriteString(": ")
+	b.WriteString(m.Description)
+	return b.String()
+}
+
+// String formats the message with blank lines between header, body and footers
+func (m Message) String() string {
+	parts := []string{m.Header()}
+	if m.Body != "" {
+		parts = append(parts, m.Body)
+	}
+	if len(m.Footers) > 0 {
+		footers := make([]string, len(m.Footers))
+		for i, footer := range m.Footers {
+			footers[i] = footer.String()
+		}
+		parts = append(parts, strings.Join(footers, "\n"))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// scopeSeparators split a combined scope such as "api,web", as commitlint does
+var scopeSeparators = regexp.MustCompile(`\s*[,/\\]\s*`)
+
+// ScopeNames returns the scopes of a combined scope such as "api,web"
+func (m Message) ScopeNames() []string {
+	if m.Scope == "" {
+		return nil
+	}
+	return scopeSeparators.Split(m.Scope, -1)
+}
+
+// IsBreaking reports whether the message marks a breaking change, with "!"
+// or a BREAKING CHANGE footer
+func (m Message) IsBreaking() bool {
+	if m.Breaking {
+		return true
+	}
+	for _, footer := range m.Footers {
+		if footer.Token == BreakingChangeToken || footer.Token == "BREAKING-CHANGE" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseError describes why text isn't a Conventional Commits message
+type ParseError struct {
+	Header string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("first line %q is not in the form \"type(scope): description\"", e.Header)
+}
+
+// Parse parses a commit message. Only the header is required to follow the
+// grammar; any paragraphs after it form the body, except a final paragraph
+// made of footers.
+func Parse(text string) (Message, error) {
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	header, rest, _ := strings.Cut(text, "\n")
+
+	match := headerPattern.FindStringSubmatch(strings.TrimSpace(header))
+	if match == nil || strings.TrimSpace(match[5]) == "" {
+		return Message{}, &ParseError{Header: header}
+	}
+	msg := Message{
+		Emoji:       match[1],
+		Type:        match[2],
+		Scope:       strings.TrimSpace(match[3]),
+		Breaking:    match[4] == "!",
+		Description: strings.TrimSpace(match[5]),
+	}
+
+	paragraphs := splitParagraphs(rest)
+	if n := len(paragraphs); n > 0 {
+		if footers, ok := parseFooters(paragraphs[n-1]); ok {
+			msg.Footers = footers
+			paragraphs = paragraphs[:n-1]
+		}
+	}
+	msg.Body = strings.Join(paragraphs, "\n\n")
+	return msg, nil
+}
+
+// splitParagraphs splits text at blank lines, dropping empty paragraphs
+func splitParagraphs(text string) []string {
+	var paragraphs []string
+	var current []string
+	flush := func() {
+		if len(current) > 0 {
+			paragraphs = append(paragraphs, strings.Join(current, "\n"))
+			current = nil
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			flush()
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+	return paragraphs
+}
+
+// parseFooters parses a paragraph as footers. Lines that don't start a new
+// footer continue the previous one. It reports false if the paragraph doesn't
+// start with a footer.
+func parseFooters(paragraph string) ([]Footer, bool) {
+	var footers []Footer
+	for _, line := range strings.Split(paragraph, "\n") {
+		if match := footerPattern.FindStringSubmatch(line); match != nil {
+			token := match[1]
+			if token == "BREAKING-CHANGE" || token == "BREAKING CHANGE" {
+				token = BreakingChangeToken
+			} else if strings.Contains(token, " ") {
+				return nil, false
+			}
+			footers = append(footers, Footer{Token: token, Separator: match[2], Value: match[3]})
+			continue
+		}
+		if len(footers) == 0 {
+			return nil, false
+		}
+		footers[len(footers)-1].Value += "\n" + line
+	}
+	return footers, len(footers) > 0
+}
+
+// AddFooters appends footers to a commit message, skipping those it already
+// has. They join the footer paragraph at the end of the message, if there is
+// one, or start a new paragraph. The message doesn't have to follow the
+// Conventional Commits format.
+func AddFooters(text string, footers []Footer) string {
+	text = strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), " \t\n")
+	_, rest, _ := strings.Cut(text, "\n")
+
+	var existing []Footer
+	hasFooters := false
+	if paragraphs := splitParagraphs(rest); len(paragraphs) > 0 {
+		existing, hasFooters = parseFooters(paragraphs[len(paragraphs)-1])
+	}
+
+	var added []string
+	for _, footer := range footers {
+		if hasFooter(existing, footer) {
+			continue
+		}
+		existing = append(existing, footer)
+		added = append(added, footer.String())
+	}
+	if len(added) == 0 {
+		return text
+	}
+
+	if hasFooters {
+		text += "\n"
+	} else {
+		text += "\n\n"
+	}
+	return text + strings.Join(added, "\n")
+}
+
+// hasFooter reports whether footers contain one with the same token, ignoring
+// case, and value
+func hasFooter(footers []Footer, footer Footer) bool {
+	for _, existing := range footers {
+		if strings.EqualFold(existing.Token, footer.Token) && strings.TrimSpace(existing.Value) == strings.TrimSpace(footer.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Type is an allowed commit type
+type Type struct {
+	Name string `yaml:"name"`
+	// Description explains to the model when to use the type
+	Description string `yaml:"description,omitempty"`
+	// Emoji is put in front of the type when emoji are enabled
+	Emoji string `yaml:"emoji,omitempty"`
+}
+
+// DefaultTypes are the commit types from the Conventional Commits
+// specification and the Angular convention, as used by
+// @commitlint/config-conventional
+var DefaultTypes = []Type{
+	{Name: "feat", Description: "A new feature", Emoji: "✨"},
+	{Name: "fix", Description: "A bug fix", Emoji: "🐛"},
+	{Name: "docs", Description: "Documentation only changes", Emoji: "📚"},
+	{Name: "style", Description: "Changes that do not affect the meaning of the code (white-space, formatting, etc)", Emoji: "💄"},
+	{Name: "refactor", Description: "A code change that neither fixes a bug nor adds a feature", Emoji: "♻️"},
+	{Name: "perf", Description: "A code change that improves performance", Emoji: "⚡"},
+	{Name: "test", Description: "Adding missing tests or correcting existing tests", Emoji: "✅"},
+	{Name: "build", Description: "Changes that affect the build system or external dependencies", Emoji: "🏗️"},
+	{Name: "ci", Description: "Changes to CI configuration files and scripts", Emoji: "👷"},
+	{Name: "chore", Description: "Other changes that don't modify source or test files", Emoji: "🔧"},
+	{Name: "revert", Description: "Reverts a previous commit", Emoji: "⏪"},
+}
+
+// Default limits for the first line and body lines
+const (
+	DefaultMaxHeaderLength = 72
+	DefaultBodyWrap        = 72
+)
+
+// DefaultRules returns the rules used when nothing is configured
+func DefaultRules() Rules {
+	return Rules{Types: DefaultTypes, MaxHeaderLength: DefaultMaxHeaderLength, BodyWrap: DefaultBodyWrap}
+}
+
+// Rules are the checks applied to generated messages on top of the grammar
+type Rules struct {
+	// Types lists the allowed types; empty allows any
+	Types []Type
+	// Scopes lists the allowed scopes; empty allows any
+	Scopes []string
+	// MaxHeaderLength is the longest allowed first line in characters; 0 disables the check
+	MaxHeaderLength int
+	// BodyWrap is the longest allowed body line; 0 disables the check
+	BodyWrap int
+}
+
+// Check returns the rules the message breaks, as instructions that can be
+// shown to the user or sent back to the model
+func Check(text string, rules Rules) []string {
+	msg, err := Parse(text)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var violations []string
+	if _, ok := rules.Type(msg.Type); !ok {
+		violations = append(violations, fmt.Sprintf("type %q is not allowed; use one of: %s", msg.Type, strings.Join(rules.TypeNames(), ", ")))
+	}
+	if len(rules.Scopes) > 0 {
+		for _, scope := range msg.ScopeNames() {
+			if !contains(rules.Scopes, scope) {
+				violations = append(violations, fmt.Sprintf("scope %q is not allowed; use one of: %s, or no scope", scope, strings.Join(rules.Scopes, ", ")))
+			}
+		}
+	}
+	if length := utf8.RuneCountInString(msg.Header()); rules.MaxHeaderLength > 0 && length > rules.MaxHeaderLength {
+		violations = append(violations, fmt.Sprintf("the first line is %d characters long; shorten it to at most %d", length, rules.MaxHeaderLength))
+	}
+	if header, _, _ := strings.Cut(strings.TrimSpace(text), "\n"); strings.TrimSpace(header) != msg.Header() {
+		violations = append(violations, "the first line must be exactly \"type(scope): description\" with a single space after the colon")
+	}
+	if _, rest, ok := strings.Cut(strings.TrimSpace(text), "\n"); ok && !strings.HasPrefix(rest, "\n") {
+		violations = append(violations, "separate the first line from the body with a blank line")
+	}
+	if rules.BodyWrap > 0 {
+		// Code blocks are kept as they are, like wrap does
+		inFence := false
+		for _, line := range strings.Split(msg.Body, "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "```") {
+				inFence = !inFence
+			}
+			if !inFence && utf8.RuneCountInString(line) > rules.BodyWrap && wrappable(line) {
+				violations = append(violations, fmt.Sprintf("wrap body lines at %d characters", rules.BodyWrap))
+				break
+			}
+		}
+	}
+	return violations
+}
+
+// Type returns the allowed type with the given name. Any name is allowed
+// when no types are configured.
+func (r Rules) Type(name string) (Type, bool) {
+	if len(r.Types) == 0 {
+		return Type{Name: name}, true
+	}
+	for _, t := range r.Types {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Type{}, false
+}
+
+// EmojiPrefix returns the emoji of a type followed by a space, as it is put
+// in front of a commit message, or "" if the type has no emoji
+func (r Rules) EmojiPrefix(name string) string {
+	t, ok := r.Type(name)
+	if !ok || t.Emoji == "" {
+		return ""
+	}
+	return t.Emoji + " "
+}
+
+// TypeNames returns the names of the allowed types
+func (r Rules) TypeNames() []string {
+	names := make([]string, len(r.Types))
+	for i, t := range r.Types {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// contains reports whether list holds value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package conventional
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	msg, err := Parse("feat(api)!: drop v1 endpoints\n\nThe v1 API has been deprecated for a year.\n\nBREAKING CHANGE: clients must use /v2\nRefs #123")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if msg.Type != "feat" || msg.Scope != "api" || !msg.Breaking || msg.Description != "drop v1 endpoints" {
+		t.Errorf("Unexpected header: %+v", msg)
+	}
+	if msg.Body != "The v1 API has been deprecated for a year." {
+		t.Errorf("Unexpected body: %q", msg.Body)
+	}
+	if len(msg.Footers) != 2 || msg.Footers[0].Token != BreakingChangeToken || msg.Footers[1].String() != "Refs #123" {
+		t.Errorf("Unexpected footers: %+v", msg.Footers)
+	}
+
+	emoji, err := Parse("✨ feat: add thing")
+	if err != nil || emoji.Emoji != "✨ " || emoji.Type != "feat" {
+		t.Errorf("Expected an emoji prefix to be kept, got %+v (%v)", emoji, err)
+	}
+	if emoji.String() != "✨ feat: add thing" {
+		t.Errorf("Expected the message to round-trip, got %q", emoji.String())
+	}
+
+	for _, invalid := range []string{"Add a thing", "feat add thing", "feat:", "- fix: thing"} {
+		if _, err := Parse(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestAddFooters(t *testing.T) {
+	refs := []Footer{{Token: "Refs", Separator: ": ", Value: "PROJ-1"}}
+
+	tests := []struct {
+		message  string
+		expected string
+	}{
+		{"fix: x", "fix: x\n\nRefs: PROJ-1"},
+		{"fix: x\n\nSome body.\n", "fix: x\n\nSome body.\n\nRefs: PROJ-1"},
+		{"feat!: x\n\nBREAKING CHANGE: y", "feat!: x\n\nBREAKING CHANGE: y\nRefs: PROJ-1"},
+		{"fix: x\n\nrefs: PROJ-1", "fix: x\n\nrefs: PROJ-1"},
+		{"Not conventional", "Not conventional\n\nRefs: PROJ-1"},
+	}
+	for _, test := range tests {
+		if got := AddFooters(test.message, refs); got != test.expected {
+			t.Errorf("AddFooters(%q) = %q, expected %q", test.message, got, test.expected)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	rules := Rules{Types: []Type{{Name: "feat"}, {Name: "fix"}}, Scopes: []string{"api"}, MaxHeaderLength: 30, BodyWrap: 20}
+
+	if violations := Check("fix(api): handle nil\n\nShort body.", rules); len(violations) != 0 {
+		t.Errorf("Expected no violations, got %q", violations)
+	}
+
+	if violations := Check("fix(api,web): x", rules); len(violations) != 1 || !strings.Contains(violations[0], `scope "web"`) {
+		t.Errorf("Expected each part of a combined scope to be checked, got %q", violations)
+	}
+
+	violations := Check("chore(web): a description that is far too long\nthis body line is much longer than twenty characters", rules)
+	expected := []string{"type \"chore\"", "scope \"web\"", "shorten it to at most 30", "blank line", "wrap body lines at 20"}
+	if len(violations) != len(expected) {
+		t.Fatalf("Expected %d violations, got %q", len(expected), violations)
+	}
+	for i, want := range expected {
+		if !strings.Contains(violations[i], want) {
+			t.Errorf("Violation %d = %q, expected it to mention %q", i, violations[i], want)
+		}
+	}
+}
+
+func TestRepair(t *testing.T) {
+	rules := Rules{Types: []Type{{Name: "feat"}, {Name: "fix"}, {Name: "docs"}}, MaxHeaderLength: 72, BodyWrap: 40}
+
+	tests := map[string]string{
+		"Here is your commit message:\n\n```\nfeat: add login.\n```":                                          "feat: add login",
+		`"fix(auth): handle expired tokens"`:                                                                  "fix(auth): handle expired tokens",
+		"**Commit message:** Feature:add login":                                                               "feat: add login",
+		"Sure! Here's a commit message for these changes:\n\nDocs: update README\nExplain the setup":          "docs: update README\n\nExplain the setup",
+		"feat: add export\n\n- adds a CSV export that streams rows instead of loading everything\n\nRefs #12": "feat: add export\n\n- adds a CSV export that streams rows\n  instead of loading everything\n\nRefs #12",
+	}
+	for input, want := range tests {
+		got, violations := Repair(input, rules)
+		if got != want {
+			t.Errorf("Repair(%q) = %q, expected %q", input, got, want)
+		}
+		if len(violations) != 0 {
+			t.Errorf("Repair(%q) left violations: %q", input, violations)
+		}
+	}
+
+	// A header that is too long can't be fixed without the model
+	long := "feat: " + strings.Repeat("word ", 20)
+	if _, violations := Repair(long, rules); len(violations) != 1 || !strings.Contains(violations[0], "shorten") {
+		t.Errorf("Expected a length violation, got %q", violations)
+	}
+
+	// URLs and code are not wrapped
+	body := "fix: x\n\nSee https://example.com/" + strings.Repeat("a", 60) + "\n\n    indented code that is longer than forty characters"
+	if got, _ := Repair(body, rules); !strings.Contains(got, "\nhttps://example.com/") || !strings.Contains(got, "    indented code that is longer than forty characters") {
+		t.Errorf("Unexpected wrapping: %q", got)
+	}
+}
+
+func TestCleanKeepsFencedExamples(t *testing.T) {
+	message := "feat(cli): add config import\n\nExample usage:\n\n```\ninstitutionalized config import\n```"
+	if got := Clean(message + "\n"); got != message {
+		t.Errorf("Expected the code example in the body to be kept, got %q", got)
+	}
+
+	// A fenced message is still unwrapped, with or without a preamble
+	for _, input := range []string{"```\n" + message + "\n```", "Here you go:\n```text\nfeat: add x\n```"} {
+		if got := Clean(input); strings.HasPrefix(got, "```") || strings.Contains(got, "Here you go") {
+			t.Errorf("Clean(%q) = %q, expected the fence to be removed", input, got)
+		}
+	}
+}
+
+func TestFencedLongLinesAreAllowed(t *testing.T) {
+	message := "feat: add thing\n\nExplain it.\n\n```\n" + strings.TrimSpace(strings.Repeat("word ", 30)) + "\n```"
+	if violations := Check(message, DefaultRules()); len(violations) != 0 {
+		t.Errorf("Expected no violations for a long line in a code block, got %v", violations)
+	}
+	repaired, violations := Repair(message, DefaultRules())
+	if repaired != message || len(violations) != 0 {
+		t.Errorf("Expected the message to be kept, got %q with %v", repaired, violations)
+	}
+
+	// Long lines after the block still have to be wrapped
+	if violations := Check(message+"\n\n"+strings.Repeat("word ", 30), DefaultRules()); len(violations) != 1 {
+		t.Errorf("Expected the long line after the block to be reported, got %v", violations)
+	}
+}
@@ -0,0 +1,187 @@
+package conventional
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// typeAliases maps types models commonly invent to the standard ones
+var typeAliases = map[string]string{
+	"feature":       "feat",
+	"features":      "feat",
+	"bugfix":        "fix",
+	"bug":           "fix",
+	"hotfix":        "fix",
+	"doc":           "docs",
+	"documentation": "docs",
+	"tests":         "test",
+	"testing":       "test",
+	"refactoring":   "refactor",
+	"performance":   "perf",
+	"chores":        "chore",
+}
+
+// labelPattern matches labels models put in front of the header, such as
+// "Commit message:" or "Subject:"
+var labelPattern = regexp.MustCompile(`(?i)^(?:(?:suggested |proposed )?commit message|subject|title|header)\s*:\s*`)
+
+// Clean strips the wrapping models add around a commit message: code fences,
+// surrounding quotes, Markdown emphasis, labels and chatty preambles such as
+// "Here is your commit message:"
+func Clean(text string) string {
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	text = unfence(text)
+	text = unquote(text)
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		candidate := cleanHeader(line)
+		if _, err := Parse(candidate); err == nil {
+			// Everything before the first valid header is preamble
+			lines[i] = candidate
+			return strings.TrimSpace(strings.Join(lines[i:], "\n"))
+		}
+	}
+	return text
+}
+
+// unfence returns the contents of the first fenced code block, if the
+// message is wrapped in one. A fence after a valid header is a code example
+// in the body and is kept.
+func unfence(text string) string {
+	start := strings.Index(text, "```")
+	if start < 0 {
+		return text
+	}
+	for _, line := range strings.Split(text[:start], "\n") {
+		if _, err := Parse(cleanHeader(line)); err == nil {
+			return text
+		}
+	}
+	inner := text[start+3:]
+	// Skip the info string, e.g. ```text
+	if newline := strings.Index(inner, "\n"); newline >= 0 {
+		inner = inner[newline+1:]
+	}
+	if end := strings.Index(inner, "```"); end >= 0 {
+		inner = inner[:end]
+	}
+	return strings.TrimSpace(inner)
+}
+
+// unquote removes quotes or backticks wrapped around the whole text
+func unquote(text string) string {
+	for _, quote := range []string{`"""`, `"`, "'", "`", "“"} {
+		closing := quote
+		if quote == "“" {
+			closing = "”"
+		}
+		if len(text) > len(quote)+len(closing) && strings.HasPrefix(text, quote) && strings.HasSuffix(text, closing) {
+			return strings.TrimSpace(text[len(quote) : len(text)-len(closing)])
+		}
+	}
+	return text
+}
+
+// cleanHeader strips labels, Markdown emphasis and quotes from a header line
+func cleanHeader(line string) string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "# ")
+	for _, emphasis := range []string{"**", "__", "`"} {
+		if strings.HasPrefix(line, emphasis) {
+			// Labels may be emphasized on their own: "**Commit message:** feat: x"
+			line = strings.Replace(strings.TrimPrefix(line, emphasis), emphasis, "", 1)
+			line = strings.TrimSpace(line)
+		}
+	}
+	line = labelPattern.ReplaceAllString(line, "")
+	return unquote(strings.TrimSpace(line))
+}
+
+// Repair cleans a generated message and fixes what can be fixed without the
+// model: type aliases and case, spacing, a trailing period in the
+// description, the blank line after the header and body wrapping. It returns
+// the repaired message and the rules it still breaks.
+func Repair(text string, rules Rules) (string, []string) {
+	text = Clean(text)
+	msg, err := Parse(text)
+	if err != nil {
+		return text, Check(text, rules)
+	}
+
+	msg.Type = strings.ToLower(msg.Type)
+	if _, known := rules.Type(msg.Type); !known {
+		if alias, ok := typeAliases[msg.Type]; ok {
+			if _, allowed := rules.Type(alias); allowed {
+				msg.Type = alias
+			}
+		}
+	}
+	msg.Description = strings.TrimRight(msg.Description, ". ")
+	if msg.Emoji != "" && !strings.HasSuffix(msg.Emoji, " ") {
+		msg.Emoji += " "
+	}
+	if rules.BodyWrap > 0 {
+		msg.Body = wrap(msg.Body, rules.BodyWrap)
+	}
+
+	repaired := msg.String()
+	return repaired, Check(repaired, rules)
+}
+
+// listItemPattern matches the marker of a list item so wrapped lines can be
+// indented under its text
+var listItemPattern = regexp.MustCompile(`^(\s*(?:[-*+]|\d+[.)])\s+)`)
+
+// wrap breaks body lines longer than width at spaces. Short lines are left
+// alone rather than reflowed, and code blocks, indented lines and words too
+// long to break (such as URLs) are kept intact.
+func wrap(body string, width int) string {
+	var out []string
+	inFence := false
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+		}
+		if inFence || utf8.RuneCountInString(line) <= width || !wrappable(line) {
+			out = append(out, line)
+			continue
+		}
+
+		indent := ""
+		if match := listItemPattern.FindString(line); match != "" {
+			indent = strings.Repeat(" ", utf8.RuneCountInString(match))
+		}
+
+		current := ""
+		for _, word := range strings.Fields(line[len(leadingSpace(line)):]) {
+			if current == "" {
+				current = leadingSpace(line) + word
+				continue
+			}
+			if utf8.RuneCountInString(current)+1+utf8.RuneCountInString(word) > width {
+				out = append(out, current)
+				current = indent + word
+				continue
+			}
+			current += " " + word
+		}
+		out = append(out, current)
+	}
+	return strings.Join(out, "\n")
+}
+
+// wrappable reports whether a long line can and should be wrapped: indented
+// code and lines without spaces to break at are left alone
+func wrappable(line string) bool {
+	if strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") {
+		return false
+	}
+	return strings.Contains(strings.TrimSpace(line), " ")
+}
+
+// leadingSpace returns the whitespace a line starts with
+func leadingSpace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
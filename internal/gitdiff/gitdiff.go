@@ -0,0 +1,175 @@
+// Package gitdiff parses unified git diffs into files and hunks, and git diff
+// --numstat output into per-file line counts.
+package gitdiff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// File is the part of a unified git diff that belongs to a single file
+type File struct {
+	// Path is the file's path after the change, or before it for deletions
+	Path string
+	// OldPath is the path before a rename or copy; it equals Path otherwise
+	OldPath string
+	// Header holds the "diff --git" line and extended headers up to the first hunk
+	Header string
+	// Hunks holds each hunk including its "@@" line
+	Hunks   []string
+	Added   int
+	Deleted int
+	Binary  bool
+}
+
+// String returns the file's diff text
+func (f File) String() string {
+	return f.Header + strings.Join(f.Hunks, "")
+}
+
+// Parse splits the output of git diff into files. Text before the first
+// "diff --git" line is ignored.
+func Parse(diff string) []File {
+	var files []File
+	var current *File
+	var hunk strings.Builder
+
+	flushHunk := func() {
+		if current != nil && hunk.Len() > 0 {
+			current.Hunks = append(current.Hunks, hunk.String())
+			hunk.Reset()
+		}
+	}
+
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "diff --git ") {
+			flushHunk()
+			oldPath, newPath := parseDiffLine(line)
+			files = append(files, File{Path: newPath, OldPath: oldPath, Header: line})
+			current = &files[len(files)-1]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		// Everything before the first hunk is header
+		if len(current.Hunks) == 0 && hunk.Len() == 0 && !strings.HasPrefix(line, "@@") {
+			current.Header += line
+			parseHeaderLine(current, line)
+			continue
+		}
+
+		if strings.HasPrefix(line, "@@") {
+			flushHunk()
+		}
+		hunk.WriteString(line)
+
+		switch {
+		case strings.HasPrefix(line, "+"):
+			current.Added++
+		case strings.HasPrefix(line, "-"):
+			current.Deleted++
+		}
+	}
+	flushHunk()
+
+	return files
+}
+
+// parseDiffLine extracts the paths from a "diff --git a/old b/new" line. The
+// header lines that follow are more reliable and override these when present.
+func parseDiffLine(line string) (string, string) {
+	rest := strings.TrimSuffix(strings.TrimPrefix(line, "diff --git "), "\n")
+	if oldPath, newPath, ok := strings.Cut(rest, " b/"); ok {
+		return strings.TrimPrefix(oldPath, "a/"), newPath
+	}
+	return rest, rest
+}
+
+// parseHeaderLine records what an extended header line says about the file
+func parseHeaderLine(file *File, line string) {
+	line = strings.TrimSuffix(line, "\n")
+	switch {
+	case strings.HasPrefix(line, "rename from "):
+		file.OldPath = strings.TrimPrefix(line, "rename from ")
+	case strings.HasPrefix(line, "rename to "):
+		file.Path = strings.TrimPrefix(line, "rename to ")
+	case strings.HasPrefix(line, "--- a/"):
+		file.OldPath = strings.TrimPrefix(line, "--- a/")
+	case strings.HasPrefix(line, "+++ b/"):
+		file.Path = strings.TrimPrefix(line, "+++ b/")
+	case line == "+++ /dev/null":
+		// Deleted files keep their old path
+		file.Path = file.OldPath
+	case strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch":
+		file.Binary = true
+	}
+}
+
+// Stat is a file's line counts from git diff --numstat
+type Stat struct {
+	Path string
+	// OldPath is the path before a rename; it equals Path otherwise
+	OldPath string
+	Added   int
+	Deleted int
+	Binary  bool
+}
+
+// String describes the change, e.g. "go.sum (+12 -3)"
+func (s Stat) String() string {
+	name := s.Path
+	if s.OldPath != s.Path {
+		name = fmt.Sprintf("%s → %s", s.OldPath, s.Path)
+	}
+	if s.Binary {
+		return name + " (binary)"
+	}
+	return fmt.Sprintf("%s (+%d -%d)", name, s.Added, s.Deleted)
+}
+
+// ParseNumstat parses the output of git diff --numstat -z
+func ParseNumstat(output string) ([]Stat, error) {
+	var stats []Stat
+	fields := strings.Split(output, "\x00")
+	for i := 0; i < len(fields); i++ {
+		record := strings.TrimLeft(fields[i], "\n")
+		if record == "" {
+			continue
+		}
+
+		parts := strings.SplitN(record, "\t", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("unexpected numstat record %q", record)
+		}
+
+		stat := Stat{Path: parts[2], OldPath: parts[2]}
+		if parts[0] == "-" && parts[1] == "-" {
+			stat.Binary = true
+		} else {
+			added, addErr := strconv.Atoi(parts[0])
+			deleted, delErr := strconv.Atoi(parts[1])
+			if addErr != nil || delErr != nil {
+				return nil, fmt.Errorf("unexpected numstat record %q", record)
+			}
+			stat.Added, stat.Deleted = added, deleted
+		}
+
+		// Renames and copies leave the path empty and follow with old and new paths
+		if stat.Path == "" {
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("truncated numstat rename record")
+			}
+			stat.OldPath, stat.Path = fields[i+1], fields[i+2]
+			i += 2
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
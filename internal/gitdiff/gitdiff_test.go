@@ -0,0 +1,78 @@
+package gitdiff
+
+import "testing"
+
+const sampleDiff = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,4 @@
+ package main
++import "fmt"
+-func old() {}
+@@ -10,2 +11,3 @@ func main() {
++	fmt.Println("hi")
+diff --git a/old.txt b/new.txt
+similarity index 100%
+rename from old.txt
+rename to new.txt
+diff --git a/gone.go b/gone.go
+deleted file mode 100644
+index 3333333..0000000
+--- a/gone.go
++++ /dev/null
+@@ -1 +0,0 @@
+-package gone
+diff --git a/logo.png b/logo.png
+new file mode 100644
+index 0000000..4444444
+Binary files /dev/null and b/logo.png differ
+`
+
+func TestParse(t *testing.T) {
+	files := Parse(sampleDiff)
+	if len(files) != 4 {
+		t.Fatalf("Expected 4 files, got %d", len(files))
+	}
+
+	main := files[0]
+	if main.Path != "main.go" || len(main.Hunks) != 2 || main.Added != 2 || main.Deleted != 1 {
+		t.Errorf("Unexpected main.go: path %q, %d hunks, +%d -%d", main.Path, len(main.Hunks), main.Added, main.Deleted)
+	}
+	if main.String() != sampleDiff[:len(main.String())] {
+		t.Errorf("Expected file text to round-trip, got:\n%s", main.String())
+	}
+
+	if renamed := files[1]; renamed.Path != "new.txt" || renamed.OldPath != "old.txt" || len(renamed.Hunks) != 0 {
+		t.Errorf("Unexpected rename: %+v", renamed)
+	}
+	if deleted := files[2]; deleted.Path != "gone.go" || deleted.Deleted != 1 {
+		t.Errorf("Unexpected deletion: %+v", deleted)
+	}
+	if binary := files[3]; binary.Path != "logo.png" || !binary.Binary {
+		t.Errorf("Expected logo.png to be binary: %+v", binary)
+	}
+}
+
+func TestParseNumstat(t *testing.T) {
+	output := "3\t1\tmain.go\x00-\t-\tlogo.png\x000\t0\t\x00old name.txt\x00new name.txt\x00"
+
+	stats, err := ParseNumstat(output)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stats) != 3 {
+		t.Fatalf("Expected 3 stats, got %d", len(stats))
+	}
+
+	expected := []string{"main.go (+3 -1)", "logo.png (binary)", "old name.txt → new name.txt (+0 -0)"}
+	for i, stat := range stats {
+		if stat.String() != expected[i] {
+			t.Errorf("Stat %d = %q, expected %q", i, stat.String(), expected[i])
+		}
+	}
+
+	if _, err := ParseNumstat("garbage\x00"); err == nil {
+		t.Error("Expected an error for a malformed record")
+	}
+}
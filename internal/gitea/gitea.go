@@ -0,0 +1,237 @@
+// Package gitea is a small client for the parts of the Gitea REST API that
+// institutionalized needs: looking up a repository and opening and updating
+// pull requests. Forgejo, and so Codeberg, serve the same API.
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/restapi"
+	"gopkg.in/yaml.v3"
+)
+
+// Client calls the Gitea REST API
+type Client struct {
+	api *restapi.Client
+}
+
+// NewClient creates a client for the API at baseURL, authenticating with
+// token. Use APIBaseURL to find the base URL for a host.
+func NewClient(baseURL, token string) *Client {
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+	if token != "" {
+		header.Set("Authorization", "token "+token)
+	}
+	return &Client{api: restapi.NewClient("Gitea", baseURL, header, parseError)}
+}
+
+// APIBaseURL returns the REST API base URL for a host, https://<host>/api/v1/
+func APIBaseURL(host string) string {
+	return "https://" + host + "/api/v1/"
+}
+
+// IsHost reports whether host looks like a Gitea or Forgejo instance:
+// codeberg.org or a host with "gitea" or "forgejo" in its name
+func IsHost(host string) bool {
+	host = strings.ToLower(host)
+	return host == "codeberg.org" || strings.Contains(host, "gitea") || strings.Contains(host, "forgejo")
+}
+
+// Repository is a Gitea repository
+type Repository struct {
+	FullName      string `json:"full_name"`
+	DefaultBranch string `json:"default_branch"`
+}
+
+// NewPullRequest describes a pull request to open. Gitea has no draft flag;
+// use DraftTitle to mark a pull request as work in progress.
+type NewPullRequest struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	// Head is the branch with the changes
+	Head string `json:"head"`
+	// Base is the branch the changes are merged into
+	Base string `json:"base"`
+}
+
+// PullRequest is a pull request as returned by the API
+type PullRequest struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	Head    Branch `json:"head"`
+	Base    Branch `json:"base"`
+}
+
+// Branch is one end of a pull request
+type Branch struct {
+	Ref string `json:"ref"`
+}
+
+// PullRequestUpdate holds the fields of a pull request to change
+type PullRequestUpdate struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// pageSize is how many pull requests are listed per request
+const pageSize = 50
+
+// wipPattern matches the title prefixes Gitea treats as work in progress by
+// default
+var wipPattern = regexp.MustCompile(`(?i)^\s*(wip:|\[wip\])`)
+
+// IsDraftTitle reports whether title marks a pull request as work in
+// progress
+func IsDraftTitle(title string) bool {
+	return wipPattern.MatchString(title)
+}
+
+// DraftTitle returns title with the "WIP:" prefix that makes Gitea and
+// Forgejo treat a pull request as work in progress, which can't be merged
+func DraftTitle(title string) string {
+	if IsDraftTitle(title) {
+		return title
+	}
+	return "WIP: " + title
+}
+
+// APIError is returned when the API answers with an error status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("Gitea API error (HTTP %d)", e.StatusCode)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Repository looks up owner/repo
+func (c *Client) Repository(ctx context.Context, owner, repo string) (*Repository, error) {
+	var repository Repository
+	if err := c.api.Do(ctx, http.MethodGet, repoPath(owner, repo), nil, &repository); err != nil {
+		return nil, err
+	}
+	return &repository, nil
+}
+
+// CreatePullRequest opens a pull request in owner/repo
+func (c *Client) CreatePullRequest(ctx context.Context, owner, repo string, pr NewPullRequest) (*PullRequest, error) {
+	var created PullRequest
+	if err := c.api.Do(ctx, http.MethodPost, repoPath(owner, repo)+"/pulls", pr, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// OpenPullRequests lists the open pull requests in owner/repo from the
+// branch head. The API can't filter by branch, so every page is read.
+func (c *Client) OpenPullRequests(ctx context.Context, owner, repo, head string) ([]PullRequest, error) {
+	var matches []PullRequest
+	for page := 1; ; page++ {
+		query := url.Values{"state": {"open"}, "limit": {fmt.Sprint(pageSize)}, "page": {fmt.Sprint(page)}}
+		var pulls []PullRequest
+		if err := c.api.Do(ctx, http.MethodGet, repoPath(owner, repo)+"/pulls?"+query.Encode(), nil, &pulls); err != nil {
+			return nil, err
+		}
+		for _, pull := range pulls {
+			if pull.Head.Ref == head {
+				matches = append(matches, pull)
+			}
+		}
+		if len(pulls) < pageSize {
+			return matches, nil
+		}
+	}
+}
+
+// UpdatePullRequest changes the title and body of pull request number
+func (c *Client) UpdatePullRequest(ctx context.Context, owner, repo string, number int, update PullRequestUpdate) (*PullRequest, error) {
+	var updated PullRequest
+	path := fmt.Sprintf("%s/pulls/%d", repoPath(owner, repo), number)
+	if err := c.api.Do(ctx, http.MethodPatch, path, update, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// repoPath returns the API path of a repository
+func repoPath(owner, repo string) string {
+	return "repos/" + url.PathEscape(owner) + "/" + url.PathEscape(repo)
+}
+
+// parseError builds an APIError from an error response
+func parseError(statusCode int, body []byte) error {
+	apiErr := &APIError{StatusCode: statusCode}
+	var errResp struct {
+		Message string   `json:"message"`
+		Errors  []string `json:"errors"`
+	}
+	if json.Unmarshal(body, &errResp) != nil {
+		apiErr.Message = strings.TrimSpace(string(body))
+		return apiErr
+	}
+	apiErr.Message = errResp.Message
+	if len(errResp.Errors) > 0 {
+		apiErr.Message += " (" + strings.Join(errResp.Errors, "; ") + ")"
+	}
+	return apiErr
+}
+
+// Token finds a token for host in GITEA_TOKEN, FORGEJO_TOKEN or the logins
+// of tea, Gitea's CLI. It returns "" if there is none.
+func Token(host string) string {
+	for _, name := range []string{"GITEA_TOKEN", "FORGEJO_TOKEN"} {
+		if token := os.Getenv(name); token != "" {
+			return token
+		}
+	}
+	return teaToken(host)
+}
+
+// teaToken reads the token of tea's login for host
+func teaToken(host string) string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "tea", "config.yml"))
+	if err != nil {
+		return ""
+	}
+
+	var config struct {
+		Logins []struct {
+			URL   string `yaml:"url"`
+			Token string `yaml:"token"`
+		} `yaml:"logins"`
+	}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return ""
+	}
+	for _, login := range config.Logins {
+		if u, err := url.Parse(login.URL); err == nil && strings.EqualFold(u.Hostname(), host) {
+			return login.Token
+		}
+	}
+	return ""
+}
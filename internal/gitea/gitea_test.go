@@ -0,0 +1,142 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	var created NewPullRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message": "token is required"}`))
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/repos/owner/repo":
+			w.Write([]byte(`{"full_name": "owner/repo", "default_branch": "main"}`))
+		case "POST /api/v1/repos/owner/repo/pulls":
+			json.NewDecoder(r.Body).Decode(&created)
+			if created.Head == "existing" {
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"message": "pull request already exists for these targets"}`))
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"number": 5, "html_url": "https://codeberg.org/owner/repo/pulls/5"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/api/v1", "secret")
+	ctx := context.Background()
+
+	repository, err := client.Repository(ctx, "owner", "repo")
+	if err != nil || repository.DefaultBranch != "main" {
+		t.Errorf("Expected the default branch to be main, got %+v (%v)", repository, err)
+	}
+
+	pr, err := client.CreatePullRequest(ctx, "owner", "repo", NewPullRequest{Title: DraftTitle("feat: x"), Body: "body", Head: "feature", Base: "main"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pr.Number != 5 || created.Title != "WIP: feat: x" || created.Base != "main" {
+		t.Errorf("Unexpected pull request %+v from request %+v", pr, created)
+	}
+
+	_, err = client.CreatePullRequest(ctx, "owner", "repo", NewPullRequest{Title: "x", Head: "existing", Base: "main"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Expected the conflict to be reported, got %v", err)
+	}
+}
+
+func TestClientUpdatesPullRequests(t *testing.T) {
+	var update PullRequestUpdate
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/repos/owner/repo/pulls":
+			// A full first page without the branch, then the branch's pull
+			// request on the second
+			var pulls []PullRequest
+			if r.URL.Query().Get("page") == "1" {
+				for i := 0; i < pageSize; i++ {
+					pulls = append(pulls, PullRequest{Number: 100 + i, Head: Branch{Ref: "other"}})
+				}
+			} else {
+				pulls = append(pulls, PullRequest{Number: 3, Title: "WIP: old", Head: Branch{Ref: "feature"}, Base: Branch{Ref: "main"}})
+			}
+			json.NewEncoder(w).Encode(pulls)
+		case "PATCH /api/v1/repos/owner/repo/pulls/3":
+			json.NewDecoder(r.Body).Decode(&update)
+			w.Write([]byte(`{"number": 3, "html_url": "https://codeberg.org/owner/repo/pulls/3"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(server.URL+"/api/v1", "secret")
+	ctx := context.Background()
+
+	pulls, err := client.OpenPullRequests(ctx, "owner", "repo", "feature")
+	if err != nil || len(pulls) != 1 || pulls[0].Number != 3 || !IsDraftTitle(pulls[0].Title) {
+		t.Fatalf("Expected work in progress pull request 3, got %+v (%v)", pulls, err)
+	}
+
+	pr, err := client.UpdatePullRequest(ctx, "owner", "repo", 3, PullRequestUpdate{Title: "WIP: new", Body: "new body"})
+	if err != nil || pr.HTMLURL != "https://codeberg.org/owner/repo/pulls/3" {
+		t.Errorf("Unexpected pull request %+v (%v)", pr, err)
+	}
+	if update.Title != "WIP: new" || update.Body != "new body" {
+		t.Errorf("Unexpected update %+v", update)
+	}
+}
+
+func TestDraftTitle(t *testing.T) {
+	tests := map[string]string{
+		"feat: x":      "WIP: feat: x",
+		"WIP: feat: x": "WIP: feat: x",
+		"[wip] x":      "[wip] x",
+	}
+	for title, expected := range tests {
+		if got := DraftTitle(title); got != expected {
+			t.Errorf("DraftTitle(%q) = %q, expected %q", title, got, expected)
+		}
+	}
+}
+
+func TestToken(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("GITEA_TOKEN", "")
+	t.Setenv("FORGEJO_TOKEN", "")
+
+	if err := os.MkdirAll(filepath.Join(dir, "tea"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := "logins:\n  - name: codeberg\n    url: https://codeberg.org\n    token: from-tea\n"
+	if err := os.WriteFile(filepath.Join(dir, "tea", "config.yml"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if token := Token("codeberg.org"); token != "from-tea" {
+		t.Errorf("Expected the token from tea's login, got %q", token)
+	}
+	if token := Token("gitea.example.com"); token != "" {
+		t.Errorf("Expected no token for another host, got %q", token)
+	}
+
+	t.Setenv("FORGEJO_TOKEN", "from-env")
+	if token := Token("gitea.example.com"); token != "from-env" {
+		t.Errorf("Expected FORGEJO_TOKEN to be used, got %q", token)
+	}
+}
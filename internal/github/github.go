@@ -0,0 +1,187 @@
+// Package github is a small client for the parts of the GitHub REST API
+// that institutionalized needs: looking up a repository and opening and
+// updating pull requests. It works with github.com and GitHub Enterprise
+// Server.
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/restapi"
+)
+
+// DefaultHost is the host of github.com
+const DefaultHost = "github.com"
+
+// apiVersion is the REST API version requests are written against
+const apiVersion = "2022-11-28"
+
+// Client calls the GitHub REST API
+type Client struct {
+	api *restapi.Client
+}
+
+// NewClient creates a client for the API at baseURL, authenticating with
+// token. Use APIBaseURL to find the base URL for a host.
+func NewClient(baseURL, token string) *Client {
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github+json")
+	header.Set("X-GitHub-Api-Version", apiVersion)
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return &Client{api: restapi.NewClient("GitHub", baseURL, header, parseError)}
+}
+
+// APIBaseURL returns the REST API base URL for a GitHub host: api.github.com
+// for github.com and https://<host>/api/v3/ for GitHub Enterprise Server.
+// GITHUB_API_URL, which GitHub Actions sets, takes precedence.
+func APIBaseURL(host string) string {
+	if apiURL := os.Getenv("GITHUB_API_URL"); apiURL != "" {
+		return strings.TrimSuffix(apiURL, "/") + "/"
+	}
+	if host == "" || host == DefaultHost {
+		return "https://api.github.com/"
+	}
+	return "https://" + host + "/api/v3/"
+}
+
+// Repository is a GitHub repository
+type Repository struct {
+	FullName      string `json:"full_name"`
+	DefaultBranch string `json:"default_branch"`
+}
+
+// NewPullRequest describes a pull request to open
+type NewPullRequest struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	// Head is the branch with the changes
+	Head string `json:"head"`
+	// Base is the branch the changes are merged into
+	Base  string `json:"base"`
+	Draft bool   `json:"draft,omitempty"`
+}
+
+// PullRequest is a pull request as returned by the API
+type PullRequest struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	Draft   bool   `json:"draft"`
+	Head    Branch `json:"head"`
+	Base    Branch `json:"base"`
+}
+
+// Branch is one end of a pull request
+type Branch struct {
+	Ref string `json:"ref"`
+}
+
+// PullRequestUpdate holds the fields of a pull request to change
+type PullRequestUpdate struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// APIError is returned when the API answers with an error status
+type APIError struct {
+	StatusCode int
+	Message    string
+	// Errors holds the details GitHub gives for validation failures
+	Errors []string
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("GitHub API error (HTTP %d)", e.StatusCode)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if len(e.Errors) > 0 {
+		msg += " (" + strings.Join(e.Errors, "; ") + ")"
+	}
+	return msg
+}
+
+// Repository looks up owner/repo
+func (c *Client) Repository(ctx context.Context, owner, repo string) (*Repository, error) {
+	var repository Repository
+	if err := c.api.Do(ctx, http.MethodGet, repoPath(owner, repo), nil, &repository); err != nil {
+		return nil, err
+	}
+	return &repository, nil
+}
+
+// CreatePullRequest opens a pull request in owner/repo
+func (c *Client) CreatePullRequest(ctx context.Context, owner, repo string, pr NewPullRequest) (*PullRequest, error) {
+	var created PullRequest
+	if err := c.api.Do(ctx, http.MethodPost, repoPath(owner, repo)+"/pulls", pr, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// OpenPullRequests lists the open pull requests in owner/repo from the
+// branch head of the same repository
+func (c *Client) OpenPullRequests(ctx context.Context, owner, repo, head string) ([]PullRequest, error) {
+	query := url.Values{"state": {"open"}, "head": {owner + ":" + head}}
+	var pulls []PullRequest
+	if err := c.api.Do(ctx, http.MethodGet, repoPath(owner, repo)+"/pulls?"+query.Encode(), nil, &pulls); err != nil {
+		return nil, err
+	}
+	return pulls, nil
+}
+
+// UpdatePullRequest changes the title and body of pull request number
+func (c *Client) UpdatePullRequest(ctx context.Context, owner, repo string, number int, update PullRequestUpdate) (*PullRequest, error) {
+	var updated PullRequest
+	path := fmt.Sprintf("%s/pulls/%d", repoPath(owner, repo), number)
+	if err := c.api.Do(ctx, http.MethodPatch, path, update, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// repoPath returns the API path of a repository
+func repoPath(owner, repo string) string {
+	return "repos/" + url.PathEscape(owner) + "/" + url.PathEscape(repo)
+}
+
+// parseError builds an APIError from an error response. Validation errors
+// carry a message or a code per field.
+func parseError(statusCode int, body []byte) error {
+	var errResp struct {
+		Message string `json:"message"`
+		Errors  []struct {
+			Message string `json:"message"`
+			Field   string `json:"field"`
+			Code    string `json:"code"`
+		} `json:"errors"`
+	}
+	apiErr := &APIError{StatusCode: statusCode}
+	if json.Unmarshal(body, &errResp) != nil {
+		apiErr.Message = strings.TrimSpace(string(body))
+		return apiErr
+	}
+
+	apiErr.Message = errResp.Message
+	for _, detail := range errResp.Errors {
+		switch {
+		case detail.Message != "":
+			apiErr.Errors = append(apiErr.Errors, detail.Message)
+		case detail.Field != "":
+			apiErr.Errors = append(apiErr.Errors, detail.Field+" "+detail.Code)
+		case detail.Code != "":
+			apiErr.Errors = append(apiErr.Errors, detail.Code)
+		}
+	}
+	return apiErr
+}
@@ -0,0 +1,179 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeGitHub serves the endpoints the client uses for owner/repo under
+// /api/v3/, as GitHub Enterprise Server does
+func fakeGitHub(t *testing.T, created *NewPullRequest) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/owner/repo", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"full_name": "owner/repo", "default_branch": "trunk"}`))
+	})
+	mux.HandleFunc("POST /api/v3/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(created); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if created.Head == "existing" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"message": "Validation Failed", "errors": [{"resource": "PullRequest", "code": "custom", "message": "A pull request already exists for owner:existing."}]}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"number": 42, "html_url": "https://ghe.example.com/owner/repo/pull/42", "draft": true}`))
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message": "Bad credentials"}`))
+			return
+		}
+		if r.Header.Get("Accept") != "application/vnd.github+json" || r.Header.Get("X-GitHub-Api-Version") == "" {
+			t.Errorf("Missing API headers: %v", r.Header)
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient(t *testing.T) {
+	var created NewPullRequest
+	server := fakeGitHub(t, &created)
+	client := NewClient(server.URL+"/api/v3", "secret")
+	ctx := context.Background()
+
+	repository, err := client.Repository(ctx, "owner", "repo")
+	if err != nil || repository.DefaultBranch != "trunk" {
+		t.Errorf("Expected the default branch to be trunk, got %+v (%v)", repository, err)
+	}
+
+	body := "## Summary\n\nQuotes \"and\" `backticks` survive; $(not run)\n"
+	pr, err := client.CreatePullRequest(ctx, "owner", "repo", NewPullRequest{Title: "feat: add x", Body: body, Head: "feature", Base: "trunk", Draft: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pr.Number != 42 || pr.HTMLURL != "https://ghe.example.com/owner/repo/pull/42" {
+		t.Errorf("Unexpected pull request %+v", pr)
+	}
+	if created.Body != body || created.Head != "feature" || created.Base != "trunk" || !created.Draft {
+		t.Errorf("Unexpected request %+v", created)
+	}
+
+	_, err = client.CreatePullRequest(ctx, "owner", "repo", NewPullRequest{Title: "x", Head: "existing", Base: "trunk"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity ||
+		!strings.Contains(err.Error(), "A pull request already exists") {
+		t.Errorf("Expected the validation error to be reported, got %v", err)
+	}
+
+	_, err = NewClient(server.URL+"/api/v3/", "wrong").Repository(ctx, "owner", "repo")
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "Bad credentials" {
+		t.Errorf("Expected an authentication error, got %v", err)
+	}
+}
+
+func TestClientUpdatesPullRequests(t *testing.T) {
+	var update PullRequestUpdate
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /repos/owner/repo/pulls":
+			if r.URL.Query().Get("head") != "owner:feature" || r.URL.Query().Get("state") != "open" {
+				w.Write([]byte(`[]`))
+				return
+			}
+			w.Write([]byte(`[{"number": 7, "title": "old", "body": "old body", "head": {"ref": "feature"}, "base": {"ref": "main"}}]`))
+		case "PATCH /repos/owner/repo/pulls/7":
+			json.NewDecoder(r.Body).Decode(&update)
+			w.Write([]byte(`{"number": 7, "html_url": "https://github.com/owner/repo/pull/7"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, "secret")
+	ctx := context.Background()
+
+	pulls, err := client.OpenPullRequests(ctx, "owner", "repo", "feature")
+	if err != nil || len(pulls) != 1 || pulls[0].Number != 7 || pulls[0].Base.Ref != "main" {
+		t.Fatalf("Expected pull request 7 into main, got %+v (%v)", pulls, err)
+	}
+	if pulls, err := client.OpenPullRequests(ctx, "owner", "repo", "other"); err != nil || len(pulls) != 0 {
+		t.Errorf("Expected no pull requests, got %+v (%v)", pulls, err)
+	}
+
+	pr, err := client.UpdatePullRequest(ctx, "owner", "repo", 7, PullRequestUpdate{Title: "new", Body: "new body"})
+	if err != nil || pr.HTMLURL != "https://github.com/owner/repo/pull/7" {
+		t.Errorf("Unexpected pull request %+v (%v)", pr, err)
+	}
+	if update.Title != "new" || update.Body != "new body" {
+		t.Errorf("Unexpected update %+v", update)
+	}
+}
+
+func TestAPIBaseURL(t *testing.T) {
+	t.Setenv("GITHUB_API_URL", "")
+	tests := map[string]string{
+		"":                "https://api.github.com/",
+		"github.com":      "https://api.github.com/",
+		"ghe.example.com": "https://ghe.example.com/api/v3/",
+	}
+	for host, expected := range tests {
+		if got := APIBaseURL(host); got != expected {
+			t.Errorf("APIBaseURL(%q) = %q, expected %q", host, got, expected)
+		}
+	}
+
+	t.Setenv("GITHUB_API_URL", "https://api.example.com")
+	if got := APIBaseURL("github.com"); got != "https://api.example.com/" {
+		t.Errorf("Expected GITHUB_API_URL to be used, got %q", got)
+	}
+}
+
+func TestToken(t *testing.T) {
+	// Keep a real gh and its configuration out of the test
+	t.Setenv("PATH", "")
+	dir := t.TempDir()
+	t.Setenv("GH_CONFIG_DIR", dir)
+	for _, name := range []string{"GH_TOKEN", "GITHUB_TOKEN", "GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"} {
+		t.Setenv(name, "")
+	}
+
+	if token := Token("github.com"); token != "" {
+		t.Errorf("Expected no token, got %q", token)
+	}
+
+	hosts := "github.com:\n    user: someone\n    oauth_token: from-gh\nghe.example.com:\n    oauth_token: from-gh-enterprise\n"
+	if err := os.WriteFile(filepath.Join(dir, "hosts.yml"), []byte(hosts), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if token := Token(""); token != "from-gh" {
+		t.Errorf("Expected the token from hosts.yml, got %q", token)
+	}
+	if token := Token("GHE.example.com"); token != "from-gh-enterprise" {
+		t.Errorf("Expected the enterprise token from hosts.yml, got %q", token)
+	}
+
+	t.Setenv("GITHUB_TOKEN", "from-env")
+	if token := Token("github.com"); token != "from-env" {
+		t.Errorf("Expected GITHUB_TOKEN to be used, got %q", token)
+	}
+	if token := Token("ghe.example.com"); token != "from-gh-enterprise" {
+		t.Errorf("Expected GITHUB_TOKEN not to be sent to another host, got %q", token)
+	}
+	t.Setenv("GH_ENTERPRISE_TOKEN", "enterprise-env")
+	if token := Token("ghe.example.com"); token != "enterprise-env" {
+		t.Errorf("Expected GH_ENTERPRISE_TOKEN to be used, got %q", token)
+	}
+}
@@ -0,0 +1,92 @@
+package github
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Token finds a token for host. It checks, in order, the environment
+// variables gh reads (GH_TOKEN and GITHUB_TOKEN for github.com,
+// GH_ENTERPRISE_TOKEN and GITHUB_ENTERPRISE_TOKEN for other hosts), gh's
+// hosts.yml and finally "gh auth token", which also reads tokens gh keeps in
+// the system keyring. It returns "" if there is none.
+func Token(host string) string {
+	if host == "" {
+		host = DefaultHost
+	}
+
+	envVars := []string{"GH_TOKEN", "GITHUB_TOKEN"}
+	if host != DefaultHost {
+		envVars = []string{"GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"}
+	}
+	for _, name := range envVars {
+		if token := os.Getenv(name); token != "" {
+			return token
+		}
+	}
+
+	if token := hostsFileToken(host); token != "" {
+		return token
+	}
+	return ghAuthToken(host)
+}
+
+// ghConfigDir returns the directory gh keeps its configuration in
+func ghConfigDir() string {
+	if dir := os.Getenv("GH_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gh")
+	}
+	if dir := os.Getenv("AppData"); dir != "" {
+		return filepath.Join(dir, "GitHub CLI")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "gh")
+}
+
+// hostsFileToken reads the token for host from gh's hosts.yml. Recent gh
+// versions keep tokens in the system keyring instead, leaving none here.
+func hostsFileToken(host string) string {
+	dir := ghConfigDir()
+	if dir == "" {
+		return ""
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "hosts.yml"))
+	if err != nil {
+		return ""
+	}
+
+	var hosts map[string]struct {
+		OAuthToken string `yaml:"oauth_token"`
+	}
+	if err := yaml.Unmarshal(content, &hosts); err != nil {
+		return ""
+	}
+	for name, entry := range hosts {
+		if strings.EqualFold(name, host) {
+			return entry.OAuthToken
+		}
+	}
+	return ""
+}
+
+// ghAuthToken asks gh for its token for host, if gh is installed
+func ghAuthToken(host string) string {
+	if _, err := exec.LookPath("gh"); err != nil {
+		return ""
+	}
+	output, err := exec.Command("gh", "auth", "token", "--hostname", host).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
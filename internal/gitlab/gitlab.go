@@ -0,0 +1,218 @@
+// Package gitlab is a small client for the parts of the GitLab REST API that
+// institutionalized needs: looking up a project and opening and updating
+// merge requests. It works with gitlab.com and self-hosted instances.
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/restapi"
+)
+
+// DefaultHost is the host of gitlab.com
+const DefaultHost = "gitlab.com"
+
+// Client calls the GitLab REST API
+type Client struct {
+	api *restapi.Client
+}
+
+// NewClient creates a client for the API at baseURL, authenticating with
+// token. Use APIBaseURL to find the base URL for a host.
+func NewClient(baseURL, token string) *Client {
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+	if token != "" {
+		// Personal, project and OAuth tokens are all accepted as bearer tokens
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return &Client{api: restapi.NewClient("GitLab", baseURL, header, parseError)}
+}
+
+// APIBaseURL returns the REST API base URL for a GitLab host,
+// https://<host>/api/v4/. GITLAB_API_URL takes precedence, and in GitLab CI
+// the job's CI_API_V4_URL is used for the instance running the job.
+func APIBaseURL(host string) string {
+	if apiURL := os.Getenv("GITLAB_API_URL"); apiURL != "" {
+		return strings.TrimSuffix(apiURL, "/") + "/"
+	}
+	if apiURL := os.Getenv("CI_API_V4_URL"); apiURL != "" && strings.EqualFold(os.Getenv("CI_SERVER_HOST"), host) {
+		return strings.TrimSuffix(apiURL, "/") + "/"
+	}
+	if host == "" {
+		host = DefaultHost
+	}
+	return "https://" + host + "/api/v4/"
+}
+
+// IsHost reports whether host looks like a GitLab instance: gitlab.com, a
+// host with "gitlab" in its name, or the instance named by GITLAB_HOST or,
+// in GitLab CI, CI_SERVER_HOST
+func IsHost(host string) bool {
+	host = strings.ToLower(host)
+	if host == DefaultHost || strings.Contains(host, "gitlab") {
+		return true
+	}
+	for _, name := range []string{"GITLAB_HOST", "CI_SERVER_HOST"} {
+		configured := os.Getenv(name)
+		if u, err := url.Parse(configured); err == nil && u.Host != "" {
+			configured = u.Hostname()
+		}
+		if configured != "" && strings.EqualFold(configured, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Project is a GitLab project
+type Project struct {
+	PathWithNamespace string `json:"path_with_namespace"`
+	DefaultBranch     string `json:"default_branch"`
+	WebURL            string `json:"web_url"`
+}
+
+// NewMergeRequest describes a merge request to open. GitLab has no draft
+// flag; use DraftTitle to mark a merge request as a draft.
+type NewMergeRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// SourceBranch is the branch with the changes
+	SourceBranch string `json:"source_branch"`
+	// TargetBranch is the branch the changes are merged into
+	TargetBranch string `json:"target_branch"`
+}
+
+// MergeRequest is a merge request as returned by the API
+type MergeRequest struct {
+	// IID is the merge request's number within its project, as in "!12"
+	IID         int    `json:"iid"`
+	WebURL      string `json:"web_url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Draft       bool   `json:"draft"`
+	// SourceBranch is the branch with the changes
+	SourceBranch string `json:"source_branch"`
+	// TargetBranch is the branch the changes are merged into
+	TargetBranch string `json:"target_branch"`
+}
+
+// MergeRequestUpdate holds the fields of a merge request to change
+type MergeRequestUpdate struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// draftPattern matches the title prefixes GitLab treats as marking a draft
+var draftPattern = regexp.MustCompile(`(?i)^\s*(\[draft\]|\(draft\)|draft:|draft\s+-)`)
+
+// DraftTitle returns title with the "Draft:" prefix that makes GitLab treat
+// a merge request as a draft
+func DraftTitle(title string) string {
+	if draftPattern.MatchString(title) {
+		return title
+	}
+	return "Draft: " + title
+}
+
+// APIError is returned when the API answers with an error status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("GitLab API error (HTTP %d)", e.StatusCode)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Project looks up a project by its path, e.g. "group/subgroup/project"
+func (c *Client) Project(ctx context.Context, path string) (*Project, error) {
+	var project Project
+	if err := c.api.Do(ctx, http.MethodGet, projectPath(path), nil, &project); err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// CreateMergeRequest opens a merge request in the project at path
+func (c *Client) CreateMergeRequest(ctx context.Context, path string, mr NewMergeRequest) (*MergeRequest, error) {
+	var created MergeRequest
+	if err := c.api.Do(ctx, http.MethodPost, projectPath(path)+"/merge_requests", mr, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// OpenMergeRequests lists the open merge requests in the project at path
+// from sourceBranch
+func (c *Client) OpenMergeRequests(ctx context.Context, path, sourceBranch string) ([]MergeRequest, error) {
+	query := url.Values{"state": {"opened"}, "source_branch": {sourceBranch}}
+	var mrs []MergeRequest
+	if err := c.api.Do(ctx, http.MethodGet, projectPath(path)+"/merge_requests?"+query.Encode(), nil, &mrs); err != nil {
+		return nil, err
+	}
+	return mrs, nil
+}
+
+// UpdateMergeRequest changes the title and description of merge request iid
+func (c *Client) UpdateMergeRequest(ctx context.Context, path string, iid int, update MergeRequestUpdate) (*MergeRequest, error) {
+	var updated MergeRequest
+	mrPath := fmt.Sprintf("%s/merge_requests/%d", projectPath(path), iid)
+	if err := c.api.Do(ctx, http.MethodPut, mrPath, update, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// projectPath returns the API path of a project. The API takes the project
+// path as a single, encoded segment.
+func projectPath(path string) string {
+	return "projects/" + url.PathEscape(path)
+}
+
+// parseError builds an APIError from an error response. GitLab gives the
+// message as a string, a list of strings or a map of field errors, or gives
+// an "error" instead.
+func parseError(statusCode int, body []byte) error {
+	apiErr := &APIError{StatusCode: statusCode}
+	var errResp struct {
+		Message json.RawMessage `json:"message"`
+		Error   string          `json:"error"`
+	}
+	if json.Unmarshal(body, &errResp) != nil {
+		apiErr.Message = strings.TrimSpace(string(body))
+		return apiErr
+	}
+
+	var text string
+	var list []string
+	var fields map[string][]string
+	switch {
+	case json.Unmarshal(errResp.Message, &text) == nil:
+		apiErr.Message = text
+	case json.Unmarshal(errResp.Message, &list) == nil:
+		apiErr.Message = strings.Join(list, "; ")
+	case json.Unmarshal(errResp.Message, &fields) == nil:
+		for field, problems := range fields {
+			list = append(list, field+" "+strings.Join(problems, ", "))
+		}
+		sort.Strings(list)
+		apiErr.Message = strings.Join(list, "; ")
+	default:
+		apiErr.Message = errResp.Error
+	}
+	return apiErr
+}
@@ -0,0 +1,189 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	var created NewMergeRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message": "401 Unauthorized"}`))
+			return
+		}
+		// The project path is a single encoded segment
+		switch r.Method + " " + r.URL.EscapedPath() {
+		case "GET /gitlab/api/v4/projects/group%2Fsub%2Fproject":
+			w.Write([]byte(`{"path_with_namespace": "group/sub/project", "default_branch": "develop"}`))
+		case "POST /gitlab/api/v4/projects/group%2Fsub%2Fproject/merge_requests":
+			json.NewDecoder(r.Body).Decode(&created)
+			if created.SourceBranch == "existing" {
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"message": ["Another open merge request already exists for this source branch: !4"]}`))
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"iid": 12, "web_url": "https://git.example.com/gitlab/group/sub/project/-/merge_requests/12", "draft": true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "404 Project Not Found"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/gitlab/api/v4", "secret")
+	ctx := context.Background()
+
+	project, err := client.Project(ctx, "group/sub/project")
+	if err != nil || project.DefaultBranch != "develop" {
+		t.Errorf("Expected the default branch to be develop, got %+v (%v)", project, err)
+	}
+
+	mr, err := client.CreateMergeRequest(ctx, "group/sub/project", NewMergeRequest{
+		Title:        DraftTitle("feat: add x"),
+		Description:  "## Summary\n\nBody",
+		SourceBranch: "feature",
+		TargetBranch: "develop",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if mr.IID != 12 || !strings.HasSuffix(mr.WebURL, "/merge_requests/12") {
+		t.Errorf("Unexpected merge request %+v", mr)
+	}
+	if created.Title != "Draft: feat: add x" || created.TargetBranch != "develop" {
+		t.Errorf("Unexpected request %+v", created)
+	}
+
+	_, err = client.CreateMergeRequest(ctx, "group/sub/project", NewMergeRequest{Title: "x", SourceBranch: "existing", TargetBranch: "develop"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Expected the conflict to be reported, got %v", err)
+	}
+
+	_, err = client.Project(ctx, "group/other")
+	if !errors.As(err, &apiErr) || apiErr.Message != "404 Project Not Found" {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+}
+
+func TestClientUpdatesMergeRequests(t *testing.T) {
+	var update MergeRequestUpdate
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.EscapedPath() {
+		case "GET /api/v4/projects/group%2Fproject/merge_requests":
+			if r.URL.Query().Get("source_branch") != "feature" || r.URL.Query().Get("state") != "opened" {
+				w.Write([]byte(`[]`))
+				return
+			}
+			w.Write([]byte(`[{"iid": 4, "title": "Draft: old", "draft": true, "source_branch": "feature", "target_branch": "develop"}]`))
+		case "PUT /api/v4/projects/group%2Fproject/merge_requests/4":
+			json.NewDecoder(r.Body).Decode(&update)
+			w.Write([]byte(`{"iid": 4, "web_url": "https://gitlab.com/group/project/-/merge_requests/4"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(server.URL+"/api/v4", "secret")
+	ctx := context.Background()
+
+	mrs, err := client.OpenMergeRequests(ctx, "group/project", "feature")
+	if err != nil || len(mrs) != 1 || mrs[0].IID != 4 || !mrs[0].Draft || mrs[0].TargetBranch != "develop" {
+		t.Fatalf("Expected draft merge request 4 into develop, got %+v (%v)", mrs, err)
+	}
+
+	mr, err := client.UpdateMergeRequest(ctx, "group/project", 4, MergeRequestUpdate{Title: "Draft: new", Description: "new body"})
+	if err != nil || !strings.HasSuffix(mr.WebURL, "/merge_requests/4") {
+		t.Errorf("Unexpected merge request %+v (%v)", mr, err)
+	}
+	if update.Title != "Draft: new" || update.Description != "new body" {
+		t.Errorf("Unexpected update %+v", update)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := map[string]string{
+		`{"message": {"title": ["can't be blank"], "base": ["is invalid"]}}`: "base is invalid; title can't be blank",
+		`{"error": "insufficient_scope"}`:                                    "insufficient_scope",
+		`Bad Gateway`:                                                        "Bad Gateway",
+	}
+	for body, expected := range tests {
+		var apiErr *APIError
+		if err := parseError(400, []byte(body)); !errors.As(err, &apiErr) || apiErr.Message != expected {
+			t.Errorf("parseError(%s) = %v, expected %q", body, err, expected)
+		}
+	}
+}
+
+func TestDraftTitle(t *testing.T) {
+	tests := map[string]string{
+		"feat: add x":        "Draft: feat: add x",
+		"Draft: feat: add x": "Draft: feat: add x",
+		"[Draft] add x":      "[Draft] add x",
+	}
+	for title, expected := range tests {
+		if got := DraftTitle(title); got != expected {
+			t.Errorf("DraftTitle(%q) = %q, expected %q", title, got, expected)
+		}
+	}
+}
+
+func TestAPIBaseURLAndHost(t *testing.T) {
+	for _, name := range []string{"GITLAB_API_URL", "CI_API_V4_URL", "CI_SERVER_HOST", "GITLAB_HOST"} {
+		t.Setenv(name, "")
+	}
+	if got := APIBaseURL("git.example.com"); got != "https://git.example.com/api/v4/" {
+		t.Errorf("Unexpected base URL %q", got)
+	}
+	t.Setenv("CI_SERVER_HOST", "git.example.com")
+	t.Setenv("CI_API_V4_URL", "https://git.example.com/gitlab/api/v4")
+	if got := APIBaseURL("git.example.com"); got != "https://git.example.com/gitlab/api/v4/" {
+		t.Errorf("Expected the CI API URL, got %q", got)
+	}
+	if got := APIBaseURL("gitlab.com"); got != "https://gitlab.com/api/v4/" {
+		t.Errorf("Expected the CI API URL only for its own instance, got %q", got)
+	}
+
+	if !IsHost("gitlab.com") || !IsHost("gitlab.example.com") || !IsHost("git.example.com") || IsHost("github.com") {
+		t.Error("Unexpected GitLab host detection")
+	}
+	t.Setenv("CI_SERVER_HOST", "")
+	t.Setenv("GITLAB_HOST", "https://code.example.com")
+	if !IsHost("code.example.com") || IsHost("git.example.com") {
+		t.Error("Expected GITLAB_HOST to name the GitLab instance")
+	}
+}
+
+func TestToken(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GLAB_CONFIG_DIR", dir)
+	t.Setenv("GITLAB_TOKEN", "")
+	t.Setenv("GITLAB_ACCESS_TOKEN", "")
+
+	if token := Token("gitlab.com"); token != "" {
+		t.Errorf("Expected no token, got %q", token)
+	}
+
+	config := "hosts:\n    git.example.com:\n        token: from-glab\n        api_protocol: https\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.yml"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if token := Token("git.example.com"); token != "from-glab" {
+		t.Errorf("Expected the token from glab's config, got %q", token)
+	}
+
+	t.Setenv("GITLAB_TOKEN", "from-env")
+	if token := Token("git.example.com"); token != "from-env" {
+		t.Errorf("Expected GITLAB_TOKEN to be used, got %q", token)
+	}
+}
@@ -0,0 +1,66 @@
+package gitlab
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Token finds a token for host. It checks GITLAB_TOKEN and
+// GITLAB_ACCESS_TOKEN, which glab also reads, and then glab's config.yml. It
+// returns "" if there is none.
+func Token(host string) string {
+	if host == "" {
+		host = DefaultHost
+	}
+	for _, name := range []string{"GITLAB_TOKEN", "GITLAB_ACCESS_TOKEN"} {
+		if token := os.Getenv(name); token != "" {
+			return token
+		}
+	}
+	return glabConfigToken(host)
+}
+
+// glabConfigDir returns the directory glab keeps its configuration in
+func glabConfigDir() string {
+	if dir := os.Getenv("GLAB_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "glab-cli")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "glab-cli")
+}
+
+// glabConfigToken reads the token for host from glab's config.yml
+func glabConfigToken(host string) string {
+	dir := glabConfigDir()
+	if dir == "" {
+		return ""
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "config.yml"))
+	if err != nil {
+		return ""
+	}
+
+	var config struct {
+		Hosts map[string]struct {
+			Token string `yaml:"token"`
+		} `yaml:"hosts"`
+	}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return ""
+	}
+	for name, entry := range config.Hosts {
+		if strings.EqualFold(name, host) {
+			return entry.Token
+		}
+	}
+	return ""
+}
@@ -0,0 +1,71 @@
+// Package gitremote parses git remote URLs into the host and repository path
+// that forges such as GitHub identify repositories by.
+package gitremote
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Remote is the repository a remote URL points to
+type Remote struct {
+	// Host is the server name without user or port, e.g. "github.com"
+	Host string
+	// Path is the repository path without ".git", e.g. "owner/repo" or
+	// "group/subgroup/project"
+	Path string
+}
+
+// Owner returns the part of the path before the repository name
+func (r Remote) Owner() string {
+	owner, _, _ := cutLast(r.Path, "/")
+	return owner
+}
+
+// Name returns the repository name, the last part of the path
+func (r Remote) Name() string {
+	_, name, _ := cutLast(r.Path, "/")
+	return name
+}
+
+// scpPattern matches scp-like URLs such as "git@github.com:owner/repo.git"
+var scpPattern = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// Parse parses a remote URL in any form git accepts for network remotes:
+// https://host/owner/repo.git, ssh://git@host:22/owner/repo.git or
+// git@host:owner/repo.git
+func Parse(remoteURL string) (Remote, error) {
+	remoteURL = strings.TrimSpace(remoteURL)
+
+	var host, path string
+	if strings.Contains(remoteURL, "://") {
+		u, err := url.Parse(remoteURL)
+		if err != nil {
+			return Remote{}, fmt.Errorf("invalid remote URL %q: %w", remoteURL, err)
+		}
+		if u.Scheme == "file" {
+			return Remote{}, fmt.Errorf("remote %q is a local path, not a hosted repository", remoteURL)
+		}
+		host, path = u.Hostname(), u.Path
+	} else if match := scpPattern.FindStringSubmatch(remoteURL); match != nil {
+		host, path = match[1], match[2]
+	} else {
+		return Remote{}, fmt.Errorf("remote %q is a local path, not a hosted repository", remoteURL)
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if host == "" || !strings.Contains(path, "/") {
+		return Remote{}, fmt.Errorf("can't tell the repository from remote URL %q", remoteURL)
+	}
+	return Remote{Host: strings.ToLower(host), Path: path}, nil
+}
+
+// cutLast slices s around the last instance of sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return "", s, false
+}
@@ -0,0 +1,213 @@
+// Package ignore decides which changed files are left out of prompts, using
+// gitignore-style patterns from the config and the .institutionalizedignore
+// file.
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/budget"
+)
+
+// File is the name of the repository file listing paths to keep out of prompts
+const File = ".institutionalizedignore"
+
+// DefaultPatterns exclude files whose changes say little about the intent of
+// a commit: the lockfiles, generated files and vendored directories that the
+// budget package ranks lowest
+var DefaultPatterns = defaultPatterns()
+
+// defaultPatterns turns the budget package's classification into gitignore
+// patterns
+func defaultPatterns() []string {
+	patterns := append([]string{}, budget.Lockfiles...)
+	patterns = append(patterns, budget.VendoredDirs...)
+	for _, suffix := range budget.GeneratedSuffixes {
+		patterns = append(patterns, "*"+suffix)
+	}
+	return patterns
+}
+
+// pattern is a single gitignore rule
+type pattern struct {
+	negate  bool
+	dirOnly bool
+	// anchored patterns match paths from the root; others match a name at any depth
+	anchored bool
+	regexp   *regexp.Regexp
+}
+
+// Matcher decides whether paths are ignored using gitignore rules. Later
+// patterns override earlier ones, so a negated pattern can re-include a path
+// excluded before it.
+type Matcher struct {
+	patterns []pattern
+}
+
+// NewMatcher creates a matcher from gitignore-style pattern lines
+func NewMatcher(lines []string) (*Matcher, error) {
+	m := &Matcher{}
+	if err := m.Add(lines); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Add appends pattern lines. Blank lines and comments are skipped.
+func (m *Matcher) Add(lines []string) error {
+	for _, line := range lines {
+		p, ok, err := parsePattern(line)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", line, err)
+		}
+		if ok {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+	return nil
+}
+
+// AddFile appends the patterns of an ignore file. A missing file is not an error.
+func (m *Matcher) AddFile(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := m.Add(lines); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// Match reports whether a slash-separated path relative to the repository
+// root is ignored
+func (m *Matcher) Match(path string) bool {
+	if m == nil {
+		return false
+	}
+
+	// A path is ignored if it or any of its parent directories match
+	segments := strings.Split(path, "/")
+	ignored := false
+	for _, p := range m.patterns {
+		for i := range segments {
+			isDir := i < len(segments)-1
+			if p.dirOnly && !isDir {
+				continue
+			}
+			if p.matches(strings.Join(segments[:i+1], "/"), segments[i]) {
+				ignored = !p.negate
+				break
+			}
+		}
+	}
+	return ignored
+}
+
+// matches checks a pattern against a path and its last segment
+func (p pattern) matches(path, name string) bool {
+	if p.anchored {
+		return p.regexp.MatchString(path)
+	}
+	return p.regexp.MatchString(name)
+}
+
+// parsePattern parses one line of an ignore file. It reports false for blank
+// lines and comments.
+func parsePattern(line string) (pattern, bool, error) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false, nil
+	}
+
+	p := pattern{}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	// A slash anywhere but the end ties the pattern to the root
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return pattern{}, false, nil
+	}
+
+	expr, err := regexp.Compile("^" + globToRegexp(line) + "$")
+	if err != nil {
+		return pattern{}, false, err
+	}
+	p.regexp = expr
+	return p, true, nil
+}
+
+// globToRegexp converts gitignore glob syntax to a regular expression
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**") {
+				// "**/" matches zero or more directories, a trailing "**" everything
+				if strings.HasPrefix(glob[i:], "**/") {
+					b.WriteString("(?:.*/)?")
+					i += 2
+				} else {
+					b.WriteString(".*")
+					i++
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IanKnighton/institutionalized/internal/budget"
+)
+
+func TestMatch(t *testing.T) {
+	matcher, err := NewMatcher([]string{
+		"# comment",
+		"*.log",
+		"!keep.log",
+		"build/",
+		"/root-only.txt",
+		"docs/**/*.png",
+		"**/fixtures/*.json",
+		"file[0-9].txt",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := map[string]bool{
+		"debug.log":                   true,
+		"nested/dir/debug.log":        true,
+		"keep.log":                    false,
+		"build/output.bin":            true,
+		"src/build/output.bin":        true,
+		"build":                       false,
+		"root-only.txt":               true,
+		"sub/root-only.txt":           false,
+		"docs/logo.png":               true,
+		"docs/img/deep/logo.png":      true,
+		"assets/logo.png":             false,
+		"fixtures/user.json":          true,
+		"test/fixtures/user.json":     true,
+		"test/fixtures/deep/obj.json": false,
+		"file7.txt":                   true,
+		"fileA.txt":                   false,
+		"main.go":                     false,
+	}
+	for path, expected := range tests {
+		if got := matcher.Match(path); got != expected {
+			t.Errorf("Match(%q) = %t, expected %t", path, got, expected)
+		}
+	}
+}
+
+func TestDefaultPatterns(t *testing.T) {
+	matcher, err := NewMatcher(DefaultPatterns)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, path := range []string{"go.sum", "web/package-lock.json", "vendor/x/y.go", "ui/__snapshots__/App.test.js.snap", "dist/app.min.js", "api/v1/user.pb.go"} {
+		if !matcher.Match(path) {
+			t.Errorf("Expected %s to be excluded by default", path)
+		}
+	}
+	for _, path := range []string{"go.mod", "cmd/commit.go", "internal/vendorlib/lib.go"} {
+		if matcher.Match(path) {
+			t.Errorf("Expected %s not to be excluded by default", path)
+		}
+	}
+}
+
+func TestDefaultPatternsAgreeWithBudget(t *testing.T) {
+	matcher, _ := NewMatcher(DefaultPatterns)
+
+	for _, path := range []string{"mix.lock", "ios/Podfile.lock", "flake.lock", "src/packages.lock.json", "api/models_generated.go", "pkg/client.gen.go", "web/dist/app.js", "ui/__snapshots__/App.txt", "cmd/commit.go", "README.md", "go.mod"} {
+		excluded, low := matcher.Match(path), budget.Classify(path) == budget.PriorityLow
+		if excluded != low {
+			t.Errorf("%s: excluded by default is %t but low priority is %t", path, excluded, low)
+		}
+	}
+}
+
+func TestAddFileOverridesDefaults(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, File)
+	if err := os.WriteFile(path, []byte("!go.sum\ngenerated/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	matcher, _ := NewMatcher(DefaultPatterns)
+	if err := matcher.AddFile(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if matcher.Match("go.sum") {
+		t.Error("Expected the ignore file to re-include go.sum")
+	}
+	if !matcher.Match("generated/models.go") {
+		t.Error("Expected generated/ to be excluded")
+	}
+
+	if err := matcher.AddFile(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("Expected a missing file to be ignored, got: %v", err)
+	}
+}
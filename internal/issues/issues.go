@@ -0,0 +1,146 @@
+// Package issues finds issue references such as "PROJ-123" or "#456" in
+// branch names and adds them to commit messages and pull request bodies.
+package issues
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/conventional"
+)
+
+// DefaultPatterns match Jira-style keys anywhere in a branch name, as in
+// "feature/PROJ-123-foo", and numbers that are a whole path segment or are
+// followed by a word, as in "fix/456-bar". Numbers followed by more digits,
+// such as the dates in "release/2024-10-16", or by a short token like
+// "2024_q3" are not issues.
+var DefaultPatterns = []string{
+	`\b([A-Z][A-Z0-9]+-[0-9]+)\b`,
+	`(?:^|/)([0-9]+)(?:$|/|[-_][A-Za-z]{2})`,
+}
+
+// numberPattern matches keys that are plain issue numbers
+var numberPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// Extractor finds issue references in branch names
+type Extractor struct {
+	patterns []*regexp.Regexp
+}
+
+// NewExtractor compiles the patterns that match issue keys. The first capture
+// group of a pattern is the key, or the whole match if it has none. No
+// patterns uses DefaultPatterns.
+func NewExtractor(patterns []string) (*Extractor, error) {
+	if len(patterns) == 0 {
+		patterns = DefaultPatterns
+	}
+	e := &Extractor{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid issue pattern %q: %w", pattern, err)
+		}
+		e.patterns = append(e.patterns, re)
+	}
+	return e, nil
+}
+
+// Extract returns the issue references in a branch name in the order they
+// appear, without duplicates. Plain numbers are formatted as "#456".
+func (e *Extractor) Extract(branch string) []string {
+	type match struct {
+		start int
+		key   string
+	}
+	var matches []match
+	for _, re := range e.patterns {
+		for _, loc := range re.FindAllStringSubmatchIndex(branch, -1) {
+			start, end := loc[0], loc[1]
+			if len(loc) > 3 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			if start < end {
+				matches = append(matches, match{start, branch[start:end]})
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+
+	var refs []string
+	seen := make(map[string]bool)
+	for _, m := range matches {
+		ref := m.key
+		if numberPattern.MatchString(ref) {
+			ref = "#" + ref
+		}
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// AddTrailers adds a trailer such as "Refs: PROJ-123" to a commit message for
+// each reference it doesn't have yet
+func AddTrailers(message, token string, refs []string) string {
+	footers := make([]conventional.Footer, len(refs))
+	for i, ref := range refs {
+		footers[i] = conventional.Footer{Token: token, Separator: ": ", Value: ref}
+	}
+	return conventional.AddFooters(message, footers)
+}
+
+// AddPrefix puts the references missing from the first line of a commit
+// message in front of its description, as in "feat(api): PROJ-123 add
+// export", so the message stays a valid Conventional Commit. Messages in
+// another format get the references in front of the first line.
+func AddPrefix(message string, refs []string) string {
+	message = strings.TrimSpace(message)
+	header, rest, hasRest := strings.Cut(message, "\n")
+
+	var missing []string
+	for _, ref := range refs {
+		if !strings.Contains(header, ref) {
+			missing = append(missing, ref)
+		}
+	}
+	if len(missing) == 0 {
+		return message
+	}
+
+	prefix := strings.Join(missing, " ")
+	if msg, err := conventional.Parse(header); err == nil {
+		msg.Description = prefix + " " + msg.Description
+		header = msg.Header()
+	} else {
+		header = prefix + " " + header
+	}
+	if hasRest {
+		return header + "\n" + rest
+	}
+	return header
+}
+
+// AddClosingLines appends a line such as "Closes #456" to a pull request body
+// for each reference the body doesn't mention with the keyword yet
+func AddClosingLines(body, keyword string, refs []string) string {
+	var lines []string
+	for _, ref := range refs {
+		// "Closes #45" doesn't count as a mention of #456
+		mention := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(keyword+" "+ref) + `(?:[^\w-]|$)`)
+		if !mention.MatchString(body) {
+			lines = append(lines, keyword+" "+ref)
+		}
+	}
+	if len(lines) == 0 {
+		return body
+	}
+	body = strings.TrimRight(body, "\n")
+	if body == "" {
+		return strings.Join(lines, "\n")
+	}
+	return body + "\n\n" + strings.Join(lines, "\n")
+}
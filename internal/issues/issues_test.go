@@ -0,0 +1,77 @@
+package issues
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	extractor, err := NewExtractor(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := map[string][]string{
+		"feature/PROJ-123-foo":       {"PROJ-123"},
+		"fix/456-bar":                {"#456"},
+		"456":                        {"#456"},
+		"PROJ-1-and-OPS-22":          {"PROJ-1", "OPS-22"},
+		"fix/PROJ-7/PROJ-7-again":    {"PROJ-7"},
+		"release/v2-cleanup":         nil,
+		"feature/upgrade-to-go1-24":  nil,
+		"main":                       nil,
+		"chore/123-PROJ-9-two-kinds": {"#123", "PROJ-9"},
+		"release/2024-10-16":         nil,
+		"hotfix/2024_q3":             nil,
+		"fix/12_ui-glitch":           {"#12"},
+		"feature/UTF-8-support":      {"UTF-8"},
+	}
+	for branch, expected := range tests {
+		if got := extractor.Extract(branch); !slices.Equal(got, expected) {
+			t.Errorf("Extract(%q) = %q, expected %q", branch, got, expected)
+		}
+	}
+
+	custom, err := NewExtractor([]string{`(?i)ticket-([0-9]+)`, `CU-[a-z0-9]+`})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := custom.Extract("Ticket-88/CU-8669xyz"); !slices.Equal(got, []string{"#88", "CU-8669xyz"}) {
+		t.Errorf("Expected capture groups and whole matches, got %q", got)
+	}
+
+	if _, err := NewExtractor([]string{"("}); err == nil {
+		t.Error("Expected an invalid pattern to be rejected")
+	}
+}
+
+func TestAddPrefix(t *testing.T) {
+	tests := []struct {
+		message  string
+		expected string
+	}{
+		{"feat(api): add export\n\nBody.", "feat(api): PROJ-1 #2 add export\n\nBody."},
+		{"✨ feat!: add export", "✨ feat!: PROJ-1 #2 add export"},
+		{"fix: PROJ-1 handle nil", "fix: #2 PROJ-1 handle nil"},
+		{"Add export", "PROJ-1 #2 Add export"},
+	}
+	for _, test := range tests {
+		if got := AddPrefix(test.message, []string{"PROJ-1", "#2"}); got != test.expected {
+			t.Errorf("AddPrefix(%q) = %q, expected %q", test.message, got, test.expected)
+		}
+	}
+}
+
+func TestAddTrailers(t *testing.T) {
+	got := AddTrailers("fix: x\n\nRefs: PROJ-1", "Refs", []string{"PROJ-1", "#2"})
+	if expected := "fix: x\n\nRefs: PROJ-1\nRefs: #2"; got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestAddClosingLines(t *testing.T) {
+	got := AddClosingLines("## Summary\n\nFixes the thing. closes #45\n", "Closes", []string{"#45", "#456", "PROJ-1"})
+	if expected := "## Summary\n\nFixes the thing. closes #45\n\nCloses #456\nCloses PROJ-1"; got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
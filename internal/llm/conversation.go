@@ -0,0 +1,39 @@
+package llm
+
+// Conversation holds the messages exchanged while generating one commit
+// message, commit plan or PR, so feedback refines the previous answer instead of
+// starting over
+type Conversation struct {
+	Task     Task
+	Messages []Message
+}
+
+// NewConversation starts a conversation with the prompt for a task
+func NewConversation(task Task, prompt string) *Conversation {
+	return &Conversation{Task: task, Messages: userMessage(prompt)}
+}
+
+// Reply records an answer. An answer that hasn't been responded to yet is
+// replaced, so regenerated or edited answers don't pile up.
+func (c *Conversation) Reply(content string) {
+	c.Retry()
+	c.Messages = append(c.Messages, Message{Role: RoleAssistant, Content: content})
+}
+
+// Refine asks for a revision of the latest answer with the given feedback
+func (c *Conversation) Refine(feedback string) {
+	c.Messages = append(c.Messages, Message{Role: RoleUser, Content: RefinePromptTemplate(c.Task, feedback)})
+}
+
+// Correct asks for a revision of the latest answer that fixes the given
+// format problems
+func (c *Conversation) Correct(violations []string) {
+	c.Messages = append(c.Messages, Message{Role: RoleUser, Content: CorrectionPromptTemplate(c.Task, violations)})
+}
+
+// Retry drops the latest answer so the last request can be asked again
+func (c *Conversation) Retry() {
+	if n := len(c.Messages); n > 0 && c.Messages[n-1].Role == RoleAssistant {
+		c.Messages = c.Messages[:n-1]
+	}
+}
@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConversation(t *testing.T) {
+	conversation := NewConversation(TaskPR, "prompt")
+	conversation.Reply("TITLE: first")
+	conversation.Reply("TITLE: edited")
+	if len(conversation.Messages) != 2 || conversation.Messages[1].Content != "TITLE: edited" {
+		t.Fatalf("Expected the edit to replace the reply, got %+v", conversation.Messages)
+	}
+
+	conversation.Refine("mention the migration")
+	last := conversation.Messages[len(conversation.Messages)-1]
+	if last.Role != RoleUser || !strings.Contains(last.Content, "mention the migration") || !strings.Contains(last.Content, "TITLE:") {
+		t.Errorf("Unexpected feedback message: %+v", last)
+	}
+
+	// Retrying a request that hasn't been answered keeps the request
+	conversation.Retry()
+	if len(conversation.Messages) != 3 {
+		t.Errorf("Expected the feedback to be kept, got %d messages", len(conversation.Messages))
+	}
+	conversation.Reply("TITLE: revised")
+	conversation.Retry()
+	if len(conversation.Messages) != 3 {
+		t.Errorf("Expected the revised reply to be dropped, got %d messages", len(conversation.Messages))
+	}
+}
+
+func TestProviderRequestsCarryHistory(t *testing.T) {
+	messages := []Message{
+		{Role: RoleUser, Content: "prompt"},
+		{Role: RoleAssistant, Content: "answer"},
+		{Role: RoleUser, Content: "feedback"},
+	}
+
+	gemini := NewGeminiProvider("key", ModelSettings{}).request(messages, GenerationOptions{})
+	if len(gemini.Contents) != 3 || gemini.Contents[1].Role != "model" || gemini.Contents[2].Role != "user" {
+		t.Errorf("Unexpected Gemini contents: %+v", gemini.Contents)
+	}
+
+	claude := NewClaudeProvider("key", ModelSettings{}).request(messages, GenerationOptions{})
+	if len(claude.Messages) != 3 || claude.Messages[1].Role != "assistant" {
+		t.Errorf("Unexpected Claude messages: %+v", claude.Messages)
+	}
+
+	generate := NewOllamaProvider("", ModelSettings{}).generateRequest(messages, GenerationOptions{}, false)
+	if !strings.Contains(generate.Prompt, "Assistant:\nanswer") || !strings.HasSuffix(generate.Prompt, "Assistant:\n") {
+		t.Errorf("Unexpected Ollama transcript: %q", generate.Prompt)
+	}
+	if single := transcript(messages[:1]); single != "prompt" {
+		t.Errorf("Expected a single prompt to be sent as is, got %q", single)
+	}
+}
@@ -0,0 +1,492 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Strategy controls how the ProviderManager queries its providers
+type Strategy string
+
+const (
+	// StrategySequential tries providers one at a time, moving on only after
+	// a provider fails or exceeds the delay threshold
+	StrategySequential Strategy = "sequential"
+	// StrategyRace starts the next provider after the hedge delay (or all of
+	// them at once) and returns the first valid answer
+	StrategyRace Strategy = "race"
+	// StrategyBestOf queries all providers at once and returns every answer
+	StrategyBestOf Strategy = "best-of"
+)
+
+// Candidate is one answer to a conversation and the provider that produced it
+type Candidate struct {
+	Reply    string
+	Provider string
+}
+
+// ProviderManager manages multiple LLM providers with fallback capability
+type ProviderManager struct {
+	providers      []Provider
+	delayThreshold time.Duration
+	strategy       Strategy
+	hedgeDelay     time.Duration
+	// mu guards disabled and calls to onFallback so requests can run concurrently
+	mu sync.Mutex
+	// disabled holds providers that failed authentication; they are skipped
+	// for the rest of the manager's lifetime
+	disabled   map[string]bool
+	onFallback func(provider string, err error)
+	// ctx ends every request when it is done; see SetContext
+	ctx context.Context
+}
+
+// NewProviderManager creates a new provider manager
+func NewProviderManager(providers []Provider, delayThreshold time.Duration) *ProviderManager {
+	return &ProviderManager{
+		providers:      providers,
+		delayThreshold: delayThreshold,
+		strategy:       StrategySequential,
+		disabled:       make(map[string]bool),
+		ctx:            context.Background(),
+	}
+}
+
+// SetStrategy changes how providers are queried. The hedge delay is only
+// used by StrategyRace.
+func (pm *ProviderManager) SetStrategy(strategy Strategy, hedgeDelay time.Duration) error {
+	switch strategy {
+	case "":
+		strategy = StrategySequential
+	case StrategySequential, StrategyRace, StrategyBestOf:
+	default:
+		return fmt.Errorf("unknown provider strategy %q", strategy)
+	}
+	pm.strategy = strategy
+	pm.hedgeDelay = hedgeDelay
+	return nil
+}
+
+// SetContext makes every request stop when ctx is done, such as when a
+// deadline for the whole run passes. Once it is done no further providers
+// are tried.
+func (pm *ProviderManager) SetContext(ctx context.Context) {
+	pm.ctx = ctx
+}
+
+// Strategy returns the strategy used to query providers
+func (pm *ProviderManager) Strategy() Strategy {
+	return pm.strategy
+}
+
+// SetFallbackHandler registers a function that is called whenever a provider
+// fails and the manager moves on to the next one. It returns the handler it
+// replaces, so a temporary handler can be removed again.
+func (pm *ProviderManager) SetFallbackHandler(handler func(provider string, err error)) func(provider string, err error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	previous := pm.onFallback
+	pm.onFallback = handler
+	return previous
+}
+
+// SummarizeDiff summarizes part of a diff with the configured strategy. It
+// may be called from several goroutines at once.
+func (pm *ProviderManager) SummarizeDiff(path, diff string) (string, string, error) {
+	return firstResult(pm, func(ctx context.Context, provider Provider) (string, error) {
+		return provider.SummarizeDiff(ctx, path, diff)
+	})
+}
+
+// Chat asks for the next reply in a conversation with the configured
+// strategy. StrategyBestOf behaves like StrategySequential here.
+func (pm *ProviderManager) Chat(conversation *Conversation) (string, string, error) {
+	messages := append([]Message(nil), conversation.Messages...)
+	return firstResult(pm, func(ctx context.Context, provider Provider) (string, error) {
+		return provider.Chat(ctx, conversation.Task, messages)
+	})
+}
+
+// StreamChat asks for the next reply in a conversation like Chat, passing
+// text to onToken as it arrives from providers that support streaming.
+// Providers are always tried sequentially so output from several providers
+// never interleaves; if a provider fails mid-stream the next one starts from
+// scratch.
+func (pm *ProviderManager) StreamChat(conversation *Conversation, onToken func(provider string, token string)) (string, string, error) {
+	messages := append([]Message(nil), conversation.Messages...)
+	return sequential(pm, func(ctx context.Context, provider Provider) (string, error) {
+		streamer, ok := provider.(StreamingProvider)
+		if !ok {
+			return provider.Chat(ctx, conversation.Task, messages)
+		}
+		return streamer.StreamChat(ctx, conversation.Task, messages, func(token string) {
+			onToken(provider.Name(), token)
+		})
+	})
+}
+
+// Candidates asks for n different answers to a conversation and returns them
+// with the provider that wrote each. With StrategyBestOf every provider is
+// asked for n answers; otherwise they come from the first provider that
+// answers. Duplicate answers are dropped, so fewer than n may be returned.
+func (pm *ProviderManager) Candidates(conversation *Conversation, n int) ([]Candidate, error) {
+	messages := append([]Message(nil), conversation.Messages...)
+	generate := func(ctx context.Context, provider Provider) ([]string, error) {
+		return chatCandidates(ctx, provider, conversation.Task, messages, n)
+	}
+
+	var candidates []Candidate
+	if pm.strategy == StrategyBestOf {
+		results, err := allResults(pm, generate)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			for _, reply := range result.value {
+				candidates = append(candidates, Candidate{Reply: reply, Provider: result.provider})
+			}
+		}
+	} else {
+		replies, provider, err := firstResult(pm, generate)
+		if err != nil {
+			return nil, err
+		}
+		for _, reply := range replies {
+			candidates = append(candidates, Candidate{Reply: reply, Provider: provider})
+		}
+	}
+	return distinctCandidates(candidates), nil
+}
+
+// chatCandidates collects n answers from one provider, in a single request if
+// the provider supports it. Answers still missing are requested in parallel.
+func chatCandidates(ctx context.Context, provider Provider, task Task, messages []Message, n int) ([]string, error) {
+	var replies []string
+	if multi, ok := provider.(CandidateProvider); ok && n > 1 {
+		var err error
+		replies, err = multi.ChatCandidates(ctx, task, messages, n)
+		if err != nil {
+			return nil, err
+		}
+		replies = distinctReplies(replies)
+		if len(replies) >= n {
+			return replies[:n], nil
+		}
+	}
+
+	missing := make([]providerResult[string], n-len(replies))
+	var wg sync.WaitGroup
+	for i := range missing {
+		wg.Add(1)
+		go func(result *providerResult[string]) {
+			defer wg.Done()
+			result.value, result.err = provider.Chat(ctx, task, messages)
+		}(&missing[i])
+	}
+	wg.Wait()
+
+	var lastErr error
+	for _, result := range missing {
+		if result.err != nil {
+			lastErr = result.err
+			continue
+		}
+		replies = append(replies, result.value)
+	}
+	if len(replies) == 0 {
+		return nil, lastErr
+	}
+	return replies, nil
+}
+
+// distinctCandidates drops candidates whose reply repeats an earlier one
+func distinctCandidates(candidates []Candidate) []Candidate {
+	seen := make(map[string]bool)
+	var distinct []Candidate
+	for _, candidate := range candidates {
+		key := strings.TrimSpace(candidate.Reply)
+		if !seen[key] {
+			seen[key] = true
+			distinct = append(distinct, candidate)
+		}
+	}
+	return distinct
+}
+
+// distinctReplies drops replies that repeat an earlier one
+func distinctReplies(replies []string) []string {
+	candidates := make([]Candidate, len(replies))
+	for i, reply := range replies {
+		candidates[i] = Candidate{Reply: reply}
+	}
+	distinct := make([]string, 0, len(replies))
+	for _, candidate := range distinctCandidates(candidates) {
+		distinct = append(distinct, candidate.Reply)
+	}
+	return distinct
+}
+
+// ProviderNames returns the names of the available providers in priority order
+func (pm *ProviderManager) ProviderNames() []string {
+	var names []string
+	for _, provider := range pm.activeProviders() {
+		names = append(names, provider.Name())
+	}
+	return names
+}
+
+// Only returns a manager with the same settings that uses just the named
+// provider, or nil if no such provider is available
+func (pm *ProviderManager) Only(name string) *ProviderManager {
+	for _, provider := range pm.activeProviders() {
+		if provider.Name() == name {
+			only := NewProviderManager([]Provider{provider}, pm.delayThreshold)
+			only.strategy = pm.strategy
+			only.hedgeDelay = pm.hedgeDelay
+			only.onFallback = pm.onFallback
+			only.ctx = pm.ctx
+			return only
+		}
+	}
+	return nil
+}
+
+// ContextWindow returns the smallest context window of the available
+// providers, so a prompt that fits it fits whichever provider answers
+func (pm *ProviderManager) ContextWindow() int {
+	window := 0
+	for _, provider := range pm.activeProviders() {
+		if size := provider.ContextWindow(); window == 0 || size < window {
+			window = size
+		}
+	}
+	if window == 0 {
+		return DefaultContextWindow
+	}
+	return window
+}
+
+// providerResult is the outcome of one provider call
+type providerResult[T any] struct {
+	value    T
+	provider string
+	index    int
+	err      error
+}
+
+// firstResult runs generate with the configured strategy and returns the
+// first successful value and the name of the provider that produced it (or
+// of the last provider tried)
+func firstResult[T any](pm *ProviderManager, generate func(ctx context.Context, provider Provider) (T, error)) (T, string, error) {
+	if pm.strategy == StrategyRace {
+		return race(pm, generate)
+	}
+	return sequential(pm, generate)
+}
+
+// sequential calls generate with each provider in turn until one succeeds.
+// Every provider gets delayThreshold to answer, including any retries the
+// transport makes.
+func sequential[T any](pm *ProviderManager, generate func(ctx context.Context, provider Provider) (T, error)) (T, string, error) {
+	var zero T
+	var failures []error
+	lastProvider := ""
+
+	for _, provider := range pm.activeProviders() {
+		lastProvider = provider.Name()
+
+		ctx, cancel := context.WithTimeout(pm.ctx, pm.delayThreshold)
+		value, err := generate(ctx, provider)
+		cancel()
+		if err == nil {
+			return value, provider.Name(), nil
+		}
+		// The provider didn't fail; the whole request was called off
+		if pm.ctx.Err() != nil {
+			return zero, provider.Name(), pm.ctx.Err()
+		}
+
+		failures = append(failures, pm.recordFailure(provider.Name(), err))
+	}
+
+	if lastProvider == "" {
+		return zero, "", fmt.Errorf("no providers available")
+	}
+	return zero, lastProvider, allFailed(failures)
+}
+
+// race starts providers in priority order, launching the next one when the
+// hedge delay passes or a running provider fails. The first successful
+// answer wins and the remaining requests are cancelled.
+func race[T any](pm *ProviderManager, generate func(ctx context.Context, provider Provider) (T, error)) (T, string, error) {
+	var zero T
+	providers := pm.activeProviders()
+	if len(providers) == 0 {
+		return zero, "", fmt.Errorf("no providers available")
+	}
+
+	ctx, cancel := context.WithCancel(pm.ctx)
+	defer cancel()
+
+	results := make(chan providerResult[T], len(providers))
+	next, running := 0, 0
+	launchNext := func() {
+		provider := providers[next]
+		next++
+		running++
+		go func() {
+			providerCtx, providerCancel := context.WithTimeout(ctx, pm.delayThreshold)
+			defer providerCancel()
+			value, err := generate(providerCtx, provider)
+			results <- providerResult[T]{value: value, provider: provider.Name(), err: err}
+		}()
+	}
+
+	launchNext()
+	var failures []error
+	lastProvider := ""
+	for running > 0 {
+		var hedge <-chan time.Time
+		var timer *time.Timer
+		if next < len(providers) {
+			if pm.hedgeDelay <= 0 {
+				launchNext()
+				continue
+			}
+			timer = time.NewTimer(pm.hedgeDelay)
+			hedge = timer.C
+		}
+
+		select {
+		case result := <-results:
+			running--
+			if result.err == nil {
+				if timer != nil {
+					timer.Stop()
+				}
+				return result.value, result.provider, nil
+			}
+			if pm.ctx.Err() != nil {
+				return zero, result.provider, pm.ctx.Err()
+			}
+			lastProvider = result.provider
+			failures = append(failures, pm.recordFailure(result.provider, result.err))
+			// Don't wait for the hedge delay to replace a provider that failed
+			if next < len(providers) {
+				launchNext()
+			}
+		case <-hedge:
+			launchNext()
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+
+	return zero, lastProvider, allFailed(failures)
+}
+
+// allResults calls generate with every provider at once and returns the
+// successful results in provider order. It only fails if no provider succeeds.
+func allResults[T any](pm *ProviderManager, generate func(ctx context.Context, provider Provider) (T, error)) ([]providerResult[T], error) {
+	providers := pm.activeProviders()
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no providers available")
+	}
+
+	results := make(chan providerResult[T], len(providers))
+	for i, provider := range providers {
+		go func(index int, provider Provider) {
+			ctx, cancel := context.WithTimeout(pm.ctx, pm.delayThreshold)
+			defer cancel()
+			value, err := generate(ctx, provider)
+			results <- providerResult[T]{value: value, provider: provider.Name(), index: index, err: err}
+		}(i, provider)
+	}
+
+	ordered := make([]providerResult[T], len(providers))
+	for range providers {
+		result := <-results
+		ordered[result.index] = result
+	}
+	if pm.ctx.Err() != nil {
+		return nil, pm.ctx.Err()
+	}
+
+	var successes []providerResult[T]
+	var failures []error
+	for _, result := range ordered {
+		if result.err != nil {
+			failures = append(failures, pm.recordFailure(result.provider, result.err))
+			continue
+		}
+		successes = append(successes, result)
+	}
+
+	if len(successes) == 0 {
+		return nil, allFailed(failures)
+	}
+	return successes, nil
+}
+
+// activeProviders returns the providers that haven't been disabled
+func (pm *ProviderManager) activeProviders() []Provider {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	var active []Provider
+	for _, provider := range pm.providers {
+		if !pm.disabled[provider.Name()] {
+			active = append(active, provider)
+		}
+	}
+	return active
+}
+
+// recordFailure classifies a provider failure, disables providers whose
+// credentials were rejected and notifies the fallback handler
+func (pm *ProviderManager) recordFailure(provider string, err error) error {
+	providerErr := asProviderError(provider, err)
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	// A bad key won't start working during this run, so don't retry it on
+	// later requests (e.g. when regenerating)
+	if providerErr.Class == ErrorClassAuth {
+		pm.disabled[provider] = true
+	}
+
+	if pm.onFallback != nil {
+		pm.onFallback(provider, providerErr)
+	}
+	return providerErr
+}
+
+// allFailed combines the failures of every provider into one error
+func allFailed(failures []error) error {
+	return fmt.Errorf("all providers failed:\n%w", errors.Join(failures...))
+}
+
+// asProviderError makes sure every failure carries the provider name and an
+// error class, wrapping errors that don't come from the transport
+func asProviderError(provider string, err error) *ProviderError {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr
+	}
+
+	class := ErrorClassUnknown
+	// The context only carries our own deadline, so a deadline error means
+	// the provider was too slow rather than broken
+	if errors.Is(err, context.DeadlineExceeded) {
+		class = ErrorClassTimeout
+	}
+	return &ProviderError{Provider: provider, Class: class, Err: err}
+}
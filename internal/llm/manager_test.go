@@ -0,0 +1,315 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProvider answers after a delay with a fixed message or error
+type fakeProvider struct {
+	name    string
+	delay   time.Duration
+	message string
+	err     error
+	calls   int
+	// history is the conversation passed to the last Chat call
+	history []Message
+}
+
+func (p *fakeProvider) Name() string {
+	return p.name
+}
+
+// answer waits for the delay, or for the request to be cancelled
+func (p *fakeProvider) answer(ctx context.Context) (string, error) {
+	p.calls++
+	select {
+	case <-time.After(p.delay):
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	return p.message, p.err
+}
+
+func (p *fakeProvider) SummarizeDiff(ctx context.Context, path string, diff string) (string, error) {
+	return p.answer(ctx)
+}
+
+func (p *fakeProvider) ContextWindow() int {
+	return DefaultContextWindow
+}
+
+func (p *fakeProvider) Chat(ctx context.Context, task Task, messages []Message) (string, error) {
+	p.history = messages
+	return p.answer(ctx)
+}
+
+func TestSequentialFallsBackOnFailure(t *testing.T) {
+	failing := &fakeProvider{name: "first", err: &ProviderError{Provider: "first", Class: ErrorClassOverloaded}}
+	working := &fakeProvider{name: "second", message: "feat: second"}
+
+	manager := NewProviderManager([]Provider{failing, working}, time.Second)
+
+	var fallbacks []string
+	manager.SetFallbackHandler(func(provider string, err error) {
+		fallbacks = append(fallbacks, provider)
+	})
+
+	message, provider, err := manager.Chat(NewConversation(TaskCommit, "prompt"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if message != "feat: second" || provider != "second" {
+		t.Errorf("Expected answer from second provider, got %q from %s", message, provider)
+	}
+	if len(fallbacks) != 1 || fallbacks[0] != "first" {
+		t.Errorf("Expected fallback notification for first provider, got %v", fallbacks)
+	}
+
+	// A temporary handler hands back the one it replaced
+	previous := manager.SetFallbackHandler(func(provider string, err error) {})
+	manager.SetFallbackHandler(previous)
+	manager.Chat(NewConversation(TaskCommit, "prompt"))
+	if len(fallbacks) != 2 {
+		t.Errorf("Expected the restored handler to be notified again, got %v", fallbacks)
+	}
+}
+
+func TestSequentialDisablesProvidersWithBadCredentials(t *testing.T) {
+	unauthorized := &fakeProvider{name: "first", err: &ProviderError{Provider: "first", Class: ErrorClassAuth}}
+	working := &fakeProvider{name: "second", message: "feat: second"}
+
+	manager := NewProviderManager([]Provider{unauthorized, working}, time.Second)
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := manager.Chat(NewConversation(TaskCommit, "prompt")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if unauthorized.calls != 1 {
+		t.Errorf("Expected provider with bad credentials to be called once, got %d", unauthorized.calls)
+	}
+}
+
+func TestSequentialReportsAllFailures(t *testing.T) {
+	first := &fakeProvider{name: "first", err: &ProviderError{Provider: "first", Class: ErrorClassRateLimit}}
+	second := &fakeProvider{name: "second", delay: time.Second}
+
+	manager := NewProviderManager([]Provider{first, second}, 20*time.Millisecond)
+
+	_, provider, err := manager.Chat(NewConversation(TaskCommit, "prompt"))
+	if err == nil {
+		t.Fatal("Expected error when all providers fail")
+	}
+	if provider != "second" {
+		t.Errorf("Expected last provider tried to be second, got %s", provider)
+	}
+	if !strings.Contains(err.Error(), "first rate limited") || !strings.Contains(err.Error(), "second timed out") {
+		t.Errorf("Expected both failures in error, got: %v", err)
+	}
+	if ErrorClassOf(err) != ErrorClassRateLimit {
+		t.Errorf("Expected the joined error to expose the first failure's class, got %v", ErrorClassOf(err))
+	}
+}
+
+func TestRaceReturnsFirstAnswer(t *testing.T) {
+	slow := &fakeProvider{name: "slow", delay: time.Second, message: "feat: slow"}
+	fast := &fakeProvider{name: "fast", delay: 10 * time.Millisecond, message: "feat: fast"}
+
+	manager := NewProviderManager([]Provider{slow, fast}, 5*time.Second)
+	if err := manager.SetStrategy(StrategyRace, 20*time.Millisecond); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	start := time.Now()
+	message, provider, err := manager.Chat(NewConversation(TaskCommit, "prompt"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if provider != "fast" || message != "feat: fast" {
+		t.Errorf("Expected hedged provider to win, got %q from %s", message, provider)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected race to finish before the slow provider, took %v", elapsed)
+	}
+}
+
+func TestRaceReplacesFailedProviderImmediately(t *testing.T) {
+	failing := &fakeProvider{name: "failing", err: errors.New("boom")}
+	working := &fakeProvider{name: "working", message: "feat: working"}
+
+	manager := NewProviderManager([]Provider{failing, working}, 5*time.Second)
+	manager.SetStrategy(StrategyRace, time.Hour)
+
+	_, provider, err := manager.Chat(NewConversation(TaskCommit, "prompt"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if provider != "working" {
+		t.Errorf("Expected working provider to answer, got %s", provider)
+	}
+}
+
+func TestBestOfCollectsAllAnswers(t *testing.T) {
+	providers := []Provider{
+		&fakeProvider{name: "a", delay: 30 * time.Millisecond, message: "feat: a"},
+		&fakeProvider{name: "b", err: errors.New("boom")},
+		&fakeProvider{name: "c", message: "feat: c"},
+	}
+
+	manager := NewProviderManager(providers, time.Second)
+	manager.SetStrategy(StrategyBestOf, 0)
+
+	candidates, err := manager.Candidates(NewConversation(TaskCommit, "prompt"), 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("Expected 2 candidates, got %d", len(candidates))
+	}
+	if candidates[0].Provider != "a" || candidates[1].Provider != "c" {
+		t.Errorf("Expected candidates in provider order, got %+v", candidates)
+	}
+}
+
+func TestChatSendsConversationHistory(t *testing.T) {
+	first := &fakeProvider{name: "first", message: "feat: first"}
+	second := &fakeProvider{name: "second", message: "feat: second"}
+	manager := NewProviderManager([]Provider{first, second}, time.Second)
+
+	conversation := NewConversation(TaskCommit, "prompt")
+	conversation.Reply("feat: draft")
+	conversation.Refine("shorter")
+
+	reply, provider, err := manager.Chat(conversation)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reply != "feat: first" || provider != "first" {
+		t.Errorf("Expected answer from first provider, got %q from %s", reply, provider)
+	}
+	if len(first.history) != 3 || first.history[1].Content != "feat: draft" || !strings.Contains(first.history[2].Content, "shorter") {
+		t.Errorf("Unexpected history: %+v", first.history)
+	}
+
+	only := manager.Only("second")
+	if only == nil {
+		t.Fatal("Expected a manager for the second provider")
+	}
+	if _, provider, _ := only.Chat(conversation); provider != "second" {
+		t.Errorf("Expected the second provider to answer, got %s", provider)
+	}
+	if manager.Only("missing") != nil {
+		t.Error("Expected no manager for an unknown provider")
+	}
+}
+
+// numberingProvider answers every request with a new numbered message and can
+// optionally return several answers per request
+type numberingProvider struct {
+	name     string
+	perBatch int
+	requests atomic.Int32
+	next     atomic.Int32
+}
+
+func (p *numberingProvider) Name() string { return p.name }
+
+func (p *numberingProvider) SummarizeDiff(ctx context.Context, path string, diff string) (string, error) {
+	return p.Chat(ctx, TaskCommit, nil)
+}
+
+func (p *numberingProvider) ContextWindow() int { return DefaultContextWindow }
+
+func (p *numberingProvider) Chat(ctx context.Context, task Task, messages []Message) (string, error) {
+	p.requests.Add(1)
+	return fmt.Sprintf("feat: %s %d", p.name, p.next.Add(1)), nil
+}
+
+// batchingProvider adds native multi-answer support to numberingProvider
+type batchingProvider struct {
+	*numberingProvider
+}
+
+func (p batchingProvider) ChatCandidates(ctx context.Context, task Task, messages []Message, n int) ([]string, error) {
+	p.requests.Add(1)
+	var replies []string
+	for i := 0; i < min(n, p.perBatch); i++ {
+		replies = append(replies, fmt.Sprintf("feat: %s %d", p.name, p.next.Add(1)))
+	}
+	// Repeat the first answer to check duplicates are dropped
+	return append(replies, replies[0]), nil
+}
+
+func TestCandidatesFillsMissingAnswers(t *testing.T) {
+	plain := &numberingProvider{name: "plain"}
+	manager := NewProviderManager([]Provider{plain}, time.Second)
+
+	candidates, err := manager.Candidates(NewConversation(TaskCommit, "prompt"), 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(candidates) != 3 || plain.requests.Load() != 3 {
+		t.Errorf("Expected 3 candidates from 3 parallel requests, got %d from %d", len(candidates), plain.requests.Load())
+	}
+
+	batching := batchingProvider{&numberingProvider{name: "batching", perBatch: 2}}
+	manager = NewProviderManager([]Provider{batching}, time.Second)
+
+	candidates, err = manager.Candidates(NewConversation(TaskCommit, "prompt"), 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The batch holds two answers plus a duplicate, so one more request is made
+	if len(candidates) != 3 || batching.requests.Load() != 2 {
+		t.Errorf("Expected 3 candidates from 2 requests, got %d from %d", len(candidates), batching.requests.Load())
+	}
+	for _, candidate := range candidates {
+		if candidate.Provider != "batching" {
+			t.Errorf("Unexpected provider %q", candidate.Provider)
+		}
+	}
+}
+
+func TestCandidatesBestOf(t *testing.T) {
+	first := &numberingProvider{name: "first"}
+	second := &numberingProvider{name: "second"}
+	manager := NewProviderManager([]Provider{first, second}, time.Second)
+	manager.SetStrategy(StrategyBestOf, 0)
+
+	candidates, err := manager.Candidates(NewConversation(TaskCommit, "prompt"), 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(candidates) != 4 || candidates[0].Provider != "first" || candidates[3].Provider != "second" {
+		t.Errorf("Expected 2 candidates from each provider in order, got %+v", candidates)
+	}
+}
+
+func TestContextStopsAllProviders(t *testing.T) {
+	first := &fakeProvider{name: "first", delay: time.Second}
+	second := &fakeProvider{name: "second", message: "feat: second"}
+	manager := NewProviderManager([]Provider{first, second}, 5*time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	manager.SetContext(ctx)
+
+	var fallbacks []string
+	manager.SetFallbackHandler(func(provider string, err error) {
+		fallbacks = append(fallbacks, provider)
+	})
+
+	_, _, err := manager.Chat(NewConversation(TaskCommit, "prompt"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to end the request, got %v", err)
+	}
+	if second.calls != 0 || len(fallbacks) != 0 {
+		t.Errorf("Expected no fallback once the deadline passed, got %d calls and %v", second.calls, fallbacks)
+	}
+}
@@ -1,40 +1,141 @@
 package llm
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
 
-// CommitMessagePromptTemplate generates the prompt for commit message generation
-func CommitMessagePromptTemplate(diff string, useEmoji bool, userContext string) string {
-	emojiInstruction := ""
-	if useEmoji {
-		emojiInstruction = "\n- Add an appropriate emoji at the beginning of the commit type (✨ feat, 🐛 fix, 📚 docs, 💄 style, ♻️ refactor, ✅ test, 🔧 chore, ⚡ perf, 👷 ci, 🏗️ build, ⏪ revert)"
-	}
+	"github.com/IanKnighton/institutionalized/internal/conventional"
+)
+
+// CommitMessagePromptTemplate generates the prompt for commit message
+// generation. The allowed types, scopes and first line length come from rules;
+// scope is the scope suggested for the changed files, if any, and breaks
+// lists the breaking API changes detected in the diff.
+func CommitMessagePromptTemplate(diff string, rules conventional.Rules, scope string, breaks []string, useEmoji bool, userContext string) string {
+	breakingSection := ""
+	if len(breaks) > 0 {
+		breakingSection = fmt.Sprintf(`
+
+These changes break existing users of the public API:
+- %s
 
-	contextSection := ""
-	if userContext != "" {
-		contextSection = fmt.Sprintf("\n\nAdditional context from the developer:\n%s", userContext)
+Mark the commit as a breaking change: add "!" right before the colon of the first line, and end the message with a "BREAKING CHANGE:" footer that tells users what they have to change.`, strings.Join(breaks, "\n- "))
 	}
 
 	return fmt.Sprintf(`Analyze the following git diff and generate a conventional commit message. 
 
 The commit message should follow the Conventional Commits specification:
-- Start with a type (feat, fix, docs, style, refactor, test, chore, etc.)
-- Include a brief description in present tense
-- Keep the first line under 50 characters if possible
-- Add a body if the change is complex (separate with blank line)%s
+%s%s
 
 Git diff:
 %s%s
 
-Return only the commit message, nothing else.`, emojiInstruction, diff, contextSection)
+Return only the commit message, nothing else.`, commitFormatInstructions(rules, scope, useEmoji), breakingSection, diff, contextSection(userContext))
+}
+
+// commitFormatInstructions lists the Conventional Commits rules a generated
+// commit message must follow
+func commitFormatInstructions(rules conventional.Rules, scope string, useEmoji bool) string {
+	typeInstruction := "- Start with a type (feat, fix, docs, style, refactor, test, chore, etc.)"
+	if len(rules.Types) > 0 {
+		var b strings.Builder
+		b.WriteString("- Start with one of these types:")
+		for _, t := range rules.Types {
+			b.WriteString("\n  - " + t.Name)
+			if t.Description != "" {
+				b.WriteString(": " + t.Description)
+			}
+		}
+		typeInstruction = b.String()
+	}
+
+	scopeInstruction := ""
+	if scope != "" {
+		scopeInstruction = fmt.Sprintf("\n- Use the scope %q in parentheses after the type; it matches the changed files", scope)
+	} else if len(rules.Scopes) > 0 {
+		scopeInstruction = fmt.Sprintf("\n- If the change is limited to one area, add one of these scopes in parentheses after the type: %s. Otherwise leave the scope out.", strings.Join(rules.Scopes, ", "))
+	}
+
+	lengthInstruction := "- Keep the first line under 50 characters if possible"
+	if rules.MaxHeaderLength > 0 {
+		lengthInstruction += fmt.Sprintf(", and never longer than %d characters", rules.MaxHeaderLength)
+	}
+
+	emojiInstruction := ""
+	if useEmoji {
+		var emoji []string
+		for _, t := range rules.Types {
+			if t.Emoji != "" {
+				emoji = append(emoji, t.Emoji+" "+t.Name)
+			}
+		}
+		if len(emoji) > 0 {
+			emojiInstruction = fmt.Sprintf("\n- Add the type's emoji at the beginning of the commit type (%s)", strings.Join(emoji, ", "))
+		} else {
+			emojiInstruction = "\n- Add an appropriate emoji at the beginning of the commit type"
+		}
+	}
+
+	return fmt.Sprintf(`%s%s
+- Include a brief description in present tense
+%s
+- Add a body if the change is complex (separate with blank line)%s`, typeInstruction, scopeInstruction, lengthInstruction, emojiInstruction)
+}
+
+// contextSection formats the developer's additional context for a prompt
+func contextSection(userContext string) string {
+	if userContext == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n\nAdditional context from the developer:\n%s", userContext)
+}
+
+// PRChanges is what a pull request description is written from. Parts left
+// empty are not sent, so the prompt can be built from the commits, the diff
+// or both.
+type PRChanges struct {
+	// Commits holds the full messages of the branch's commits
+	Commits string
+	// Stat is the diffstat of the branch since its merge-base
+	Stat string
+	// Files lists the changed files with how each changed
+	Files string
+	// Diff is the diff since the merge-base, summarized in parts if it is
+	// too large
+	Diff string
+}
+
+// prChangesSections formats each part of the changes as its own section
+func prChangesSections(changes PRChanges) string {
+	var b strings.Builder
+	section := func(heading, content string) {
+		// Leading spaces are kept; they align the diffstat
+		if strings.TrimSpace(content) != "" {
+			fmt.Fprintf(&b, "\n\n%s:\n%s", heading, strings.TrimRight(strings.TrimLeft(content, "\n"), " \n"))
+		}
+	}
+	section("Commit messages", changes.Commits)
+	section("Diffstat", changes.Stat)
+	section("Changed files", changes.Files)
+	section("Diff against the merge-base", changes.Diff)
+	return b.String()
 }
 
 // PRContentPromptTemplate generates the prompt for PR content generation
-func PRContentPromptTemplate(commits, currentBranch, defaultBranch, prTemplate string, useEmoji bool, userContext string) string {
+func PRContentPromptTemplate(changes PRChanges, currentBranch, defaultBranch, prTemplate string, useEmoji bool, userContext string) string {
 	emojiInstruction := ""
 	if useEmoji {
 		emojiInstruction = "\n- You may add appropriate emojis to make the PR more engaging if it fits naturally"
 	}
 
+	sourceInstruction := "\n- Base the description on the commit messages"
+	switch {
+	case changes.Diff != "" && changes.Commits != "":
+		sourceInstruction = "\n- Describe what the code actually changes, using the diff, and take the intent behind the changes from the commit messages"
+	case changes.Diff != "":
+		sourceInstruction = "\n- Describe what the code actually changes, using the diff"
+	}
+
 	templateInstruction := ""
 	if prTemplate != "" {
 		templateInstruction = fmt.Sprintf(`
@@ -45,15 +146,10 @@ IMPORTANT: This repository has a pull request template that you MUST follow. Ple
 %s
 --- PR TEMPLATE END ---
 
-When generating the PR body, use the template structure above but fill it with content based on the commit analysis. Maintain the same sections and format from the template.`, prTemplate)
-	}
-
-	contextSection := ""
-	if userContext != "" {
-		contextSection = fmt.Sprintf("\n\nAdditional context from the developer:\n%s", userContext)
+When generating the PR body, use the template structure above but fill it with content based on the analysis of the changes. Maintain the same sections and format from the template.`, prTemplate)
 	}
 
-	return fmt.Sprintf(`Analyze the following git commits and generate a comprehensive pull request title and body.
+	return fmt.Sprintf(`Analyze the following changes and generate a comprehensive pull request title and body.
 
 The pull request merges branch '%s' into '%s'.%s
 
@@ -63,14 +159,101 @@ Requirements:
   - ## Summary: Brief overview of what this PR accomplishes
   - ## Changes Made: Bullet points of key changes and improvements
   - ## Testing: Description of testing performed or needed
-  - ## Additional Notes: Any important information for reviewers%s
+  - ## Additional Notes: Any important information for reviewers%s%s
 
-Commits to analyze:
-%s%s
+Changes to analyze:%s%s
 
 Return the response in this exact format:
 TITLE: [your generated title here]
 
 BODY:
-[your generated body here]`, currentBranch, defaultBranch, templateInstruction, emojiInstruction, commits, contextSection)
+[your generated body here]`, currentBranch, defaultBranch, templateInstruction, sourceInstruction, emojiInstruction, prChangesSections(changes), contextSection(userContext))
+}
+
+// DiffSummaryPromptTemplate generates the prompt for summarizing part of a
+// diff that is too large to include in a commit message prompt
+func DiffSummaryPromptTemplate(path, diff string) string {
+	return fmt.Sprintf(`Summarize the following part of a git diff for %s so that a commit message can be written from the summary alone.
+
+Requirements:
+- Describe what changed and why it likely changed, not line-by-line edits
+- Mention added, removed or renamed functions, types and files
+- Use at most 5 short bullet points
+
+Git diff:
+%s
+
+Return only the summary, nothing else.`, path, diff)
+}
+
+// SplitPlanPromptTemplate generates the prompt for grouping the hunks of a
+// large staged change into separate commits. hunks lists every numbered hunk
+// with its path; diff is the diff with each hunk header marked with its number.
+func SplitPlanPromptTemplate(hunks, diff string, rules conventional.Rules, useEmoji bool, userContext string) string {
+	return fmt.Sprintf(`Analyze the following git diff and split it into a sequence of small, coherent commits that can be applied in order.
+
+Requirements:
+- Group the numbered hunks by the logical change they belong to, such as one feature, one fix or one refactoring
+- Every hunk must be in exactly one commit
+- Order the commits so that each builds on the previous ones, e.g. a refactoring before the feature that uses it
+- Prefer fewer commits over splitting a single logical change
+- Hunks whose contents aren't shown still need to be placed in a commit, based on their path
+
+Each commit message should follow the Conventional Commits specification:
+%s
+
+Hunks:
+%s
+Git diff (hunk numbers are marked on the @@ lines):
+%s%s
+
+%s`, commitFormatInstructions(rules, "", useEmoji), hunks, diff, contextSection(userContext), splitPlanFormat)
+}
+
+// splitPlanFormat describes the format of commit plans
+const splitPlanFormat = `Return the plan in this exact format, with one block per commit:
+COMMIT 1
+HUNKS: [comma-separated hunk numbers, ranges like 4-6 allowed]
+MESSAGE:
+[the commit message]
+
+COMMIT 2
+...`
+
+// RefinePromptTemplate generates the follow-up prompt that asks for a revised
+// answer, given the developer's feedback on the previous one
+func RefinePromptTemplate(task Task, feedback string) string {
+	format := "Return only the revised commit message, nothing else."
+	switch task {
+	case TaskPR:
+		format = `Return the revised pull request in the same format:
+TITLE: [your revised title here]
+
+BODY:
+[your revised body here]`
+	case TaskSplit:
+		format = "Return the revised commit plan in the same format, nothing else."
+	}
+
+	return fmt.Sprintf(`Revise your previous answer based on this feedback from the developer:
+%s
+
+Keep everything the feedback doesn't ask you to change.
+
+%s`, feedback, format)
+}
+
+// CorrectionPromptTemplate generates the follow-up prompt that asks for a
+// commit message, or commit plan, fixing the format problems found in the
+// previous answer
+func CorrectionPromptTemplate(task Task, violations []string) string {
+	kind, format := "commit message", "Return only the corrected commit message, nothing else."
+	if task == TaskSplit {
+		kind, format = "commit plan", "Return the corrected commit plan in the same format, nothing else."
+	}
+
+	return fmt.Sprintf(`Your previous %s doesn't follow the required format:
+- %s
+
+Fix these problems and keep everything else. %s`, kind, strings.Join(violations, "\n- "), format)
 }
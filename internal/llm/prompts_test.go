@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/IanKnighton/institutionalized/internal/conventional"
+)
+
+func TestCommitPromptUsesRules(t *testing.T) {
+	rules := conventional.Rules{
+		Types:           []conventional.Type{{Name: "deps", Description: "Dependency updates", Emoji: "⬆️"}, {Name: "feat"}},
+		Scopes:          []string{"api", "cli"},
+		MaxHeaderLength: 60,
+	}
+	prompt := CommitMessagePromptTemplate("diff", rules, "", nil, true, "")
+
+	for _, want := range []string{"  - deps: Dependency updates\n  - feat\n", "scopes in parentheses after the type: api, cli", "never longer than 60", "(⬆️ deps)"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected the prompt to contain %q:\n%s", want, prompt)
+		}
+	}
+	if strings.Contains(prompt, "docs") {
+		t.Errorf("Expected only the configured types in the prompt:\n%s", prompt)
+	}
+}
+
+func TestCommitPromptSuggestsScope(t *testing.T) {
+	prompt := CommitMessagePromptTemplate("diff", conventional.Rules{Scopes: []string{"api", "llm"}}, "llm", nil, false, "")
+	if !strings.Contains(prompt, `Use the scope "llm"`) || strings.Contains(prompt, "one of these scopes") {
+		t.Errorf("Expected the suggested scope instead of the scope list:\n%s", prompt)
+	}
+}
+
+func TestCommitPromptListsBreakingChanges(t *testing.T) {
+	prompt := CommitMessagePromptTemplate("diff", conventional.DefaultRules(), "", []string{"pkg/client: removed func New"}, false, "")
+	if !strings.Contains(prompt, "- pkg/client: removed func New\n") || !strings.Contains(prompt, `"BREAKING CHANGE:" footer`) {
+		t.Errorf("Expected the breaking changes in the prompt:\n%s", prompt)
+	}
+	if prompt := CommitMessagePromptTemplate("diff", conventional.DefaultRules(), "", nil, false, ""); strings.Contains(prompt, "BREAKING") {
+		t.Errorf("Expected no breaking change instructions:\n%s", prompt)
+	}
+}
+
+func TestPRPromptSections(t *testing.T) {
+	changes := PRChanges{
+		Commits: "commit abc1234\nfeat: add x\n\nExplains why.",
+		Stat:    " x.go | 3 ++-\n 1 file changed",
+		Files:   "- modified: x.go",
+		Diff:    "diff --git a/x.go b/x.go\n+x",
+	}
+	prompt := PRContentPromptTemplate(changes, "feature", "main", "", false, "")
+	for _, want := range []string{"Commit messages:\ncommit abc1234", "Diffstat:\n x.go", "Changed files:\n- modified: x.go", "Diff against the merge-base:\ndiff --git", "intent behind the changes from the commit messages"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected the prompt to contain %q:\n%s", want, prompt)
+		}
+	}
+
+	prompt = PRContentPromptTemplate(PRChanges{Commits: changes.Commits}, "feature", "main", "", false, "")
+	if strings.Contains(prompt, "Diffstat") || strings.Contains(prompt, "Diff against") || !strings.Contains(prompt, "Base the description on the commit messages") {
+		t.Errorf("Expected only the commit messages:\n%s", prompt)
+	}
+}
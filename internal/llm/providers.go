@@ -1,62 +1,254 @@
 package llm
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
-	"time"
 )
 
 // Provider represents an LLM provider interface
 type Provider interface {
-	GenerateCommitMessage(ctx context.Context, diff string, useEmoji bool, userContext string) (string, error)
-	GeneratePRContent(ctx context.Context, commits string, currentBranch string, defaultBranch string, useEmoji bool, prTemplate string, userContext string) (title string, body string, err error)
+	// SummarizeDiff describes part of a diff that is too large to send whole
+	SummarizeDiff(ctx context.Context, path string, diff string) (string, error)
+	// ContextWindow returns the number of tokens the provider's models accept
+	ContextWindow() int
+	// Chat continues a conversation and returns the provider's next reply,
+	// using the generation settings for the task
+	Chat(ctx context.Context, task Task, messages []Message) (string, error)
 	Name() string
 }
 
-// OpenAIProvider implements the Provider interface for OpenAI
+// CandidateProvider is implemented by providers whose API can return several
+// answers to one request. It may return fewer than n answers.
+type CandidateProvider interface {
+	Provider
+	ChatCandidates(ctx context.Context, task Task, messages []Message, n int) ([]string, error)
+}
+
+// Role identifies who wrote a message in a conversation
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+// Message is one turn of a conversation with a provider
+type Message struct {
+	Role    Role
+	Content string
+}
+
+// userMessage starts a conversation with a single prompt
+func userMessage(prompt string) []Message {
+	return []Message{{Role: RoleUser, Content: prompt}}
+}
+
+// Task is the kind of content a request generates, which selects the
+// generation settings it uses
+type Task string
+
+const (
+	TaskCommit Task = "commit"
+	TaskPR     Task = "pr"
+	// TaskSplit groups a staged change into several commits; it uses the
+	// commit generation settings
+	TaskSplit Task = "split"
+)
+
+// GenerationOptions controls the model and sampling parameters of a request.
+// Nil or zero values leave the choice to the provider.
+type GenerationOptions struct {
+	Model       string
+	Temperature *float64
+	TopP        *float64
+	MaxTokens   int
+	// ContextWindow overrides the model's known context size in tokens
+	ContextWindow int
+}
+
+// ModelSettings holds the generation options a provider uses for each kind of request
+type ModelSettings struct {
+	Commit GenerationOptions
+	PR     GenerationOptions
+}
+
+// withDefaults fills in the model and max tokens where they were left unset
+func (s ModelSettings) withDefaults(model string, commitMaxTokens, prMaxTokens int) ModelSettings {
+	if s.Commit.Model == "" {
+		s.Commit.Model = model
+	}
+	if s.PR.Model == "" {
+		s.PR.Model = model
+	}
+	if s.Commit.MaxTokens == 0 {
+		s.Commit.MaxTokens = commitMaxTokens
+	}
+	if s.PR.MaxTokens == 0 {
+		s.PR.MaxTokens = prMaxTokens
+	}
+	return s
+}
+
+// forTask returns the generation options for a task
+func (s ModelSettings) forTask(task Task) GenerationOptions {
+	if task == TaskPR {
+		return s.PR
+	}
+	return s.Commit
+}
+
+// contextWindow returns the smaller context window of the commit and PR models
+func (s ModelSettings) contextWindow() int {
+	return min(s.Commit.contextWindow(), s.PR.contextWindow())
+}
+
+// contextWindow returns the configured context window or the model's known one
+func (o GenerationOptions) contextWindow() int {
+	if o.ContextWindow > 0 {
+		return o.ContextWindow
+	}
+	return ModelContextWindow(o.Model)
+}
+
+// DefaultContextWindow is assumed for models whose context size is unknown
+const DefaultContextWindow = 8192
+
+// modelContextWindows lists context sizes by model name prefix. Longer
+// prefixes must come before shorter ones they start with.
+var modelContextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-3.5-turbo", 16385},
+	{"gpt-4.1", 1047576},
+	{"gpt-4o", 128000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4", 8192},
+	{"gpt-5", 400000},
+	{"o1", 200000},
+	{"o3", 200000},
+	{"o4", 200000},
+	{"gemini-pro", 32760},
+	{"gemini-1.0", 32760},
+	{"gemini-", 1048576},
+	{"claude-", 200000},
+}
+
+// ModelContextWindow returns the context size of a known model, or
+// DefaultContextWindow for models it doesn't know
+func ModelContextWindow(model string) int {
+	for _, known := range modelContextWindows {
+		if strings.HasPrefix(model, known.prefix) {
+			return known.tokens
+		}
+	}
+	return DefaultContextWindow
+}
+
+// OpenAIProvider implements the Provider interface for OpenAI and any server
+// that speaks the OpenAI chat completions API (vLLM, LM Studio, LiteLLM, ...)
 type OpenAIProvider struct {
-	apiKey string
+	name     string
+	apiKey   string
+	endpoint string
+	headers  map[string]string
+	settings ModelSettings
 }
 
 // GeminiProvider implements the Provider interface for Google Gemini
 type GeminiProvider struct {
-	apiKey string
+	apiKey   string
+	settings ModelSettings
 }
 
 // ClaudeProvider implements the Provider interface for Anthropic Claude
 type ClaudeProvider struct {
-	apiKey string
+	apiKey   string
+	settings ModelSettings
 }
 
+// OllamaProvider implements the Provider interface for a local Ollama server
+type OllamaProvider struct {
+	host     string
+	settings ModelSettings
+}
+
+// Default endpoints and models used when the configuration leaves them unset
+const (
+	DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+	DefaultOpenAIModel   = "gpt-3.5-turbo"
+	DefaultGeminiModel   = "gemini-pro"
+	DefaultClaudeModel   = "claude-3-haiku-20240307"
+	DefaultOllamaHost    = "http://localhost:11434"
+	DefaultOllamaModel   = "llama3.2"
+)
+
+// defaultOllamaContextWindow is the context size Ollama uses unless num_ctx is set
+const defaultOllamaContextWindow = 4096
+
+// Claude requires max_tokens on every request, so it always gets these defaults
+const (
+	defaultClaudeCommitMaxTokens = 1024
+	defaultClaudePRMaxTokens     = 2048
+)
+
 // NewOpenAIProvider creates a new OpenAI provider instance
-func NewOpenAIProvider(apiKey string) *OpenAIProvider {
+func NewOpenAIProvider(apiKey string, settings ModelSettings) *OpenAIProvider {
+	return NewOpenAICompatibleProvider("OpenAI", DefaultOpenAIBaseURL, apiKey, nil, settings.withDefaults(DefaultOpenAIModel, 0, 0))
+}
+
+// NewOpenAICompatibleProvider creates a provider for an OpenAI-compatible API.
+// The base URL is the API root (e.g. "http://localhost:8000/v1"); an empty API
+// key sends no Authorization header, and headers are added to every request.
+func NewOpenAICompatibleProvider(name, baseURL, apiKey string, headers map[string]string, settings ModelSettings) *OpenAIProvider {
+	endpoint := strings.TrimRight(baseURL, "/")
+	if !strings.HasSuffix(endpoint, "/chat/completions") {
+		endpoint += "/chat/completions"
+	}
 	return &OpenAIProvider{
-		apiKey: apiKey,
+		name:     name,
+		apiKey:   apiKey,
+		endpoint: endpoint,
+		headers:  headers,
+		settings: settings,
 	}
 }
 
 // NewGeminiProvider creates a new Gemini provider instance
-func NewGeminiProvider(apiKey string) *GeminiProvider {
+func NewGeminiProvider(apiKey string, settings ModelSettings) *GeminiProvider {
 	return &GeminiProvider{
-		apiKey: apiKey,
+		apiKey:   apiKey,
+		settings: settings.withDefaults(DefaultGeminiModel, 0, 0),
 	}
 }
 
 // NewClaudeProvider creates a new Claude provider instance
-func NewClaudeProvider(apiKey string) *ClaudeProvider {
+func NewClaudeProvider(apiKey string, settings ModelSettings) *ClaudeProvider {
 	return &ClaudeProvider{
-		apiKey: apiKey,
+		apiKey:   apiKey,
+		settings: settings.withDefaults(DefaultClaudeModel, defaultClaudeCommitMaxTokens, defaultClaudePRMaxTokens),
+	}
+}
+
+// NewOllamaProvider creates a new Ollama provider instance. An empty host
+// falls back to DefaultOllamaHost.
+func NewOllamaProvider(host string, settings ModelSettings) *OllamaProvider {
+	if host == "" {
+		host = DefaultOllamaHost
+	}
+	return &OllamaProvider{
+		host:     strings.TrimRight(host, "/"),
+		settings: settings.withDefaults(DefaultOllamaModel, 0, 0),
 	}
 }
 
 // Name returns the provider name
 func (p *OpenAIProvider) Name() string {
-	return "OpenAI"
+	return p.name
 }
 
 // Name returns the provider name
@@ -69,10 +261,20 @@ func (p *ClaudeProvider) Name() string {
 	return "Claude"
 }
 
+// Name returns the provider name
+func (p *OllamaProvider) Name() string {
+	return "Ollama"
+}
+
 // OpenAI API structures
 type openAIRequest struct {
-	Model    string    `json:"model"`
-	Messages []message `json:"messages"`
+	Model       string    `json:"model"`
+	Messages    []message `json:"messages"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	TopP        *float64  `json:"top_p,omitempty"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+	N           int       `json:"n,omitempty"`
+	Stream      bool      `json:"stream,omitempty"`
 }
 
 type message struct {
@@ -96,10 +298,19 @@ type apiError struct {
 
 // Gemini API structures
 type geminiRequest struct {
-	Contents []geminiContent `json:"contents"`
+	Contents         []geminiContent         `json:"contents"`
+	GenerationConfig *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	CandidateCount  int      `json:"candidateCount,omitempty"`
 }
 
 type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
 	Parts []geminiPart `json:"parts"`
 }
 
@@ -123,9 +334,12 @@ type geminiError struct {
 
 // Claude API structures
 type claudeRequest struct {
-	Model     string          `json:"model"`
-	MaxTokens int             `json:"max_tokens"`
-	Messages  []claudeMessage `json:"messages"`
+	Model       string          `json:"model"`
+	MaxTokens   int             `json:"max_tokens"`
+	Messages    []claudeMessage `json:"messages"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	TopP        *float64        `json:"top_p,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
 }
 
 type claudeMessage struct {
@@ -147,339 +361,456 @@ type claudeError struct {
 	Message string `json:"message"`
 }
 
-// GenerateCommitMessage generates a commit message using OpenAI
-func (p *OpenAIProvider) GenerateCommitMessage(ctx context.Context, diff string, useEmoji bool, userContext string) (string, error) {
-	prompt := CommitMessagePromptTemplate(diff, useEmoji, userContext)
+// Ollama API structures
+type ollamaChatRequest struct {
+	Model    string         `json:"model"`
+	Messages []message      `json:"messages"`
+	Stream   bool           `json:"stream"`
+	Options  *ollamaOptions `json:"options,omitempty"`
+}
 
-	reqBody := openAIRequest{
-		Model: "gpt-3.5-turbo",
-		Messages: []message{
-			{Role: "user", Content: prompt},
-		},
-	}
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	NumCtx      int      `json:"num_ctx,omitempty"`
+}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
+type ollamaChatResponse struct {
+	Message message `json:"message"`
+	Done    bool    `json:"done"`
+	Error   string  `json:"error,omitempty"`
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
+type ollamaGenerateRequest struct {
+	Model   string         `json:"model"`
+	Prompt  string         `json:"prompt"`
+	Stream  bool           `json:"stream"`
+	Options *ollamaOptions `json:"options,omitempty"`
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+type ollamaGenerateResponse struct {
+	Response string `json:"response"`
+	Done     bool   `json:"done"`
+	Error    string `json:"error,omitempty"`
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
+// geminiConfig converts generation options to a Gemini generation config,
+// omitting it entirely when nothing is set
+func geminiConfig(opts GenerationOptions) *geminiGenerationConfig {
+	if opts.Temperature == nil && opts.TopP == nil && opts.MaxTokens == 0 {
+		return nil
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+	return &geminiGenerationConfig{
+		Temperature:     opts.Temperature,
+		TopP:            opts.TopP,
+		MaxOutputTokens: opts.MaxTokens,
 	}
+}
 
-	var openAIResp openAIResponse
-	if err := json.Unmarshal(body, &openAIResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+// ollamaRequestOptions converts generation options to Ollama model options,
+// omitting them entirely when nothing is set
+func ollamaRequestOptions(opts GenerationOptions) *ollamaOptions {
+	if opts.Temperature == nil && opts.TopP == nil && opts.MaxTokens == 0 && opts.ContextWindow == 0 {
+		return nil
 	}
-
-	if openAIResp.Error != nil {
-		return "", fmt.Errorf("OpenAI API error: %s", openAIResp.Error.Message)
-	}
-
-	if len(openAIResp.Choices) == 0 {
-		return "", fmt.Errorf("no response from OpenAI")
+	return &ollamaOptions{
+		Temperature: opts.Temperature,
+		TopP:        opts.TopP,
+		NumPredict:  opts.MaxTokens,
+		NumCtx:      opts.ContextWindow,
 	}
+}
 
-	return openAIResp.Choices[0].Message.Content, nil
+// Chat continues a conversation using OpenAI
+func (p *OpenAIProvider) Chat(ctx context.Context, task Task, messages []Message) (string, error) {
+	return p.complete(ctx, messages, p.settings.forTask(task))
 }
 
-// GeneratePRContent generates PR title and body using OpenAI
-func (p *OpenAIProvider) GeneratePRContent(ctx context.Context, commits string, currentBranch string, defaultBranch string, useEmoji bool, prTemplate string, userContext string) (string, string, error) {
-	prompt := PRContentPromptTemplate(commits, currentBranch, defaultBranch, prTemplate, useEmoji, userContext)
+// SummarizeDiff summarizes part of a large diff using OpenAI
+func (p *OpenAIProvider) SummarizeDiff(ctx context.Context, path string, diff string) (string, error) {
+	return p.complete(ctx, userMessage(DiffSummaryPromptTemplate(path, diff)), p.settings.Commit)
+}
 
-	reqBody := openAIRequest{
-		Model: "gpt-3.5-turbo",
-		Messages: []message{
-			{Role: "user", Content: prompt},
-		},
-	}
+// ContextWindow returns the context size of the configured models
+func (p *OpenAIProvider) ContextWindow() int {
+	return p.settings.contextWindow()
+}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to marshal request: %w", err)
-	}
+// ChatCandidates asks OpenAI for n answers in one request
+func (p *OpenAIProvider) ChatCandidates(ctx context.Context, task Task, messages []Message, n int) ([]string, error) {
+	return p.completions(ctx, messages, p.settings.forTask(task), n)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
+// complete sends the prompt to the chat completions endpoint and returns the reply
+func (p *OpenAIProvider) complete(ctx context.Context, messages []Message, opts GenerationOptions) (string, error) {
+	replies, err := p.completions(ctx, messages, opts, 1)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to create request: %w", err)
+		return "", err
 	}
+	return replies[0], nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.apiKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to make request: %w", err)
+// completions requests n choices from the chat completions endpoint. Servers
+// that ignore n return a single choice.
+func (p *OpenAIProvider) completions(ctx context.Context, messages []Message, opts GenerationOptions, n int) ([]string, error) {
+	reqBody := p.request(messages, opts)
+	if n > 1 {
+		reqBody.N = n
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := defaultTransport.PostJSON(ctx, p.name, p.endpoint, p.requestHeaders(), reqBody)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
 
 	var openAIResp openAIResponse
 	if err := json.Unmarshal(body, &openAIResp); err != nil {
-		return "", "", fmt.Errorf("failed to unmarshal response: %w", err)
+		return nil, invalidResponse(p.name, "failed to unmarshal response: %v", err)
 	}
 
 	if openAIResp.Error != nil {
-		return "", "", fmt.Errorf("OpenAI API error: %s", openAIResp.Error.Message)
+		return nil, invalidResponse(p.name, "%s", openAIResp.Error.Message)
 	}
 
 	if len(openAIResp.Choices) == 0 {
-		return "", "", fmt.Errorf("no response from OpenAI")
+		return nil, invalidResponse(p.name, "no response from %s", p.name)
 	}
 
-	content := openAIResp.Choices[0].Message.Content
-	return parsePRResponse(content)
+	replies := make([]string, len(openAIResp.Choices))
+	for i, choice := range openAIResp.Choices {
+		replies[i] = choice.Message.Content
+	}
+	return replies, nil
 }
 
-// GenerateCommitMessage generates a commit message using Gemini
-func (p *GeminiProvider) GenerateCommitMessage(ctx context.Context, diff string, useEmoji bool, userContext string) (string, error) {
-	prompt := CommitMessagePromptTemplate(diff, useEmoji, userContext)
-
-	reqBody := geminiRequest{
-		Contents: []geminiContent{
-			{
-				Parts: []geminiPart{
-					{Text: prompt},
-				},
-			},
-		},
+// request builds a chat completions request for the conversation
+func (p *OpenAIProvider) request(messages []Message, opts GenerationOptions) openAIRequest {
+	return openAIRequest{
+		Model:       opts.Model,
+		Messages:    chatMessages(messages),
+		Temperature: opts.Temperature,
+		TopP:        opts.TopP,
+		MaxTokens:   opts.MaxTokens,
 	}
+}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+// requestHeaders returns the authorization and any configured extra headers
+func (p *OpenAIProvider) requestHeaders() map[string]string {
+	headers := make(map[string]string, len(p.headers)+1)
+	if p.apiKey != "" {
+		headers["Authorization"] = "Bearer " + p.apiKey
+	}
+	for key, value := range p.headers {
+		headers[key] = value
 	}
+	return headers
+}
 
-	// Gemini API endpoint
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/gemini-pro:generateContent?key=%s", p.apiKey)
+// Chat continues a conversation using Gemini
+func (p *GeminiProvider) Chat(ctx context.Context, task Task, messages []Message) (string, error) {
+	return p.complete(ctx, messages, p.settings.forTask(task))
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
+// SummarizeDiff summarizes part of a large diff using Gemini
+func (p *GeminiProvider) SummarizeDiff(ctx context.Context, path string, diff string) (string, error) {
+	return p.complete(ctx, userMessage(DiffSummaryPromptTemplate(path, diff)), p.settings.Commit)
+}
 
-	req.Header.Set("Content-Type", "application/json")
+// ContextWindow returns the context size of the configured models
+func (p *GeminiProvider) ContextWindow() int {
+	return p.settings.contextWindow()
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// ChatCandidates asks Gemini for n candidates in one request
+func (p *GeminiProvider) ChatCandidates(ctx context.Context, task Task, messages []Message, n int) ([]string, error) {
+	return p.completions(ctx, messages, p.settings.forTask(task), n)
+}
+
+// complete sends the prompt to the generateContent endpoint and returns the reply
+func (p *GeminiProvider) complete(ctx context.Context, messages []Message, opts GenerationOptions) (string, error) {
+	replies, err := p.completions(ctx, messages, opts, 1)
 	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
+	return replies[0], nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+// completions requests n candidates from the generateContent endpoint.
+// Candidates without text (e.g. blocked by safety filters) are skipped.
+func (p *GeminiProvider) completions(ctx context.Context, messages []Message, opts GenerationOptions, n int) ([]string, error) {
+	reqBody := p.request(messages, opts)
+	if n > 1 {
+		if reqBody.GenerationConfig == nil {
+			reqBody.GenerationConfig = &geminiGenerationConfig{}
+		}
+		reqBody.GenerationConfig.CandidateCount = n
+	}
+
+	body, err := defaultTransport.PostJSON(ctx, p.Name(), geminiURL(opts.Model, "generateContent"), p.requestHeaders(), reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
 
 	var geminiResp geminiResponse
 	if err := json.Unmarshal(body, &geminiResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+		return nil, invalidResponse(p.Name(), "failed to unmarshal response: %v", err)
 	}
 
 	if geminiResp.Error != nil {
-		return "", fmt.Errorf("Gemini API error: %s", geminiResp.Error.Message)
+		return nil, invalidResponse(p.Name(), "%s", geminiResp.Error.Message)
 	}
 
 	if len(geminiResp.Candidates) == 0 {
-		return "", fmt.Errorf("no response from Gemini")
+		return nil, invalidResponse(p.Name(), "no response from Gemini")
 	}
 
-	if len(geminiResp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("empty response from Gemini")
+	var replies []string
+	for _, candidate := range geminiResp.Candidates {
+		if len(candidate.Content.Parts) > 0 {
+			replies = append(replies, candidate.Content.Parts[0].Text)
+		}
 	}
-
-	return geminiResp.Candidates[0].Content.Parts[0].Text, nil
+	if len(replies) == 0 {
+		return nil, invalidResponse(p.Name(), "empty response from Gemini")
+	}
+	return replies, nil
 }
 
-// GeneratePRContent generates PR title and body using Gemini
-func (p *GeminiProvider) GeneratePRContent(ctx context.Context, commits string, currentBranch string, defaultBranch string, useEmoji bool, prTemplate string, userContext string) (string, string, error) {
-	prompt := PRContentPromptTemplate(commits, currentBranch, defaultBranch, prTemplate, useEmoji, userContext)
-
-	reqBody := geminiRequest{
-		Contents: []geminiContent{
-			{
-				Parts: []geminiPart{
-					{Text: prompt},
-				},
-			},
-		},
+// request builds a Gemini content request for the conversation. Gemini
+// calls the assistant role "model".
+func (p *GeminiProvider) request(messages []Message, opts GenerationOptions) geminiRequest {
+	contents := make([]geminiContent, len(messages))
+	for i, msg := range messages {
+		role := "user"
+		if msg.Role == RoleAssistant {
+			role = "model"
+		}
+		contents[i] = geminiContent{Role: role, Parts: []geminiPart{{Text: msg.Content}}}
 	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to marshal request: %w", err)
+	return geminiRequest{
+		Contents:         contents,
+		GenerationConfig: geminiConfig(opts),
 	}
+}
 
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/gemini-pro:generateContent?key=%s", p.apiKey)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", "", fmt.Errorf("failed to create request: %w", err)
-	}
+// requestHeaders returns the API key header. The key is sent as a header
+// rather than a query parameter so it can't leak into error messages.
+func (p *GeminiProvider) requestHeaders() map[string]string {
+	return map[string]string{"x-goog-api-key": p.apiKey}
+}
 
-	req.Header.Set("Content-Type", "application/json")
+// geminiURL returns the Gemini API endpoint for a model and method
+func geminiURL(model, method string) string {
+	return fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:%s", model, method)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to make request: %w", err)
-	}
-	defer resp.Body.Close()
+// Chat continues a conversation using Claude
+func (p *ClaudeProvider) Chat(ctx context.Context, task Task, messages []Message) (string, error) {
+	return p.complete(ctx, messages, p.settings.forTask(task))
+}
+
+// SummarizeDiff summarizes part of a large diff using Claude
+func (p *ClaudeProvider) SummarizeDiff(ctx context.Context, path string, diff string) (string, error) {
+	return p.complete(ctx, userMessage(DiffSummaryPromptTemplate(path, diff)), p.settings.Commit)
+}
+
+// ContextWindow returns the context size of the configured models
+func (p *ClaudeProvider) ContextWindow() int {
+	return p.settings.contextWindow()
+}
 
-	body, err := io.ReadAll(resp.Body)
+// complete sends the prompt to the messages endpoint and returns the reply
+func (p *ClaudeProvider) complete(ctx context.Context, messages []Message, opts GenerationOptions) (string, error) {
+	body, err := defaultTransport.PostJSON(ctx, p.Name(), claudeMessagesURL, p.requestHeaders(), p.request(messages, opts))
 	if err != nil {
-		return "", "", fmt.Errorf("failed to read response: %w", err)
+		return "", err
 	}
 
-	var geminiResp geminiResponse
-	if err := json.Unmarshal(body, &geminiResp); err != nil {
-		return "", "", fmt.Errorf("failed to unmarshal response: %w", err)
+	var claudeResp claudeResponse
+	if err := json.Unmarshal(body, &claudeResp); err != nil {
+		return "", invalidResponse(p.Name(), "failed to unmarshal response: %v", err)
 	}
 
-	if geminiResp.Error != nil {
-		return "", "", fmt.Errorf("Gemini API error: %s", geminiResp.Error.Message)
+	if claudeResp.Error != nil {
+		return "", invalidResponse(p.Name(), "%s", claudeResp.Error.Message)
 	}
 
-	if len(geminiResp.Candidates) == 0 {
-		return "", "", fmt.Errorf("no response from Gemini")
+	if len(claudeResp.Content) == 0 {
+		return "", invalidResponse(p.Name(), "no response from Claude")
 	}
 
-	content := geminiResp.Candidates[0].Content.Parts[0].Text
-	return parsePRResponse(content)
+	return claudeResp.Content[0].Text, nil
 }
 
-// GenerateCommitMessage generates a commit message using Claude
-func (p *ClaudeProvider) GenerateCommitMessage(ctx context.Context, diff string, useEmoji bool, userContext string) (string, error) {
-	prompt := CommitMessagePromptTemplate(diff, useEmoji, userContext)
+// claudeMessagesURL is the Anthropic messages endpoint
+const claudeMessagesURL = "https://api.anthropic.com/v1/messages"
 
-	reqBody := claudeRequest{
-		Model:     "claude-3-haiku-20240307",
-		MaxTokens: 1024,
-		Messages: []claudeMessage{
-			{Role: "user", Content: prompt},
-		},
+// request builds a Claude messages request for the conversation
+func (p *ClaudeProvider) request(messages []Message, opts GenerationOptions) claudeRequest {
+	claudeMessages := make([]claudeMessage, len(messages))
+	for i, msg := range messages {
+		claudeMessages[i] = claudeMessage{Role: string(msg.Role), Content: msg.Content}
 	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+	return claudeRequest{
+		Model:       opts.Model,
+		MaxTokens:   opts.MaxTokens,
+		Messages:    claudeMessages,
+		Temperature: opts.Temperature,
+		TopP:        opts.TopP,
 	}
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+// requestHeaders returns the API key and version headers
+func (p *ClaudeProvider) requestHeaders() map[string]string {
+	return map[string]string{
+		"x-api-key":         p.apiKey,
+		"anthropic-version": "2023-06-01",
 	}
+}
+
+// Chat continues a conversation using Ollama
+func (p *OllamaProvider) Chat(ctx context.Context, task Task, messages []Message) (string, error) {
+	return p.complete(ctx, messages, p.settings.forTask(task))
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", p.apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+// SummarizeDiff summarizes part of a large diff using Ollama
+func (p *OllamaProvider) SummarizeDiff(ctx context.Context, path string, diff string) (string, error) {
+	return p.complete(ctx, userMessage(DiffSummaryPromptTemplate(path, diff)), p.settings.Commit)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
+// ContextWindow returns the configured context window. Ollama runs models
+// with the server's default context rather than the model's maximum, so
+// known model sizes don't apply.
+func (p *OllamaProvider) ContextWindow() int {
+	return min(ollamaContextWindow(p.settings.Commit), ollamaContextWindow(p.settings.PR))
+}
+
+// ollamaContextWindow returns the num_ctx sent with requests, or the server default
+func ollamaContextWindow(opts GenerationOptions) int {
+	if opts.ContextWindow > 0 {
+		return opts.ContextWindow
+	}
+	return defaultOllamaContextWindow
+}
+
+// complete sends the prompt to the /api/chat endpoint, falling back to
+// /api/generate for older Ollama servers that don't expose the chat API
+func (p *OllamaProvider) complete(ctx context.Context, messages []Message, opts GenerationOptions) (string, error) {
+	content, err := p.chat(ctx, messages, opts)
+	if isOllamaEndpointNotFound(err) {
+		return p.generate(ctx, messages, opts)
 	}
-	defer resp.Body.Close()
+	return content, err
+}
 
-	body, err := io.ReadAll(resp.Body)
+// isOllamaEndpointNotFound reports whether the server doesn't know the
+// endpoint at all. Ollama also answers 404 for models that haven't been
+// pulled, but those errors mention the model.
+func isOllamaEndpointNotFound(err error) bool {
+	var providerErr *ProviderError
+	return errors.As(err, &providerErr) &&
+		providerErr.StatusCode == http.StatusNotFound &&
+		!strings.Contains(providerErr.Message, "model")
+}
+
+// chat calls the Ollama /api/chat endpoint
+func (p *OllamaProvider) chat(ctx context.Context, messages []Message, opts GenerationOptions) (string, error) {
+	body, err := defaultTransport.PostJSON(ctx, p.Name(), p.host+"/api/chat", nil, p.chatRequest(messages, opts, false))
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return "", err
 	}
 
-	var claudeResp claudeResponse
-	if err := json.Unmarshal(body, &claudeResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+	var chatResp ollamaChatResponse
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		return "", invalidResponse(p.Name(), "failed to unmarshal response: %v", err)
 	}
 
-	if claudeResp.Error != nil {
-		return "", fmt.Errorf("Claude API error: %s", claudeResp.Error.Message)
+	if chatResp.Error != "" {
+		return "", invalidResponse(p.Name(), "%s", chatResp.Error)
 	}
 
-	if len(claudeResp.Content) == 0 {
-		return "", fmt.Errorf("no response from Claude")
+	if strings.TrimSpace(chatResp.Message.Content) == "" {
+		return "", invalidResponse(p.Name(), "no response from Ollama")
 	}
 
-	return claudeResp.Content[0].Text, nil
+	return chatResp.Message.Content, nil
 }
 
-// GeneratePRContent generates PR title and body using Claude
-func (p *ClaudeProvider) GeneratePRContent(ctx context.Context, commits string, currentBranch string, defaultBranch string, useEmoji bool, prTemplate string, userContext string) (string, string, error) {
-	prompt := PRContentPromptTemplate(commits, currentBranch, defaultBranch, prTemplate, useEmoji, userContext)
+// generate calls the Ollama /api/generate endpoint
+func (p *OllamaProvider) generate(ctx context.Context, messages []Message, opts GenerationOptions) (string, error) {
+	body, err := defaultTransport.PostJSON(ctx, p.Name(), p.host+"/api/generate", nil, p.generateRequest(messages, opts, false))
+	if err != nil {
+		return "", err
+	}
 
-	reqBody := claudeRequest{
-		Model:     "claude-3-haiku-20240307",
-		MaxTokens: 2048,
-		Messages: []claudeMessage{
-			{Role: "user", Content: prompt},
-		},
+	var generateResp ollamaGenerateResponse
+	if err := json.Unmarshal(body, &generateResp); err != nil {
+		return "", invalidResponse(p.Name(), "failed to unmarshal response: %v", err)
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to marshal request: %w", err)
+	if generateResp.Error != "" {
+		return "", invalidResponse(p.Name(), "%s", generateResp.Error)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", "", fmt.Errorf("failed to create request: %w", err)
+	if strings.TrimSpace(generateResp.Response) == "" {
+		return "", invalidResponse(p.Name(), "no response from Ollama")
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", p.apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+	return generateResp.Response, nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to make request: %w", err)
+// chatRequest builds an Ollama chat request for the conversation
+func (p *OllamaProvider) chatRequest(messages []Message, opts GenerationOptions, stream bool) ollamaChatRequest {
+	return ollamaChatRequest{
+		Model:    opts.Model,
+		Messages: chatMessages(messages),
+		Stream:   stream,
+		Options:  ollamaRequestOptions(opts),
 	}
-	defer resp.Body.Close()
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to read response: %w", err)
+// generateRequest builds an Ollama generate request for the conversation.
+// The generate API takes a single prompt, so earlier turns are written out
+// as a transcript.
+func (p *OllamaProvider) generateRequest(messages []Message, opts GenerationOptions, stream bool) ollamaGenerateRequest {
+	return ollamaGenerateRequest{
+		Model:   opts.Model,
+		Prompt:  transcript(messages),
+		Stream:  stream,
+		Options: ollamaRequestOptions(opts),
 	}
+}
 
-	var claudeResp claudeResponse
-	if err := json.Unmarshal(body, &claudeResp); err != nil {
-		return "", "", fmt.Errorf("failed to unmarshal response: %w", err)
+// chatMessages converts a conversation to OpenAI-style chat messages
+func chatMessages(messages []Message) []message {
+	converted := make([]message, len(messages))
+	for i, msg := range messages {
+		converted[i] = message{Role: string(msg.Role), Content: msg.Content}
 	}
+	return converted
+}
 
-	if claudeResp.Error != nil {
-		return "", "", fmt.Errorf("Claude API error: %s", claudeResp.Error.Message)
+// transcript flattens a conversation into a single prompt. A conversation
+// with one message is just that message.
+func transcript(messages []Message) string {
+	if len(messages) == 1 {
+		return messages[0].Content
 	}
-
-	if len(claudeResp.Content) == 0 {
-		return "", "", fmt.Errorf("no response from Claude")
+	var b strings.Builder
+	for _, msg := range messages {
+		speaker := "User"
+		if msg.Role == RoleAssistant {
+			speaker = "Assistant"
+		}
+		fmt.Fprintf(&b, "%s:\n%s\n\n", speaker, msg.Content)
 	}
-
-	content := claudeResp.Content[0].Text
-	return parsePRResponse(content)
+	b.WriteString("Assistant:\n")
+	return b.String()
 }
 
 // parsePRResponse parses the LLM response to extract title and body
-func parsePRResponse(content string) (string, string, error) {
+func ParsePRResponse(content string) (string, string, error) {
 	lines := strings.Split(content, "\n")
 	var title, body string
 	var inBody bool
@@ -512,74 +843,8 @@ func parsePRResponse(content string) (string, string, error) {
 	return title, body, nil
 }
 
-// ProviderManager manages multiple LLM providers with fallback capability
-type ProviderManager struct {
-	providers      []Provider
-	delayThreshold time.Duration
-}
-
-// NewProviderManager creates a new provider manager
-func NewProviderManager(providers []Provider, delayThreshold time.Duration) *ProviderManager {
-	return &ProviderManager{
-		providers:      providers,
-		delayThreshold: delayThreshold,
-	}
-}
-
-// GenerateCommitMessage tries providers in order with timeout and fallback
-func (pm *ProviderManager) GenerateCommitMessage(diff string, useEmoji bool, userContext string) (string, string, error) {
-	for i, provider := range pm.providers {
-		ctx, cancel := context.WithTimeout(context.Background(), pm.delayThreshold)
-		defer cancel()
-
-		result, err := provider.GenerateCommitMessage(ctx, diff, useEmoji, userContext)
-		if err == nil {
-			return result, provider.Name(), nil
-		}
-
-		// If this was the last provider or if it's not a timeout error, return the error
-		if i == len(pm.providers)-1 {
-			return "", provider.Name(), fmt.Errorf("all providers failed, last error from %s: %w", provider.Name(), err)
-		}
-
-		// Check if the error is due to context timeout
-		if ctx.Err() == context.DeadlineExceeded {
-			// Continue to next provider
-			continue
-		}
-
-		// For non-timeout errors, still try the next provider but log this one
-		continue
-	}
-
-	return "", "", fmt.Errorf("no providers available")
-}
-
-// GeneratePRContent tries providers in order to generate PR title and body
-func (pm *ProviderManager) GeneratePRContent(commits string, currentBranch string, defaultBranch string, useEmoji bool, prTemplate string, userContext string) (string, string, string, error) {
-	for i, provider := range pm.providers {
-		ctx, cancel := context.WithTimeout(context.Background(), pm.delayThreshold)
-		defer cancel()
-
-		title, body, err := provider.GeneratePRContent(ctx, commits, currentBranch, defaultBranch, useEmoji, prTemplate, userContext)
-		if err == nil {
-			return title, body, provider.Name(), nil
-		}
-
-		// If this was the last provider or if it's not a timeout error, return the error
-		if i == len(pm.providers)-1 {
-			return "", "", provider.Name(), fmt.Errorf("all providers failed, last error from %s: %w", provider.Name(), err)
-		}
-
-		// Check if the error is due to context timeout
-		if ctx.Err() == context.DeadlineExceeded {
-			// Continue to next provider
-			continue
-		}
-
-		// For non-timeout errors, still try the next provider but log this one
-		continue
-	}
-
-	return "", "", "", fmt.Errorf("no providers available")
+// FormatPRResponse writes a title and body in the format ParsePRResponse
+// reads, so an edited PR can be put back into a conversation
+func FormatPRResponse(title, body string) string {
+	return fmt.Sprintf("TITLE: %s\nBODY:\n%s", title, body)
 }
@@ -0,0 +1,286 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// StreamingProvider is implemented by providers that can pass generated text
+// to a callback as it arrives instead of waiting for the full response
+type StreamingProvider interface {
+	Provider
+	StreamChat(ctx context.Context, task Task, messages []Message, onToken func(string)) (string, error)
+}
+
+// Stream event structures
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta message `json:"delta"`
+	} `json:"choices"`
+	Error *apiError `json:"error,omitempty"`
+}
+
+type claudeStreamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Error *claudeError `json:"error,omitempty"`
+}
+
+// StreamChat streams the next reply in a conversation from OpenAI
+func (p *OpenAIProvider) StreamChat(ctx context.Context, task Task, messages []Message, onToken func(string)) (string, error) {
+	return p.stream(ctx, messages, p.settings.forTask(task), onToken)
+}
+
+// stream sends a streaming chat completions request and reads the
+// server-sent events until the [DONE] marker
+func (p *OpenAIProvider) stream(ctx context.Context, messages []Message, opts GenerationOptions, onToken func(string)) (string, error) {
+	reqBody := p.request(messages, opts)
+	reqBody.Stream = true
+
+	body, err := defaultTransport.PostStream(ctx, p.name, p.endpoint, p.requestHeaders(), reqBody)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	var content strings.Builder
+	err = readServerSentEvents(body, func(data []byte) (bool, error) {
+		if string(data) == "[DONE]" {
+			return true, nil
+		}
+
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return false, invalidResponse(p.name, "failed to unmarshal stream event: %v", err)
+		}
+		if chunk.Error != nil {
+			return false, invalidResponse(p.name, "%s", chunk.Error.Message)
+		}
+		for _, choice := range chunk.Choices {
+			emit(&content, choice.Delta.Content, onToken)
+		}
+		return false, nil
+	})
+	return finishStream(ctx, p.name, content.String(), err)
+}
+
+// StreamChat streams the next reply in a conversation from Gemini
+func (p *GeminiProvider) StreamChat(ctx context.Context, task Task, messages []Message, onToken func(string)) (string, error) {
+	return p.stream(ctx, messages, p.settings.forTask(task), onToken)
+}
+
+// stream calls streamGenerateContent with alt=sse; every event is a partial
+// generateContent response
+func (p *GeminiProvider) stream(ctx context.Context, messages []Message, opts GenerationOptions, onToken func(string)) (string, error) {
+	url := geminiURL(opts.Model, "streamGenerateContent") + "?alt=sse"
+
+	body, err := defaultTransport.PostStream(ctx, p.Name(), url, p.requestHeaders(), p.request(messages, opts))
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	var content strings.Builder
+	err = readServerSentEvents(body, func(data []byte) (bool, error) {
+		var chunk geminiResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return false, invalidResponse(p.Name(), "failed to unmarshal stream event: %v", err)
+		}
+		if chunk.Error != nil {
+			return false, invalidResponse(p.Name(), "%s", chunk.Error.Message)
+		}
+		if len(chunk.Candidates) > 0 {
+			for _, part := range chunk.Candidates[0].Content.Parts {
+				emit(&content, part.Text, onToken)
+			}
+		}
+		return false, nil
+	})
+	return finishStream(ctx, p.Name(), content.String(), err)
+}
+
+// StreamChat streams the next reply in a conversation from Claude
+func (p *ClaudeProvider) StreamChat(ctx context.Context, task Task, messages []Message, onToken func(string)) (string, error) {
+	return p.stream(ctx, messages, p.settings.forTask(task), onToken)
+}
+
+// stream sends a streaming messages request and collects the text deltas
+// until the message_stop event
+func (p *ClaudeProvider) stream(ctx context.Context, messages []Message, opts GenerationOptions, onToken func(string)) (string, error) {
+	reqBody := p.request(messages, opts)
+	reqBody.Stream = true
+
+	body, err := defaultTransport.PostStream(ctx, p.Name(), claudeMessagesURL, p.requestHeaders(), reqBody)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	var content strings.Builder
+	err = readServerSentEvents(body, func(data []byte) (bool, error) {
+		var event claudeStreamEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return false, invalidResponse(p.Name(), "failed to unmarshal stream event: %v", err)
+		}
+
+		switch event.Type {
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" {
+				emit(&content, event.Delta.Text, onToken)
+			}
+		case "message_stop":
+			return true, nil
+		case "error":
+			// Errors after the response started still carry their class
+			if event.Error != nil && event.Error.Type == "overloaded_error" {
+				return false, &ProviderError{Provider: p.Name(), Class: ErrorClassOverloaded, Message: event.Error.Message}
+			}
+			if event.Error != nil {
+				return false, invalidResponse(p.Name(), "%s", event.Error.Message)
+			}
+		}
+		return false, nil
+	})
+	return finishStream(ctx, p.Name(), content.String(), err)
+}
+
+// StreamChat streams the next reply in a conversation from Ollama
+func (p *OllamaProvider) StreamChat(ctx context.Context, task Task, messages []Message, onToken func(string)) (string, error) {
+	return p.stream(ctx, messages, p.settings.forTask(task), onToken)
+}
+
+// stream reads the newline-delimited JSON stream of /api/chat, falling back
+// to /api/generate for older servers like complete does
+func (p *OllamaProvider) stream(ctx context.Context, messages []Message, opts GenerationOptions, onToken func(string)) (string, error) {
+	body, err := defaultTransport.PostStream(ctx, p.Name(), p.host+"/api/chat", nil, p.chatRequest(messages, opts, true))
+	useGenerate := isOllamaEndpointNotFound(err)
+	if useGenerate {
+		body, err = defaultTransport.PostStream(ctx, p.Name(), p.host+"/api/generate", nil, p.generateRequest(messages, opts, true))
+	}
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	var content strings.Builder
+	scanner := newLineScanner(body)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var token, errorMessage string
+		var done bool
+		if useGenerate {
+			var chunk ollamaGenerateResponse
+			if err := json.Unmarshal(line, &chunk); err != nil {
+				return "", invalidResponse(p.Name(), "failed to unmarshal stream event: %v", err)
+			}
+			token, done, errorMessage = chunk.Response, chunk.Done, chunk.Error
+		} else {
+			var chunk ollamaChatResponse
+			if err := json.Unmarshal(line, &chunk); err != nil {
+				return "", invalidResponse(p.Name(), "failed to unmarshal stream event: %v", err)
+			}
+			token, done, errorMessage = chunk.Message.Content, chunk.Done, chunk.Error
+		}
+
+		if errorMessage != "" {
+			return "", invalidResponse(p.Name(), "%s", errorMessage)
+		}
+		emit(&content, token, onToken)
+		if done {
+			break
+		}
+	}
+	return finishStream(ctx, p.Name(), content.String(), scanner.Err())
+}
+
+// emit appends a token to the content and passes it on
+func emit(content *strings.Builder, token string, onToken func(string)) {
+	if token == "" {
+		return
+	}
+	content.WriteString(token)
+	if onToken != nil {
+		onToken(token)
+	}
+}
+
+// finishStream turns a stream's outcome into the final result, classifying
+// errors from a connection that broke mid-response
+func finishStream(ctx context.Context, provider, content string, err error) (string, error) {
+	if err != nil {
+		var providerErr *ProviderError
+		if errors.As(err, &providerErr) {
+			return "", err
+		}
+		return "", defaultTransport.requestError(ctx, provider, err)
+	}
+	if strings.TrimSpace(content) == "" {
+		return "", invalidResponse(provider, "no response from %s", provider)
+	}
+	return content, nil
+}
+
+// readServerSentEvents reads a text/event-stream body and calls onData with
+// the data of each event. Reading stops at the end of the stream, when
+// onData returns an error, or when it reports that the stream is done.
+func readServerSentEvents(r io.Reader, onData func(data []byte) (done bool, err error)) error {
+	scanner := newLineScanner(r)
+	var data []byte
+
+	dispatch := func() (bool, error) {
+		if len(data) == 0 {
+			return false, nil
+		}
+		event := data
+		data = nil
+		return onData(event)
+	}
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		// A blank line ends the event
+		if len(line) == 0 {
+			if done, err := dispatch(); done || err != nil {
+				return err
+			}
+			continue
+		}
+
+		field, value, _ := bytes.Cut(line, []byte(":"))
+		if string(field) != "data" {
+			// Comments and event/id/retry fields aren't needed
+			continue
+		}
+		value = bytes.TrimPrefix(value, []byte(" "))
+		if len(data) > 0 {
+			data = append(data, '\n')
+		}
+		data = append(data, value...)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	_, err := dispatch()
+	return err
+}
+
+// newLineScanner returns a line scanner that tolerates long stream events
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return scanner
+}
@@ -0,0 +1,71 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadServerSentEvents(t *testing.T) {
+	stream := ": keep-alive\n\nevent: delta\ndata: one\n\ndata: two\ndata: lines\n\ndata: [DONE]\n\ndata: ignored\n\n"
+
+	var events []string
+	err := readServerSentEvents(strings.NewReader(stream), func(data []byte) (bool, error) {
+		if string(data) == "[DONE]" {
+			return true, nil
+		}
+		events = append(events, string(data))
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 2 || events[0] != "one" || events[1] != "two\nlines" {
+		t.Errorf("Unexpected events: %q", events)
+	}
+}
+
+func TestOpenAIProviderStreamsTokens(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, token := range []string{"feat", ": add", " thing"} {
+			w.Write([]byte(`data: {"choices": [{"delta": {"content": "` + token + `"}}]}` + "\n\n"))
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	settings := ModelSettings{Commit: GenerationOptions{Model: "local-model"}}
+	provider := NewOpenAICompatibleProvider("gateway", server.URL, "", nil, settings)
+
+	var tokens []string
+	message, err := provider.StreamChat(context.Background(), TaskCommit, userMessage("prompt"), func(token string) {
+		tokens = append(tokens, token)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if message != "feat: add thing" {
+		t.Errorf("Unexpected message: %q", message)
+	}
+	if len(tokens) != 3 {
+		t.Errorf("Expected 3 tokens, got %q", tokens)
+	}
+}
+
+func TestStreamWithoutContentIsInvalid(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	settings := ModelSettings{Commit: GenerationOptions{Model: "local-model"}}
+	provider := NewOpenAICompatibleProvider("gateway", server.URL, "", nil, settings)
+
+	_, err := provider.StreamChat(context.Background(), TaskCommit, userMessage("prompt"), nil)
+	if ErrorClassOf(err) != ErrorClassInvalidResponse {
+		t.Errorf("Expected invalid response error, got: %v", err)
+	}
+}
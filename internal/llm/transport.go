@@ -0,0 +1,350 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorClass categorizes provider failures so callers can decide how to react
+type ErrorClass int
+
+const (
+	// ErrorClassUnknown is used for failures that don't fit another class
+	ErrorClassUnknown ErrorClass = iota
+	// ErrorClassAuth means the API key is missing, invalid or lacks permission
+	ErrorClassAuth
+	// ErrorClassRateLimit means the provider rejected the request due to rate or quota limits
+	ErrorClassRateLimit
+	// ErrorClassOverloaded means the provider is temporarily unavailable or erroring
+	ErrorClassOverloaded
+	// ErrorClassBadRequest means the provider rejected the request itself
+	// (invalid model, prompt too long, malformed payload)
+	ErrorClassBadRequest
+	// ErrorClassNetwork means the provider could not be reached
+	ErrorClassNetwork
+	// ErrorClassTimeout means the request ran out of time
+	ErrorClassTimeout
+	// ErrorClassInvalidResponse means the provider answered but the response was unusable
+	ErrorClassInvalidResponse
+)
+
+// String returns a human-readable name for the error class
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassAuth:
+		return "authentication failed"
+	case ErrorClassRateLimit:
+		return "rate limited"
+	case ErrorClassOverloaded:
+		return "overloaded"
+	case ErrorClassBadRequest:
+		return "bad request"
+	case ErrorClassNetwork:
+		return "network error"
+	case ErrorClassTimeout:
+		return "timed out"
+	case ErrorClassInvalidResponse:
+		return "invalid response"
+	default:
+		return "error"
+	}
+}
+
+// ProviderError is returned by providers when an API call fails
+type ProviderError struct {
+	Provider   string
+	Class      ErrorClass
+	StatusCode int
+	// RetryAfter is the delay the provider asked for, if any
+	RetryAfter time.Duration
+	Message    string
+	Err        error
+}
+
+// Error implements the error interface
+func (e *ProviderError) Error() string {
+	msg := fmt.Sprintf("%s %s", e.Provider, e.Class)
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" (HTTP %d)", e.StatusCode)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	} else if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether retrying the same request later could succeed
+func (e *ProviderError) Temporary() bool {
+	switch e.Class {
+	case ErrorClassRateLimit, ErrorClassOverloaded, ErrorClassNetwork:
+		return true
+	}
+	return false
+}
+
+// ErrorClassOf returns the class of a provider error, or ErrorClassUnknown if
+// err is not a ProviderError
+func ErrorClassOf(err error) ErrorClass {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.Class
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTimeout
+	}
+	return ErrorClassUnknown
+}
+
+// invalidResponse builds an error for a response that could not be used
+func invalidResponse(provider, format string, args ...interface{}) error {
+	return &ProviderError{
+		Provider: provider,
+		Class:    ErrorClassInvalidResponse,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// Transport sends provider API requests, retrying transient failures with
+// jittered exponential backoff and honoring Retry-After headers
+type Transport struct {
+	Client *http.Client
+	// MaxRetries is the number of retries after the first attempt
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry; it doubles on each retry
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff between attempts
+	MaxDelay time.Duration
+
+	// sleep waits between attempts and can be replaced in tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewTransport creates a transport with the default retry policy
+func NewTransport() *Transport {
+	return &Transport{
+		Client:     &http.Client{},
+		MaxRetries: 2,
+		BaseDelay:  500 * time.Millisecond,
+		MaxDelay:   8 * time.Second,
+		sleep:      sleepContext,
+	}
+}
+
+// defaultTransport is shared by all providers
+var defaultTransport = NewTransport()
+
+// PostJSON marshals payload, posts it to url and returns the body of a
+// successful response. Failures are returned as *ProviderError.
+func (t *Transport) PostJSON(ctx context.Context, provider, url string, headers map[string]string, payload interface{}) ([]byte, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := t.do(ctx, provider, url, headers, jsonData)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, t.requestError(ctx, provider, err)
+	}
+	return body, nil
+}
+
+// PostStream marshals payload and posts it to url like PostJSON, but returns
+// the response body unread so it can be consumed as a stream. Retries only
+// happen before the response starts; the caller must close the body.
+func (t *Transport) PostStream(ctx context.Context, provider, url string, headers map[string]string, payload interface{}) (io.ReadCloser, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := t.do(ctx, provider, url, headers, jsonData)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// do sends the request until it succeeds, fails permanently or retries run
+// out. On success the caller owns the response body.
+func (t *Transport) do(ctx context.Context, provider, url string, headers map[string]string, payload []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		var providerErr *ProviderError
+		resp, err := t.Client.Do(req)
+		if err != nil {
+			providerErr = t.requestError(ctx, provider, err)
+		} else if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		} else {
+			providerErr = responseError(provider, resp)
+			resp.Body.Close()
+		}
+
+		if !providerErr.Temporary() || attempt >= t.MaxRetries {
+			return nil, providerErr
+		}
+
+		delay := t.backoff(attempt, providerErr.RetryAfter)
+		// Don't wait for a retry that can't happen before the deadline
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return nil, providerErr
+		}
+		if err := t.sleep(ctx, delay); err != nil {
+			return nil, t.requestError(ctx, provider, err)
+		}
+	}
+}
+
+// backoff returns the delay before the next attempt. A Retry-After from the
+// provider wins; otherwise the delay grows exponentially with equal jitter.
+func (t *Transport) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+
+	delay := t.BaseDelay << attempt
+	if delay > t.MaxDelay || delay <= 0 {
+		delay = t.MaxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// requestError classifies a failure to send a request or read its response
+func (t *Transport) requestError(ctx context.Context, provider string, err error) *ProviderError {
+	class := ErrorClassNetwork
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		class = ErrorClassTimeout
+		err = ctx.Err()
+	case ctx.Err() != nil:
+		class = ErrorClassUnknown
+		err = ctx.Err()
+	}
+	return &ProviderError{
+		Provider: provider,
+		Class:    class,
+		Err:      err,
+	}
+}
+
+// responseError classifies a non-2xx response
+func responseError(provider string, resp *http.Response) *ProviderError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	class := ErrorClassUnknown
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		class = ErrorClassAuth
+	case resp.StatusCode == http.StatusTooManyRequests:
+		class = ErrorClassRateLimit
+	case resp.StatusCode == http.StatusRequestTimeout:
+		class = ErrorClassNetwork
+	case resp.StatusCode >= 500:
+		// Includes Anthropic's non-standard 529 "overloaded"
+		class = ErrorClassOverloaded
+	case resp.StatusCode >= 400:
+		class = ErrorClassBadRequest
+	}
+
+	return &ProviderError{
+		Provider:   provider,
+		Class:      class,
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header),
+		Message:    errorMessage(body),
+	}
+}
+
+// errorMessage extracts the error message from a provider's error response.
+// OpenAI, Gemini and Claude use {"error": {"message": ...}}, Ollama uses
+// {"error": "..."}; anything else is returned as trimmed text.
+func errorMessage(body []byte) string {
+	var structured struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &structured); err == nil && len(structured.Error) > 0 {
+		var nested struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(structured.Error, &nested); err == nil && nested.Message != "" {
+			return nested.Message
+		}
+		var plain string
+		if err := json.Unmarshal(structured.Error, &plain); err == nil && plain != "" {
+			return plain
+		}
+	}
+
+	text := strings.TrimSpace(string(body))
+	if len(text) > 200 {
+		text = text[:200] + "..."
+	}
+	return text
+}
+
+// parseRetryAfter reads the delay requested by the provider from the
+// Retry-After header (seconds or HTTP date) or OpenAI's retry-after-ms
+func parseRetryAfter(header http.Header) time.Duration {
+	if ms := header.Get("retry-after-ms"); ms != "" {
+		if value, err := strconv.ParseFloat(ms, 64); err == nil && value > 0 {
+			return time.Duration(value * float64(time.Millisecond))
+		}
+	}
+
+	retryAfter := header.Get("Retry-After")
+	if retryAfter == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(retryAfter, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// sleepContext waits for d or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
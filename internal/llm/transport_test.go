@@ -0,0 +1,235 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestTransport returns a transport that records backoff delays instead of sleeping
+func newTestTransport(delays *[]time.Duration) *Transport {
+	transport := NewTransport()
+	transport.sleep = func(ctx context.Context, d time.Duration) error {
+		*delays = append(*delays, d)
+		return nil
+	}
+	return transport
+}
+
+func TestTransportRetriesTransientFailures(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error": {"message": "try again"}}`))
+			return
+		}
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+	transport := newTestTransport(&delays)
+
+	body, err := transport.PostJSON(context.Background(), "Test", server.URL, nil, map[string]string{"hello": "world"})
+	if err != nil {
+		t.Fatalf("Expected success after retries, got: %v", err)
+	}
+	if string(body) != `{"ok": true}` {
+		t.Errorf("Unexpected body: %s", body)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+	if len(delays) != 2 {
+		t.Fatalf("Expected 2 backoff delays, got %d", len(delays))
+	}
+	for i, delay := range delays {
+		maxDelay := transport.BaseDelay << i
+		if delay < maxDelay/2 || delay > maxDelay {
+			t.Errorf("Backoff %d = %v, expected between %v and %v", i, delay, maxDelay/2, maxDelay)
+		}
+	}
+}
+
+func TestTransportHonorsRetryAfter(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+	transport := newTestTransport(&delays)
+
+	if _, err := transport.PostJSON(context.Background(), "Test", server.URL, nil, struct{}{}); err != nil {
+		t.Fatalf("Expected success after retry, got: %v", err)
+	}
+	if len(delays) != 1 || delays[0] != 3*time.Second {
+		t.Errorf("Expected a single 3s delay from Retry-After, got %v", delays)
+	}
+}
+
+func TestTransportSkipsRetryPastDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+	transport := newTestTransport(&delays)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := transport.PostJSON(ctx, "Test", server.URL, nil, struct{}{})
+	if ErrorClassOf(err) != ErrorClassRateLimit {
+		t.Fatalf("Expected rate limit error, got: %v", err)
+	}
+	if len(delays) != 0 {
+		t.Errorf("Expected no wait when Retry-After exceeds the deadline, got %v", delays)
+	}
+}
+
+func TestTransportClassifiesErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		class     ErrorClass
+		message   string
+		retryable bool
+	}{
+		{"auth", http.StatusUnauthorized, `{"error": {"message": "Invalid API key"}}`, ErrorClassAuth, "Invalid API key", false},
+		{"forbidden", http.StatusForbidden, `{"error": {"code": 403, "message": "API key not valid"}}`, ErrorClassAuth, "API key not valid", false},
+		{"rate limit", http.StatusTooManyRequests, `{"error": {"message": "slow down"}}`, ErrorClassRateLimit, "slow down", true},
+		{"overloaded", 529, `{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`, ErrorClassOverloaded, "Overloaded", true},
+		{"bad request", http.StatusBadRequest, `{"error": {"message": "context length exceeded"}}`, ErrorClassBadRequest, "context length exceeded", false},
+		{"ollama", http.StatusNotFound, `{"error": "model \"llama9\" not found"}`, ErrorClassBadRequest, `model "llama9" not found`, false},
+		{"plain text", http.StatusBadGateway, "upstream unavailable", ErrorClassOverloaded, "upstream unavailable", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&attempts, 1)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			var delays []time.Duration
+			transport := newTestTransport(&delays)
+
+			_, err := transport.PostJSON(context.Background(), "Test", server.URL, nil, struct{}{})
+
+			var providerErr *ProviderError
+			if !errors.As(err, &providerErr) {
+				t.Fatalf("Expected *ProviderError, got %T: %v", err, err)
+			}
+			if providerErr.Class != tt.class {
+				t.Errorf("Expected class %v, got %v", tt.class, providerErr.Class)
+			}
+			if providerErr.StatusCode != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, providerErr.StatusCode)
+			}
+			if providerErr.Message != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, providerErr.Message)
+			}
+
+			expectedAttempts := int32(1)
+			if tt.retryable {
+				expectedAttempts = int32(transport.MaxRetries + 1)
+			}
+			if attempts != expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", expectedAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestTransportNetworkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	var delays []time.Duration
+	transport := newTestTransport(&delays)
+
+	_, err := transport.PostJSON(context.Background(), "Test", url, nil, struct{}{})
+	if ErrorClassOf(err) != ErrorClassNetwork {
+		t.Fatalf("Expected network error, got: %v", err)
+	}
+	if len(delays) != transport.MaxRetries {
+		t.Errorf("Expected %d retries, got %d", transport.MaxRetries, len(delays))
+	}
+}
+
+func TestOpenAICompatibleProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Unexpected Authorization header: %q", got)
+		}
+		if got := r.Header.Get("X-Team"); got != "platform" {
+			t.Errorf("Unexpected X-Team header: %q", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"model":"local-model"`) {
+			t.Errorf("Expected configured model in request, got: %s", body)
+		}
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "feat: add thing"}}]}`))
+	}))
+	defer server.Close()
+
+	settings := ModelSettings{
+		Commit: GenerationOptions{Model: "local-model"},
+		PR:     GenerationOptions{Model: "local-model"},
+	}
+	provider := NewOpenAICompatibleProvider("gateway", server.URL+"/v1/", "secret", map[string]string{"X-Team": "platform"}, settings)
+
+	message, err := provider.Chat(context.Background(), TaskCommit, userMessage("prompt"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if message != "feat: add thing" {
+		t.Errorf("Unexpected message: %q", message)
+	}
+}
+
+func TestOpenAIProviderRequestsSeveralChoices(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"n":3`) {
+			t.Errorf("Expected n in request, got: %s", body)
+		}
+		w.Write([]byte(`{"choices": [{"message": {"content": "feat: one"}}, {"message": {"content": "feat: two"}}, {"message": {"content": "feat: three"}}]}`))
+	}))
+	defer server.Close()
+
+	settings := ModelSettings{Commit: GenerationOptions{Model: "local-model"}}
+	provider := NewOpenAICompatibleProvider("gateway", server.URL, "", nil, settings)
+
+	replies, err := provider.ChatCandidates(context.Background(), TaskCommit, userMessage("prompt"), 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(replies) != 3 || replies[2] != "feat: three" {
+		t.Errorf("Unexpected replies: %q", replies)
+	}
+}
@@ -0,0 +1,91 @@
+// Package restapi sends the JSON requests the forge clients (GitHub, GitLab,
+// Bitbucket, Gitea) are built on. Each client adds its own headers and turns
+// its service's error responses into errors.
+package restapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// requestTimeout bounds each API call
+const requestTimeout = 30 * time.Second
+
+// ErrorParser turns an error response into an error
+type ErrorParser func(statusCode int, body []byte) error
+
+// Client sends JSON requests to one API
+type Client struct {
+	// Service names the API in errors, e.g. "GitHub"
+	Service string
+	baseURL string
+	header  http.Header
+	// parseError reads error responses
+	parseError ErrorParser
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the API at baseURL that sends header with
+// every request and reads error responses with parseError
+func NewClient(service, baseURL string, header http.Header, parseError ErrorParser) *Client {
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("User-Agent", "institutionalized")
+	return &Client{
+		Service:    service,
+		baseURL:    strings.TrimSuffix(baseURL, "/") + "/",
+		header:     header,
+		parseError: parseError,
+		httpClient: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Do sends a request to path, relative to the base URL, with in encoded as
+// JSON if it isn't nil, and decodes the JSON reply into out if it isn't nil
+func (c *Client) Do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header = c.header.Clone()
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", c.Service, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return c.parseError(resp.StatusCode, respBody)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+// Package scope infers the Conventional Commits scope of a change from the
+// paths it touches.
+package scope
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/ignore"
+)
+
+// Rule maps paths matching a gitignore-style pattern to a scope
+type Rule struct {
+	Path  string `yaml:"path"`
+	Scope string `yaml:"scope"`
+}
+
+// containerDirs hold one directory per component, so the directory below
+// them names the scope rather than the container itself
+var containerDirs = map[string]bool{
+	"apps":     true,
+	"cmd":      true,
+	"internal": true,
+	"libs":     true,
+	"modules":  true,
+	"packages": true,
+	"pkg":      true,
+	"services": true,
+	"src":      true,
+}
+
+// Resolver maps paths to scopes. Configured rules are tried first, then the
+// closest go.mod or package.json below the repository root, then the
+// top-level directory.
+type Resolver struct {
+	root  string
+	rules []compiledRule
+	// workspaces caches the scope of each directory's workspace; "" if the
+	// directory isn't part of a nested module or package
+	workspaces map[string]string
+}
+
+type compiledRule struct {
+	matcher *ignore.Matcher
+	scope   string
+}
+
+// NewResolver creates a resolver for the repository at root
+func NewResolver(root string, rules []Rule) (*Resolver, error) {
+	r := &Resolver{root: root, workspaces: map[string]string{"": "", ".": ""}}
+	for _, rule := range rules {
+		if rule.Scope == "" {
+			return nil, fmt.Errorf("scope rule for %q has no scope", rule.Path)
+		}
+		matcher, err := ignore.NewMatcher([]string{rule.Path})
+		if err != nil {
+			return nil, fmt.Errorf("invalid scope rule path %q: %w", rule.Path, err)
+		}
+		r.rules = append(r.rules, compiledRule{matcher: matcher, scope: rule.Scope})
+	}
+	return r, nil
+}
+
+// Scope returns the scope of a path relative to the repository root, or ""
+// for files at the top level that belong to no scope
+func (r *Resolver) Scope(file string) string {
+	file = filepath.ToSlash(file)
+	for _, rule := range r.rules {
+		if rule.matcher.Match(file) {
+			return rule.scope
+		}
+	}
+	if workspace := r.workspace(path.Dir(file)); workspace != "" {
+		return workspace
+	}
+	return directoryScope(file)
+}
+
+// workspace returns the scope of the nested module or package containing dir
+func (r *Resolver) workspace(dir string) string {
+	if scope, ok := r.workspaces[dir]; ok {
+		return scope
+	}
+
+	scope := ""
+	if _, err := os.Stat(filepath.Join(r.root, dir, "go.mod")); err == nil {
+		scope = path.Base(dir)
+	} else if data, err := os.ReadFile(filepath.Join(r.root, dir, "package.json")); err == nil {
+		scope = packageName(data, dir)
+	} else {
+		scope = r.workspace(path.Dir(dir))
+	}
+	r.workspaces[dir] = scope
+	return scope
+}
+
+// packageName returns the name of a package.json without its npm scope,
+// falling back to the directory name
+func packageName(data []byte, dir string) string {
+	var pkg struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(data, &pkg) != nil || pkg.Name == "" {
+		return path.Base(dir)
+	}
+	if _, name, ok := strings.Cut(pkg.Name, "/"); ok && strings.HasPrefix(pkg.Name, "@") {
+		return name
+	}
+	return pkg.Name
+}
+
+// directoryScope returns the top-level directory of a path, or the one below
+// it for container directories such as internal/ or packages/
+func directoryScope(file string) string {
+	parts := strings.Split(file, "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	if containerDirs[parts[0]] && len(parts) > 2 {
+		return parts[1]
+	}
+	return parts[0]
+}
+
+// Count is the number of changed files in a scope
+type Count struct {
+	Scope string
+	Files int
+}
+
+// Summary is the scopes touched by a change
+type Summary struct {
+	// Scopes are ordered by the number of files, most first
+	Scopes []Count
+	// Unscoped counts files that belong to no scope, such as top-level files
+	Unscoped int
+}
+
+// Resolve sorts the changed files into scopes. Scopes not in allowed are
+// counted as unscoped, unless allowed is empty.
+func (r *Resolver) Resolve(files []string, allowed []string) Summary {
+	counts := map[string]int{}
+	var summary Summary
+	for _, file := range files {
+		scope := r.Scope(file)
+		if scope == "" || (len(allowed) > 0 && !contains(allowed, scope)) {
+			summary.Unscoped++
+			continue
+		}
+		counts[scope]++
+	}
+
+	for scope, files := range counts {
+		summary.Scopes = append(summary.Scopes, Count{Scope: scope, Files: files})
+	}
+	sort.Slice(summary.Scopes, func(i, j int) bool {
+		a, b := summary.Scopes[i], summary.Scopes[j]
+		if a.Files != b.Files {
+			return a.Files > b.Files
+		}
+		return a.Scope < b.Scope
+	})
+	return summary
+}
+
+// Names returns the scope names, most files first
+func (s Summary) Names() []string {
+	names := make([]string, len(s.Scopes))
+	for i, count := range s.Scopes {
+		names[i] = count.Scope
+	}
+	return names
+}
+
+// Suggest returns the scope to use for the change: the only scope touched,
+// or up to maxCombined scopes joined with commas. split reports that the
+// change touches more scopes than that and should rather be split up.
+// Files without a scope don't count.
+func (s Summary) Suggest(maxCombined int) (scope string, split bool) {
+	switch {
+	case len(s.Scopes) == 0:
+		return "", false
+	case len(s.Scopes) > maxCombined:
+		return "", true
+	}
+	names := s.Names()
+	sort.Strings(names)
+	return strings.Join(names, ","), false
+}
+
+// contains reports whether list holds value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
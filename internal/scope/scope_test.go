@@ -0,0 +1,82 @@
+package scope
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, root, name, content string) {
+	t.Helper()
+	path := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScope(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "go.mod", "module example.com/mono\n")
+	writeFile(t, root, "package.json", `{"name": "mono", "workspaces": ["packages/*"]}`)
+	writeFile(t, root, "services/billing/go.mod", "module example.com/mono/services/billing\n")
+	writeFile(t, root, "packages/ui/package.json", `{"name": "@acme/design-system"}`)
+
+	resolver, err := NewResolver(root, []Rule{{Path: "docs/api/", Scope: "api"}, {Path: "*.proto", Scope: "proto"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := map[string]string{
+		"docs/api/index.md":                 "api",
+		"services/billing/proto/bill.proto": "proto",
+		"services/billing/internal/x.go":    "billing",
+		"packages/ui/src/Button.tsx":        "design-system",
+		"internal/llm/manager.go":           "llm",
+		"cmd/commit.go":                     "cmd",
+		"docs/setup.md":                     "docs",
+		"README.md":                         "",
+		"go.mod":                            "",
+	}
+	for file, want := range tests {
+		if got := resolver.Scope(file); got != want {
+			t.Errorf("Scope(%q) = %q, expected %q", file, got, want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	resolver, err := NewResolver(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	summary := resolver.Resolve([]string{"web/a.ts", "web/b.ts", "api/c.go", "go.sum"}, nil)
+	if summary.Unscoped != 1 || len(summary.Scopes) != 2 || summary.Scopes[0] != (Count{Scope: "web", Files: 2}) {
+		t.Fatalf("Unexpected summary: %+v", summary)
+	}
+	if scope, split := summary.Suggest(2); scope != "api,web" || split {
+		t.Errorf("Expected a combined scope, got %q (split %t)", scope, split)
+	}
+	if scope, split := summary.Suggest(1); scope != "" || !split {
+		t.Errorf("Expected a split warning, got %q (split %t)", scope, split)
+	}
+
+	// Scopes that aren't allowed don't count
+	summary = resolver.Resolve([]string{"web/a.ts", "api/c.go"}, []string{"api"})
+	if scope, split := summary.Suggest(1); scope != "api" || split || summary.Unscoped != 1 {
+		t.Errorf("Expected only the allowed scope, got %q (split %t, %+v)", scope, split, summary)
+	}
+
+	if scope, split := resolver.Resolve([]string{"README.md"}, nil).Suggest(2); scope != "" || split {
+		t.Errorf("Expected no scope for top-level files, got %q (split %t)", scope, split)
+	}
+}
+
+func TestInvalidRule(t *testing.T) {
+	if _, err := NewResolver(t.TempDir(), []Rule{{Path: "web/"}}); err == nil {
+		t.Error("Expected a rule without a scope to be rejected")
+	}
+}
@@ -0,0 +1,395 @@
+// Package secrets finds credentials, private keys and other likely secrets in
+// diffs before they are sent to a provider, and redacts them.
+package secrets
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/budget"
+	"github.com/IanKnighton/institutionalized/internal/gitdiff"
+)
+
+// Finding is a possible secret found in scanned text
+type Finding struct {
+	// Rule is the ID of the rule that matched
+	Rule string
+	// Path is the file the secret was found in, or a description of the text
+	Path string
+	// Line is the line number in the new version of the file, or in the text
+	Line int
+	// Match is the secret itself; it is empty for findings about a whole file
+	Match string
+}
+
+// String describes the finding without revealing the secret
+func (f Finding) String() string {
+	location := f.Path
+	if f.Line > 0 {
+		location = fmt.Sprintf("%s:%d", f.Path, f.Line)
+	}
+	if f.Match == "" {
+		return fmt.Sprintf("%s: %s", location, f.Rule)
+	}
+	return fmt.Sprintf("%s: %s (%s)", location, f.Rule, Mask(f.Match))
+}
+
+// Mask shows just enough of a secret to recognize it
+func Mask(secret string) string {
+	if len(secret) <= 8 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:4] + strings.Repeat("*", min(len(secret)-4, 12))
+}
+
+// rule detects one kind of secret. The secret is the first submatch if the
+// pattern has one, otherwise the whole match.
+type rule struct {
+	id      string
+	pattern *regexp.Regexp
+	// minEntropy filters out low-entropy matches such as placeholders
+	minEntropy float64
+	// needsDigit filters out identifiers, which generic rules match otherwise
+	needsDigit bool
+}
+
+// rules are checked in order; the first rule matching a span wins
+var rules = []rule{
+	{id: "private-key", pattern: regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`)},
+	{id: "aws-access-key-id", pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`)},
+	{id: "aws-secret-access-key", pattern: regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`)},
+	{id: "github-token", pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{id: "gitlab-token", pattern: regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`)},
+	{id: "slack-token", pattern: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{id: "slack-webhook", pattern: regexp.MustCompile(`https://hooks\.slack\.com/services/[A-Za-z0-9_/]+`)},
+	{id: "stripe-key", pattern: regexp.MustCompile(`\b[rs]k_(?:live|test)_[A-Za-z0-9]{20,}`)},
+	{id: "google-api-key", pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{id: "anthropic-api-key", pattern: regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+	{id: "openai-api-key", pattern: regexp.MustCompile(`\bsk-(?:proj-|svcacct-)?[A-Za-z0-9_-]{20,}`), minEntropy: 3.5},
+	{id: "jwt", pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{id: "url-password", pattern: regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s:/@]+:([^\s:/@]{3,})@`)},
+	{id: "secret-assignment", pattern: regexp.MustCompile(`(?i)(?:api[_-]?key|secret|token|passw(?:or)?d|pwd|credentials?|auth)[a-z0-9_]*["']?\s*[:=]\s*["']?([^\s"',;]{8,})`), minEntropy: 3.0, needsDigit: true},
+}
+
+// highEntropyRule flags long random-looking strings no other rule matched
+const highEntropyRule = "high-entropy-string"
+
+var (
+	entropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/_=-]{24,}`)
+	hexOnly          = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	urlPattern       = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://\S+`)
+	// placeholder values that secret-assignment should never report
+	placeholder = regexp.MustCompile(`(?i)^(?:\$\{?|<|%|\{\{)|(?:example|changeme|placeholder|your[_-]|xxxx|\*\*\*\*|redacted|os\.getenv|process\.env|env\()`)
+)
+
+// minHighEntropy is the Shannon entropy in bits per character above which a
+// long string is treated as random. Random base64 is close to 6, English
+// identifiers and paths stay well below 4.5.
+const minHighEntropy = 4.5
+
+// checksumFiles contain hashes by design, so they are not checked for
+// high-entropy strings: the known lockfiles, anything named like one, and
+// minified or encoded assets
+var checksumFiles = append([]string{"*.lock", "*-lock.json", "*-lock.yaml", "*.lockb", "*.svg", "*.min.js", "*.min.css", "*.map"}, budget.Lockfiles...)
+
+// sensitiveFiles are files that shouldn't be shared at all
+var sensitiveFiles = []string{".env", ".env.*", "*.pem", "*.key", "*.p12", "*.pfx", "id_rsa", "id_dsa", "id_ecdsa", "id_ed25519", ".netrc", ".pgpass", "credentials.json", "*.keystore", "*.jks"}
+
+// Scanner finds possible secrets in text and diffs
+type Scanner struct {
+	allowlist *Allowlist
+}
+
+// NewScanner creates a scanner that ignores findings matched by the
+// allowlist, which may be nil
+func NewScanner(allowlist *Allowlist) *Scanner {
+	if allowlist == nil {
+		allowlist = &Allowlist{}
+	}
+	return &Scanner{allowlist: allowlist}
+}
+
+// Scan checks every line of text. The name is used as the finding path.
+func (s *Scanner) Scan(name, text string) []Finding {
+	var findings []Finding
+	inPrivateKey := false
+	for i, line := range strings.Split(text, "\n") {
+		findings = append(findings, s.scanLine(name, i+1, line, &inPrivateKey)...)
+	}
+	return findings
+}
+
+// ScanDiff checks the lines a unified git diff adds. Removed and context lines
+// are already in the repository and aren't checked.
+func (s *Scanner) ScanDiff(diff string) []Finding {
+	var findings []Finding
+	var file string
+	line := 0
+	inPrivateKey := false
+
+	for _, text := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(text, "diff --git "):
+			file = ""
+			inPrivateKey = false
+		case strings.HasPrefix(text, "+++ "):
+			file = strings.TrimPrefix(strings.TrimPrefix(text, "+++ "), "b/")
+			if file != "/dev/null" && matchesAny(sensitiveFiles, file) && !s.allowlist.allows(file, "sensitive-file", "") {
+				findings = append(findings, Finding{Rule: "sensitive-file", Path: file})
+			}
+		case strings.HasPrefix(text, "@@"):
+			line = hunkStart(text)
+		case strings.HasPrefix(text, "+"):
+			findings = append(findings, s.scanLine(file, line, text[1:], &inPrivateKey)...)
+			line++
+		case strings.HasPrefix(text, " "):
+			line++
+		}
+	}
+	return findings
+}
+
+// scanLine checks a single line. Lines between the header and footer of a
+// private key are reported as part of the key.
+func (s *Scanner) scanLine(file string, lineNumber int, line string, inPrivateKey *bool) []Finding {
+	var findings []Finding
+	report := func(ruleID, match string) {
+		if !s.allowlist.allows(file, ruleID, match) {
+			findings = append(findings, Finding{Rule: ruleID, Path: file, Line: lineNumber, Match: match})
+		}
+	}
+
+	if *inPrivateKey {
+		if strings.Contains(line, "-----END ") {
+			*inPrivateKey = false
+		} else if body := strings.TrimSpace(line); body != "" {
+			report("private-key", body)
+		}
+		return findings
+	}
+
+	// Spans already reported, so later rules don't report them again
+	var covered [][]int
+	overlaps := func(start, end int) bool {
+		for _, span := range covered {
+			if start < span[1] && end > span[0] {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, r := range rules {
+		for _, loc := range r.pattern.FindAllStringSubmatchIndex(line, -1) {
+			start, end := loc[0], loc[1]
+			if len(loc) >= 4 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			if overlaps(loc[0], loc[1]) {
+				continue
+			}
+			match := line[start:end]
+			if r.minEntropy > 0 && (entropy(match) < r.minEntropy || placeholder.MatchString(match)) {
+				continue
+			}
+			if r.needsDigit && !strings.ContainsAny(match, "0123456789") {
+				continue
+			}
+			covered = append(covered, []int{loc[0], loc[1]})
+			report(r.id, match)
+			if r.id == "private-key" {
+				*inPrivateKey = true
+			}
+		}
+	}
+
+	if matchesAny(checksumFiles, file) {
+		return findings
+	}
+	// URL paths look random but credentials in URLs are found by url-password
+	covered = append(covered, urlPattern.FindAllStringIndex(line, -1)...)
+	for _, loc := range entropyCandidate.FindAllStringIndex(line, -1) {
+		match := line[loc[0]:loc[1]]
+		if overlaps(loc[0], loc[1]) || hexOnly.MatchString(match) || entropy(match) < minHighEntropy {
+			continue
+		}
+		report(highEntropyRule, match)
+	}
+	return findings
+}
+
+// Redact replaces every secret found with a placeholder naming its rule
+func Redact(text string, findings []Finding) string {
+	var pairs []string
+	seen := make(map[string]bool)
+	for _, finding := range findings {
+		if finding.Match == "" || seen[finding.Match] {
+			continue
+		}
+		seen[finding.Match] = true
+		pairs = append(pairs, finding.Match, fmt.Sprintf("[REDACTED:%s]", finding.Rule))
+	}
+	if len(pairs) == 0 {
+		return text
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// RedactDiff redacts the secrets found in a diff like Redact, and replaces
+// the changes of files that were reported as a whole, such as .env files
+func RedactDiff(diff string, findings []Finding) string {
+	sensitive := make(map[string]bool)
+	for _, finding := range findings {
+		if finding.Match == "" {
+			sensitive[finding.Path] = true
+		}
+	}
+
+	var b strings.Builder
+	for _, file := range gitdiff.Parse(diff) {
+		if !sensitive[file.Path] {
+			b.WriteString(file.String())
+			continue
+		}
+		b.WriteString(file.Header)
+		fmt.Fprintf(&b, "[REDACTED:sensitive-file +%d -%d lines]\n", file.Added, file.Deleted)
+	}
+	return Redact(b.String(), findings)
+}
+
+// entropy returns the Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	total := float64(len([]rune(s)))
+	var bits float64
+	for _, count := range counts {
+		p := float64(count) / total
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
+
+// hunkStart returns the first line number of the new file in a hunk header
+// like "@@ -1,3 +4,5 @@"
+func hunkStart(header string) int {
+	fields := strings.Fields(header)
+	if len(fields) < 3 {
+		return 0
+	}
+	start, _, _ := strings.Cut(strings.TrimPrefix(fields[2], "+"), ",")
+	n, _ := strconv.Atoi(start)
+	return n
+}
+
+// matchesAny reports whether the path or its base name matches one of the globs
+func matchesAny(globs []string, filePath string) bool {
+	for _, glob := range globs {
+		if matchPath(glob, filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath matches a glob against a path. Globs without a slash match the
+// base name; a trailing "/**" matches everything below a directory.
+func matchPath(glob, filePath string) bool {
+	if dir, ok := strings.CutSuffix(glob, "/**"); ok {
+		return filePath == dir || strings.HasPrefix(filePath, dir+"/")
+	}
+	if !strings.Contains(glob, "/") {
+		matched, _ := path.Match(glob, path.Base(filePath))
+		return matched
+	}
+	matched, _ := path.Match(strings.TrimPrefix(glob, "/"), filePath)
+	return matched
+}
+
+// AllowlistFile is the name of the repository file listing known false positives
+const AllowlistFile = ".institutionalized-allowlist"
+
+// Allowlist suppresses findings that are known false positives
+type Allowlist struct {
+	paths    []string
+	rules    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// ParseAllowlist reads allowlist entries, one per line:
+//
+//	path:<glob>   ignore findings in matching files
+//	rule:<id>     turn off a rule entirely
+//	<regexp>      ignore secrets matching the regular expression
+//
+// Blank lines and lines starting with # are ignored.
+func ParseAllowlist(content string) (*Allowlist, error) {
+	allowlist := &Allowlist{rules: make(map[string]bool)}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		entry := strings.TrimSpace(scanner.Text())
+		switch {
+		case entry == "" || strings.HasPrefix(entry, "#"):
+		case strings.HasPrefix(entry, "path:"):
+			allowlist.paths = append(allowlist.paths, strings.TrimSpace(strings.TrimPrefix(entry, "path:")))
+		case strings.HasPrefix(entry, "rule:"):
+			allowlist.rules[strings.TrimSpace(strings.TrimPrefix(entry, "rule:"))] = true
+		default:
+			pattern, err := regexp.Compile(entry)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid regular expression: %w", lineNumber, err)
+			}
+			allowlist.patterns = append(allowlist.patterns, pattern)
+		}
+	}
+	return allowlist, scanner.Err()
+}
+
+// LoadAllowlist reads the allowlist file in the given directory. A missing
+// file gives an empty allowlist.
+func LoadAllowlist(dir string) (*Allowlist, error) {
+	content, err := os.ReadFile(filepath.Join(dir, AllowlistFile))
+	if os.IsNotExist(err) {
+		return &Allowlist{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	allowlist, err := ParseAllowlist(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", AllowlistFile, err)
+	}
+	return allowlist, nil
+}
+
+// allows reports whether a finding is suppressed
+func (a *Allowlist) allows(file, ruleID, match string) bool {
+	if a.rules[ruleID] {
+		return true
+	}
+	if file != "" && matchesAny(a.paths, file) {
+		return true
+	}
+	if match != "" {
+		for _, pattern := range a.patterns {
+			if pattern.MatchString(match) {
+				return true
+			}
+		}
+	}
+	return false
+}
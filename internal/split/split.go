@@ -0,0 +1,362 @@
+// Package split divides a staged diff into numbered hunks, reads plans that
+// group those hunks into separate commits, and builds the patch for each
+// group.
+package split
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/gitdiff"
+)
+
+// Hunk is a part of the diff that can be committed on its own: one hunk of a
+// modified file, or a whole file for additions, deletions, renames, mode
+// changes and binary files
+type Hunk struct {
+	// ID numbers hunks from 1 in diff order
+	ID   int
+	Path string
+	// file is the index of the hunk's file in Diff.Files
+	file int
+	// index is the hunk's index in the file, or -1 for the whole file
+	index   int
+	Added   int
+	Deleted int
+}
+
+// String describes the hunk, e.g. "3: main.go (+2 -1)"
+func (h Hunk) String() string {
+	return fmt.Sprintf("%d: %s (+%d -%d)", h.ID, h.Path, h.Added, h.Deleted)
+}
+
+// Diff is a staged diff cut into hunks
+type Diff struct {
+	Files []gitdiff.File
+	Hunks []Hunk
+}
+
+// New cuts the output of git diff into hunks. The diff must be complete
+// (including binary patches) for the patches built from it to apply.
+func New(diff string) *Diff {
+	d := &Diff{Files: gitdiff.Parse(diff)}
+	for i, file := range d.Files {
+		if !splittable(file) {
+			d.Hunks = append(d.Hunks, Hunk{ID: len(d.Hunks) + 1, Path: file.Path, file: i, index: -1, Added: file.Added, Deleted: file.Deleted})
+			continue
+		}
+		for j, text := range file.Hunks {
+			added, deleted := countLines(text)
+			d.Hunks = append(d.Hunks, Hunk{ID: len(d.Hunks) + 1, Path: file.Path, file: i, index: j, Added: added, Deleted: deleted})
+		}
+	}
+	return d
+}
+
+// splittable reports whether the file's hunks can be committed separately.
+// Changes to the file itself, such as creating or renaming it, have to be
+// committed in one go.
+func splittable(file gitdiff.File) bool {
+	if file.Binary || len(file.Hunks) < 2 || file.Path != file.OldPath {
+		return false
+	}
+	for _, line := range strings.Split(file.Header, "\n") {
+		for _, prefix := range []string{"new file mode", "deleted file mode", "old mode", "copy from"} {
+			if strings.HasPrefix(line, prefix) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// countLines counts the lines a hunk adds and removes
+func countLines(hunk string) (added, deleted int) {
+	for _, line := range strings.Split(hunk, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			deleted++
+		}
+	}
+	return added, deleted
+}
+
+// Listing lists every hunk with its path and line counts, one per line
+func (d *Diff) Listing() string {
+	var b strings.Builder
+	for _, hunk := range d.Hunks {
+		b.WriteString(hunk.String() + "\n")
+	}
+	return b.String()
+}
+
+// Annotated returns the diff of the files include accepts, with each hunk
+// header marked with its hunk number, e.g. "@@ -1,3 +1,4 @@ [hunk 2]". Files
+// committed as a whole carry the same number on every hunk header. Binary
+// files are only named; their patches stay out of prompts, and in Patch.
+func (d *Diff) Annotated(include func(path string) bool) string {
+	var b strings.Builder
+	for _, hunk := range d.Hunks {
+		file := d.Files[hunk.file]
+		if include != nil && !include(file.Path) {
+			continue
+		}
+		if file.Binary {
+			fmt.Fprintf(&b, "binary file changed: %s [hunk %d]\n", file.Path, hunk.ID)
+			continue
+		}
+		if hunk.index <= 0 {
+			b.WriteString(file.Header)
+		}
+		texts := file.Hunks
+		if hunk.index >= 0 {
+			texts = texts[hunk.index : hunk.index+1]
+		}
+		for _, text := range texts {
+			header, rest, _ := strings.Cut(text, "\n")
+			fmt.Fprintf(&b, "%s [hunk %d]\n%s", header, hunk.ID, rest)
+		}
+	}
+	return b.String()
+}
+
+// Patch returns a patch with the given hunks, in diff order, that git apply
+// accepts. Hunks of the same file share its header.
+func (d *Diff) Patch(ids []int) string {
+	selected := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	var b strings.Builder
+	lastFile := -1
+	for _, hunk := range d.Hunks {
+		if !selected[hunk.ID] {
+			continue
+		}
+		file := d.Files[hunk.file]
+		if hunk.index < 0 {
+			b.WriteString(file.String())
+			continue
+		}
+		if hunk.file != lastFile {
+			b.WriteString(file.Header)
+			lastFile = hunk.file
+		}
+		b.WriteString(file.Hunks[hunk.index])
+	}
+	return b.String()
+}
+
+// Paths returns the paths of the given hunks in diff order, each listed once
+// with the numbers of its hunks
+func (d *Diff) Paths(ids []int) []string {
+	selected := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	var paths []string
+	numbers := make(map[string][]string)
+	for _, hunk := range d.Hunks {
+		if !selected[hunk.ID] {
+			continue
+		}
+		if _, seen := numbers[hunk.Path]; !seen {
+			paths = append(paths, hunk.Path)
+		}
+		numbers[hunk.Path] = append(numbers[hunk.Path], strconv.Itoa(hunk.ID))
+	}
+	for i, path := range paths {
+		label := "hunk"
+		if len(numbers[path]) > 1 {
+			label = "hunks"
+		}
+		paths[i] = fmt.Sprintf("%s (%s %s)", path, label, strings.Join(numbers[path], ", "))
+	}
+	return paths
+}
+
+// Group is one commit of a plan: the hunks it contains and its message
+type Group struct {
+	Hunks   []int
+	Message string
+}
+
+// Plan is the sequence of commits a staged change is split into
+type Plan []Group
+
+// Markers of the plan format read by ParsePlan
+const (
+	commitMarker  = "COMMIT"
+	hunksMarker   = "HUNKS:"
+	messageMarker = "MESSAGE:"
+)
+
+// commitLine matches the line that starts a commit, e.g. "COMMIT 2:"
+var commitLine = regexp.MustCompile(`^\W*` + commitMarker + `\b`)
+
+// ParsePlan reads a plan written in the format:
+//
+//	COMMIT 1
+//	HUNKS: 1, 2, 4-6
+//	MESSAGE:
+//	feat(api): add export endpoint
+//
+//	Optional body.
+//
+// Text before the first COMMIT line, such as an introduction from the
+// model, is ignored.
+func ParsePlan(text string) (Plan, error) {
+	var plan Plan
+	var current *Group
+	var message []string
+	inMessage := false
+
+	finish := func() {
+		if current != nil {
+			current.Message = strings.TrimSpace(strings.Join(message, "\n"))
+			plan = append(plan, *current)
+		}
+		current, message, inMessage = nil, nil, false
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case commitLine.MatchString(trimmed):
+			finish()
+			current = &Group{}
+		case current == nil:
+			continue
+		case !inMessage && strings.HasPrefix(strings.ToUpper(trimmed), hunksMarker):
+			hunks, err := parseHunkList(trimmed[len(hunksMarker):])
+			if err != nil {
+				return nil, fmt.Errorf("commit %d: %w", len(plan)+1, err)
+			}
+			current.Hunks = append(current.Hunks, hunks...)
+		case !inMessage && strings.HasPrefix(strings.ToUpper(trimmed), messageMarker):
+			inMessage = true
+			if rest := strings.TrimSpace(trimmed[len(messageMarker):]); rest != "" {
+				message = append(message, rest)
+			}
+		case inMessage:
+			// Models like to fence the message; the fences aren't part of it
+			if !strings.HasPrefix(trimmed, "```") {
+				message = append(message, strings.TrimRight(line, " \t"))
+			}
+		}
+	}
+	finish()
+
+	if len(plan) == 0 {
+		return nil, fmt.Errorf("no commits found in the plan")
+	}
+	return plan, nil
+}
+
+// parseHunkList reads a comma-separated list of hunk numbers and ranges
+func parseHunkList(list string) ([]int, error) {
+	var hunks []int
+	for _, item := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' }) {
+		item = strings.Trim(item, "[]#")
+		if item == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(item, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hunk number %q", item)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil || end < start {
+				return nil, fmt.Errorf("invalid hunk range %q", item)
+			}
+		}
+		for id := start; id <= end; id++ {
+			hunks = append(hunks, id)
+		}
+	}
+	return hunks, nil
+}
+
+// String writes the plan in the format ParsePlan reads
+func (p Plan) String() string {
+	var b strings.Builder
+	for i, group := range p {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s %d\n%s %s\n%s\n%s\n", commitMarker, i+1, hunksMarker, formatHunkList(group.Hunks), messageMarker, group.Message)
+	}
+	return b.String()
+}
+
+// formatHunkList writes hunk numbers as a sorted list, joining consecutive
+// numbers into ranges
+func formatHunkList(hunks []int) string {
+	sorted := append([]int(nil), hunks...)
+	sort.Ints(sorted)
+
+	var items []string
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+		if j > i {
+			items = append(items, fmt.Sprintf("%d-%d", sorted[i], sorted[j]))
+		} else {
+			items = append(items, strconv.Itoa(sorted[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(items, ", ")
+}
+
+// Check returns the problems that keep a plan from covering the diff: unknown
+// or repeated hunks, hunks no commit contains and commits without a message
+func (d *Diff) Check(plan Plan) []string {
+	var problems []string
+	owner := make(map[int]int)
+	for i, group := range plan {
+		if len(group.Hunks) == 0 {
+			problems = append(problems, fmt.Sprintf("commit %d contains no hunks", i+1))
+		}
+		if group.Message == "" {
+			problems = append(problems, fmt.Sprintf("commit %d has no message", i+1))
+		}
+		for _, id := range group.Hunks {
+			switch previous, seen := owner[id]; {
+			case id < 1 || id > len(d.Hunks):
+				problems = append(problems, fmt.Sprintf("commit %d lists hunk %d, but there are only %d hunks", i+1, id, len(d.Hunks)))
+			case seen && previous == i:
+				// Listing a hunk twice in the same commit is harmless
+			case seen:
+				problems = append(problems, fmt.Sprintf("hunk %d is in both commit %d and commit %d; every hunk belongs to exactly one commit", id, previous+1, i+1))
+			default:
+				owner[id] = i
+			}
+		}
+	}
+
+	var missing []int
+	for _, hunk := range d.Hunks {
+		if _, ok := owner[hunk.ID]; !ok {
+			missing = append(missing, hunk.ID)
+		}
+	}
+	switch {
+	case len(missing) == 1:
+		problems = append(problems, fmt.Sprintf("hunk %d is not in any commit; every hunk belongs to exactly one commit", missing[0]))
+	case len(missing) > 1:
+		problems = append(problems, fmt.Sprintf("hunks %s are not in any commit; every hunk belongs to exactly one commit", formatHunkList(missing)))
+	}
+	return problems
+}
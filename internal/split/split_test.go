@@ -0,0 +1,108 @@
+package split
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleDiff = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,4 @@
+ package main
++import "fmt"
+@@ -20,2 +21,3 @@ func main() {
++	fmt.Println("hi")
+diff --git a/new.go b/new.go
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1,2 @@
++package main
++func helper() {}
+diff --git a/logo.png b/logo.png
+new file mode 100644
+index 0000000..4444444
+Binary files /dev/null and b/logo.png differ
+`
+
+func TestNewNumbersHunks(t *testing.T) {
+	diff := New(sampleDiff)
+	expected := "1: main.go (+1 -0)\n2: main.go (+1 -0)\n3: new.go (+2 -0)\n4: logo.png (+0 -0)\n"
+	if listing := diff.Listing(); listing != expected {
+		t.Errorf("Unexpected listing:\n%s", listing)
+	}
+
+	annotated := diff.Annotated(func(path string) bool { return path != "new.go" })
+	if !strings.Contains(annotated, "@@ -20,2 +21,3 @@ func main() { [hunk 2]\n") || strings.Contains(annotated, "helper") {
+		t.Errorf("Unexpected annotated diff:\n%s", annotated)
+	}
+}
+
+func TestPatch(t *testing.T) {
+	diff := New(sampleDiff)
+
+	patch := diff.Patch([]int{2, 3})
+	if !strings.HasPrefix(patch, "diff --git a/main.go b/main.go\n") || strings.Contains(patch, `import "fmt"`) {
+		t.Errorf("Expected only the second main.go hunk with its header:\n%s", patch)
+	}
+	if !strings.Contains(patch, "+++ b/new.go\n@@ -0,0 +1,2 @@\n") {
+		t.Errorf("Expected new.go in full:\n%s", patch)
+	}
+
+	if paths := diff.Paths([]int{1, 2, 4}); strings.Join(paths, "; ") != "main.go (hunks 1, 2); logo.png (hunk 4)" {
+		t.Errorf("Unexpected paths: %q", paths)
+	}
+}
+
+func TestParsePlan(t *testing.T) {
+	reply := "Here is the plan:\n\n**COMMIT 1**\nHUNKS: 1, 3-4\nMESSAGE:\n```\nfeat: add helper\n\nAdds a helper.\n```\n\nCOMMIT 2\nHunks: [2]\nMESSAGE: fix: print greeting\n"
+
+	plan, err := ParsePlan(reply)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(plan) != 2 || plan[0].Message != "feat: add helper\n\nAdds a helper." || plan[1].Message != "fix: print greeting" {
+		t.Fatalf("Unexpected plan: %+v", plan)
+	}
+	if len(plan[0].Hunks) != 3 || plan[0].Hunks[2] != 4 || len(plan[1].Hunks) != 1 || plan[1].Hunks[0] != 2 {
+		t.Errorf("Unexpected hunks: %v, %v", plan[0].Hunks, plan[1].Hunks)
+	}
+
+	// The plan round-trips through its text format
+	again, err := ParsePlan(plan.String())
+	if err != nil || again.String() != plan.String() {
+		t.Errorf("Expected the plan to round-trip, got %q: %v", again.String(), err)
+	}
+	if !strings.Contains(plan.String(), "HUNKS: 1, 3-4\n") {
+		t.Errorf("Expected ranges in the formatted plan:\n%s", plan.String())
+	}
+
+	if _, err := ParsePlan("feat: no plan here"); err == nil {
+		t.Error("Expected an error without commits")
+	}
+	if _, err := ParsePlan("COMMIT 1\nHUNKS: one\n"); err == nil {
+		t.Error("Expected an error for an invalid hunk number")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	diff := New(sampleDiff)
+
+	if problems := diff.Check(Plan{{Hunks: []int{1, 2, 3}, Message: "feat: a"}, {Hunks: []int{4}, Message: "chore: b"}}); len(problems) != 0 {
+		t.Errorf("Expected a complete plan, got %q", problems)
+	}
+
+	problems := diff.Check(Plan{{Hunks: []int{1, 5}, Message: "feat: a"}, {Hunks: []int{1}}})
+	expected := []string{
+		"commit 1 lists hunk 5, but there are only 4 hunks",
+		"commit 2 has no message",
+		"hunk 1 is in both commit 1 and commit 2; every hunk belongs to exactly one commit",
+		"hunks 2-4 are not in any commit; every hunk belongs to exactly one commit",
+	}
+	if strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected problems:\n%s", strings.Join(problems, "\n"))
+	}
+}
@@ -0,0 +1,137 @@
+// Package trailers builds the git trailers added to commit messages, such as
+// "Signed-off-by" and "Co-authored-by", and looks up co-authors in a team
+// roster or the repository's history.
+package trailers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/IanKnighton/institutionalized/internal/conventional"
+)
+
+// Trailer tokens added by the commit command
+const (
+	SignedOffBy  = "Signed-off-by"
+	CoAuthoredBy = "Co-authored-by"
+)
+
+// ProviderPlaceholder in a configured trailer is replaced by the name of the
+// provider that wrote the message
+const ProviderPlaceholder = "{provider}"
+
+// tokenPattern matches valid trailer names
+var tokenPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`)
+
+// ValidToken reports whether token can name a trailer, e.g. "Refs"
+func ValidToken(token string) bool {
+	return tokenPattern.MatchString(token)
+}
+
+// Parse parses a trailer written as "Token: value"
+func Parse(text string) (conventional.Footer, error) {
+	token, value, ok := strings.Cut(text, ":")
+	token, value = strings.TrimSpace(token), strings.TrimSpace(value)
+	if !ok || !ValidToken(token) || value == "" {
+		return conventional.Footer{}, fmt.Errorf("invalid trailer %q (expected \"Token: value\")", text)
+	}
+	return conventional.Footer{Token: token, Separator: ": ", Value: value}, nil
+}
+
+// Expand replaces the {provider} placeholder in a configured trailer
+func Expand(trailer conventional.Footer, provider string) conventional.Footer {
+	trailer.Value = strings.ReplaceAll(trailer.Value, ProviderPlaceholder, provider)
+	return trailer
+}
+
+// Person is a commit author or co-author
+type Person struct {
+	Name  string
+	Email string
+	// Aliases are short names for the person in a roster, e.g. initials
+	Aliases []string
+}
+
+// String formats the person as git identities are written, "Name <email>"
+func (p Person) String() string {
+	return p.Name + " <" + p.Email + ">"
+}
+
+// identityPattern matches "Name <email>"
+var identityPattern = regexp.MustCompile(`^([^<>]*?)\s*<([^<>\s]+@[^<>\s]+)>$`)
+
+// ParsePerson parses an identity written as "Name <email>"
+func ParsePerson(text string) (Person, bool) {
+	match := identityPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil || match[1] == "" {
+		return Person{}, false
+	}
+	return Person{Name: match[1], Email: match[2]}, true
+}
+
+// ParseRoster parses a team roster with one person per line, written as
+// "Name <email>". Aliases go before an "=", as in "jd, jane = Jane Doe
+// <jane@example.com>". Blank lines and lines starting with '#' are skipped.
+func ParseRoster(text string) ([]Person, error) {
+	var roster []Person
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		aliases, identity, hasAliases := strings.Cut(line, "=")
+		if !hasAliases {
+			identity = line
+		}
+		person, ok := ParsePerson(identity)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"Name <email>\", got %q", i+1, line)
+		}
+		if hasAliases {
+			for _, alias := range strings.Split(aliases, ",") {
+				if alias = strings.TrimSpace(alias); alias != "" {
+					person.Aliases = append(person.Aliases, alias)
+				}
+			}
+		}
+		roster = append(roster, person)
+	}
+	return roster, nil
+}
+
+// Find returns the people a query refers to. An alias or email matching the
+// query exactly wins; otherwise everyone whose name or email contains the
+// query matches. Case is ignored.
+func Find(people []Person, query string) []Person {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil
+	}
+
+	var exact, partial []Person
+	for _, person := range people {
+		email := strings.ToLower(person.Email)
+		switch {
+		case email == query || containsFold(person.Aliases, query):
+			exact = append(exact, person)
+		case strings.Contains(strings.ToLower(person.Name), query) || strings.Contains(email, query):
+			partial = append(partial, person)
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	return partial
+}
+
+// containsFold reports whether list contains value, ignoring case
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
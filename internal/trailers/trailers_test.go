@@ -0,0 +1,60 @@
+package trailers
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	trailer, err := Parse("Generated-by:  institutionalized/{provider} ")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := Expand(trailer, "claude").String(); got != "Generated-by: institutionalized/claude" {
+		t.Errorf("Unexpected trailer: %q", got)
+	}
+
+	for _, invalid := range []string{"Generated-by", "Generated by: x", "Reviewed-by:", ": x"} {
+		if _, err := Parse(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestRoster(t *testing.T) {
+	roster, err := ParseRoster(`# Team
+jd, jane = Jane Doe <jane@example.com>
+John Smith <john@example.com>
+
+Janet Roe <janet@example.org>
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(roster) != 3 || roster[0].String() != "Jane Doe <jane@example.com>" || len(roster[0].Aliases) != 2 {
+		t.Fatalf("Unexpected roster: %+v", roster)
+	}
+
+	tests := map[string][]string{
+		"JD":               {"Jane Doe <jane@example.com>"},
+		"john@example.com": {"John Smith <john@example.com>"},
+		"smith":            {"John Smith <john@example.com>"},
+		"jan":              {"Jane Doe <jane@example.com>", "Janet Roe <janet@example.org>"},
+		"nobody":           nil,
+	}
+	for query, expected := range tests {
+		found := Find(roster, query)
+		if len(found) != len(expected) {
+			t.Errorf("Find(%q) = %v, expected %v", query, found, expected)
+			continue
+		}
+		for i, person := range found {
+			if person.String() != expected[i] {
+				t.Errorf("Find(%q) = %v, expected %v", query, found, expected)
+			}
+		}
+	}
+
+	if _, err := ParseRoster("Jane Doe jane@example.com"); err == nil {
+		t.Error("Expected a line without an email in brackets to be rejected")
+	}
+}